@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -117,14 +119,23 @@ func loadConfig() Config {
 		TelegramToken: getEnv("TELEGRAM_BOT_TOKEN", ""),
 		OllamaURL:     getEnv("OLLAMA_URL", "http://ollama:11434"),
 		OllamaModel:   getEnv("OLLAMA_MODEL", "qwen2.5:0.5b"),
-		ChatIDs:       []int64{}, // Should be loaded from database or config
+		ChatIDs:       []int64{},
 	}
 
-	// Parse chat IDs from environment (comma-separated)
-	if chatIDsStr := getEnv("TELEGRAM_CHAT_IDS", ""); chatIDsStr != "" {
-		// This is a simplified version - in production, you'd parse the string properly
-		zerologlog.Info().Str("chat_ids", chatIDsStr).Msg("Chat IDs configured")
+	// Report recipients (comma-separated): telegram ids of users get their own reports,
+	// negative ids of group chats the group's
+	for _, field := range strings.Split(getEnv("TELEGRAM_CHAT_IDS", ""), ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		chatID, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			zerologlog.Warn().Str("chat_id", field).Msg("Ignoring invalid chat id")
+			continue
+		}
+		config.ChatIDs = append(config.ChatIDs, chatID)
 	}
+	zerologlog.Info().Int("chat_ids", len(config.ChatIDs)).Msg("Chat IDs configured")
 
 	return config
 }
@@ -177,10 +188,17 @@ func setupRouter(handlers *handlers.Handlers) *chi.Mux {
 
 	// API routes
 	r.Route("/api/v1", func(r chi.Router) {
+		// The whole API under one prefix, for the api-service proxy
+		r.Get("/health", handlers.HealthCheck)
+		r.Post("/summary", handlers.GetSummary)
+
 		// Analysis endpoints
 		r.Get("/analyze", handlers.AnalyzePeriod)
 		r.Post("/analyze/trigger", handlers.TriggerAnalysis)
 
+		// Forecast of the current period
+		r.Get("/forecast", handlers.GetForecast)
+
 		// Messaging endpoints
 		r.Post("/messages/send", handlers.SendMessage)
 
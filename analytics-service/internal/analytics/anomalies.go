@@ -0,0 +1,494 @@
+package analytics
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"analytics-service/internal/types"
+)
+
+// Anomaly detection compares the analyzed period with a rolling baseline of the previous periods of
+// the same length. Totals per category and merchant are scored with the modified z-score
+// (distance from the baseline median in units of the median absolute deviation), which one or two
+// extreme periods do not distort the way they distort a mean and standard deviation.
+const (
+	// baselinePeriods is how many previous periods the baseline looks back
+	baselinePeriods = 8
+	// minBaselinePeriods is how many periods of history a score needs
+	minBaselinePeriods = 3
+	// minTransactions is how many earlier transactions a single transaction is compared with
+	minTransactions = 5
+
+	// Modified z-scores from which a value is an anomaly and its severity rises
+	zThreshold = 3.5
+	zMedium    = 5
+	zHigh      = 8
+
+	// minRelativeScale keeps stable series from flagging small changes: the deviation unit is
+	// at least this share of the median
+	minRelativeScale = 0.1
+	// minLogScale is the smallest deviation unit of log amounts, about 20% of the amount
+	minLogScale = 0.2
+	// minLargeMultiplier is how many times the usual amount a large transaction at least is
+	minLargeMultiplier = 2
+
+	// Creep: the later half of the baseline is at least creepGrowth above the earlier half
+	// and at least creepConsistency of the period pairs grow
+	creepGrowth      = 0.3
+	creepConsistency = 0.75
+
+	// Two charges of the same amount at the same merchant within duplicateWindow are a duplicate;
+	// without a merchant they must share the category and come within duplicateWindowNoMerchant
+	duplicateWindow           = 30 * time.Minute
+	duplicateWindowNoMerchant = 5 * time.Minute
+)
+
+// transaction is a transaction the detector looks at, its amount in the scope currency
+type transaction struct {
+	ID            int
+	Timestamp     time.Time
+	OperationType string
+	Amount        float64
+	Category      string
+	Merchant      string
+}
+
+// median returns the median of values, 0 for none
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// robustScale returns the median and the deviation unit of values: the median absolute deviation
+// scaled to a standard deviation of normal data
+func robustScale(values []float64) (med, scale float64) {
+	med = median(values)
+	deviations := make([]float64, len(values))
+	for i, v := range values {
+		deviations[i] = math.Abs(v - med)
+	}
+	return med, 1.4826 * median(deviations)
+}
+
+// modifiedZ scores value against the baseline values with a deviation unit of at least
+// minRelativeScale of the median, 0 when the baseline is all zeros
+func modifiedZ(value float64, baseline []float64) (z, med float64) {
+	med, scale := robustScale(baseline)
+	scale = math.Max(scale, minRelativeScale*math.Abs(med))
+	if scale == 0 {
+		return 0, med
+	}
+	return (value - med) / scale, med
+}
+
+// severity maps a score to low, medium or high
+func severity(z float64) string {
+	switch {
+	case z >= zHigh:
+		return "high"
+	case z >= zMedium:
+		return "medium"
+	default:
+		return "low"
+	}
+}
+
+// confidence is the probability that a normal value stays within z deviations, discounted
+// for a short baseline of n points
+func confidence(z float64, n int) float64 {
+	c := math.Erf(math.Abs(z)/math.Sqrt2) * float64(n) / float64(n+2)
+	return math.Round(c*100) / 100
+}
+
+// detector holds the transactions split into periods: index 0 is the analyzed period,
+// 1..baselinePeriods the previous ones, newest first
+type detector struct {
+	periods [][]transaction
+	// history is the number of baseline periods since the first transaction, so that a new user's
+	// empty past does not count as periods without spending
+	history int
+}
+
+func newDetector(txs []transaction, start, end time.Time) *detector {
+	d := &detector{periods: make([][]transaction, baselinePeriods+1)}
+	length := end.Sub(start)
+	if length <= 0 {
+		return d
+	}
+	for _, tx := range txs {
+		index := 0
+		if tx.Timestamp.Before(start) {
+			index = int(math.Ceil(float64(start.Sub(tx.Timestamp)) / float64(length)))
+		}
+		if index < 0 || index > baselinePeriods || tx.Timestamp.After(end) {
+			continue
+		}
+		d.periods[index] = append(d.periods[index], tx)
+		d.history = max(d.history, index)
+	}
+	return d
+}
+
+// series returns the total per period of the transactions key maps to name (ok false skips a transaction),
+// oldest baseline period first; the analyzed period is returned separately
+func (d *detector) series(key func(transaction) (string, bool)) (current map[string]float64, baseline map[string][]float64) {
+	baseline = make(map[string][]float64)
+	totals := make([]map[string]float64, d.history+1)
+	for index := 0; index <= d.history; index++ {
+		totals[index] = make(map[string]float64)
+		for _, tx := range d.periods[index] {
+			if name, ok := key(tx); ok {
+				totals[index][name] += tx.Amount
+			}
+		}
+	}
+	current = totals[0]
+	names := make(map[string]bool)
+	for index := 1; index <= d.history; index++ {
+		for name := range totals[index] {
+			names[name] = true
+		}
+	}
+	for name := range names {
+		values := make([]float64, 0, d.history)
+		for index := d.history; index >= 1; index-- {
+			values = append(values, totals[index][name])
+		}
+		baseline[name] = values
+	}
+	return current, baseline
+}
+
+// regular tells whether a series has spending in at least half of its periods; sporadic series
+// have a median of zero and every period with spending would look anomalous
+func regular(values []float64) bool {
+	nonZero := 0
+	for _, v := range values {
+		if v > 0 {
+			nonZero++
+		}
+	}
+	return nonZero*2 >= len(values)
+}
+
+func expenses(tx transaction) bool { return tx.OperationType != "income" }
+
+// findAnomalies detects the anomalies of the period [start, end] in txs, which cover that period
+// and up to baselinePeriods periods of the same length before it
+func findAnomalies(txs []transaction, start, end time.Time) []types.AnomalyData {
+	d := newDetector(txs, start, end)
+	var anomalies []types.AnomalyData
+	if d.history >= minBaselinePeriods {
+		anomalies = append(anomalies, d.totals()...)
+		anomalies = append(anomalies, d.categories()...)
+		anomalies = append(anomalies, d.merchants()...)
+		anomalies = append(anomalies, d.newCategories()...)
+	}
+	anomalies = append(anomalies, d.largeTransactions()...)
+	anomalies = append(anomalies, d.duplicates()...)
+
+	rank := map[string]int{"high": 0, "medium": 1, "low": 2}
+	slices.SortStableFunc(anomalies, func(a, b types.AnomalyData) int {
+		return cmp.Or(cmp.Compare(rank[a.Severity], rank[b.Severity]), cmp.Compare(b.Confidence, a.Confidence))
+	})
+	return anomalies
+}
+
+// totals flags total spending far above and incomes far below the baseline
+func (d *detector) totals() []types.AnomalyData {
+	var anomalies []types.AnomalyData
+	current, baseline := d.series(func(tx transaction) (string, bool) { return tx.OperationType, true })
+
+	if values := baseline["expense"]; values != nil {
+		amount := current["expense"]
+		if z, med := modifiedZ(amount, values); z >= zThreshold {
+			anomalies = append(anomalies, types.AnomalyData{
+				Type: "high_spending", Amount: amount, Average: med, Multiplier: ratio(amount, med),
+				Description: fmt.Sprintf("Расходы в %.1f раза выше обычного", ratio(amount, med)),
+				Severity:    severity(z), Confidence: confidence(z, len(values)),
+			})
+		}
+		if creep, ok := creepOf(values); ok {
+			creep.Description = fmt.Sprintf("Расходы постепенно растут: +%.0f%% за %d периодов", (creep.Multiplier-1)*100, len(values))
+			anomalies = append(anomalies, creep)
+		}
+	}
+	if values := baseline["income"]; values != nil && regular(values) {
+		amount := current["income"]
+		if z, med := modifiedZ(amount, values); -z >= zThreshold {
+			anomalies = append(anomalies, types.AnomalyData{
+				Type: "low_income", Amount: amount, Average: med, Multiplier: ratio(amount, med),
+				Description: fmt.Sprintf("Доходы на %.0f%% ниже обычного", (1-ratio(amount, med))*100),
+				Severity:    severity(-z), Confidence: confidence(z, len(values)),
+			})
+		}
+	}
+	return anomalies
+}
+
+// categories flags categories with spending far above their baseline or creeping up
+func (d *detector) categories() []types.AnomalyData {
+	var anomalies []types.AnomalyData
+	current, baseline := d.series(func(tx transaction) (string, bool) { return tx.Category, expenses(tx) && tx.Category != "" })
+	for _, category := range sortedKeys(baseline) {
+		values := baseline[category]
+		if !regular(values) {
+			continue
+		}
+		amount := current[category]
+		if z, med := modifiedZ(amount, values); z >= zThreshold {
+			anomalies = append(anomalies, types.AnomalyData{
+				Type: "unusual_category", Category: category, Amount: amount, Average: med, Multiplier: ratio(amount, med),
+				Description: fmt.Sprintf("Траты на %s в %.1f раза выше обычного", category, ratio(amount, med)),
+				Severity:    severity(z), Confidence: confidence(z, len(values)),
+			})
+		}
+		if creep, ok := creepOf(values); ok {
+			creep.Category = category
+			creep.Description = fmt.Sprintf("Траты на %s постепенно растут: +%.0f%% за %d периодов", category, (creep.Multiplier-1)*100, len(values))
+			anomalies = append(anomalies, creep)
+		}
+	}
+	return anomalies
+}
+
+// merchants flags merchants where the spending is far above its baseline
+func (d *detector) merchants() []types.AnomalyData {
+	var anomalies []types.AnomalyData
+	current, baseline := d.series(func(tx transaction) (string, bool) { return tx.Merchant, expenses(tx) && tx.Merchant != "" })
+	for _, merchant := range sortedKeys(baseline) {
+		values := baseline[merchant]
+		if !regular(values) {
+			continue
+		}
+		amount := current[merchant]
+		if z, med := modifiedZ(amount, values); z >= zThreshold {
+			anomalies = append(anomalies, types.AnomalyData{
+				Type: "unusual_merchant", Merchant: merchant, Amount: amount, Average: med, Multiplier: ratio(amount, med),
+				Description: fmt.Sprintf("Траты в %s в %.1f раза выше обычного", merchant, ratio(amount, med)),
+				Severity:    severity(z), Confidence: confidence(z, len(values)),
+			})
+		}
+	}
+	return anomalies
+}
+
+// newCategories flags categories never seen in the baseline
+func (d *detector) newCategories() []types.AnomalyData {
+	var anomalies []types.AnomalyData
+	current, baseline := d.series(func(tx transaction) (string, bool) { return tx.Category, expenses(tx) && tx.Category != "" })
+	totals, _ := d.series(func(tx transaction) (string, bool) { return "", expenses(tx) })
+	for _, category := range sortedKeys(current) {
+		if _, seen := baseline[category]; seen {
+			continue
+		}
+		amount := current[category]
+		share := ratio(amount, totals[""])
+		severity := "low"
+		if share >= 0.3 {
+			severity = "medium"
+		}
+		anomalies = append(anomalies, types.AnomalyData{
+			Type: "new_category", Category: category, Amount: amount, Multiplier: share,
+			Description: fmt.Sprintf("Новая категория трат: %s", category),
+			Severity:    severity, Confidence: confidence(zThreshold, d.history),
+		})
+	}
+	return anomalies
+}
+
+// largeTransactions flags single transactions far larger than the earlier ones of their category,
+// or than all earlier ones when the category has too few. Amounts are compared on a log scale,
+// as transaction amounts spread multiplicatively.
+func (d *detector) largeTransactions() []types.AnomalyData {
+	var all []float64
+	byCategory := make(map[string][]float64)
+	for index := 1; index <= d.history; index++ {
+		for _, tx := range d.periods[index] {
+			if !expenses(tx) || tx.Amount <= 0 {
+				continue
+			}
+			all = append(all, math.Log(tx.Amount))
+			byCategory[tx.Category] = append(byCategory[tx.Category], math.Log(tx.Amount))
+		}
+	}
+
+	var anomalies []types.AnomalyData
+	for _, tx := range d.periods[0] {
+		if !expenses(tx) || tx.Amount <= 0 {
+			continue
+		}
+		baseline := byCategory[tx.Category]
+		if len(baseline) < minTransactions || tx.Category == "" {
+			baseline = all
+		}
+		if len(baseline) < minTransactions {
+			continue
+		}
+		med, scale := robustScale(baseline)
+		z := (math.Log(tx.Amount) - med) / math.Max(scale, minLogScale)
+		usual := math.Exp(med)
+		if z < zThreshold || tx.Amount < minLargeMultiplier*usual {
+			continue
+		}
+		anomalies = append(anomalies, types.AnomalyData{
+			Type: "large_transaction", Category: tx.Category, Merchant: tx.Merchant, Amount: tx.Amount, Average: usual,
+			Multiplier:     ratio(tx.Amount, usual),
+			Description:    fmt.Sprintf("Крупная трата%s: в %.1f раза больше обычной", where(tx), ratio(tx.Amount, usual)),
+			Severity:       severity(z),
+			Confidence:     confidence(z, len(baseline)),
+			TransactionIDs: []int{tx.ID},
+		})
+	}
+	return anomalies
+}
+
+// duplicates flags charges repeated with the same amount at the same merchant within a short time
+func (d *detector) duplicates() []types.AnomalyData {
+	txs := slices.Clone(d.periods[0])
+	slices.SortFunc(txs, func(a, b transaction) int { return cmp.Or(a.Timestamp.Compare(b.Timestamp), cmp.Compare(a.ID, b.ID)) })
+
+	var anomalies []types.AnomalyData
+	reported := make(map[int]bool)
+	for i, first := range txs {
+		if !expenses(first) || reported[first.ID] {
+			continue
+		}
+		window := duplicateWindowNoMerchant
+		if first.Merchant != "" {
+			window = duplicateWindow
+		}
+		for _, second := range txs[i+1:] {
+			gap := second.Timestamp.Sub(first.Timestamp)
+			if gap > window {
+				break
+			}
+			if !expenses(second) || reported[second.ID] || math.Abs(second.Amount-first.Amount) >= 0.005 ||
+				second.Merchant != first.Merchant || first.Merchant == "" && second.Category != first.Category {
+				continue
+			}
+			reported[second.ID] = true
+			// The closer in time, the likelier a double charge rather than two purchases
+			c := math.Round((0.95-0.45*float64(gap)/float64(window))*100) / 100
+			anomalies = append(anomalies, types.AnomalyData{
+				Type: "duplicate_charge", Category: first.Category, Merchant: first.Merchant, Amount: second.Amount, Average: first.Amount,
+				Multiplier:     1,
+				Description:    fmt.Sprintf("Возможно двойное списание%s: %.2f дважды за %s", where(first), first.Amount, gap.Round(time.Second)),
+				Severity:       "medium",
+				Confidence:     c,
+				TransactionIDs: []int{first.ID, second.ID},
+			})
+		}
+	}
+	return anomalies
+}
+
+// creepOf detects a slow steady rise of a baseline series (oldest first): the median of its later half
+// is well above that of its earlier half, and most pairs of periods grow
+func creepOf(values []float64) (types.AnomalyData, bool) {
+	n := len(values)
+	if n < 4 || !regular(values) {
+		return types.AnomalyData{}, false
+	}
+	earlier, later := median(values[:n/2]), median(values[(n+1)/2:])
+	if earlier <= 0 || later < earlier*(1+creepGrowth) {
+		return types.AnomalyData{}, false
+	}
+	growing, pairs := 0, 0
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			pairs++
+			if values[j] > values[i] {
+				growing++
+			}
+		}
+	}
+	consistency := float64(growing) / float64(pairs)
+	if consistency < creepConsistency {
+		return types.AnomalyData{}, false
+	}
+	severity := "low"
+	if later >= earlier*(1+2*creepGrowth) {
+		severity = "medium"
+	}
+	return types.AnomalyData{
+		Type: "spending_creep", Amount: later, Average: earlier, Multiplier: later / earlier,
+		Severity: severity, Confidence: math.Round(consistency*float64(n)/float64(n+2)*100) / 100,
+	}, true
+}
+
+// ratio is a / b, 0 when b is 0
+func ratio(a, b float64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return a / b
+}
+
+// where names the merchant or the category of a transaction for a description
+func where(tx transaction) string {
+	switch {
+	case tx.Merchant != "":
+		return " в " + tx.Merchant
+	case tx.Category != "":
+		return " на " + strings.ToLower(tx.Category)
+	}
+	return ""
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// detectAnomalies loads the scope's transactions of the period and its baseline and detects anomalies
+func (e *Engine) detectAnomalies(ctx context.Context, scope Scope, startDate, endDate time.Time) ([]types.AnomalyData, error) {
+	where, args := scope.condition(4)
+	from := startDate.Add(-baselinePeriods * endDate.Sub(startDate))
+	rows, err := e.db.Query(ctx, fmt.Sprintf(`
+		SELECT e.id, e.timestamp, e.operation_type, %s, COALESCE(c.name, ''), COALESCE(m.name, '')
+		FROM expenses e
+		LEFT JOIN categories c ON c.id = e.category_id
+		LEFT JOIN merchants m ON m.id = e.merchant_id
+		WHERE e.timestamp >= $1 AND e.timestamp <= $2 AND %s
+	`, amountSQL("e"), where), append([]any{from, endDate, scope.Currency}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query transactions for anomalies: %w", err)
+	}
+	defer rows.Close()
+
+	var txs []transaction
+	for rows.Next() {
+		var tx transaction
+		var cents *int64
+		if err := rows.Scan(&tx.ID, &tx.Timestamp, &tx.OperationType, &cents, &tx.Category, &tx.Merchant); err != nil {
+			return nil, fmt.Errorf("failed to scan transaction for anomalies: %w", err)
+		}
+		if cents == nil {
+			continue // no exchange rate for its date
+		}
+		tx.Amount = float64(*cents) / 100
+		txs = append(txs, tx)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return findAnomalies(txs, startDate, endDate), nil
+}
@@ -0,0 +1,225 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"analytics-service/internal/types"
+)
+
+// The analyzed period is the week from start; the baseline weeks precede it
+var (
+	start = time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	end   = start.Add(7 * 24 * time.Hour)
+	week  = end.Sub(start)
+)
+
+// builder generates synthetic transactions, one set per week
+type builder struct {
+	txs []transaction
+}
+
+// add adds an expense in the week weeksAgo (0 is the analyzed one), hours after the week starts
+func (b *builder) add(weeksAgo int, hours float64, amount float64, category, merchant string) {
+	b.txs = append(b.txs, transaction{
+		ID:            len(b.txs) + 1,
+		Timestamp:     start.Add(-time.Duration(weeksAgo)*week + time.Duration(hours*float64(time.Hour))),
+		OperationType: "expense",
+		Amount:        amount,
+		Category:      category,
+		Merchant:      merchant,
+	})
+}
+
+// stable adds weekly groceries and cafe visits with a little noise for weeks down to 0
+func (b *builder) stable(weeks int) {
+	noise := []float64{0, 120, -80, 60, -150, 40, 90, -30, 10}
+	for w := weeks; w >= 0; w-- {
+		b.add(w, 10, 3000+noise[w%len(noise)], "Продукты", "Пятёрочка")
+		b.add(w, 34, 1500-noise[(w+3)%len(noise)], "Продукты", "Перекрёсток")
+		b.add(w, 50, 400+noise[(w+5)%len(noise)]/10, "Кафе", "Кофемания")
+		b.add(w, 80, 450-noise[(w+1)%len(noise)]/10, "Кафе", "Кофемания")
+		b.add(w, 120, 900+noise[(w+2)%len(noise)], "Транспорт", "")
+	}
+}
+
+func find(anomalies []types.AnomalyData, typ, name string) *types.AnomalyData {
+	for i, a := range anomalies {
+		if a.Type == typ && (name == "" || a.Category == name || a.Merchant == name) {
+			return &anomalies[i]
+		}
+	}
+	return nil
+}
+
+func TestRobustScale(t *testing.T) {
+	med, scale := robustScale([]float64{10, 11, 9, 10, 100})
+	if med != 10 || math.Abs(scale-1.4826) > 1e-9 {
+		t.Errorf("robustScale() = %v, %v, want 10, 1.4826", med, scale)
+	}
+	// No spread: the deviation unit falls back to a share of the median
+	if z, _ := modifiedZ(600, []float64{500, 500, 500}); z != 2 {
+		t.Errorf("modifiedZ(600, constant 500) = %v, want 2", z)
+	}
+	if median([]float64{4, 1, 3, 2}) != 2.5 {
+		t.Errorf("median of even count")
+	}
+}
+
+func TestFindAnomaliesStable(t *testing.T) {
+	var b builder
+	b.stable(baselinePeriods)
+	if anomalies := findAnomalies(b.txs, start, end); len(anomalies) != 0 {
+		t.Errorf("stable series: got anomalies %+v", anomalies)
+	}
+}
+
+func TestFindAnomaliesCategorySpike(t *testing.T) {
+	var b builder
+	b.stable(baselinePeriods)
+	b.add(0, 60, 2500, "Кафе", "Кофемания")
+	b.add(0, 70, 2500, "Кафе", "Кофемания")
+
+	anomalies := findAnomalies(b.txs, start, end)
+	category := find(anomalies, "unusual_category", "Кафе")
+	if category == nil {
+		t.Fatalf("no unusual_category for Кафе in %+v", anomalies)
+	}
+	if category.Severity != "high" || category.Confidence < 0.75 || category.Confidence > 1 {
+		t.Errorf("unusual_category = %+v, want high severity and confidence in [0.75, 1]", category)
+	}
+	if math.Abs(category.Average-850) > 10 {
+		t.Errorf("baseline median = %v, want about 850", category.Average)
+	}
+	if find(anomalies, "unusual_merchant", "Кофемания") == nil {
+		t.Errorf("no unusual_merchant for Кофемания in %+v", anomalies)
+	}
+	if find(anomalies, "unusual_category", "Продукты") != nil {
+		t.Errorf("unchanged category flagged in %+v", anomalies)
+	}
+	if anomalies[0].Severity != "high" {
+		t.Errorf("anomalies not sorted by severity: %+v", anomalies)
+	}
+}
+
+func TestFindAnomaliesNeedsHistory(t *testing.T) {
+	var b builder
+	b.stable(2)
+	b.add(0, 60, 5000, "Кафе", "Кофемания")
+	if a := find(findAnomalies(b.txs, start, end), "unusual_category", ""); a != nil {
+		t.Errorf("scored against %d periods of history: %+v", 2, a)
+	}
+}
+
+func TestFindAnomaliesCreep(t *testing.T) {
+	var b builder
+	b.stable(baselinePeriods)
+	// Taxi grows about 15% a week, never enough for a single week to stand out
+	amount := 1000.0
+	for w := baselinePeriods; w >= 0; w-- {
+		b.add(w, 140, amount, "Такси", "")
+		amount *= 1.15
+	}
+
+	anomalies := findAnomalies(b.txs, start, end)
+	creep := find(anomalies, "spending_creep", "Такси")
+	if creep == nil {
+		t.Fatalf("no spending_creep for Такси in %+v", anomalies)
+	}
+	if creep.Multiplier < 1+creepGrowth || creep.Confidence < 0.75 {
+		t.Errorf("spending_creep = %+v", creep)
+	}
+	if find(anomalies, "unusual_category", "Такси") != nil {
+		t.Errorf("gradual growth flagged as a spike: %+v", anomalies)
+	}
+	if find(anomalies, "spending_creep", "Продукты") != nil {
+		t.Errorf("stable category flagged as creeping: %+v", anomalies)
+	}
+}
+
+func TestFindAnomaliesLargeTransaction(t *testing.T) {
+	var b builder
+	b.stable(baselinePeriods)
+	b.add(0, 100, 20000, "Продукты", "Азбука вкуса")
+
+	anomalies := findAnomalies(b.txs, start, end)
+	large := find(anomalies, "large_transaction", "")
+	if large == nil {
+		t.Fatalf("no large_transaction in %+v", anomalies)
+	}
+	if large.Merchant != "Азбука вкуса" || len(large.TransactionIDs) != 1 || large.TransactionIDs[0] != len(b.txs) {
+		t.Errorf("large_transaction = %+v", large)
+	}
+	if large.Multiplier < 5 {
+		t.Errorf("multiplier = %v, want the amount against the usual grocery purchase", large.Multiplier)
+	}
+}
+
+func TestFindAnomaliesNewCategory(t *testing.T) {
+	var b builder
+	b.stable(baselinePeriods)
+	b.add(0, 90, 700, "Хобби", "")
+
+	anomalies := findAnomalies(b.txs, start, end)
+	category := find(anomalies, "new_category", "Хобби")
+	if category == nil {
+		t.Fatalf("no new_category in %+v", anomalies)
+	}
+	if category.Severity != "low" {
+		t.Errorf("severity of a small new category = %q, want low", category.Severity)
+	}
+	if find(anomalies, "new_category", "Кафе") != nil {
+		t.Errorf("known category reported as new: %+v", anomalies)
+	}
+}
+
+func TestFindAnomaliesDuplicates(t *testing.T) {
+	var b builder
+	b.stable(baselinePeriods)
+	b.add(0, 130, 1299, "Подписки", "Кинопоиск")
+	b.add(0, 130.01, 1299, "Подписки", "Кинопоиск")
+	// Same amount at another merchant or an hour later is not a duplicate
+	b.add(0, 131, 1299, "Подписки", "Кинопоиск")
+	b.add(0, 130.02, 1299, "Подписки", "Okko")
+
+	anomalies := findAnomalies(b.txs, start, end)
+	var duplicates []types.AnomalyData
+	for _, a := range anomalies {
+		if a.Type == "duplicate_charge" {
+			duplicates = append(duplicates, a)
+		}
+	}
+	if len(duplicates) != 1 {
+		t.Fatalf("duplicates = %+v, want one", duplicates)
+	}
+	n := len(b.txs)
+	if ids := duplicates[0].TransactionIDs; len(ids) != 2 || ids[0] != n-3 || ids[1] != n-2 {
+		t.Errorf("duplicate ids = %v, want [%d %d]", ids, n-3, n-2)
+	}
+	if c := duplicates[0].Confidence; c < 0.9 || c > 0.95 {
+		t.Errorf("confidence of a charge repeated within a minute = %v", c)
+	}
+}
+
+func TestFindAnomaliesLowIncome(t *testing.T) {
+	var b builder
+	b.stable(baselinePeriods)
+	for w := baselinePeriods; w >= 1; w-- {
+		b.txs = append(b.txs, transaction{
+			ID: len(b.txs) + 1, Timestamp: start.Add(-time.Duration(w) * week), OperationType: "income", Amount: 20000 + float64(w*100),
+		})
+	}
+
+	anomalies := findAnomalies(b.txs, start, end)
+	income := find(anomalies, "low_income", "")
+	if income == nil {
+		t.Fatalf("no low_income in %+v", anomalies)
+	}
+	if income.Amount != 0 || income.Severity != "high" {
+		t.Errorf("low_income = %+v", income)
+	}
+	if find(anomalies, "high_spending", "") != nil {
+		t.Errorf("income counted as spending: %+v", anomalies)
+	}
+}
@@ -0,0 +1,76 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+
+	"analytics-service/internal/types"
+)
+
+// Budget alert thresholds, in percent of the limit
+var budgetThresholds = []int{80, 100}
+
+// budgetThreshold returns the highest threshold the spending has reached, or 0
+func budgetThreshold(spentCents, limitCents int) int {
+	reached := 0
+	for _, threshold := range budgetThresholds {
+		if spentCents*100 >= limitCents*threshold {
+			reached = threshold
+		}
+	}
+	return reached
+}
+
+// PendingBudgetAlerts returns budgets that crossed 80% or 100% of their limit in the current period
+// and have not been alerted about that threshold yet (see the v_budget_status view)
+func (e *Engine) PendingBudgetAlerts(ctx context.Context) ([]types.BudgetAlert, error) {
+	query := `
+		SELECT s.budget_id, COALESCE(s.name, ''), COALESCE(c.name, ''), s.group_id, u.telegram_id,
+			s.period_start, s.period_end, s.limit_cents + s.rollover_cents, s.spent_cents, s.currency,
+			COALESCE((SELECT MAX(a.threshold) FROM budget_alerts a WHERE a.budget_id = s.budget_id AND a.period_start = s.period_start), 0)
+		FROM v_budget_status s
+		JOIN users u ON u.id = s.user_id
+		LEFT JOIN categories c ON c.id = s.category_id
+		WHERE s.is_current AND s.spent_cents * 100 >= (s.limit_cents + s.rollover_cents) * $1
+		ORDER BY s.budget_id
+	`
+
+	rows, err := e.db.Query(ctx, query, budgetThresholds[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to query budget status: %w", err)
+	}
+	defer rows.Close()
+
+	var alerts []types.BudgetAlert
+	for rows.Next() {
+		var alert types.BudgetAlert
+		var alerted int
+		if err := rows.Scan(&alert.BudgetID, &alert.Name, &alert.CategoryName, &alert.GroupID, &alert.TelegramID,
+			&alert.PeriodStart, &alert.PeriodEnd, &alert.LimitCents, &alert.SpentCents, &alert.Currency, &alerted); err != nil {
+			return nil, fmt.Errorf("failed to scan budget status: %w", err)
+		}
+		alert.Threshold = budgetThreshold(alert.SpentCents, alert.LimitCents)
+		if alert.Threshold > alerted {
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts, rows.Err()
+}
+
+// MarkBudgetAlertSent records the alert and every lower threshold, so each one is sent once per period
+func (e *Engine) MarkBudgetAlertSent(ctx context.Context, alert types.BudgetAlert) error {
+	for _, threshold := range budgetThresholds {
+		if threshold > alert.Threshold {
+			break
+		}
+		_, err := e.db.Exec(ctx, `
+			INSERT INTO budget_alerts (budget_id, period_start, threshold, spent_cents)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (budget_id, period_start, threshold) DO NOTHING
+		`, alert.BudgetID, alert.PeriodStart, threshold, alert.SpentCents)
+		if err != nil {
+			return fmt.Errorf("failed to record budget alert: %w", err)
+		}
+	}
+	return nil
+}
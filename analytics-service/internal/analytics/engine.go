@@ -8,33 +8,52 @@ import (
 
 	"analytics-service/internal/types"
 
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/rs/zerolog/log"
 )
 
 // Engine represents analytics engine
 type Engine struct {
-	db *pgxpool.Pool
+	db DB
+}
+
+// DB is the part of a pgx pool the engine uses
+type DB interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
 }
 
 // NewEngine creates new analytics engine
-func NewEngine(db *pgxpool.Pool) *Engine {
+func NewEngine(db DB) *Engine {
 	return &Engine{db: db}
 }
 
-// AnalyzePeriod performs comprehensive financial analysis for a period
-func (e *Engine) AnalyzePeriod(ctx context.Context, period string, startDate, endDate time.Time) (*types.AnalysisResult, error) {
-	log.Info().Str("period", period).Time("start", startDate).Time("end", endDate).Msg("Starting financial analysis")
+// counted selects the transactions (aliased e) that totals are computed from, the same rule as the
+// api-service repository: live expenses and incomes, transfers only move money between accounts
+const counted = "e.operation_type IN ('expense', 'income') AND e.deleted_at IS NULL"
+
+// amountSQL converts the amount of a transaction aliased alias into the scope currency ($3)
+// at the rate of the transaction's Moscow date, in major units
+func amountSQL(alias string) string {
+	return fmt.Sprintf("convert_cents(%[1]s.amount_cents, %[1]s.currency, $3, (%[1]s.timestamp AT TIME ZONE 'Europe/Moscow')::date)", alias)
+}
+
+// AnalyzePeriod performs comprehensive financial analysis of the scope's transactions for a period
+func (e *Engine) AnalyzePeriod(ctx context.Context, scope Scope, period string, startDate, endDate time.Time) (*types.AnalysisResult, error) {
+	log.Info().Str("scope", scope.Kind).Int64("user_id", scope.UserID).Str("period", period).Time("start", startDate).Time("end", endDate).
+		Msg("Starting financial analysis")
 
 	// Get current period data
-	currentData, err := e.getFinancialData(ctx, startDate, endDate)
+	currentData, err := e.getFinancialData(ctx, scope, startDate, endDate)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get current period data: %w", err)
 	}
 
 	// Get previous period data for comparison
 	prevStart, prevEnd := e.getPreviousPeriod(startDate, endDate, period)
-	previousData, err := e.getFinancialData(ctx, prevStart, prevEnd)
+	previousData, err := e.getFinancialData(ctx, scope, prevStart, prevEnd)
 	if err != nil {
 		log.Warn().Err(err).Msg("Failed to get previous period data, using zero values")
 		previousData = &types.FinancialData{
@@ -45,14 +64,18 @@ func (e *Engine) AnalyzePeriod(ctx context.Context, period string, startDate, en
 			Incomes:    0,
 			Balance:    0,
 			Categories: make(map[string]float64),
+			Currency:   scope.Currency,
 		}
 	}
 
 	// Calculate changes
 	changes := e.calculateChanges(*currentData, *previousData)
 
-	// Detect anomalies
-	anomalies := e.detectAnomalies(*currentData, *previousData)
+	// Detect anomalies against the rolling baseline
+	anomalies, err := e.detectAnomalies(ctx, scope, startDate, endDate)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to detect anomalies")
+	}
 
 	// Analyze trends
 	trends := e.analyzeTrends(*currentData, *previousData, changes)
@@ -62,6 +85,7 @@ func (e *Engine) AnalyzePeriod(ctx context.Context, period string, startDate, en
 
 	result := &types.AnalysisResult{
 		Period:      period,
+		Scope:       scope.Kind,
 		Data:        *currentData,
 		Comparison:  types.ComparisonData{Current: *currentData, Previous: *previousData, Change: changes},
 		Anomalies:   anomalies,
@@ -81,25 +105,26 @@ func (e *Engine) AnalyzePeriod(ctx context.Context, period string, startDate, en
 	return result, nil
 }
 
-// getFinancialData retrieves financial data for a period
-func (e *Engine) getFinancialData(ctx context.Context, startDate, endDate time.Time) (*types.FinancialData, error) {
-	query := `
+// getFinancialData retrieves financial data of the scope for a period
+func (e *Engine) getFinancialData(ctx context.Context, scope Scope, startDate, endDate time.Time) (*types.FinancialData, error) {
+	where, args := scope.condition(4)
+	query := fmt.Sprintf(`
 		SELECT 
-			COALESCE(SUM(CASE WHEN operation_type = 'expense' THEN amount_cents ELSE 0 END), 0) / 100.0 as expenses,
-			COALESCE(SUM(CASE WHEN operation_type = 'income' THEN amount_cents ELSE 0 END), 0) / 100.0 as incomes,
-			COALESCE(SUM(CASE WHEN operation_type = 'income' THEN amount_cents ELSE -amount_cents END), 0) / 100.0 as balance
-		FROM expenses 
-		WHERE timestamp >= $1 AND timestamp <= $2
-	`
+			COALESCE(SUM(CASE WHEN e.operation_type = 'expense' THEN %[1]s ELSE 0 END), 0) / 100.0 as expenses,
+			COALESCE(SUM(CASE WHEN e.operation_type = 'income' THEN %[1]s ELSE 0 END), 0) / 100.0 as incomes,
+			COALESCE(SUM(CASE WHEN e.operation_type = 'income' THEN %[1]s ELSE -%[1]s END), 0) / 100.0 as balance
+		FROM expenses e
+		WHERE e.timestamp >= $1 AND e.timestamp <= $2 AND %[2]s
+	`, amountSQL("e"), where)
 
 	var expenses, incomes, balance float64
-	err := e.db.QueryRow(ctx, query, startDate, endDate).Scan(&expenses, &incomes, &balance)
+	err := e.db.QueryRow(ctx, query, append([]any{startDate, endDate, scope.Currency}, args...)...).Scan(&expenses, &incomes, &balance)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query financial data: %w", err)
 	}
 
 	// Get category breakdown
-	categories, err := e.getCategoryBreakdown(ctx, startDate, endDate)
+	categories, err := e.getCategoryBreakdown(ctx, scope, startDate, endDate)
 	if err != nil {
 		log.Warn().Err(err).Msg("Failed to get category breakdown")
 		categories = make(map[string]float64)
@@ -113,22 +138,24 @@ func (e *Engine) getFinancialData(ctx context.Context, startDate, endDate time.T
 		Incomes:    incomes,
 		Balance:    balance,
 		Categories: categories,
+		Currency:   scope.Currency,
 	}, nil
 }
 
-// getCategoryBreakdown gets spending breakdown by categories
-func (e *Engine) getCategoryBreakdown(ctx context.Context, startDate, endDate time.Time) (map[string]float64, error) {
-	query := `
-		SELECT c.name, COALESCE(SUM(e.amount_cents), 0) / 100.0 as amount
+// getCategoryBreakdown gets the scope's spending breakdown by categories
+func (e *Engine) getCategoryBreakdown(ctx context.Context, scope Scope, startDate, endDate time.Time) (map[string]float64, error) {
+	where, args := scope.condition(4)
+	query := fmt.Sprintf(`
+		SELECT c.name, COALESCE(SUM(%s), 0) / 100.0 as amount
 		FROM expenses e
 		LEFT JOIN categories c ON e.category_id = c.id
-		WHERE e.timestamp >= $1 AND e.timestamp <= $2 
-		AND e.operation_type = 'expense'
+		WHERE e.timestamp >= $1 AND e.timestamp <= $2 AND %s
+			AND e.operation_type = 'expense'
 		GROUP BY c.name
 		ORDER BY amount DESC
-	`
+	`, amountSQL("e"), where)
 
-	rows, err := e.db.Query(ctx, query, startDate, endDate)
+	rows, err := e.db.Query(ctx, query, append([]any{startDate, endDate, scope.Currency}, args...)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query category breakdown: %w", err)
 	}
@@ -193,54 +220,6 @@ func (e *Engine) calculateChanges(current, previous types.FinancialData) types.C
 	}
 }
 
-// detectAnomalies detects spending anomalies
-func (e *Engine) detectAnomalies(current, previous types.FinancialData) []types.AnomalyData {
-	var anomalies []types.AnomalyData
-
-	// High spending anomaly
-	if previous.Expenses > 0 && current.Expenses > previous.Expenses*2 {
-		anomalies = append(anomalies, types.AnomalyData{
-			Type:        "high_spending",
-			Amount:      current.Expenses,
-			Average:     previous.Expenses,
-			Multiplier:  current.Expenses / previous.Expenses,
-			Description: fmt.Sprintf("Расходы увеличились в %.1f раз", current.Expenses/previous.Expenses),
-			Severity:    "high",
-		})
-	}
-
-	// Low income anomaly
-	if previous.Incomes > 0 && current.Incomes < previous.Incomes*0.5 {
-		anomalies = append(anomalies, types.AnomalyData{
-			Type:        "low_income",
-			Amount:      current.Incomes,
-			Average:     previous.Incomes,
-			Multiplier:  current.Incomes / previous.Incomes,
-			Description: fmt.Sprintf("Доходы снизились на %.1f%%", (1-current.Incomes/previous.Incomes)*100),
-			Severity:    "medium",
-		})
-	}
-
-	// Category anomalies
-	for category, amount := range current.Categories {
-		if prevAmount, exists := previous.Categories[category]; exists && prevAmount > 0 {
-			if amount > prevAmount*2 {
-				anomalies = append(anomalies, types.AnomalyData{
-					Type:        "unusual_category",
-					Category:    category,
-					Amount:      amount,
-					Average:     prevAmount,
-					Multiplier:  amount / prevAmount,
-					Description: fmt.Sprintf("Увеличение трат на %s в %.1f раз", category, amount/prevAmount),
-					Severity:    "medium",
-				})
-			}
-		}
-	}
-
-	return anomalies
-}
-
 // analyzeTrends analyzes spending trends
 func (e *Engine) analyzeTrends(current, previous types.FinancialData, changes types.ChangeData) []types.TrendData {
 	var trends []types.TrendData
@@ -252,7 +231,7 @@ func (e *Engine) analyzeTrends(current, previous types.FinancialData, changes ty
 			Type:        "saving",
 			Direction:   "up",
 			Amount:      changes.BalanceChange,
-			Description: fmt.Sprintf("Экономия %.2f руб", changes.BalanceChange),
+			Description: fmt.Sprintf("Экономия %.2f %s", changes.BalanceChange, types.CurrencySymbol(current.Currency)),
 			Confidence:  confidence,
 		})
 	}
@@ -0,0 +1,463 @@
+package analytics
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"analytics-service/internal/types"
+)
+
+// The forecast projects the spending of the rest of the period from its pace so far, blended with the
+// pace of the weeks before it and spread over the remaining days by weekday, and adds the recurring
+// charges still due. Recurring transactions are left out of the pace, they are known in advance.
+const (
+	// forecastHistoryDays is the history before the period: eight of every weekday
+	forecastHistoryDays = 56
+	// forecastPrior is how many days of the period's pace the history counts as, so that the first
+	// days of a month do not decide its projection alone
+	forecastPrior = 7
+	// forecastZ is the normal quantile of the 80% confidence band
+	forecastZ          = 1.2816
+	forecastConfidence = 0.8
+	// forecastUncertain is the half-width of the band, as a share of the remaining spending,
+	// when there are too few days to estimate the spread
+	forecastUncertain = 0.5
+
+	uncategorized = "Без категории"
+)
+
+var (
+	// ErrInvalidPeriod is returned for a forecast period other than month or week
+	ErrInvalidPeriod = errors.New("period must be month or week")
+
+	// moscow is the time zone days and periods are counted in
+	moscow = time.FixedZone("MSK", 3*60*60)
+)
+
+// dailyAmount is the total of a day's expenses or incomes of a category, recurring ones apart
+type dailyAmount struct {
+	Day           time.Time // midnight UTC of the Moscow date
+	OperationType string
+	Category      string
+	Recurring     bool
+	Amount        float64
+}
+
+// forecastInput is what a forecast is computed from; dates are midnight UTC of Moscow dates
+type forecastInput struct {
+	Start, End time.Time // first and last day of the period
+	Today      time.Time
+	Days       []dailyAmount             // from forecastHistoryDays before Start through Today
+	Recurring  []types.RecurringForecast // occurrences not yet booked, through End
+	Balance    *float64                  // of the accounts, nil without accounts
+}
+
+// forecastPeriod returns the first and last day of the month or the week (from Monday) of today
+func forecastPeriod(period string, today time.Time) (time.Time, time.Time, error) {
+	switch period {
+	case "month", "":
+		start := today.AddDate(0, 0, 1-today.Day())
+		return start, start.AddDate(0, 1, -1), nil
+	case "week":
+		start := today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+		return start, start.AddDate(0, 0, 6), nil
+	}
+	return time.Time{}, time.Time{}, ErrInvalidPeriod
+}
+
+// dateOf returns the Moscow date of t as midnight UTC
+func dateOf(t time.Time) time.Time {
+	y, m, d := t.In(moscow).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// weekdayWeights returns how much is spent on each weekday relative to an average day, from the
+// daily totals starting at first. Half of each weight is the average day, so a single big Saturday
+// does not make every Saturday expensive.
+func weekdayWeights(totals []float64, first time.Time) [7]float64 {
+	var sums [7]float64
+	sum := 0.0
+	for i, v := range totals {
+		sums[first.AddDate(0, 0, i).Weekday()] += v
+		sum += v
+	}
+	var weights [7]float64
+	for wd := range weights {
+		weights[wd] = 1
+		if sum > 0 {
+			// every weekday occurs len(totals)/7 times
+			weights[wd] = (sums[wd]*7/sum + 1) / 2
+		}
+	}
+	return weights
+}
+
+// projection is the projected rest of a daily series
+type projection struct {
+	remaining float64 // expected spending in the remaining days
+	half      float64 // half-width of the confidence band of remaining
+}
+
+// project projects the remaining days of values, the daily amounts from forecastHistoryDays before the
+// period through today; history tells whether the days before the period are known at all
+func project(values []float64, first time.Time, elapsed int, remaining []time.Time, weights [7]float64, history bool) projection {
+	weight := func(i int) float64 { return weights[first.AddDate(0, 0, i).Weekday()] }
+
+	used := forecastHistoryDays // index of the first day the pace is estimated from
+	prior := 0.0
+	historyRate := 0.0
+	if history {
+		used, prior = 0, forecastPrior
+		sum, w := 0.0, 0.0
+		for i := 0; i < forecastHistoryDays; i++ {
+			sum += values[i]
+			w += weight(i)
+		}
+		historyRate = sum / w
+	}
+	sum, elapsedW := 0.0, 0.0
+	for i := forecastHistoryDays; i < forecastHistoryDays+elapsed; i++ {
+		sum += values[i]
+		elapsedW += weight(i)
+	}
+	rate := (sum + historyRate*prior) / (elapsedW + prior)
+
+	remainingW := 0.0
+	for _, day := range remaining {
+		remainingW += weights[day.Weekday()]
+	}
+	p := projection{remaining: rate * remainingW}
+
+	// The spread of the days around the weekday-weighted pace, plus the uncertainty of the pace itself
+	n := forecastHistoryDays + elapsed - used
+	if n < 2 {
+		p.half = forecastUncertain * p.remaining
+		return p
+	}
+	squares := 0.0
+	for i := used; i < forecastHistoryDays+elapsed; i++ {
+		d := values[i] - rate*weight(i)
+		squares += d * d
+	}
+	variance := squares / float64(n-1)
+	p.half = forecastZ * math.Sqrt(variance*(float64(len(remaining))+remainingW*remainingW/(elapsedW+prior)))
+	return p
+}
+
+// forecast projects the period of in
+func forecast(in forecastInput) types.ForecastResult {
+	first := in.Start.AddDate(0, 0, -forecastHistoryDays)
+	elapsed := int(in.Today.Sub(in.Start).Hours()/24) + 1
+	var remaining []time.Time
+	for day := in.Today.AddDate(0, 0, 1); !day.After(in.End); day = day.AddDate(0, 0, 1) {
+		remaining = append(remaining, day)
+	}
+
+	// Daily series of the spending paced by, per category and in total ("")
+	days := forecastHistoryDays + elapsed
+	series := map[string][]float64{"": make([]float64, days)}
+	actual := make(map[string]float64)
+	incomes := 0.0
+	history := false
+	for _, d := range in.Days {
+		i := int(d.Day.Sub(first).Hours() / 24)
+		if i < 0 || i >= days {
+			continue
+		}
+		history = history || i < forecastHistoryDays
+		if d.OperationType == "income" {
+			if i >= forecastHistoryDays {
+				incomes += d.Amount
+			}
+			continue
+		}
+		if i >= forecastHistoryDays {
+			actual[d.Category] += d.Amount
+			actual[""] += d.Amount
+		}
+		if d.Recurring {
+			continue
+		}
+		if series[d.Category] == nil {
+			series[d.Category] = make([]float64, days)
+		}
+		series[d.Category][i] += d.Amount
+		series[""][i] += d.Amount
+	}
+
+	due := make(map[string]float64)
+	dueIncomes := 0.0
+	for _, r := range in.Recurring {
+		if r.Type == "income" {
+			dueIncomes += r.Amount
+			continue
+		}
+		due[r.Category] += r.Amount
+		due[""] += r.Amount
+	}
+
+	weights := weekdayWeights(series[""][:forecastHistoryDays], first)
+	value := func(category string) types.ForecastValue {
+		v := types.ForecastValue{Actual: actual[category]}
+		if values := series[category]; values != nil {
+			p := project(values, first, elapsed, remaining, weights, history)
+			v.Projected = v.Actual + due[category] + p.remaining
+			v.Low = math.Max(v.Actual+due[category], v.Projected-p.half)
+			v.High = v.Projected + p.half
+		} else {
+			v.Projected = v.Actual + due[category]
+			v.Low, v.High = v.Projected, v.Projected
+		}
+		return v
+	}
+
+	result := types.ForecastResult{
+		StartDate:       in.Start,
+		EndDate:         in.End,
+		DaysElapsed:     elapsed,
+		DaysRemaining:   len(remaining),
+		ConfidenceLevel: forecastConfidence,
+		Expenses:        value(""),
+		Recurring:       in.Recurring,
+	}
+	projected := incomes + dueIncomes
+	result.Incomes = types.ForecastValue{Actual: incomes, Projected: projected, Low: projected, High: projected}
+	result.Net = types.ForecastValue{
+		Actual:    result.Incomes.Actual - result.Expenses.Actual,
+		Projected: result.Incomes.Projected - result.Expenses.Projected,
+		Low:       result.Incomes.Low - result.Expenses.High,
+		High:      result.Incomes.High - result.Expenses.Low,
+	}
+
+	categories := make(map[string]bool)
+	for _, m := range []map[string]float64{actual, due} {
+		for category := range m {
+			categories[category] = true
+		}
+	}
+	for category := range series {
+		categories[category] = true
+	}
+	delete(categories, "")
+	for category := range categories {
+		v := value(category)
+		if round2(v.Projected) == 0 {
+			continue
+		}
+		result.Categories = append(result.Categories, types.CategoryForecast{Category: category, ForecastValue: roundValue(v), Recurring: round2(due[category])})
+	}
+	slices.SortFunc(result.Categories, func(a, b types.CategoryForecast) int {
+		return cmp.Or(cmp.Compare(b.Projected, a.Projected), cmp.Compare(a.Category, b.Category))
+	})
+
+	if in.Balance != nil {
+		balance := *in.Balance
+		result.Balance = &types.ForecastValue{
+			Actual:    balance,
+			Projected: balance + result.Net.Projected - result.Net.Actual,
+			Low:       balance + result.Net.Low - result.Net.Actual,
+			High:      balance + result.Net.High - result.Net.Actual,
+		}
+		// The period's projected net spread over its days is the pace the balance goes at
+		burn := -result.Net.Projected / float64(elapsed+len(remaining))
+		if burn > 0 {
+			runway := int(math.Max(balance, 0) / burn)
+			result.Runway = &types.RunwayData{Days: runway, Date: in.Today.AddDate(0, 0, runway), DailyBurn: round2(burn)}
+		}
+		*result.Balance = roundValue(*result.Balance)
+	}
+
+	result.Expenses = roundValue(result.Expenses)
+	result.Incomes = roundValue(result.Incomes)
+	result.Net = roundValue(result.Net)
+	return result
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func roundValue(v types.ForecastValue) types.ForecastValue {
+	return types.ForecastValue{Actual: round2(v.Actual), Projected: round2(v.Projected), Low: round2(v.Low), High: round2(v.High)}
+}
+
+// recurringRule is the schedule of a recurring transaction, as api-service's recurring package
+// materializes it: next_run is its next occurrence not yet booked
+type recurringRule struct {
+	Kind       string // "monthly", "last_business_day", "weekly"
+	Interval   int
+	DayOfMonth int
+	End        *time.Time
+	NextRun    time.Time
+}
+
+// occurrences returns the occurrences from next_run through to
+func (r recurringRule) occurrences(to time.Time) []time.Time {
+	var dates []time.Time
+	for day := r.NextRun; !day.After(to) && (r.End == nil || !day.After(*r.End)); day = r.after(day) {
+		dates = append(dates, day)
+		if r.Interval < 1 {
+			break
+		}
+	}
+	return dates
+}
+
+// after returns the occurrence following day
+func (r recurringRule) after(day time.Time) time.Time {
+	if r.Kind == "weekly" {
+		return day.AddDate(0, 0, 7*r.Interval)
+	}
+	first := day.AddDate(0, 0, 1-day.Day()).AddDate(0, r.Interval, 0)
+	last := first.AddDate(0, 1, -1)
+	if r.Kind == "last_business_day" {
+		for last.Weekday() == time.Saturday || last.Weekday() == time.Sunday {
+			last = last.AddDate(0, 0, -1)
+		}
+		return last
+	}
+	if r.DayOfMonth > last.Day() {
+		return last
+	}
+	return first.AddDate(0, 0, r.DayOfMonth-1)
+}
+
+// Forecast projects the scope's expenses, incomes and balance to the end of the current month or week
+func (e *Engine) Forecast(ctx context.Context, scope Scope, period string, now time.Time) (*types.ForecastResult, error) {
+	today := dateOf(now)
+	start, end, err := forecastPeriod(period, today)
+	if err != nil {
+		return nil, err
+	}
+	if period == "" {
+		period = "month"
+	}
+
+	days, err := e.forecastDays(ctx, scope, start, now)
+	if err != nil {
+		return nil, err
+	}
+	recurring, err := e.recurringDue(ctx, scope, end)
+	if err != nil {
+		return nil, err
+	}
+	var balance *float64
+	if userID, ok := scope.balanceUser(); ok {
+		if balance, err = e.accountsBalance(ctx, userID, scope.Currency); err != nil {
+			return nil, err
+		}
+	}
+
+	result := forecast(forecastInput{Start: start, End: end, Today: today, Days: days, Recurring: recurring, Balance: balance})
+	result.Period = period
+	result.Scope = scope.Kind
+	result.Currency = scope.Currency
+	result.GeneratedAt = time.Now()
+	return &result, nil
+}
+
+// forecastDays returns the scope's daily expenses and incomes per category from forecastHistoryDays before start through now
+func (e *Engine) forecastDays(ctx context.Context, scope Scope, start, now time.Time) ([]dailyAmount, error) {
+	first := start.AddDate(0, 0, -forecastHistoryDays)
+	from := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, moscow)
+	where, args := scope.condition(4)
+	rows, err := e.db.Query(ctx, fmt.Sprintf(`
+		SELECT (e.timestamp AT TIME ZONE 'Europe/Moscow')::date, e.operation_type, COALESCE(c.name, '%s'),
+			e.recurring_id IS NOT NULL, COALESCE(SUM(%s), 0) / 100.0
+		FROM expenses e
+		LEFT JOIN categories c ON c.id = e.category_id
+		WHERE e.timestamp >= $1 AND e.timestamp <= $2 AND %s
+		GROUP BY 1, 2, 3, 4
+	`, uncategorized, amountSQL("e"), where), append([]any{from, now, scope.Currency}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query daily amounts: %w", err)
+	}
+	defer rows.Close()
+
+	var days []dailyAmount
+	for rows.Next() {
+		var d dailyAmount
+		if err := rows.Scan(&d.Day, &d.OperationType, &d.Category, &d.Recurring, &d.Amount); err != nil {
+			return nil, fmt.Errorf("failed to scan daily amount: %w", err)
+		}
+		days = append(days, d)
+	}
+	return days, rows.Err()
+}
+
+// recurringDue returns the occurrences of the scope's active recurring transactions not yet booked, through end
+func (e *Engine) recurringDue(ctx context.Context, scope Scope, end time.Time) ([]types.RecurringForecast, error) {
+	where, args := scope.recurringCondition(3)
+	// Recurring amounts are in their own currency, converted at today's rate
+	rows, err := e.db.Query(ctx, fmt.Sprintf(`
+		SELECT r.operation_type, COALESCE(c.name, '%s'), COALESCE(r.description, ''),
+			convert_cents(r.amount_cents, r.currency, $1, CURRENT_DATE) / 100.0,
+			r.schedule, r.interval_count, COALESCE(r.day_of_month, 0), r.end_date, r.next_run
+		FROM recurring_transactions r
+		LEFT JOIN categories c ON c.id = r.category_id
+		WHERE r.is_active AND r.next_run IS NOT NULL AND r.next_run <= $2 AND %s
+		ORDER BY r.next_run, r.id
+	`, uncategorized, where), append([]any{scope.Currency, end}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recurring transactions: %w", err)
+	}
+	defer rows.Close()
+
+	var due []types.RecurringForecast
+	for rows.Next() {
+		var item types.RecurringForecast
+		var amount *float64
+		var rule recurringRule
+		if err := rows.Scan(&item.Type, &item.Category, &item.Description, &amount,
+			&rule.Kind, &rule.Interval, &rule.DayOfMonth, &rule.End, &rule.NextRun); err != nil {
+			return nil, fmt.Errorf("failed to scan recurring transaction: %w", err)
+		}
+		if amount == nil {
+			continue // no exchange rate
+		}
+		item.Amount = *amount
+		for _, date := range rule.occurrences(end) {
+			item.Date = date
+			due = append(due, item)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(due, func(a, b types.RecurringForecast) int { return a.Date.Compare(b.Date) })
+	return due, nil
+}
+
+// balanceUser returns the user whose accounts the forecast balance is of. Only a user scope has one:
+// the projection of a family or group spends the money of other members too, and their accounts are theirs.
+func (s Scope) balanceUser() (int64, bool) {
+	return s.UserID, s.Kind == ScopeUser
+}
+
+// accountsBalance returns the balance of the user's accounts in currency, nil when they have none
+func (e *Engine) accountsBalance(ctx context.Context, userID int64, currency string) (*float64, error) {
+	// Each account's balance in its own currency, as api-service computes it, then in currency
+	var count int
+	var balance float64
+	err := e.db.QueryRow(ctx, `
+		SELECT COUNT(*), COALESCE(SUM(convert_cents((a.opening_balance_cents + COALESCE((
+			SELECT SUM(CASE WHEN e.operation_type = 'income' OR e.transfer_leg = 'credit' THEN x.cents ELSE -x.cents END)
+			FROM expenses e
+			CROSS JOIN LATERAL (SELECT convert_cents(e.amount_cents, e.currency, a.currency, (e.timestamp AT TIME ZONE 'Europe/Moscow')::date) AS cents) x
+			WHERE e.account_id = a.id AND e.deleted_at IS NULL), 0))::bigint, a.currency, $2, CURRENT_DATE)), 0) / 100.0
+		FROM accounts a
+		WHERE a.user_id = $1 AND NOT a.is_archived
+	`, userID, currency).Scan(&count, &balance)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query account balances: %w", err)
+	}
+	if count == 0 {
+		return nil, nil
+	}
+	return &balance, nil
+}
@@ -0,0 +1,212 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"analytics-service/internal/types"
+)
+
+func date(month time.Month, day int) time.Time {
+	return time.Date(2026, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// steadyDays spends amount in category every day from 56 days before March through today
+func steadyDays(today time.Time, category string, amount float64) []dailyAmount {
+	var days []dailyAmount
+	for day := date(time.March, 1).AddDate(0, 0, -forecastHistoryDays); !day.After(today); day = day.AddDate(0, 0, 1) {
+		days = append(days, dailyAmount{Day: day, OperationType: "expense", Category: category, Amount: amount})
+	}
+	return days
+}
+
+func TestForecastPeriod(t *testing.T) {
+	start, end, err := forecastPeriod("month", date(time.February, 10))
+	if err != nil || !start.Equal(date(time.February, 1)) || !end.Equal(date(time.February, 28)) {
+		t.Errorf("month = %v..%v, %v", start, end, err)
+	}
+	// 2026-03-05 is a Thursday
+	start, end, _ = forecastPeriod("week", date(time.March, 5))
+	if !start.Equal(date(time.March, 2)) || !end.Equal(date(time.March, 8)) {
+		t.Errorf("week = %v..%v, want Monday to Sunday", start, end)
+	}
+	if _, _, err := forecastPeriod("year", date(time.March, 5)); err != ErrInvalidPeriod {
+		t.Errorf("year: err = %v", err)
+	}
+	if got := dateOf(time.Date(2026, 3, 31, 22, 0, 0, 0, time.UTC)); !got.Equal(date(time.April, 1)) {
+		t.Errorf("dateOf(22:00 UTC) = %v, want the next Moscow day", got)
+	}
+}
+
+func TestForecastSteady(t *testing.T) {
+	today := date(time.March, 10)
+	result := forecast(forecastInput{Start: date(time.March, 1), End: date(time.March, 31), Today: today,
+		Days: steadyDays(today, "Продукты", 1000)})
+
+	if result.DaysElapsed != 10 || result.DaysRemaining != 21 {
+		t.Errorf("days = %d + %d, want 10 + 21", result.DaysElapsed, result.DaysRemaining)
+	}
+	if e := result.Expenses; e.Actual != 10000 || e.Projected != 31000 || e.Low != 31000 || e.High != 31000 {
+		t.Errorf("expenses = %+v, want 31000 with no spread", e)
+	}
+	if len(result.Categories) != 1 || result.Categories[0].Category != "Продукты" || result.Categories[0].Projected != 31000 {
+		t.Errorf("categories = %+v", result.Categories)
+	}
+	if result.Balance != nil || result.Runway != nil {
+		t.Errorf("balance without accounts: %+v %+v", result.Balance, result.Runway)
+	}
+}
+
+func TestForecastPaceAndBand(t *testing.T) {
+	today := date(time.March, 15)
+	days := steadyDays(today, "Кафе", 0)
+	// History at 500 a day, one week more and one less, this month at 1000 a day
+	for i := range days {
+		days[i].Amount = 500 + float64((i/7)%2*2-1)*100
+		if !days[i].Day.Before(date(time.March, 1)) {
+			days[i].Amount = 1000
+		}
+	}
+	result := forecast(forecastInput{Start: date(time.March, 1), End: date(time.March, 31), Today: today, Days: days})
+
+	e := result.Expenses
+	// The pace blends 15 days at 1000 with 7 days of history at 500
+	rate := (15*1000.0 + 7*500) / 22
+	if math.Abs(e.Projected-(15000+16*rate)) > 1 {
+		t.Errorf("projected = %v, want %v", e.Projected, 15000+16*rate)
+	}
+	if !(e.Low < e.Projected && e.Projected < e.High) || e.Low < e.Actual {
+		t.Errorf("band = %+v", e)
+	}
+}
+
+func TestForecastWeekdays(t *testing.T) {
+	var spent []float64
+	for i := 0; i < forecastHistoryDays; i++ {
+		amount := 0.0
+		if date(time.January, 3).AddDate(0, 0, i).Weekday() == time.Saturday {
+			amount = 7000
+		}
+		spent = append(spent, amount)
+	}
+	weights := weekdayWeights(spent, date(time.January, 3))
+	if weights[time.Saturday] != 4 || weights[time.Monday] != 0.5 {
+		t.Errorf("weights = %v, want 4 on Saturday and 0.5 on other days", weights)
+	}
+	if weekdayWeights(make([]float64, 14), date(time.January, 3))[time.Sunday] != 1 {
+		t.Errorf("weights without spending are not flat")
+	}
+}
+
+func TestForecastRecurring(t *testing.T) {
+	today := date(time.March, 10)
+	days := steadyDays(today, "Продукты", 1000)
+	// Rent paid on the 5th every month: booked, not paced
+	for _, day := range []time.Time{date(time.January, 5), date(time.February, 5), date(time.March, 5)} {
+		days = append(days, dailyAmount{Day: day, OperationType: "expense", Category: "Жильё", Recurring: true, Amount: 40000})
+	}
+	due := []types.RecurringForecast{
+		{Date: date(time.March, 20), Type: "expense", Category: "Подписки", Amount: 300},
+		{Date: date(time.March, 25), Type: "income", Category: "Зарплата", Amount: 100000},
+	}
+	balance := 20000.0
+	result := forecast(forecastInput{Start: date(time.March, 1), End: date(time.March, 31), Today: today,
+		Days: days, Recurring: due, Balance: &balance})
+
+	if e := result.Expenses; e.Actual != 50000 || e.Projected != 71300 {
+		t.Errorf("expenses = %+v, want 50000 so far and 71300 projected", e)
+	}
+	if i := result.Incomes; i.Actual != 0 || i.Projected != 100000 {
+		t.Errorf("incomes = %+v", i)
+	}
+	byName := make(map[string]types.CategoryForecast)
+	for _, c := range result.Categories {
+		byName[c.Category] = c
+	}
+	if rent := byName["Жильё"]; rent.Projected != 40000 || rent.High != 40000 {
+		t.Errorf("rent = %+v, recurring spending must not be paced", rent)
+	}
+	if sub := byName["Подписки"]; sub.Projected != 300 || sub.Recurring != 300 {
+		t.Errorf("subscription = %+v", sub)
+	}
+	if result.Categories[0].Category != "Жильё" {
+		t.Errorf("categories not sorted by projection: %+v", result.Categories)
+	}
+	if b := result.Balance; b == nil || b.Actual != 20000 || b.Projected != 20000+100000-21300 {
+		t.Errorf("balance = %+v", b)
+	}
+	if result.Runway != nil {
+		t.Errorf("runway with a positive net: %+v", result.Runway)
+	}
+}
+
+func TestForecastRunway(t *testing.T) {
+	today := date(time.March, 10)
+	balance := 15500.0
+	result := forecast(forecastInput{Start: date(time.March, 1), End: date(time.March, 31), Today: today,
+		Days: steadyDays(today, "Продукты", 1000), Balance: &balance})
+
+	r := result.Runway
+	if r == nil || r.DailyBurn != 1000 || r.Days != 15 || !r.Date.Equal(date(time.March, 25)) {
+		t.Fatalf("runway = %+v, want 15 days at 1000 a day", r)
+	}
+	if b := result.Balance; b.Projected != -5500 || b.Low != -5500 {
+		t.Errorf("balance = %+v", b)
+	}
+}
+
+func TestForecastFamilyHasNoBalance(t *testing.T) {
+	if id, ok := (Scope{Kind: ScopeUser, UserID: 5}).balanceUser(); !ok || id != 5 {
+		t.Errorf("user scope: balanceUser() = %d, %v", id, ok)
+	}
+	for _, scope := range []Scope{
+		{Kind: ScopeFamily, UserID: 5, GroupIDs: []int64{-100}},
+		{Kind: ScopeGroup, UserID: 5, GroupIDs: []int64{-100}},
+	} {
+		if _, ok := scope.balanceUser(); ok {
+			t.Errorf("%s scope has the balance of one member's accounts", scope.Kind)
+		}
+	}
+
+	// Without a balance there is no runway however fast the family spends
+	today := date(time.March, 10)
+	result := forecast(forecastInput{Start: date(time.March, 1), End: date(time.March, 31), Today: today,
+		Days: steadyDays(today, "Продукты", 5000)})
+	if result.Balance != nil || result.Runway != nil {
+		t.Errorf("family forecast: balance %+v, runway %+v", result.Balance, result.Runway)
+	}
+}
+
+func TestRecurringOccurrences(t *testing.T) {
+	end := date(time.March, 31)
+	tests := []struct {
+		name string
+		rule recurringRule
+		want []time.Time
+	}{
+		{"monthly clamped", recurringRule{Kind: "monthly", Interval: 1, DayOfMonth: 31, NextRun: date(time.January, 31)},
+			[]time.Time{date(time.January, 31), date(time.February, 28), date(time.March, 31)}},
+		{"last business day", recurringRule{Kind: "last_business_day", Interval: 1, NextRun: date(time.February, 27)},
+			[]time.Time{date(time.February, 27), date(time.March, 31)}},
+		{"fortnightly", recurringRule{Kind: "weekly", Interval: 2, NextRun: date(time.March, 3)},
+			[]time.Time{date(time.March, 3), date(time.March, 17), date(time.March, 31)}},
+		{"ended", recurringRule{Kind: "weekly", Interval: 1, NextRun: date(time.March, 3), End: ptr(date(time.March, 12))},
+			[]time.Time{date(time.March, 3), date(time.March, 10)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.rule.occurrences(end)
+			if len(got) != len(tt.want) {
+				t.Fatalf("occurrences = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].Equal(tt.want[i]) {
+					t.Errorf("occurrences = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
@@ -0,0 +1,133 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Scope kinds
+const (
+	ScopeUser   = "user"   // the user's own transactions, private ones included
+	ScopeGroup  = "group"  // the transactions of one group chat
+	ScopeFamily = "family" // the user's own transactions and those of all their groups
+)
+
+var (
+	// ErrUnknownUser is returned for a telegram_id without a users row
+	ErrUnknownUser = errors.New("unknown user")
+	// ErrNotMember is returned when the user asks for a group they are not a member of
+	ErrNotMember = errors.New("not a member of the group")
+	// ErrInvalidScope is returned for an unknown scope kind or a group scope without a group
+	ErrInvalidScope = errors.New("scope must be user, family or group with group_id")
+)
+
+// defaultCurrency is users.base_currency of new users, for a group chat without members
+const defaultCurrency = "RUB"
+
+// Scope selects whose transactions the engine analyzes. Private transactions of other users
+// are never counted, deleted ones never are.
+type Scope struct {
+	Kind     string
+	UserID   int64   // users.id of the requester, 0 for a report to a group chat
+	GroupIDs []int64 // the group of a group scope, every group of the user for a family scope
+	Currency string  // ISO 4217 code amounts are converted into: the base currency of the requester or of most group members
+}
+
+// ResolveScope resolves the scope of a request from the requester's telegram_id (users.telegram_id)
+// and, for a group scope, the group's Telegram chat id
+func (e *Engine) ResolveScope(ctx context.Context, kind string, telegramID, groupID int64) (Scope, error) {
+	if kind == "" {
+		kind = ScopeUser
+	}
+	if kind != ScopeUser && kind != ScopeGroup && kind != ScopeFamily || kind == ScopeGroup && groupID == 0 {
+		return Scope{}, ErrInvalidScope
+	}
+
+	scope := Scope{Kind: kind}
+	err := e.db.QueryRow(ctx, "SELECT id, base_currency FROM users WHERE telegram_id = $1", telegramID).Scan(&scope.UserID, &scope.Currency)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Scope{}, ErrUnknownUser
+	}
+	if err != nil {
+		return Scope{}, fmt.Errorf("failed to resolve user: %w", err)
+	}
+
+	// group_members.user_id is a telegram_id
+	rows, err := e.db.Query(ctx, "SELECT group_id FROM group_members WHERE user_id = $1 ORDER BY group_id", telegramID)
+	if err != nil {
+		return Scope{}, fmt.Errorf("failed to resolve groups: %w", err)
+	}
+	groupIDs, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return Scope{}, fmt.Errorf("failed to resolve groups: %w", err)
+	}
+
+	switch kind {
+	case ScopeGroup:
+		for _, id := range groupIDs {
+			if id == groupID {
+				scope.GroupIDs = []int64{groupID}
+				return scope, nil
+			}
+		}
+		return Scope{}, ErrNotMember
+	case ScopeFamily:
+		scope.GroupIDs = groupIDs
+	}
+	return scope, nil
+}
+
+// RecipientScope is the scope of a scheduled report to a chat: a private chat gets the user's own
+// transactions, a group chat (negative id) the group's transactions without anyone's private ones,
+// in the base currency most of its members have
+func (e *Engine) RecipientScope(ctx context.Context, chatID int64) (Scope, error) {
+	if chatID >= 0 {
+		return e.ResolveScope(ctx, ScopeUser, chatID, 0)
+	}
+	scope := Scope{Kind: ScopeGroup, GroupIDs: []int64{chatID}, Currency: defaultCurrency}
+	err := e.db.QueryRow(ctx, `
+		SELECT u.base_currency
+		FROM group_members gm
+		JOIN users u ON u.telegram_id = gm.user_id
+		WHERE gm.group_id = $1
+		GROUP BY u.base_currency
+		ORDER BY COUNT(*) DESC, u.base_currency
+		LIMIT 1
+	`, chatID).Scan(&scope.Currency)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return Scope{}, fmt.Errorf("failed to resolve group currency: %w", err)
+	}
+	return scope, nil
+}
+
+// condition returns the condition on the transaction aliased e for the scope, its arguments numbered from first.
+// Only counted transactions match.
+func (s Scope) condition(first int) (string, []any) {
+	switch s.Kind {
+	case ScopeGroup:
+		return fmt.Sprintf("%s AND e.group_id = ANY($%d) AND (e.is_private = false OR e.user_id = $%d)", counted, first, first+1),
+			[]any{s.GroupIDs, s.UserID}
+	case ScopeFamily:
+		return fmt.Sprintf("%s AND (e.user_id = $%d OR (e.group_id = ANY($%d) AND e.is_private = false))", counted, first, first+1),
+			[]any{s.UserID, s.GroupIDs}
+	default:
+		return fmt.Sprintf("%s AND e.user_id = $%d", counted, first), []any{s.UserID}
+	}
+}
+
+// recurringCondition returns the condition on the recurring transaction aliased r for the scope,
+// its arguments numbered from first. Recurring transactions have no private flag: a group scope
+// gets the group's ones, personal ones stay with their owner.
+func (s Scope) recurringCondition(first int) (string, []any) {
+	switch s.Kind {
+	case ScopeGroup:
+		return fmt.Sprintf("r.group_id = ANY($%d)", first), []any{s.GroupIDs}
+	case ScopeFamily:
+		return fmt.Sprintf("(r.user_id = $%d OR r.group_id = ANY($%d))", first, first+1), []any{s.UserID, s.GroupIDs}
+	default:
+		return fmt.Sprintf("r.user_id = $%d", first), []any{s.UserID}
+	}
+}
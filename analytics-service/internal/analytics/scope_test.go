@@ -0,0 +1,226 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestScopeCondition(t *testing.T) {
+	tests := []struct {
+		name    string
+		scope   Scope
+		want    string // the condition after counted
+		args    []any
+		private string // how private transactions of other users are excluded, "" when only own ones match
+	}{
+		{
+			name:  "user: own transactions, private ones included",
+			scope: Scope{Kind: ScopeUser, UserID: 7, GroupIDs: []int64{-100}},
+			want:  "e.user_id = $4",
+			args:  []any{int64(7)},
+		},
+		{
+			name:    "group: the group's transactions, private ones only of the requester",
+			scope:   Scope{Kind: ScopeGroup, UserID: 7, GroupIDs: []int64{-100}},
+			want:    "e.group_id = ANY($4) AND (e.is_private = false OR e.user_id = $5)",
+			args:    []any{[]int64{-100}, int64(7)},
+			private: "(e.is_private = false OR e.user_id = $5)",
+		},
+		{
+			name:    "group report to the chat: no private ones at all",
+			scope:   Scope{Kind: ScopeGroup, GroupIDs: []int64{-100}},
+			want:    "e.group_id = ANY($4) AND (e.is_private = false OR e.user_id = $5)",
+			args:    []any{[]int64{-100}, int64(0)}, // users.id 0 matches nobody
+			private: "(e.is_private = false OR e.user_id = $5)",
+		},
+		{
+			name:    "family: own transactions and the public ones of every group",
+			scope:   Scope{Kind: ScopeFamily, UserID: 7, GroupIDs: []int64{-100, -200}},
+			want:    "(e.user_id = $4 OR (e.group_id = ANY($5) AND e.is_private = false))",
+			args:    []any{int64(7), []int64{-100, -200}},
+			private: "(e.group_id = ANY($5) AND e.is_private = false)",
+		},
+		{
+			name:    "family without groups",
+			scope:   Scope{Kind: ScopeFamily, UserID: 7},
+			want:    "(e.user_id = $4 OR (e.group_id = ANY($5) AND e.is_private = false))",
+			args:    []any{int64(7), []int64(nil)},
+			private: "(e.group_id = ANY($5) AND e.is_private = false)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args := tt.scope.condition(4)
+			// Deleted transactions and transfers never count, whatever the scope
+			if !strings.HasPrefix(where, "e.operation_type IN ('expense', 'income') AND e.deleted_at IS NULL AND ") {
+				t.Errorf("condition = %q, want deleted transactions and transfers excluded first", where)
+			}
+			if got := strings.TrimPrefix(where, counted+" AND "); got != tt.want {
+				t.Errorf("condition = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args = %#v, want %#v", args, tt.args)
+			}
+			if tt.private != "" && !strings.Contains(where, tt.private) {
+				t.Errorf("condition = %q, want private transactions of other users excluded by %q", where, tt.private)
+			}
+		})
+	}
+}
+
+func TestScopeRecurringCondition(t *testing.T) {
+	tests := []struct {
+		scope Scope
+		want  string
+	}{
+		{Scope{Kind: ScopeUser, UserID: 7}, "r.user_id = $2"},
+		{Scope{Kind: ScopeGroup, UserID: 7, GroupIDs: []int64{-100}}, "r.group_id = ANY($2)"},
+		{Scope{Kind: ScopeFamily, UserID: 7, GroupIDs: []int64{-100}}, "(r.user_id = $2 OR r.group_id = ANY($3))"},
+	}
+	for _, tt := range tests {
+		if got, _ := tt.scope.recurringCondition(2); got != tt.want {
+			t.Errorf("%s: recurringCondition() = %q, want %q", tt.scope.Kind, got, tt.want)
+		}
+	}
+}
+
+func TestResolveScope(t *testing.T) {
+	// Telegram user 100 is users.id 7 with EUR as base currency, a member of groups -100 and -200
+	db := &scopeDB{
+		users:  map[int64][]any{100: {int64(7), "EUR"}},
+		groups: map[int64][]int64{100: {-200, -100}},
+	}
+	e := NewEngine(db)
+	tests := []struct {
+		name       string
+		kind       string
+		telegramID int64
+		groupID    int64
+		want       Scope
+		wantErr    error
+	}{
+		{name: "user by default", telegramID: 100, want: Scope{Kind: ScopeUser, UserID: 7, Currency: "EUR"}},
+		{name: "group of the user", kind: ScopeGroup, telegramID: 100, groupID: -100,
+			want: Scope{Kind: ScopeGroup, UserID: 7, GroupIDs: []int64{-100}, Currency: "EUR"}},
+		{name: "family", kind: ScopeFamily, telegramID: 100,
+			want: Scope{Kind: ScopeFamily, UserID: 7, GroupIDs: []int64{-200, -100}, Currency: "EUR"}},
+		{name: "unknown telegram_id", kind: ScopeUser, telegramID: 101, wantErr: ErrUnknownUser},
+		{name: "unknown telegram_id in a group", kind: ScopeGroup, telegramID: 101, groupID: -100, wantErr: ErrUnknownUser},
+		{name: "group of other users", kind: ScopeGroup, telegramID: 100, groupID: -300, wantErr: ErrNotMember},
+		{name: "group without group_id", kind: ScopeGroup, telegramID: 100, wantErr: ErrInvalidScope},
+		{name: "unknown kind", kind: "everyone", telegramID: 100, wantErr: ErrInvalidScope},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := e.ResolveScope(context.Background(), tt.kind, tt.telegramID, tt.groupID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ResolveScope() = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ResolveScope() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecipientScope(t *testing.T) {
+	db := &scopeDB{users: map[int64][]any{100: {int64(7), "EUR"}}, groupCurrency: map[int64]string{-100: "USD"}}
+	e := NewEngine(db)
+	tests := []struct {
+		chatID  int64
+		want    Scope
+		wantErr error
+	}{
+		{chatID: 100, want: Scope{Kind: ScopeUser, UserID: 7, Currency: "EUR"}},
+		{chatID: 101, wantErr: ErrUnknownUser},
+		{chatID: -100, want: Scope{Kind: ScopeGroup, GroupIDs: []int64{-100}, Currency: "USD"}},
+		{chatID: -200, want: Scope{Kind: ScopeGroup, GroupIDs: []int64{-200}, Currency: defaultCurrency}}, // no members
+	}
+	for _, tt := range tests {
+		got, err := e.RecipientScope(context.Background(), tt.chatID)
+		if !errors.Is(err, tt.wantErr) || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("RecipientScope(%d) = %+v, %v, want %+v, %v", tt.chatID, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// scopeDB answers the queries of ResolveScope and RecipientScope
+type scopeDB struct {
+	users         map[int64][]any   // telegram_id -> id, base_currency
+	groups        map[int64][]int64 // telegram_id -> group ids
+	groupCurrency map[int64]string  // group id -> the base currency of most members
+}
+
+func (db *scopeDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	switch {
+	case strings.Contains(sql, "FROM users WHERE telegram_id"):
+		return scopeRow(db.users[args[0].(int64)])
+	case strings.Contains(sql, "FROM group_members"):
+		if currency, ok := db.groupCurrency[args[0].(int64)]; ok {
+			return scopeRow{currency}
+		}
+		return scopeRow(nil)
+	}
+	panic("unexpected query: " + sql)
+}
+
+func (db *scopeDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	if !strings.Contains(sql, "FROM group_members WHERE user_id") {
+		panic("unexpected query: " + sql)
+	}
+	rows := &scopeRows{index: -1}
+	for _, id := range db.groups[args[0].(int64)] {
+		rows.values = append(rows.values, id)
+	}
+	return rows, nil
+}
+
+func (db *scopeDB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	panic("unexpected statement: " + sql)
+}
+
+// scopeRow is a row of values, pgx.ErrNoRows when empty
+type scopeRow []any
+
+func (r scopeRow) Scan(dest ...any) error {
+	if len(r) == 0 {
+		return pgx.ErrNoRows
+	}
+	for i, d := range dest {
+		reflect.ValueOf(d).Elem().Set(reflect.ValueOf(r[i]))
+	}
+	return nil
+}
+
+// scopeRows are rows of one value each
+type scopeRows struct {
+	values []any
+	index  int
+}
+
+func (r *scopeRows) Close()                                       {}
+func (r *scopeRows) Err() error                                   { return nil }
+func (r *scopeRows) CommandTag() pgconn.CommandTag                { return pgconn.NewCommandTag("SELECT") }
+func (r *scopeRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (r *scopeRows) RawValues() [][]byte                          { return nil }
+func (r *scopeRows) Conn() *pgx.Conn                              { return nil }
+func (r *scopeRows) Values() ([]any, error)                       { return []any{r.values[r.index]}, nil }
+
+func (r *scopeRows) Next() bool {
+	r.index++
+	return r.index < len(r.values)
+}
+
+func (r *scopeRows) Scan(dest ...any) error {
+	if len(dest) != 1 {
+		return fmt.Errorf("scanning one value into %d destinations", len(dest))
+	}
+	return scopeRow{r.values[r.index]}.Scan(dest...)
+}
@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -51,7 +53,9 @@ func (h *Handlers) HealthCheck(w http.ResponseWriter, r *http.Request) {
 
 	// Check Ollama
 	ollamaHealthy := false
+	model := ""
 	if h.ollama != nil {
+		model = h.ollama.Model()
 		if err := h.ollama.HealthCheck(); err == nil {
 			ollamaHealthy = true
 		}
@@ -75,6 +79,7 @@ func (h *Handlers) HealthCheck(w http.ResponseWriter, r *http.Request) {
 		Service:   "analytics-service",
 		Status:    status,
 		Ollama:    ollamaHealthy,
+		Model:     model,
 		Database:  dbHealthy,
 		LastCheck: time.Now(),
 		Uptime:    time.Since(h.startTime).String(),
@@ -86,10 +91,46 @@ func (h *Handlers) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(health)
 }
 
+// resolveScope resolves the analysis scope of a request and writes the error response when it fails
+func (h *Handlers) resolveScope(w http.ResponseWriter, r *http.Request, kind string, telegramID, groupID int64) (analytics.Scope, bool) {
+	if telegramID == 0 {
+		http.Error(w, "telegram_id required", http.StatusBadRequest)
+		return analytics.Scope{}, false
+	}
+	scope, err := h.analytics.ResolveScope(r.Context(), kind, telegramID, groupID)
+	switch {
+	case err == nil:
+		return scope, true
+	case errors.Is(err, analytics.ErrInvalidScope):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, analytics.ErrUnknownUser):
+		http.Error(w, "user not found", http.StatusNotFound)
+	case errors.Is(err, analytics.ErrNotMember):
+		http.Error(w, "forbidden", http.StatusForbidden)
+	default:
+		log.Error().Err(err).Int64("telegram_id", telegramID).Msg("Failed to resolve analysis scope")
+		http.Error(w, "Failed to resolve scope", http.StatusInternalServerError)
+	}
+	return analytics.Scope{}, false
+}
+
+// queryScope resolves the scope from the telegram_id, scope and group_id query parameters
+func (h *Handlers) queryScope(w http.ResponseWriter, r *http.Request) (analytics.Scope, bool) {
+	query := r.URL.Query()
+	telegramID, _ := strconv.ParseInt(query.Get("telegram_id"), 10, 64)
+	groupID, _ := strconv.ParseInt(query.Get("group_id"), 10, 64)
+	return h.resolveScope(w, r, query.Get("scope"), telegramID, groupID)
+}
+
 // AnalyzePeriod handles period analysis endpoint
 func (h *Handlers) AnalyzePeriod(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
+	scope, ok := h.queryScope(w, r)
+	if !ok {
+		return
+	}
+
 	// Parse query parameters
 	period := r.URL.Query().Get("period")
 	if period == "" {
@@ -107,7 +148,7 @@ func (h *Handlers) AnalyzePeriod(w http.ResponseWriter, r *http.Request) {
 	startDate := now.AddDate(0, 0, -days)
 
 	// Perform analysis
-	analysis, err := h.analytics.AnalyzePeriod(ctx, period, startDate, endDate)
+	analysis, err := h.analytics.AnalyzePeriod(ctx, scope, period, startDate, endDate)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to analyze period")
 		http.Error(w, "Failed to analyze period", http.StatusInternalServerError)
@@ -131,6 +172,29 @@ func (h *Handlers) AnalyzePeriod(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(analysis)
 }
 
+// GetForecast handles the forecast endpoint: the projection of the current month (or week, period=week)
+func (h *Handlers) GetForecast(w http.ResponseWriter, r *http.Request) {
+	scope, ok := h.queryScope(w, r)
+	if !ok {
+		return
+	}
+
+	forecast, err := h.analytics.Forecast(r.Context(), scope, r.URL.Query().Get("period"), time.Now())
+	if errors.Is(err, analytics.ErrInvalidPeriod) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to forecast period")
+		http.Error(w, "Failed to forecast period", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(forecast)
+}
+
 // SendMessage handles sending messages to Telegram
 func (h *Handlers) SendMessage(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -167,32 +231,37 @@ func (h *Handlers) SendMessage(w http.ResponseWriter, r *http.Request) {
 		endDate = now
 	}
 
-	// Perform analysis
-	analysis, err := h.analytics.AnalyzePeriod(ctx, req.Period, startDate, endDate)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to analyze period for message")
-		http.Error(w, "Failed to analyze period", http.StatusInternalServerError)
-		return
-	}
-
-	// Send appropriate message type
-	var sendErr error
+	var send func(context.Context, *types.AnalysisResult, []int64) error
 	switch req.Type {
 	case "daily":
-		sendErr = h.messaging.GenerateDailyReport(ctx, analysis, req.ChatIDs)
+		send = h.messaging.GenerateDailyReport
 	case "anomaly":
-		sendErr = h.messaging.GenerateAnomalyAlert(ctx, analysis, req.ChatIDs)
+		send = h.messaging.GenerateAnomalyAlert
 	case "trend":
-		sendErr = h.messaging.GenerateTrendNotification(ctx, analysis, req.ChatIDs)
+		send = h.messaging.GenerateTrendNotification
 	default:
 		http.Error(w, "Invalid message type", http.StatusBadRequest)
 		return
 	}
 
-	if sendErr != nil {
-		log.Error().Err(sendErr).Msg("Failed to send message")
-		http.Error(w, "Failed to send message", http.StatusInternalServerError)
-		return
+	// Every chat gets the analysis of its own transactions
+	for _, chatID := range req.ChatIDs {
+		scope, err := h.analytics.RecipientScope(ctx, chatID)
+		if err != nil {
+			log.Warn().Err(err).Int64("chat_id", chatID).Msg("Skipping message to a chat without a user")
+			continue
+		}
+		analysis, err := h.analytics.AnalyzePeriod(ctx, scope, req.Period, startDate, endDate)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to analyze period for message")
+			http.Error(w, "Failed to analyze period", http.StatusInternalServerError)
+			return
+		}
+		if err := send(ctx, analysis, []int64{chatID}); err != nil {
+			log.Error().Err(err).Msg("Failed to send message")
+			http.Error(w, "Failed to send message", http.StatusInternalServerError)
+			return
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -213,6 +282,11 @@ func (h *Handlers) GetScheduledJobs(w http.ResponseWriter, r *http.Request) {
 func (h *Handlers) TriggerAnalysis(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
+	scope, ok := h.queryScope(w, r)
+	if !ok {
+		return
+	}
+
 	period := r.URL.Query().Get("period")
 	if period == "" {
 		period = "day"
@@ -235,7 +309,7 @@ func (h *Handlers) TriggerAnalysis(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Perform analysis
-	analysis, err := h.analytics.AnalyzePeriod(ctx, period, startDate, endDate)
+	analysis, err := h.analytics.AnalyzePeriod(ctx, scope, period, startDate, endDate)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to trigger analysis")
 		http.Error(w, "Failed to perform analysis", http.StatusInternalServerError)
@@ -276,8 +350,8 @@ func (h *Handlers) GetOllamaStatus(w http.ResponseWriter, r *http.Request) {
 
 	status := map[string]interface{}{
 		"healthy": true,
-		"model":   "qwen2.5:0.5b",
-		"url":     "http://ollama:11434",
+		"model":   h.ollama.Model(),
+		"url":     h.ollama.URL(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -292,15 +366,21 @@ func (h *Handlers) GetSummary(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		TelegramID int64  `json:"telegram_id"`
 		Period     string `json:"period"`
+		Scope      string `json:"scope"`    // user (default), family or group
+		GroupID    int64  `json:"group_id"` // Telegram chat id of the group scope
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	// The api-service proxy passes the authenticated caller in the query, it wins over the body
+	if telegramID, err := strconv.ParseInt(r.URL.Query().Get("telegram_id"), 10, 64); err == nil {
+		req.TelegramID = telegramID
+	}
 
-	if req.TelegramID == 0 {
-		http.Error(w, "telegram_id required", http.StatusBadRequest)
+	scope, ok := h.resolveScope(w, r, req.Scope, req.TelegramID, req.GroupID)
+	if !ok {
 		return
 	}
 
@@ -325,7 +405,7 @@ func (h *Handlers) GetSummary(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Perform analysis
-	analysis, err := h.analytics.AnalyzePeriod(ctx, req.Period, startDate, endDate)
+	analysis, err := h.analytics.AnalyzePeriod(ctx, scope, req.Period, startDate, endDate)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to analyze period for summary")
 		http.Error(w, "Failed to analyze period", http.StatusInternalServerError)
@@ -334,17 +414,18 @@ func (h *Handlers) GetSummary(w http.ResponseWriter, r *http.Request) {
 
 	// Generate AI summary if available
 	summary := "Анализ за период:\n\n"
+	symbol := " " + types.CurrencySymbol(analysis.Data.Currency) + "\n"
 	if analysis.Data.Expenses > 0 {
-		summary += "💸 Расходы: " + strconv.FormatFloat(analysis.Data.Expenses, 'f', 2, 64) + " руб.\n"
+		summary += "💸 Расходы: " + strconv.FormatFloat(analysis.Data.Expenses, 'f', 2, 64) + symbol
 	}
 	if analysis.Data.Incomes > 0 {
-		summary += "💰 Доходы: " + strconv.FormatFloat(analysis.Data.Incomes, 'f', 2, 64) + " руб.\n"
+		summary += "💰 Доходы: " + strconv.FormatFloat(analysis.Data.Incomes, 'f', 2, 64) + symbol
 	}
 	balance := analysis.Data.Balance
 	if balance >= 0 {
-		summary += "✅ Баланс: +" + strconv.FormatFloat(balance, 'f', 2, 64) + " руб.\n"
+		summary += "✅ Баланс: +" + strconv.FormatFloat(balance, 'f', 2, 64) + symbol
 	} else {
-		summary += "⚠️ Баланс: " + strconv.FormatFloat(balance, 'f', 2, 64) + " руб.\n"
+		summary += "⚠️ Баланс: " + strconv.FormatFloat(balance, 'f', 2, 64) + symbol
 	}
 
 	// Try to enhance with AI if available
@@ -376,9 +457,9 @@ func (h *Handlers) buildFinancialPrompt(analysis types.AnalysisResult) string {
 	return fmt.Sprintf(`Проанализируй финансовые данные и дай краткие рекомендации на русском языке:
 
 Период: %s
-Расходы: %.2f руб
-Доходы: %.2f руб
-Баланс: %.2f руб
+Расходы: %.2f %s
+Доходы: %.2f %s
+Баланс: %.2f %s
 
 Изменения:
 - Расходы: %.1f%% (%s)
@@ -390,9 +471,9 @@ func (h *Handlers) buildFinancialPrompt(analysis types.AnalysisResult) string {
 
 Дай 2-3 кратких совета по управлению финансами. Будь позитивным и мотивирующим.`,
 		analysis.Period,
-		analysis.Data.Expenses,
-		analysis.Data.Incomes,
-		analysis.Data.Balance,
+		analysis.Data.Expenses, analysis.Data.Currency,
+		analysis.Data.Incomes, analysis.Data.Currency,
+		analysis.Data.Balance, analysis.Data.Currency,
 		analysis.Comparison.Change.ExpensesPercent,
 		getChangeDirection(analysis.Comparison.Change.ExpensesChange),
 		analysis.Comparison.Change.IncomesPercent,
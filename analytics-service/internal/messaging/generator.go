@@ -78,6 +78,18 @@ func (g *Generator) GenerateTrendNotification(ctx context.Context, analysis *typ
 	return nil
 }
 
+// GenerateBudgetAlert generates and sends a budget overspend alert
+func (g *Generator) GenerateBudgetAlert(ctx context.Context, alert types.BudgetAlert) error {
+	message := g.buildBudgetAlertMessage(alert)
+
+	if err := g.sendMessage(ctx, alert.ChatID(), message); err != nil {
+		return fmt.Errorf("failed to send budget alert: %w", err)
+	}
+	log.Info().Int64("chat_id", alert.ChatID()).Int("budget_id", alert.BudgetID).Int("threshold", alert.Threshold).Msg("Budget alert sent successfully")
+
+	return nil
+}
+
 // buildDailyReportMessage builds daily report message
 func (g *Generator) buildDailyReportMessage(analysis *types.AnalysisResult) string {
 	var message strings.Builder
@@ -86,9 +98,10 @@ func (g *Generator) buildDailyReportMessage(analysis *types.AnalysisResult) stri
 	message.WriteString("📊 *Ежедневный финансовый отчет*\n\n")
 
 	// Main stats
-	message.WriteString(fmt.Sprintf("💰 *Баланс:* %.2f ₽\n", analysis.Data.Balance))
-	message.WriteString(fmt.Sprintf("📉 *Расходы:* %.2f ₽\n", analysis.Data.Expenses))
-	message.WriteString(fmt.Sprintf("📈 *Доходы:* %.2f ₽\n\n", analysis.Data.Incomes))
+	symbol := types.CurrencySymbol(analysis.Data.Currency)
+	message.WriteString(fmt.Sprintf("💰 *Баланс:* %.2f %s\n", analysis.Data.Balance, symbol))
+	message.WriteString(fmt.Sprintf("📉 *Расходы:* %.2f %s\n", analysis.Data.Expenses, symbol))
+	message.WriteString(fmt.Sprintf("📈 *Доходы:* %.2f %s\n\n", analysis.Data.Incomes, symbol))
 
 	// Changes
 	if analysis.Comparison.Change.ExpensesPercent != 0 {
@@ -129,7 +142,7 @@ func (g *Generator) buildDailyReportMessage(analysis *types.AnalysisResult) stri
 			if count >= 3 { // Show only top 3
 				break
 			}
-			message.WriteString(fmt.Sprintf("• %s: %.2f ₽\n", category, amount))
+			message.WriteString(fmt.Sprintf("• %s: %.2f %s\n", category, amount, symbol))
 			count++
 		}
 	}
@@ -145,6 +158,7 @@ func (g *Generator) buildAnomalyAlertMessage(analysis *types.AnalysisResult) str
 	var message strings.Builder
 
 	message.WriteString("🚨 *Обнаружены аномалии в тратах*\n\n")
+	symbol := types.CurrencySymbol(analysis.Data.Currency)
 
 	for _, anomaly := range analysis.Anomalies {
 		emoji := "⚠️"
@@ -153,7 +167,7 @@ func (g *Generator) buildAnomalyAlertMessage(analysis *types.AnalysisResult) str
 		}
 
 		message.WriteString(fmt.Sprintf("%s *%s*\n", emoji, anomaly.Description))
-		message.WriteString(fmt.Sprintf("Сумма: %.2f ₽ (среднее: %.2f ₽)\n\n", anomaly.Amount, anomaly.Average))
+		message.WriteString(fmt.Sprintf("Сумма: %.2f %s (среднее: %.2f %s)\n\n", anomaly.Amount, symbol, anomaly.Average, symbol))
 	}
 
 	message.WriteString("💡 *Рекомендации:*\n")
@@ -164,11 +178,49 @@ func (g *Generator) buildAnomalyAlertMessage(analysis *types.AnalysisResult) str
 	return message.String()
 }
 
+// buildBudgetAlertMessage builds budget alert message
+func (g *Generator) buildBudgetAlertMessage(alert types.BudgetAlert) string {
+	var message strings.Builder
+
+	title := alert.Name
+	if title == "" {
+		title = alert.CategoryName
+	}
+	if title == "" {
+		title = "Все расходы"
+	}
+
+	if alert.Threshold >= 100 {
+		message.WriteString(fmt.Sprintf("🚨 *Бюджет превышен: %s*\n\n", title))
+	} else {
+		message.WriteString(fmt.Sprintf("⚠️ *Бюджет почти исчерпан: %s*\n\n", title))
+	}
+
+	symbol := types.CurrencySymbol(alert.Currency)
+	spent := float64(alert.SpentCents) / 100.0
+	limit := float64(alert.LimitCents) / 100.0
+	message.WriteString(fmt.Sprintf("Потрачено: %.2f %s из %.2f %s", spent, symbol, limit, symbol))
+	if alert.LimitCents > 0 {
+		message.WriteString(fmt.Sprintf(" (%.0f%%)", spent*100/limit))
+	}
+	message.WriteString("\n")
+
+	if remaining := limit - spent; remaining > 0 {
+		message.WriteString(fmt.Sprintf("Осталось: %.2f %s\n", remaining, symbol))
+	} else {
+		message.WriteString(fmt.Sprintf("Перерасход: %.2f %s\n", -remaining, symbol))
+	}
+	message.WriteString(fmt.Sprintf("Период: %s – %s", alert.PeriodStart.Format("02.01"), alert.PeriodEnd.Format("02.01.2006")))
+
+	return message.String()
+}
+
 // buildTrendNotificationMessage builds trend notification message
 func (g *Generator) buildTrendNotificationMessage(analysis *types.AnalysisResult) string {
 	var message strings.Builder
 
 	message.WriteString("📈 *Анализ трендов*\n\n")
+	symbol := types.CurrencySymbol(analysis.Data.Currency)
 
 	for _, trend := range analysis.Trends {
 		emoji := "📊"
@@ -183,7 +235,7 @@ func (g *Generator) buildTrendNotificationMessage(analysis *types.AnalysisResult
 
 		message.WriteString(fmt.Sprintf("%s *%s*\n", emoji, trend.Description))
 		if trend.Amount != 0 {
-			message.WriteString(fmt.Sprintf("Изменение: %.2f ₽\n", trend.Amount))
+			message.WriteString(fmt.Sprintf("Изменение: %.2f %s\n", trend.Amount, symbol))
 		}
 		message.WriteString(fmt.Sprintf("Уверенность: %.0f%%\n\n", trend.Confidence*100))
 	}
@@ -34,6 +34,16 @@ func NewClient(baseURL, model string) *Client {
 	}
 }
 
+// Model returns the name of the model the client generates with
+func (c *Client) Model() string {
+	return c.model
+}
+
+// URL returns the base URL of the Ollama server
+func (c *Client) URL() string {
+	return c.baseURL
+}
+
 // HealthCheck checks if Ollama service is healthy
 func (c *Client) HealthCheck() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -141,9 +151,9 @@ func (c *Client) buildFinancialPrompt(data types.AnalysisResult) string {
 	return fmt.Sprintf(`Проанализируй финансовые данные и дай краткие рекомендации на русском языке:
 
 Период: %s
-Расходы: %.2f руб
-Доходы: %.2f руб
-Баланс: %.2f руб
+Расходы: %.2f %s
+Доходы: %.2f %s
+Баланс: %.2f %s
 
 Изменения:
 - Расходы: %.1f%% (%s)
@@ -155,9 +165,9 @@ func (c *Client) buildFinancialPrompt(data types.AnalysisResult) string {
 
 Дай 2-3 кратких совета по управлению финансами. Будь позитивным и мотивирующим.`,
 		data.Period,
-		data.Data.Expenses,
-		data.Data.Incomes,
-		data.Data.Balance,
+		data.Data.Expenses, data.Data.Currency,
+		data.Data.Incomes, data.Data.Currency,
+		data.Data.Balance, data.Data.Currency,
 		data.Comparison.Change.ExpensesPercent,
 		getChangeDirection(data.Comparison.Change.ExpensesChange),
 		data.Comparison.Change.IncomesPercent,
@@ -172,18 +182,18 @@ func (c *Client) buildFinancialPrompt(data types.AnalysisResult) string {
 func (c *Client) buildDailyReportPrompt(data types.AnalysisResult) string {
 	return fmt.Sprintf(`Создай ежедневный финансовый отчет на русском языке:
 
-Сегодня потрачено: %.2f руб
-Сегодня заработано: %.2f руб
-Баланс: %.2f руб
+Сегодня потрачено: %.2f %s
+Сегодня заработано: %.2f %s
+Баланс: %.2f %s
 
 По сравнению с вчера:
 - Расходы: %.1f%% (%s)
 - Доходы: %.1f%% (%s)
 
 Создай мотивирующее сообщение с эмодзи. Если сэкономили - похвали, если потратили больше - дай совет.`,
-		data.Data.Expenses,
-		data.Data.Incomes,
-		data.Data.Balance,
+		data.Data.Expenses, data.Data.Currency,
+		data.Data.Incomes, data.Data.Currency,
+		data.Data.Balance, data.Data.Currency,
 		data.Comparison.Change.ExpensesPercent,
 		getChangeDirection(data.Comparison.Change.ExpensesChange),
 		data.Comparison.Change.IncomesPercent,
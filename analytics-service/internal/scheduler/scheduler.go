@@ -66,6 +66,14 @@ func (s *Scheduler) Start(ctx context.Context) error {
 		return fmt.Errorf("failed to add anomaly check job: %w", err)
 	}
 
+	// Budget alerts every 30 minutes
+	_, err = s.cron.AddFunc("*/30 * * * *", func() {
+		s.runBudgetCheck(ctx)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add budget check job: %w", err)
+	}
+
 	// Weekly trend analysis on Sundays at 21:00
 	_, err = s.cron.AddFunc("0 21 * * 0", func() {
 		s.runWeeklyAnalysis(ctx)
@@ -97,6 +105,19 @@ func (s *Scheduler) Stop() {
 	s.cron.Stop()
 }
 
+// forEachRecipient calls report with the scope of every configured chat: a user gets a report on their
+// own transactions, a group chat on the group's
+func (s *Scheduler) forEachRecipient(ctx context.Context, report func(chatID int64, scope analytics.Scope)) {
+	for _, chatID := range s.chatIDs {
+		scope, err := s.analytics.RecipientScope(ctx, chatID)
+		if err != nil {
+			log.Warn().Err(err).Int64("chat_id", chatID).Msg("Skipping report to a chat without a user")
+			continue
+		}
+		report(chatID, scope)
+	}
+}
+
 // runDailyReport runs daily financial report
 func (s *Scheduler) runDailyReport(ctx context.Context) {
 	log.Info().Msg("Running daily report")
@@ -105,28 +126,30 @@ func (s *Scheduler) runDailyReport(ctx context.Context) {
 	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, s.timezone)
 	endOfDay := startOfDay.Add(24 * time.Hour)
 
-	analysis, err := s.analytics.AnalyzePeriod(ctx, "day", startOfDay, endOfDay)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to analyze daily period")
-		return
-	}
+	s.forEachRecipient(ctx, func(chatID int64, scope analytics.Scope) {
+		analysis, err := s.analytics.AnalyzePeriod(ctx, scope, "day", startOfDay, endOfDay)
+		if err != nil {
+			log.Error().Err(err).Int64("chat_id", chatID).Msg("Failed to analyze daily period")
+			return
+		}
 
-	// Try to enhance with AI if available
-	if s.ollama != nil {
-		if err := s.ollama.HealthCheck(); err == nil {
-			aiMessage, err := s.ollama.GenerateDailyReport(ctx, *analysis)
-			if err != nil {
-				log.Warn().Err(err).Msg("Failed to generate AI-enhanced daily report, using fallback")
-			} else {
-				// Use AI-generated message
-				analysis.Insights = []string{aiMessage}
+		// Try to enhance with AI if available
+		if s.ollama != nil {
+			if err := s.ollama.HealthCheck(); err == nil {
+				aiMessage, err := s.ollama.GenerateDailyReport(ctx, *analysis)
+				if err != nil {
+					log.Warn().Err(err).Msg("Failed to generate AI-enhanced daily report, using fallback")
+				} else {
+					// Use AI-generated message
+					analysis.Insights = []string{aiMessage}
+				}
 			}
 		}
-	}
 
-	if err := s.messaging.GenerateDailyReport(ctx, analysis, s.chatIDs); err != nil {
-		log.Error().Err(err).Msg("Failed to send daily report")
-	}
+		if err := s.messaging.GenerateDailyReport(ctx, analysis, []int64{chatID}); err != nil {
+			log.Error().Err(err).Int64("chat_id", chatID).Msg("Failed to send daily report")
+		}
+	})
 }
 
 // runAnomalyCheck runs anomaly detection
@@ -137,24 +160,48 @@ func (s *Scheduler) runAnomalyCheck(ctx context.Context) {
 	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, s.timezone)
 	endOfDay := startOfDay.Add(24 * time.Hour)
 
-	analysis, err := s.analytics.AnalyzePeriod(ctx, "day", startOfDay, endOfDay)
+	s.forEachRecipient(ctx, func(chatID int64, scope analytics.Scope) {
+		analysis, err := s.analytics.AnalyzePeriod(ctx, scope, "day", startOfDay, endOfDay)
+		if err != nil {
+			log.Error().Err(err).Int64("chat_id", chatID).Msg("Failed to analyze period for anomaly check")
+			return
+		}
+
+		// Only send alerts if there are high-severity anomalies
+		hasHighSeverity := false
+		for _, anomaly := range analysis.Anomalies {
+			if anomaly.Severity == "high" {
+				hasHighSeverity = true
+				break
+			}
+		}
+
+		if hasHighSeverity {
+			if err := s.messaging.GenerateAnomalyAlert(ctx, analysis, []int64{chatID}); err != nil {
+				log.Error().Err(err).Int64("chat_id", chatID).Msg("Failed to send anomaly alert")
+			}
+		}
+	})
+}
+
+// runBudgetCheck sends alerts for budgets that crossed 80% or 100% of their limit
+func (s *Scheduler) runBudgetCheck(ctx context.Context) {
+	log.Info().Msg("Running budget check")
+
+	alerts, err := s.analytics.PendingBudgetAlerts(ctx)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to analyze period for anomaly check")
+		log.Error().Err(err).Msg("Failed to check budgets")
 		return
 	}
 
-	// Only send alerts if there are high-severity anomalies
-	hasHighSeverity := false
-	for _, anomaly := range analysis.Anomalies {
-		if anomaly.Severity == "high" {
-			hasHighSeverity = true
-			break
+	for _, alert := range alerts {
+		if err := s.messaging.GenerateBudgetAlert(ctx, alert); err != nil {
+			// Not marked as sent, so it is retried on the next run
+			log.Error().Err(err).Int("budget_id", alert.BudgetID).Msg("Failed to send budget alert")
+			continue
 		}
-	}
-
-	if hasHighSeverity {
-		if err := s.messaging.GenerateAnomalyAlert(ctx, analysis, s.chatIDs); err != nil {
-			log.Error().Err(err).Msg("Failed to send anomaly alert")
+		if err := s.analytics.MarkBudgetAlertSent(ctx, alert); err != nil {
+			log.Error().Err(err).Int("budget_id", alert.BudgetID).Msg("Failed to record budget alert")
 		}
 	}
 }
@@ -167,28 +214,30 @@ func (s *Scheduler) runWeeklyAnalysis(ctx context.Context) {
 	startOfWeek := now.AddDate(0, 0, -7)
 	endOfWeek := now
 
-	analysis, err := s.analytics.AnalyzePeriod(ctx, "week", startOfWeek, endOfWeek)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to analyze weekly period")
-		return
-	}
+	s.forEachRecipient(ctx, func(chatID int64, scope analytics.Scope) {
+		analysis, err := s.analytics.AnalyzePeriod(ctx, scope, "week", startOfWeek, endOfWeek)
+		if err != nil {
+			log.Error().Err(err).Int64("chat_id", chatID).Msg("Failed to analyze weekly period")
+			return
+		}
 
-	// Try to enhance with AI if available
-	if s.ollama != nil {
-		if err := s.ollama.HealthCheck(); err == nil {
-			aiMessage, err := s.ollama.GenerateFinancialInsight(ctx, *analysis)
-			if err != nil {
-				log.Warn().Err(err).Msg("Failed to generate AI-enhanced weekly analysis, using fallback")
-			} else {
-				// Use AI-generated insights
-				analysis.Insights = []string{aiMessage}
+		// Try to enhance with AI if available
+		if s.ollama != nil {
+			if err := s.ollama.HealthCheck(); err == nil {
+				aiMessage, err := s.ollama.GenerateFinancialInsight(ctx, *analysis)
+				if err != nil {
+					log.Warn().Err(err).Msg("Failed to generate AI-enhanced weekly analysis, using fallback")
+				} else {
+					// Use AI-generated insights
+					analysis.Insights = []string{aiMessage}
+				}
 			}
 		}
-	}
 
-	if err := s.messaging.GenerateTrendNotification(ctx, analysis, s.chatIDs); err != nil {
-		log.Error().Err(err).Msg("Failed to send weekly analysis")
-	}
+		if err := s.messaging.GenerateTrendNotification(ctx, analysis, []int64{chatID}); err != nil {
+			log.Error().Err(err).Int64("chat_id", chatID).Msg("Failed to send weekly analysis")
+		}
+	})
 }
 
 // runHealthCheck runs health check
@@ -11,6 +11,7 @@ type FinancialData struct {
 	Incomes    float64            `json:"incomes"`
 	Balance    float64            `json:"balance"`
 	Categories map[string]float64 `json:"categories"`
+	Currency   string             `json:"currency"` // amounts are converted into it at each transaction's date rate
 }
 
 // ComparisonData represents comparison between periods
@@ -32,13 +33,16 @@ type ChangeData struct {
 
 // AnomalyData represents detected spending anomalies
 type AnomalyData struct {
-	Type        string  `json:"type"` // "high_spending", "unusual_category", "low_income"
-	Category    string  `json:"category"`
-	Amount      float64 `json:"amount"`
-	Average     float64 `json:"average"`
-	Multiplier  float64 `json:"multiplier"`
-	Description string  `json:"description"`
-	Severity    string  `json:"severity"` // "low", "medium", "high"
+	Type           string  `json:"type"` // "high_spending", "low_income", "unusual_category", "unusual_merchant", "large_transaction", "new_category", "duplicate_charge", "spending_creep"
+	Category       string  `json:"category"`
+	Merchant       string  `json:"merchant,omitempty"`
+	Amount         float64 `json:"amount"`
+	Average        float64 `json:"average"` // baseline median; the usual amount for a single transaction
+	Multiplier     float64 `json:"multiplier"`
+	Description    string  `json:"description"`
+	Severity       string  `json:"severity"`   // "low", "medium", "high"
+	Confidence     float64 `json:"confidence"` // 0.0 to 1.0
+	TransactionIDs []int   `json:"transaction_ids,omitempty"`
 }
 
 // TrendData represents spending trends
@@ -53,6 +57,7 @@ type TrendData struct {
 // AnalysisResult represents complete analysis result
 type AnalysisResult struct {
 	Period      string         `json:"period"`
+	Scope       string         `json:"scope"` // user, group or family
 	Data        FinancialData  `json:"data"`
 	Comparison  ComparisonData `json:"comparison"`
 	Anomalies   []AnomalyData  `json:"anomalies"`
@@ -93,11 +98,63 @@ type TelegramMessage struct {
 	ParseMode string `json:"parse_mode,omitempty"`
 }
 
+// ForecastValue is an amount so far in the period and its projection for the period end
+type ForecastValue struct {
+	Actual    float64 `json:"actual"`
+	Projected float64 `json:"projected"`
+	Low       float64 `json:"low"`  // lower bound of the confidence band
+	High      float64 `json:"high"` // upper bound of the confidence band
+}
+
+// CategoryForecast represents the projected spending of a category
+type CategoryForecast struct {
+	Category string `json:"category"`
+	ForecastValue
+	Recurring float64 `json:"recurring"` // known recurring charges still due in the period
+}
+
+// RecurringForecast represents an occurrence of a recurring transaction still due in the period
+type RecurringForecast struct {
+	Date        time.Time `json:"date"`
+	Type        string    `json:"type"` // "expense", "income"
+	Category    string    `json:"category"`
+	Description string    `json:"description"`
+	Amount      float64   `json:"amount"`
+}
+
+// RunwayData represents how long the balance lasts at the projected pace
+type RunwayData struct {
+	Days      int       `json:"days"`
+	Date      time.Time `json:"date"`       // the day the balance reaches zero
+	DailyBurn float64   `json:"daily_burn"` // expenses minus incomes per day
+}
+
+// ForecastResult represents the projection of the current period
+type ForecastResult struct {
+	Period          string              `json:"period"` // "month", "week"
+	Scope           string              `json:"scope"`
+	StartDate       time.Time           `json:"start_date"`
+	EndDate         time.Time           `json:"end_date"`
+	DaysElapsed     int                 `json:"days_elapsed"` // today included
+	DaysRemaining   int                 `json:"days_remaining"`
+	Currency        string              `json:"currency"`
+	ConfidenceLevel float64             `json:"confidence_level"` // of the low..high bands
+	Expenses        ForecastValue       `json:"expenses"`
+	Incomes         ForecastValue       `json:"incomes"` // known recurring incomes only, incomes are too irregular to extrapolate
+	Net             ForecastValue       `json:"net"`     // incomes minus expenses
+	Categories      []CategoryForecast  `json:"categories"`
+	Recurring       []RecurringForecast `json:"recurring"`
+	Balance         *ForecastValue      `json:"balance,omitempty"` // of the user's accounts, absent without accounts and for family and group scopes
+	Runway          *RunwayData         `json:"runway,omitempty"`  // absent when the balance does not run out
+	GeneratedAt     time.Time           `json:"generated_at"`
+}
+
 // HealthStatus represents service health status
 type HealthStatus struct {
 	Service   string    `json:"service"`
 	Status    string    `json:"status"` // "healthy", "unhealthy", "degraded"
 	Ollama    bool      `json:"ollama"`
+	Model     string    `json:"model,omitempty"` // the configured Ollama model
 	Database  bool      `json:"database"`
 	LastCheck time.Time `json:"last_check"`
 	Uptime    string    `json:"uptime"`
@@ -111,3 +168,37 @@ type ScheduledJob struct {
 	Prev     time.Time `json:"prev"`
 	Schedule string    `json:"schedule"`
 }
+
+// BudgetAlert represents a budget that crossed an alert threshold in its current period
+type BudgetAlert struct {
+	BudgetID     int       `json:"budget_id"`
+	Name         string    `json:"name"`
+	CategoryName string    `json:"category_name"`
+	GroupID      *int64    `json:"group_id"`    // group budgets alert the group chat
+	TelegramID   int64     `json:"telegram_id"` // personal budgets alert the owner
+	PeriodStart  time.Time `json:"period_start"`
+	PeriodEnd    time.Time `json:"period_end"`
+	LimitCents   int       `json:"limit_cents"` // including rollover
+	SpentCents   int       `json:"spent_cents"`
+	Currency     string    `json:"currency"`  // the budget owner's base currency
+	Threshold    int       `json:"threshold"` // 80 or 100 percent
+}
+
+// ChatID returns the chat the alert should be sent to
+func (a BudgetAlert) ChatID() int64 {
+	if a.GroupID != nil {
+		return *a.GroupID
+	}
+	return a.TelegramID
+}
+
+// currencySymbols are the signs of the currencies the family pays in
+var currencySymbols = map[string]string{"RUB": "₽", "USD": "$", "EUR": "€", "GEL": "₾"}
+
+// CurrencySymbol returns the sign of an ISO 4217 currency, or the code itself
+func CurrencySymbol(code string) string {
+	if symbol, ok := currencySymbols[code]; ok {
+		return symbol
+	}
+	return code
+}
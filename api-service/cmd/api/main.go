@@ -13,8 +13,11 @@ import (
 	"time"
 
 	"github.com/expense-tracker/api-service/internal/auth"
+	"github.com/expense-tracker/api-service/internal/currency"
 	"github.com/expense-tracker/api-service/internal/handlers"
 	"github.com/expense-tracker/api-service/internal/middleware"
+	"github.com/expense-tracker/api-service/internal/recurring"
+	"github.com/expense-tracker/api-service/internal/trash"
 	"github.com/go-chi/chi/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/zerolog/log"
@@ -43,6 +46,15 @@ func main() {
 	categoryHandlers := handlers.NewCategoryHandlers(pool)
 	debtHandlers := handlers.NewDebtHandlers(pool, a)
 	familyHandlers := handlers.NewFamilyHandlers(pool, a)
+	receiptHandlers := handlers.NewReceiptHandlers(pool, a)
+	budgetHandlers := handlers.NewBudgetHandlers(pool, a)
+	recurringHandlers := handlers.NewRecurringHandlers(pool, a)
+	importHandlers := handlers.NewImportHandlers(pool, a)
+	backupHandlers := handlers.NewBackupHandlers(pool, a)
+	merchantHandlers := handlers.NewMerchantHandlers(pool, a)
+	currencyHandlers := handlers.NewCurrencyHandlers(pool, a)
+	accountHandlers := handlers.NewAccountHandlers(pool, a)
+	analyticsHandlers := handlers.NewAnalyticsHandlers(pool, a)
 	internalHandlers := handlers.NewInternalHandlers(pool)
 
 	r := chi.NewRouter()
@@ -61,17 +73,28 @@ func main() {
 	r.Get("/categories", categoryHandlers.GetCategories)
 	r.Get("/api/categories", categoryHandlers.GetCategories)
 	r.Post("/categories/detect", categoryHandlers.DetectCategory)
-	
-	// TEMPORARY: Make transactions public for debugging
-	r.Get("/api/transactions", transactionHandlers.GetTransactions)
 
 	// Internal bot endpoints (protected by X-BOT-KEY header)
 	r.Post("/internal/expenses", internalHandlers.InternalPostExpense)
+	r.Post("/internal/expenses/shared", internalHandlers.InternalCreateSharedExpense)
 	r.Get("/internal/expenses/total", internalHandlers.InternalGetTotalExpenses)
 	r.Get("/internal/debts", internalHandlers.InternalGetDebts)
+	r.Post("/internal/debts/pay", internalHandlers.InternalPayDebts)
+	r.Get("/internal/groups/{id}/settle-plan", internalHandlers.InternalGetSettlePlan)
+	r.Get("/internal/recurring/upcoming", internalHandlers.InternalGetUpcomingRecurring)
+	r.HandleFunc("/internal/analytics/*", analyticsHandlers.InternalProxyAnalytics)
+	r.Get("/internal/transactions/export", internalHandlers.InternalExportTransactions)
+	r.Get("/internal/transactions/search", internalHandlers.InternalSearchTransactions)
+	r.Patch("/internal/transactions/{id}", internalHandlers.InternalUpdateTransaction)
 	r.Post("/internal/groups", internalHandlers.InternalRegisterGroup)
 	r.Post("/internal/group-members", internalHandlers.InternalRegisterGroupMember)
 	r.Get("/internal/users/by-username", internalHandlers.InternalGetUserByUsername)
+	r.Post("/internal/users/currency", internalHandlers.InternalSetBaseCurrency)
+	r.Post("/internal/receipts", internalHandlers.InternalCreateReceipt)
+	r.Get("/internal/receipts/{id}", internalHandlers.InternalGetReceipt)
+	r.Post("/internal/receipts/{id}/items/{itemID}/toggle", internalHandlers.InternalToggleReceiptItem)
+	r.Post("/internal/receipts/{id}/finalize", internalHandlers.InternalFinalizeReceipt)
+	r.Post("/internal/receipts/{id}/cancel", internalHandlers.InternalCancelReceipt)
 
 	// Protected routes with /api prefix
 	r.Route("/api", func(r chi.Router) {
@@ -91,9 +114,31 @@ func main() {
 		// Transactions endpoint (unified expenses/incomes)
 		r.Post("/transactions", transactionHandlers.CreateTransaction)
 		r.Get("/transactions", transactionHandlers.GetTransactions)
+		r.Get("/transactions/export", transactionHandlers.ExportTransactions)
+		r.Get("/transactions/search", transactionHandlers.SearchTransactions)
+		r.Post("/transactions/bulk", transactionHandlers.BulkTransactions)
+		r.Patch("/transactions/{id}", transactionHandlers.UpdateTransaction)
+		r.Get("/transactions/{id}/history", transactionHandlers.GetTransactionHistory)
 		r.Delete("/transactions/{id}", transactionHandlers.SoftDeleteTransaction)
 		r.Post("/transactions/{id}/restore", transactionHandlers.RestoreTransaction)
 		r.Get("/transactions/deleted", transactionHandlers.GetDeletedTransactions)
+		r.Delete("/transactions/deleted", transactionHandlers.EmptyTrash)
+		r.Delete("/transactions/{id}/permanent", transactionHandlers.PermanentDeleteTransaction)
+
+		// Accounts and transfers between them
+		r.Get("/accounts", accountHandlers.GetAccounts)
+		r.Post("/accounts", accountHandlers.CreateAccount)
+		r.Put("/accounts/{id}", accountHandlers.UpdateAccount)
+		r.Delete("/accounts/{id}", accountHandlers.DeleteAccount)
+		r.Post("/transfers", transactionHandlers.CreateTransfer)
+
+		// Merchants
+		r.Get("/merchants/top", merchantHandlers.GetTopMerchants)
+
+		// Currencies and exchange rates
+		r.Get("/currencies", currencyHandlers.GetCurrencies)
+		r.Put("/currencies/base", currencyHandlers.SetBaseCurrency)
+		r.Post("/exchange-rates", currencyHandlers.ImportExchangeRates)
 
 		// Categories CRUD
 		r.Post("/categories", categoryHandlers.CreateCategory)
@@ -111,74 +156,44 @@ func main() {
 
 		// Debts and balance
 		r.Get("/debts", debtHandlers.GetDebts)
+		r.Post("/debts/{id}/settle", debtHandlers.SettleDebt)
 		r.Get("/balance", debtHandlers.GetBalance)
 
+		// Budgets
+		r.Post("/budgets", budgetHandlers.CreateBudget)
+		r.Get("/budgets", budgetHandlers.GetBudgets)
+		r.Get("/budgets/status", budgetHandlers.GetBudgetStatus)
+		r.Put("/budgets/{id}", budgetHandlers.UpdateBudget)
+		r.Delete("/budgets/{id}", budgetHandlers.DeleteBudget)
+
+		// Recurring transactions
+		r.Post("/recurring", recurringHandlers.CreateRecurring)
+		r.Get("/recurring", recurringHandlers.GetRecurring)
+		r.Get("/recurring/upcoming", recurringHandlers.GetUpcomingRecurring)
+		r.Put("/recurring/{id}", recurringHandlers.UpdateRecurring)
+		r.Delete("/recurring/{id}", recurringHandlers.DeleteRecurring)
+
+		// Bank statement import
+		r.Post("/import", importHandlers.Import)
+		r.Get("/import/{id}", importHandlers.GetImport)
+		r.Post("/import/{id}/commit", importHandlers.CommitImport)
+		r.Delete("/import/{id}", importHandlers.CancelImport)
+
+		// Backup and restore
+		r.Get("/backup", backupHandlers.GetBackup)
+		r.Post("/backup/restore", backupHandlers.RestoreBackup)
+
+		// Receipt splitting
+		r.Get("/receipts/{id}", receiptHandlers.GetReceipt)
+		r.Post("/receipts/{id}/split", receiptHandlers.PreviewSplit)
+		r.Post("/receipts/{id}/finalize", receiptHandlers.FinalizeReceipt)
+
 		// Family/Groups endpoints
 		r.Get("/family/groups", familyHandlers.GetFamilyGroups)
+		r.Get("/family/groups/{id}/settle-plan", familyHandlers.GetSettlePlan)
 
-		// Analytics endpoints (proxy to analytics-service)
-		r.Get("/analytics/health", func(w http.ResponseWriter, r *http.Request) {
-			// Proxy to analytics-service
-			analyticsURL := os.Getenv("ANALYTICS_URL")
-			if analyticsURL == "" {
-				analyticsURL = "http://analytics:8081"
-			}
-
-			resp, err := http.Get(analyticsURL + "/health")
-			if err != nil {
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusServiceUnavailable)
-				json.NewEncoder(w).Encode(map[string]string{
-					"status":  "error",
-					"message": "Analytics service unavailable",
-				})
-				return
-			}
-			defer resp.Body.Close()
-
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(resp.StatusCode)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"status":        "ok",
-				"ollama_status": "available",
-				"model":         "llama2",
-			})
-		})
-
-		r.Post("/analytics/summary", func(w http.ResponseWriter, r *http.Request) {
-			// Proxy to analytics-service
-			analyticsURL := os.Getenv("ANALYTICS_URL")
-			if analyticsURL == "" {
-				analyticsURL = "http://analytics:8081"
-			}
-
-			// Forward the request
-			resp, err := http.Post(analyticsURL+"/summary", "application/json", r.Body)
-			if err != nil {
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusServiceUnavailable)
-				json.NewEncoder(w).Encode(map[string]string{
-					"status":  "error",
-					"message": "Analytics service unavailable",
-				})
-				return
-			}
-			defer resp.Body.Close()
-
-			// Copy response
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(resp.StatusCode)
-
-			var result map[string]interface{}
-			if err := json.NewDecoder(resp.Body).Decode(&result); err == nil {
-				json.NewEncoder(w).Encode(result)
-			} else {
-				json.NewEncoder(w).Encode(map[string]string{
-					"status":  "error",
-					"message": "Failed to parse analytics response",
-				})
-			}
-		})
+		// Analytics endpoints: everything of analytics-service /api/v1 as the authenticated user
+		r.HandleFunc("/analytics/*", analyticsHandlers.ProxyAnalytics)
 	})
 
 	// Public login endpoint (must be after protected routes to avoid conflicts)
@@ -201,6 +216,27 @@ func main() {
 		IdleTimeout:  120 * time.Second,
 	}
 
+	// Exchange rates: a file loaded at startup and/or a provider polled in the background
+	if path := os.Getenv("EXCHANGE_RATES_FILE"); path != "" {
+		if n, err := currency.LoadFile(ctx, pool, path); err != nil {
+			log.Error().Err(err).Str("file", path).Msg("load exchange rates")
+		} else {
+			log.Info().Int("rates", n).Str("file", path).Msg("loaded exchange rates")
+		}
+	}
+	provider, err := currency.ProviderFromEnv()
+	if err != nil {
+		log.Fatal().Err(err).Msg("exchange rates provider")
+	}
+	if provider != nil {
+		go (&currency.Updater{DB: pool, Provider: provider, Location: recurring.Calendar()}).Run(ctx, 6*time.Hour)
+	}
+
+	// Materialize due recurring transactions in the background
+	go recurring.NewMaterializer(pool).Run(ctx, 15*time.Minute)
+	// Purge transactions that stayed in the trash longer than TRASH_RETENTION_DAYS
+	go trash.NewPurger(pool).Run(ctx, time.Hour)
+
 	log.Info().Msg("api starting on :8080")
 	if err := srv.ListenAndServe(); err != nil {
 		log.Fatal().Err(err).Msg("server failed")
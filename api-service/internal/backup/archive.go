@@ -0,0 +1,398 @@
+// Package backup exports everything a user or a group owns as a versioned JSON archive
+// and restores such archives on another (or the same) installation.
+//
+// Users are identified by telegram_id and groups by their Telegram chat id, both stable across
+// installations; all other rows keep their source ids in the archive and get new ids on restore.
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// Format identifies backup archives
+	Format = "expense-tracker-backup"
+	// Version is the archive version written by Export; Restore reads versions 1..Version.
+	// Version 2: income ids are ids of expenses, incomes were folded into that table
+	Version = 2
+)
+
+// Archive scopes
+const (
+	ScopeUser  = "user"
+	ScopeGroup = "group"
+)
+
+var (
+	// ErrInvalidArchive is returned for archives that are malformed or reference missing rows
+	ErrInvalidArchive = errors.New("invalid backup archive")
+	// ErrUnsupportedVersion is returned for archives written by a newer version
+	ErrUnsupportedVersion = errors.New("unsupported backup archive version")
+	// ErrForbidden is returned when the caller may not restore the archive
+	ErrForbidden = errors.New("archive belongs to another user or group")
+)
+
+// Archive is the backup file
+type Archive struct {
+	Format          string    `json:"format"`
+	Version         int       `json:"version"`
+	Instance        string    `json:"instance"` // id of the installation that wrote the archive
+	CreatedAt       time.Time `json:"created_at"`
+	Scope           string    `json:"scope"`
+	OwnerTelegramID int64     `json:"owner_telegram_id,omitempty"` // user scope
+	GroupID         int64     `json:"group_id,omitempty"`          // group scope
+
+	Users         []User        `json:"users"`
+	Groups        []Group       `json:"groups"`
+	GroupMembers  []GroupMember `json:"group_members"`
+	Categories    []Category    `json:"categories"`
+	Subcategories []Subcategory `json:"subcategories"`
+	Accounts      []Account     `json:"accounts"` // absent in archives made before accounts
+	Expenses      []Expense     `json:"expenses"`
+	Receipts      []Receipt     `json:"receipts"`
+	Debts         []Debt        `json:"debts"`
+	Incomes       []Income      `json:"incomes"`
+	DebtPayments  []DebtPayment `json:"debt_payments"`
+}
+
+// User is identified by telegram_id on every installation
+type User struct {
+	TelegramID int64  `json:"telegram_id"`
+	Username   string `json:"username,omitempty"`
+}
+
+// Group is a Telegram group chat
+type Group struct {
+	ID   int64  `json:"id"` // Telegram chat id
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// GroupMember is a membership of a user in a group
+type GroupMember struct {
+	GroupID    int64     `json:"group_id"`
+	TelegramID int64     `json:"telegram_id"`
+	Role       string    `json:"role"`
+	JoinedAt   time.Time `json:"joined_at"`
+}
+
+// Category is matched by name on restore
+type Category struct {
+	ID      int      `json:"id"`
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases"`
+}
+
+// Subcategory is matched by name within its category on restore
+type Subcategory struct {
+	ID         int      `json:"id"`
+	CategoryID int      `json:"category_id"`
+	Name       string   `json:"name"`
+	Aliases    []string `json:"aliases"`
+}
+
+// Account is a wallet, card or savings account; it is matched by name within its user on restore
+type Account struct {
+	ID                  int    `json:"id"`
+	TelegramID          int64  `json:"telegram_id"`
+	Name                string `json:"name"`
+	Type                string `json:"type"`
+	Currency            string `json:"currency"`
+	OpeningBalanceCents int64  `json:"opening_balance_cents"`
+	IsArchived          bool   `json:"is_archived"`
+}
+
+// Expense is a row of expenses; operation_type tells expenses, incomes and transfer legs apart
+type Expense struct {
+	ID            int        `json:"id"`
+	TelegramID    int64      `json:"telegram_id"`
+	AmountCents   int        `json:"amount_cents"`
+	Currency      string     `json:"currency"` // empty in archives made before currencies
+	OperationType string     `json:"operation_type"`
+	CategoryID    *int       `json:"category_id"`
+	SubcategoryID *int       `json:"subcategory_id"`
+	Timestamp     time.Time  `json:"timestamp"`
+	IsShared      bool       `json:"is_shared"`
+	GroupID       *int64     `json:"group_id"`
+	IsPrivate     bool       `json:"is_private"`
+	Description   *string    `json:"description"`
+	Merchant      *string    `json:"merchant"`
+	ExternalID    *string    `json:"external_id"`
+	DeletedAt     *time.Time `json:"deleted_at"`
+	AccountID     *int       `json:"account_id"`
+	TransferID    *int64     `json:"transfer_id"`  // shared by the two legs of a transfer
+	TransferLeg   *string    `json:"transfer_leg"` // "debit" or "credit"
+}
+
+// Receipt is a scanned receipt with its items
+type Receipt struct {
+	ID              int           `json:"id"`
+	OwnerTelegramID int64         `json:"owner_telegram_id"`
+	Merchant        *string       `json:"merchant"`
+	ReceiptDate     *time.Time    `json:"receipt_date"`
+	TotalCents      *int          `json:"total_cents"`
+	TaxCents        int           `json:"tax_cents"`
+	FiscalFN        *string       `json:"fiscal_fn"`
+	FiscalFD        *string       `json:"fiscal_fd"`
+	FiscalFP        *string       `json:"fiscal_fp"`
+	GroupID         *int64        `json:"group_id"`
+	Status          string        `json:"status"`
+	ExpenseID       *int          `json:"expense_id"`
+	CreatedAt       time.Time     `json:"created_at"`
+	FinalizedAt     *time.Time    `json:"finalized_at"`
+	Items           []ReceiptItem `json:"items"`
+}
+
+// ReceiptItem is a line of a receipt
+type ReceiptItem struct {
+	ID         int     `json:"id"`
+	Name       string  `json:"name"`
+	PriceCents int     `json:"price_cents"`
+	Quantity   float64 `json:"quantity"`
+	SelectedBy []int64 `json:"selected_by"` // telegram ids
+}
+
+// Debt is owed by FromTelegramID to ToTelegramID
+type Debt struct {
+	ID             int        `json:"id"`
+	FromTelegramID int64      `json:"from_telegram_id"`
+	ToTelegramID   int64      `json:"to_telegram_id"`
+	AmountCents    int        `json:"amount_cents"`
+	CreatedAt      time.Time  `json:"created_at"`
+	IsPaid         bool       `json:"is_paid"`
+	PaidAt         *time.Time `json:"paid_at"`
+	ReceiptID      *int       `json:"receipt_id"`
+}
+
+// Income is an income with an income type, e.g. a repaid debt. Incomes entered as transactions
+// have no type and are archived as expenses.
+type Income struct {
+	ID            int       `json:"id"`
+	TelegramID    int64     `json:"telegram_id"`
+	AmountCents   int       `json:"amount_cents"`
+	Currency      string    `json:"currency"`
+	IncomeType    string    `json:"income_type"`
+	Description   *string   `json:"description"`
+	RelatedDebtID *int      `json:"related_debt_id"`
+	Timestamp     time.Time `json:"timestamp"`
+	GroupID       *int64    `json:"group_id"`
+	IsPrivate     bool      `json:"is_private"`
+	AccountID     *int      `json:"account_id"`
+}
+
+// DebtPayment is a (partial) repayment of a debt
+type DebtPayment struct {
+	ID                   int       `json:"id"`
+	DebtID               int       `json:"debt_id"`
+	AmountCents          int       `json:"amount_cents"`
+	RecordedByTelegramID *int64    `json:"recorded_by_telegram_id"`
+	IncomeID             *int      `json:"income_id"`
+	Note                 *string   `json:"note"`
+	PaidAt               time.Time `json:"paid_at"`
+}
+
+// Validate checks the header and that every reference points to a row of the archive
+func (a *Archive) Validate() error {
+	if a.Format != Format {
+		return fmt.Errorf("%w: format must be %q", ErrInvalidArchive, Format)
+	}
+	if a.Version < 1 || a.Version > Version {
+		return fmt.Errorf("%w %d, this installation reads up to %d", ErrUnsupportedVersion, a.Version, Version)
+	}
+	if a.Instance == "" {
+		return fmt.Errorf("%w: instance is required", ErrInvalidArchive)
+	}
+	switch {
+	case a.Scope == ScopeUser && a.OwnerTelegramID != 0:
+	case a.Scope == ScopeGroup && a.GroupID != 0:
+	default:
+		return fmt.Errorf("%w: scope must be user with owner_telegram_id or group with group_id", ErrInvalidArchive)
+	}
+
+	users := make(map[int64]bool)
+	for _, u := range a.Users {
+		users[u.TelegramID] = true
+	}
+	groups := make(map[int64]bool)
+	for _, g := range a.Groups {
+		groups[g.ID] = true
+	}
+	categories := make(map[int]bool)
+	for _, c := range a.Categories {
+		if c.Name == "" {
+			return fmt.Errorf("%w: category %d has no name", ErrInvalidArchive, c.ID)
+		}
+		categories[c.ID] = true
+	}
+	subcategories := make(map[int]bool)
+	for _, s := range a.Subcategories {
+		if s.Name == "" || !categories[s.CategoryID] {
+			return fmt.Errorf("%w: subcategory %d", ErrInvalidArchive, s.ID)
+		}
+		subcategories[s.ID] = true
+	}
+
+	var bad []string
+	check := func(ok bool, what string, id int) {
+		if !ok {
+			bad = append(bad, fmt.Sprintf("%s %d", what, id))
+		}
+	}
+	optionalGroup := func(id *int64) bool { return id == nil || groups[*id] }
+
+	if a.Scope == ScopeUser {
+		check(users[a.OwnerTelegramID], "owner", 0)
+	} else {
+		check(groups[a.GroupID], "group", 0)
+	}
+	for _, m := range a.GroupMembers {
+		check(groups[m.GroupID] && users[m.TelegramID], "group member of group", int(m.GroupID))
+	}
+	accounts := make(map[int]int64) // id -> owner
+	for _, acc := range a.Accounts {
+		check(users[acc.TelegramID] && acc.Name != "" && acc.Type != "", "account", acc.ID)
+		accounts[acc.ID] = acc.TelegramID
+	}
+	// An account must belong to the user of the row
+	ownAccount := func(id *int, telegramID int64) bool {
+		if id == nil {
+			return true
+		}
+		owner, ok := accounts[*id]
+		return ok && owner == telegramID
+	}
+	expenses := make(map[int]bool)
+	legs := make(map[int64][]string)
+	for _, e := range a.Expenses {
+		transfer := e.OperationType == "transfer"
+		check(users[e.TelegramID] && e.AmountCents > 0 && optionalGroup(e.GroupID) &&
+			(e.CategoryID == nil || categories[*e.CategoryID]) && (e.SubcategoryID == nil || subcategories[*e.SubcategoryID]) &&
+			ownAccount(e.AccountID, e.TelegramID) &&
+			transfer == (e.TransferID != nil) && transfer == (e.TransferLeg != nil) && (!transfer || e.AccountID != nil),
+			"expense", e.ID)
+		if e.TransferID != nil && e.TransferLeg != nil {
+			legs[*e.TransferID] = append(legs[*e.TransferID], *e.TransferLeg)
+		}
+		expenses[e.ID] = true
+	}
+	for _, transferID := range keys(legs) {
+		l := legs[transferID]
+		check(len(l) == 2 && l[0] != l[1], "transfer", int(transferID))
+	}
+	receipts := make(map[int]bool)
+	for _, r := range a.Receipts {
+		check(users[r.OwnerTelegramID] && optionalGroup(r.GroupID) && (r.ExpenseID == nil || expenses[*r.ExpenseID]), "receipt", r.ID)
+		receipts[r.ID] = true
+	}
+	debts := make(map[int]bool)
+	for _, d := range a.Debts {
+		check(users[d.FromTelegramID] && users[d.ToTelegramID] && d.FromTelegramID != d.ToTelegramID && d.AmountCents > 0 &&
+			(d.ReceiptID == nil || receipts[*d.ReceiptID]), "debt", d.ID)
+		debts[d.ID] = true
+	}
+	incomes := make(map[int]bool)
+	for _, i := range a.Incomes {
+		check(users[i.TelegramID] && i.AmountCents > 0 && optionalGroup(i.GroupID) &&
+			(i.RelatedDebtID == nil || debts[*i.RelatedDebtID]) && ownAccount(i.AccountID, i.TelegramID), "income", i.ID)
+		incomes[i.ID] = true
+	}
+	for _, p := range a.DebtPayments {
+		check(debts[p.DebtID] && p.AmountCents > 0 && (p.IncomeID == nil || incomes[*p.IncomeID]) &&
+			(p.RecordedByTelegramID == nil || users[*p.RecordedByTelegramID]), "debt payment", p.ID)
+	}
+
+	if len(bad) > 0 {
+		if len(bad) > 5 {
+			bad = append(bad[:5], fmt.Sprintf("and %d more", len(bad)-5))
+		}
+		return fmt.Errorf("%w: broken rows: %v", ErrInvalidArchive, bad)
+	}
+	return nil
+}
+
+// authorize checks that the caller may restore the archive and that it holds only rows the caller may
+// write. A user archive must be the caller's and hold only the caller's rows, debts the caller is a party
+// of and the caller's group memberships. A group archive must list the caller as a member of its group
+// and hold only rows of that group and its members. Validate must have passed.
+func (a *Archive) authorize(callerTelegramID int64) error {
+	owners := a.owners(callerTelegramID)
+	if !owners[callerTelegramID] {
+		return ErrForbidden
+	}
+	// A row of a user archive may be in any group of the archive, Restore checks the caller may write
+	// into it; a row of a group archive must be in the group
+	inScope := func(groupID *int64) bool {
+		return a.Scope == ScopeUser || (groupID != nil && *groupID == a.GroupID)
+	}
+
+	var bad []string
+	check := func(ok bool, what string, id int) {
+		if !ok {
+			bad = append(bad, fmt.Sprintf("%s %d", what, id))
+		}
+	}
+	for _, g := range a.Groups {
+		check(a.Scope == ScopeUser || g.ID == a.GroupID, "group", int(g.ID))
+	}
+	for _, m := range a.GroupMembers {
+		if a.Scope == ScopeUser {
+			check(m.TelegramID == callerTelegramID, "group member of group", int(m.GroupID))
+		} else {
+			check(m.GroupID == a.GroupID, "group member of group", int(m.GroupID))
+		}
+	}
+	for _, acc := range a.Accounts {
+		check(owners[acc.TelegramID], "account", acc.ID)
+	}
+	for _, e := range a.Expenses {
+		check(owners[e.TelegramID] && inScope(e.GroupID), "expense", e.ID)
+	}
+	for _, r := range a.Receipts {
+		check(owners[r.OwnerTelegramID] && inScope(r.GroupID), "receipt", r.ID)
+	}
+	parties := make(map[int][2]int64) // debt id -> from, to
+	for _, d := range a.Debts {
+		if a.Scope == ScopeUser {
+			check(d.FromTelegramID == callerTelegramID || d.ToTelegramID == callerTelegramID, "debt", d.ID)
+		} else {
+			check(owners[d.FromTelegramID] && owners[d.ToTelegramID], "debt", d.ID)
+		}
+		parties[d.ID] = [2]int64{d.FromTelegramID, d.ToTelegramID}
+	}
+	for _, i := range a.Incomes {
+		check(owners[i.TelegramID] && inScope(i.GroupID), "income", i.ID)
+	}
+	for _, p := range a.DebtPayments {
+		party := parties[p.DebtID]
+		recordedBy := p.RecordedByTelegramID
+		check(recordedBy == nil || owners[*recordedBy] || *recordedBy == party[0] || *recordedBy == party[1], "debt payment", p.ID)
+	}
+
+	if len(bad) > 0 {
+		if len(bad) > 5 {
+			bad = append(bad[:5], fmt.Sprintf("and %d more", len(bad)-5))
+		}
+		return fmt.Errorf("%w: rows of other users or groups: %v", ErrForbidden, bad)
+	}
+	return nil
+}
+
+// owners returns the users whose rows the archive may hold: the caller for a user archive of the
+// caller, the members of the group for a group archive
+func (a *Archive) owners(callerTelegramID int64) map[int64]bool {
+	owners := make(map[int64]bool)
+	if a.Scope == ScopeUser {
+		if a.OwnerTelegramID == callerTelegramID {
+			owners[callerTelegramID] = true
+		}
+		return owners
+	}
+	for _, m := range a.GroupMembers {
+		if m.GroupID == a.GroupID {
+			owners[m.TelegramID] = true
+		}
+	}
+	return owners
+}
@@ -0,0 +1,181 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func intPtr(v int) *int { return &v }
+
+func int64Ptr(v int64) *int64 { return &v }
+
+func strPtr(v string) *string { return &v }
+
+func groupArchive() *Archive {
+	groupID := int64(-100123)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	return &Archive{
+		Format: Format, Version: Version, Instance: "6f1c2b1e-0000-4000-8000-000000000001", CreatedAt: now,
+		Scope: ScopeGroup, GroupID: groupID,
+		Users:        []User{{TelegramID: 1, Username: "anna"}, {TelegramID: 2, Username: "boris"}},
+		Groups:       []Group{{ID: groupID, Name: "Семья", Type: "group"}},
+		GroupMembers: []GroupMember{{GroupID: groupID, TelegramID: 1, Role: "admin"}, {GroupID: groupID, TelegramID: 2, Role: "member"}},
+		Categories:   []Category{{ID: 1, Name: "Еда", Aliases: []string{"еда"}}},
+		Subcategories: []Subcategory{
+			{ID: 7, CategoryID: 1, Name: "Кафе"},
+		},
+		Accounts: []Account{
+			{ID: 20, TelegramID: 1, Name: "Наличные", Type: "cash", Currency: "RUB"},
+			{ID: 21, TelegramID: 1, Name: "Карта", Type: "debit_card", Currency: "RUB"},
+		},
+		Expenses: []Expense{
+			{ID: 10, TelegramID: 1, AmountCents: 50000, OperationType: "expense", CategoryID: intPtr(1), SubcategoryID: intPtr(7),
+				Timestamp: now, GroupID: &groupID, AccountID: intPtr(21)},
+			{ID: 11, TelegramID: 1, AmountCents: 300000, OperationType: "transfer", Timestamp: now, GroupID: &groupID,
+				AccountID: intPtr(21), TransferID: int64Ptr(5), TransferLeg: strPtr("debit")},
+			{ID: 12, TelegramID: 1, AmountCents: 300000, OperationType: "transfer", Timestamp: now, GroupID: &groupID,
+				AccountID: intPtr(20), TransferID: int64Ptr(5), TransferLeg: strPtr("credit")},
+		},
+		Receipts: []Receipt{{ID: 3, OwnerTelegramID: 1, GroupID: &groupID, Status: "finalized", ExpenseID: intPtr(10),
+			Items: []ReceiptItem{{ID: 5, Name: "Пицца", PriceCents: 50000, Quantity: 1, SelectedBy: []int64{1, 2}}}}},
+		Debts: []Debt{{ID: 4, FromTelegramID: 2, ToTelegramID: 1, AmountCents: 25000, ReceiptID: intPtr(3)}},
+		Incomes: []Income{{ID: 8, TelegramID: 1, AmountCents: 10000, IncomeType: "debt_return", RelatedDebtID: intPtr(4),
+			Timestamp: now, GroupID: &groupID}},
+		DebtPayments: []DebtPayment{{ID: 9, DebtID: 4, AmountCents: 10000, IncomeID: intPtr(8), PaidAt: now}},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(a *Archive)
+		want   error
+	}{
+		{name: "valid", modify: func(a *Archive) {}},
+		{name: "wrong format", modify: func(a *Archive) { a.Format = "something" }, want: ErrInvalidArchive},
+		{name: "newer version", modify: func(a *Archive) { a.Version = Version + 1 }, want: ErrUnsupportedVersion},
+		{name: "no instance", modify: func(a *Archive) { a.Instance = "" }, want: ErrInvalidArchive},
+		{name: "user scope without owner", modify: func(a *Archive) { a.Scope = ScopeUser }, want: ErrInvalidArchive},
+		{name: "group not in archive", modify: func(a *Archive) { a.Groups = nil }, want: ErrInvalidArchive},
+		{name: "unknown user", modify: func(a *Archive) { a.Expenses[0].TelegramID = 3 }, want: ErrInvalidArchive},
+		{name: "unknown subcategory", modify: func(a *Archive) { a.Expenses[0].SubcategoryID = intPtr(8) }, want: ErrInvalidArchive},
+		{name: "subcategory of unknown category", modify: func(a *Archive) { a.Subcategories[0].CategoryID = 2 }, want: ErrInvalidArchive},
+		{name: "receipt of unknown expense", modify: func(a *Archive) { a.Receipts[0].ExpenseID = intPtr(13) }, want: ErrInvalidArchive},
+		{name: "account of another user", modify: func(a *Archive) { a.Accounts[1].TelegramID = 2 }, want: ErrInvalidArchive},
+		{name: "unknown account", modify: func(a *Archive) { a.Incomes[0].AccountID = intPtr(22) }, want: ErrInvalidArchive},
+		{name: "transfer without account", modify: func(a *Archive) { a.Expenses[1].AccountID = nil }, want: ErrInvalidArchive},
+		{name: "transfer leg missing", modify: func(a *Archive) { a.Expenses = a.Expenses[:2] }, want: ErrInvalidArchive},
+		{name: "transfer legs alike", modify: func(a *Archive) { a.Expenses[2].TransferLeg = strPtr("debit") }, want: ErrInvalidArchive},
+		{name: "debt to self", modify: func(a *Archive) { a.Debts[0].ToTelegramID = 2 }, want: ErrInvalidArchive},
+		{name: "payment of unknown debt", modify: func(a *Archive) { a.DebtPayments[0].DebtID = 5 }, want: ErrInvalidArchive},
+		{name: "negative amount", modify: func(a *Archive) { a.Incomes[0].AmountCents = -1 }, want: ErrInvalidArchive},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := groupArchive()
+			tt.modify(a)
+			err := a.Validate()
+			if tt.want == nil && err != nil {
+				t.Fatalf("Validate() = %v, want nil", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("Validate() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAfterJSONRoundTrip(t *testing.T) {
+	data, err := json.Marshal(groupArchive())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var a Archive
+	if err := json.Unmarshal(data, &a); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Validate(); err != nil {
+		t.Fatalf("Validate() = %v", err)
+	}
+	if got := a.Receipts[0].Items[0].SelectedBy; len(got) != 2 {
+		t.Errorf("selected_by = %v, want two users", got)
+	}
+}
+
+// userArchive is the archive of user 1: the rows of groupArchive without the membership of user 2
+func userArchive() *Archive {
+	a := groupArchive()
+	a.Scope, a.OwnerTelegramID, a.GroupID = ScopeUser, 1, 0
+	a.GroupMembers = a.GroupMembers[:1]
+	return a
+}
+
+func TestAuthorize(t *testing.T) {
+	tests := []struct {
+		name    string
+		archive func() *Archive
+		modify  func(a *Archive)
+		caller  int64
+		want    error
+	}{
+		{name: "group member", archive: groupArchive, caller: 2},
+		{name: "not a group member", archive: groupArchive, caller: 3, want: ErrForbidden},
+		{name: "owner", archive: userArchive, caller: 1},
+		{name: "another user", archive: userArchive, caller: 2, want: ErrForbidden},
+
+		// Forged user archives: rows of other users
+		{name: "expense of another user", archive: userArchive, caller: 1,
+			modify: func(a *Archive) { a.Expenses[0].TelegramID, a.Expenses[0].AccountID = 2, nil }, want: ErrForbidden},
+		{name: "income of another user", archive: userArchive, caller: 1,
+			modify: func(a *Archive) { a.Incomes[0].TelegramID = 2 }, want: ErrForbidden},
+		{name: "membership of another user", archive: userArchive, caller: 1,
+			modify: func(a *Archive) { a.GroupMembers = groupArchive().GroupMembers }, want: ErrForbidden},
+		{name: "debt between other users", archive: userArchive, caller: 1,
+			modify: func(a *Archive) {
+				a.Users = append(a.Users, User{TelegramID: 3})
+				a.Debts[0].ToTelegramID = 3
+			}, want: ErrForbidden},
+		{name: "payment recorded by a stranger", archive: userArchive, caller: 1,
+			modify: func(a *Archive) {
+				a.Users = append(a.Users, User{TelegramID: 3})
+				a.DebtPayments[0].RecordedByTelegramID = int64Ptr(3)
+			}, want: ErrForbidden},
+
+		// Forged group archives: rows outside the group or its members
+		{name: "another group", archive: groupArchive, caller: 1,
+			modify: func(a *Archive) { a.Groups = append(a.Groups, Group{ID: -100999, Type: "group"}) }, want: ErrForbidden},
+		{name: "membership in another group", archive: groupArchive, caller: 1,
+			modify: func(a *Archive) {
+				a.Groups = append(a.Groups, Group{ID: -100999, Type: "group"})
+				a.GroupMembers = append(a.GroupMembers, GroupMember{GroupID: -100999, TelegramID: 1})
+			}, want: ErrForbidden},
+		{name: "personal expense", archive: groupArchive, caller: 1,
+			modify: func(a *Archive) { a.Expenses[0].GroupID = nil }, want: ErrForbidden},
+		{name: "income of a non-member", archive: groupArchive, caller: 1,
+			modify: func(a *Archive) {
+				a.Users = append(a.Users, User{TelegramID: 3})
+				a.Incomes[0].TelegramID = 3
+			}, want: ErrForbidden},
+		{name: "debt of a non-member", archive: groupArchive, caller: 1,
+			modify: func(a *Archive) {
+				a.Users = append(a.Users, User{TelegramID: 3})
+				a.Debts[0].FromTelegramID = 3
+			}, want: ErrForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := tt.archive()
+			if tt.modify != nil {
+				tt.modify(a)
+			}
+			if err := a.Validate(); err != nil {
+				t.Fatalf("Validate() = %v, the forged archive must be consistent", err)
+			}
+			if err := a.authorize(tt.caller); !errors.Is(err, tt.want) {
+				t.Errorf("authorize(%d) = %v, want %v", tt.caller, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,443 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// InstanceID returns the id of this installation, written into archives to recognize restores of the same data
+func InstanceID(ctx context.Context, db interface {
+	QueryRow(context.Context, string, ...any) pgx.Row
+}) (string, error) {
+	var id string
+	err := db.QueryRow(ctx, "SELECT instance_id::text FROM instance_info").Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", errors.New("instance_info is empty, apply migration 011")
+	}
+	return id, err
+}
+
+// exporter collects the rows of an archive and the users they reference
+type exporter struct {
+	db       *pgxpool.Pool
+	archive  *Archive
+	users    map[int64]bool
+	groups   map[int64]bool
+	catIDs   map[int]bool
+	subIDs   map[int]bool
+	debtIDs  []int
+	incomeID map[int]bool
+	accounts map[int]bool
+}
+
+// ExportUser exports the rows of a user (internal users.id): own accounts, expenses, incomes and receipts,
+// debts in both directions with their payments, and group memberships. Restore accepts only the
+// user's own rows, so rows of other users are left out.
+func ExportUser(ctx context.Context, db *pgxpool.Pool, userID int64) (*Archive, error) {
+	e, err := newExporter(ctx, db, ScopeUser)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.QueryRow(ctx, "SELECT telegram_id FROM users WHERE id = $1", userID).Scan(&e.archive.OwnerTelegramID); err != nil {
+		return nil, err
+	}
+	e.users[e.archive.OwnerTelegramID] = true
+
+	steps := []func() error{
+		func() error { return e.members(ctx, "gm.user_id = $1", e.archive.OwnerTelegramID) },
+		func() error { return e.expenses(ctx, "e.user_id = $1 AND e.income_type IS NULL", userID) },
+		func() error { return e.receipts(ctx, "r.owner_id = $1", userID) },
+		func() error { return e.debts(ctx, "d.from_user = $1 OR d.to_user = $1", userID) },
+		// Repayments the other party received are theirs, only the payments are exported
+		func() error { return e.incomes(ctx, "e.user_id = $1", userID) },
+		func() error { return e.accountRows(ctx, "a.user_id = $1 OR a.id = ANY($2)", userID, keys(e.accounts)) },
+	}
+	return e.run(ctx, steps)
+}
+
+// ExportGroup exports the rows of a group: its members, their expenses, incomes and receipts in the group,
+// and the debts between its members with their payments
+func ExportGroup(ctx context.Context, db *pgxpool.Pool, groupID int64) (*Archive, error) {
+	e, err := newExporter(ctx, db, ScopeGroup)
+	if err != nil {
+		return nil, err
+	}
+	e.archive.GroupID = groupID
+
+	// Rows of users who left the group stay out, a group archive holds only rows of its members
+	member := func(column string) string {
+		return `EXISTS (SELECT 1 FROM group_members gm JOIN users u ON u.telegram_id = gm.user_id
+			WHERE gm.group_id = $1 AND u.id = ` + column + `)`
+	}
+	steps := []func() error{
+		func() error { return e.members(ctx, "gm.group_id = $1", groupID) },
+		func() error {
+			return e.expenses(ctx, "e.group_id = $1 AND e.income_type IS NULL AND "+member("e.user_id"), groupID)
+		},
+		func() error { return e.receipts(ctx, "r.group_id = $1 AND "+member("r.owner_id"), groupID) },
+		func() error { return e.debts(ctx, member("d.from_user")+" AND "+member("d.to_user"), groupID) },
+		func() error { return e.incomes(ctx, "e.group_id = $1 AND "+member("e.user_id"), groupID) },
+		func() error { return e.accountRows(ctx, "a.id = ANY($1)", keys(e.accounts)) },
+	}
+	return e.run(ctx, steps)
+}
+
+func newExporter(ctx context.Context, db *pgxpool.Pool, scope string) (*exporter, error) {
+	instance, err := InstanceID(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	return &exporter{
+		db: db,
+		archive: &Archive{
+			Format: Format, Version: Version, Instance: instance, CreatedAt: time.Now().UTC(), Scope: scope,
+			Users: []User{}, Groups: []Group{}, GroupMembers: []GroupMember{}, Categories: []Category{}, Subcategories: []Subcategory{},
+			Accounts: []Account{}, Expenses: []Expense{}, Receipts: []Receipt{}, Debts: []Debt{}, Incomes: []Income{}, DebtPayments: []DebtPayment{},
+		},
+		users:    make(map[int64]bool),
+		groups:   make(map[int64]bool),
+		catIDs:   make(map[int]bool),
+		subIDs:   make(map[int]bool),
+		incomeID: make(map[int]bool),
+		accounts: make(map[int]bool),
+	}, nil
+}
+
+// run executes the scope's steps, then adds payments and the referenced groups, categories and users
+func (e *exporter) run(ctx context.Context, steps []func() error) (*Archive, error) {
+	steps = append(steps,
+		func() error { return e.payments(ctx) },
+		func() error { return e.groupRows(ctx) },
+		func() error { return e.categories(ctx) },
+		func() error { return e.userRows(ctx) },
+	)
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return nil, err
+		}
+	}
+	return e.archive, nil
+}
+
+func (e *exporter) members(ctx context.Context, where string, args ...any) error {
+	rows, err := e.db.Query(ctx, `
+		SELECT gm.group_id, gm.user_id, COALESCE(gm.role, 'member'), COALESCE(gm.joined_at, NOW())
+		FROM group_members gm WHERE `+where+` ORDER BY gm.id`, args...)
+	if err != nil {
+		return err
+	}
+	return collect(rows, func(row pgx.Rows) error {
+		var m GroupMember
+		if err := row.Scan(&m.GroupID, &m.TelegramID, &m.Role, &m.JoinedAt); err != nil {
+			return err
+		}
+		e.users[m.TelegramID] = true
+		e.groups[m.GroupID] = true
+		e.archive.GroupMembers = append(e.archive.GroupMembers, m)
+		return nil
+	})
+}
+
+func (e *exporter) expenses(ctx context.Context, where string, args ...any) error {
+	rows, err := e.db.Query(ctx, `
+		SELECT e.id, u.telegram_id, e.amount_cents, e.currency, COALESCE(e.operation_type, 'expense'), e.category_id, e.subcategory_id,
+			COALESCE(e.timestamp, NOW()), COALESCE(e.is_shared, false), e.group_id, COALESCE(e.is_private, false),
+			e.description, m.name, e.external_id, e.deleted_at, e.account_id, e.transfer_id, e.transfer_leg
+		FROM expenses e JOIN users u ON u.id = e.user_id LEFT JOIN merchants m ON m.id = e.merchant_id
+		WHERE `+where+` ORDER BY e.id`, args...)
+	if err != nil {
+		return err
+	}
+	return collect(rows, func(row pgx.Rows) error {
+		var x Expense
+		if err := row.Scan(&x.ID, &x.TelegramID, &x.AmountCents, &x.Currency, &x.OperationType, &x.CategoryID, &x.SubcategoryID,
+			&x.Timestamp, &x.IsShared, &x.GroupID, &x.IsPrivate, &x.Description, &x.Merchant, &x.ExternalID, &x.DeletedAt,
+			&x.AccountID, &x.TransferID, &x.TransferLeg); err != nil {
+			return err
+		}
+		e.users[x.TelegramID] = true
+		e.addAccount(x.AccountID)
+		e.addGroup(x.GroupID)
+		if x.CategoryID != nil {
+			e.catIDs[*x.CategoryID] = true
+		}
+		if x.SubcategoryID != nil {
+			e.subIDs[*x.SubcategoryID] = true
+		}
+		e.archive.Expenses = append(e.archive.Expenses, x)
+		return nil
+	})
+}
+
+func (e *exporter) receipts(ctx context.Context, where string, args ...any) error {
+	rows, err := e.db.Query(ctx, `
+		SELECT r.id, u.telegram_id, r.merchant, r.receipt_date, r.total_cents, r.tax_cents, r.fiscal_fn, r.fiscal_fd, r.fiscal_fp,
+			r.group_id, r.status, r.expense_id, COALESCE(r.created_at, NOW()), r.finalized_at
+		FROM receipts r JOIN users u ON u.id = r.owner_id
+		WHERE `+where+` ORDER BY r.id`, args...)
+	if err != nil {
+		return err
+	}
+	index := make(map[int]int)
+	err = collect(rows, func(row pgx.Rows) error {
+		x := Receipt{Items: []ReceiptItem{}}
+		if err := row.Scan(&x.ID, &x.OwnerTelegramID, &x.Merchant, &x.ReceiptDate, &x.TotalCents, &x.TaxCents, &x.FiscalFN, &x.FiscalFD, &x.FiscalFP,
+			&x.GroupID, &x.Status, &x.ExpenseID, &x.CreatedAt, &x.FinalizedAt); err != nil {
+			return err
+		}
+		e.users[x.OwnerTelegramID] = true
+		e.addGroup(x.GroupID)
+		index[x.ID] = len(e.archive.Receipts)
+		e.archive.Receipts = append(e.archive.Receipts, x)
+		return nil
+	})
+	if err != nil || len(index) == 0 {
+		return err
+	}
+
+	// Keep only links to expenses of the archive
+	expenses := make(map[int]bool, len(e.archive.Expenses))
+	for _, x := range e.archive.Expenses {
+		expenses[x.ID] = true
+	}
+	ids := make([]int, 0, len(index))
+	for id, i := range index {
+		ids = append(ids, id)
+		if r := &e.archive.Receipts[i]; r.ExpenseID != nil && !expenses[*r.ExpenseID] {
+			r.ExpenseID = nil
+		}
+	}
+
+	rows, err = e.db.Query(ctx, `
+		SELECT id, receipt_id, COALESCE(name, ''), COALESCE(price_cents, 0), quantity, COALESCE(selected_by, '[]')
+		FROM receipt_items WHERE receipt_id = ANY($1) ORDER BY id`, ids)
+	if err != nil {
+		return err
+	}
+	return collect(rows, func(row pgx.Rows) error {
+		var item ReceiptItem
+		var receiptID int
+		if err := row.Scan(&item.ID, &receiptID, &item.Name, &item.PriceCents, &item.Quantity, &item.SelectedBy); err != nil {
+			return err
+		}
+		r := &e.archive.Receipts[index[receiptID]]
+		r.Items = append(r.Items, item)
+		return nil
+	})
+}
+
+func (e *exporter) debts(ctx context.Context, where string, args ...any) error {
+	rows, err := e.db.Query(ctx, `
+		SELECT d.id, uf.telegram_id, ut.telegram_id, d.amount_cents, COALESCE(d.created_at, NOW()), COALESCE(d.is_paid, false), d.paid_at, d.receipt_id
+		FROM debts d
+		JOIN users uf ON uf.id = d.from_user
+		JOIN users ut ON ut.id = d.to_user
+		WHERE `+where+` ORDER BY d.id`, args...)
+	if err != nil {
+		return err
+	}
+	receipts := make(map[int]bool, len(e.archive.Receipts))
+	for _, r := range e.archive.Receipts {
+		receipts[r.ID] = true
+	}
+	return collect(rows, func(row pgx.Rows) error {
+		var x Debt
+		if err := row.Scan(&x.ID, &x.FromTelegramID, &x.ToTelegramID, &x.AmountCents, &x.CreatedAt, &x.IsPaid, &x.PaidAt, &x.ReceiptID); err != nil {
+			return err
+		}
+		if x.ReceiptID != nil && !receipts[*x.ReceiptID] {
+			x.ReceiptID = nil
+		}
+		e.users[x.FromTelegramID] = true
+		e.users[x.ToTelegramID] = true
+		e.debtIDs = append(e.debtIDs, x.ID)
+		e.archive.Debts = append(e.archive.Debts, x)
+		return nil
+	})
+}
+
+// incomes exports the incomes with an income type; like the incomes table they were kept in,
+// they have no trash and deleted ones are left out
+func (e *exporter) incomes(ctx context.Context, where string, args ...any) error {
+	rows, err := e.db.Query(ctx, `
+		SELECT e.id, u.telegram_id, e.amount_cents, e.currency, e.income_type, e.description, e.related_debt_id,
+			COALESCE(e.timestamp, NOW()), e.group_id, COALESCE(e.is_private, false), e.account_id
+		FROM expenses e JOIN users u ON u.id = e.user_id
+		WHERE e.income_type IS NOT NULL AND e.deleted_at IS NULL AND `+where+` ORDER BY e.id`, args...)
+	if err != nil {
+		return err
+	}
+	debts := make(map[int]bool, len(e.debtIDs))
+	for _, id := range e.debtIDs {
+		debts[id] = true
+	}
+	return collect(rows, func(row pgx.Rows) error {
+		var x Income
+		if err := row.Scan(&x.ID, &x.TelegramID, &x.AmountCents, &x.Currency, &x.IncomeType, &x.Description, &x.RelatedDebtID,
+			&x.Timestamp, &x.GroupID, &x.IsPrivate, &x.AccountID); err != nil {
+			return err
+		}
+		e.addAccount(x.AccountID)
+		if x.RelatedDebtID != nil && !debts[*x.RelatedDebtID] {
+			x.RelatedDebtID = nil
+		}
+		e.users[x.TelegramID] = true
+		e.addGroup(x.GroupID)
+		e.incomeID[x.ID] = true
+		e.archive.Incomes = append(e.archive.Incomes, x)
+		return nil
+	})
+}
+
+func (e *exporter) payments(ctx context.Context) error {
+	if len(e.debtIDs) == 0 {
+		return nil
+	}
+	rows, err := e.db.Query(ctx, `
+		SELECT p.id, p.debt_id, p.amount_cents, u.telegram_id, p.income_id, p.note, COALESCE(p.paid_at, NOW())
+		FROM debt_payments p LEFT JOIN users u ON u.id = p.recorded_by
+		WHERE p.debt_id = ANY($1) ORDER BY p.id`, e.debtIDs)
+	if err != nil {
+		return err
+	}
+	return collect(rows, func(row pgx.Rows) error {
+		var x DebtPayment
+		if err := row.Scan(&x.ID, &x.DebtID, &x.AmountCents, &x.RecordedByTelegramID, &x.IncomeID, &x.Note, &x.PaidAt); err != nil {
+			return err
+		}
+		if x.IncomeID != nil && !e.incomeID[*x.IncomeID] {
+			x.IncomeID = nil
+		}
+		if x.RecordedByTelegramID != nil {
+			e.users[*x.RecordedByTelegramID] = true
+		}
+		e.archive.DebtPayments = append(e.archive.DebtPayments, x)
+		return nil
+	})
+}
+
+// accountRows exports the accounts selected by where; the rows exported before add the accounts they use
+func (e *exporter) accountRows(ctx context.Context, where string, args ...any) error {
+	rows, err := e.db.Query(ctx, `
+		SELECT a.id, u.telegram_id, a.name, a.type, a.currency, a.opening_balance_cents, a.is_archived
+		FROM accounts a JOIN users u ON u.id = a.user_id
+		WHERE `+where+` ORDER BY a.id`, args...)
+	if err != nil {
+		return err
+	}
+	return collect(rows, func(row pgx.Rows) error {
+		var x Account
+		if err := row.Scan(&x.ID, &x.TelegramID, &x.Name, &x.Type, &x.Currency, &x.OpeningBalanceCents, &x.IsArchived); err != nil {
+			return err
+		}
+		e.users[x.TelegramID] = true
+		e.archive.Accounts = append(e.archive.Accounts, x)
+		return nil
+	})
+}
+
+func (e *exporter) addAccount(id *int) {
+	if id != nil {
+		e.accounts[*id] = true
+	}
+}
+
+func (e *exporter) addGroup(id *int64) {
+	if id != nil {
+		e.groups[*id] = true
+	}
+}
+
+func (e *exporter) groupRows(ctx context.Context) error {
+	if e.archive.Scope == ScopeGroup {
+		e.groups[e.archive.GroupID] = true
+	}
+	rows, err := e.db.Query(ctx, `
+		SELECT id, COALESCE(name, ''), COALESCE(type, 'group') FROM telegram_groups WHERE id = ANY($1) ORDER BY id`, keys(e.groups))
+	if err != nil {
+		return err
+	}
+	return collect(rows, func(row pgx.Rows) error {
+		var g Group
+		if err := row.Scan(&g.ID, &g.Name, &g.Type); err != nil {
+			return err
+		}
+		e.archive.Groups = append(e.archive.Groups, g)
+		return nil
+	})
+}
+
+// categories exports the categories and subcategories used by the exported expenses
+func (e *exporter) categories(ctx context.Context) error {
+	rows, err := e.db.Query(ctx, `
+		SELECT id, category_id, name, COALESCE(aliases, '[]') FROM subcategories WHERE id = ANY($1) ORDER BY id`, keys(e.subIDs))
+	if err != nil {
+		return err
+	}
+	err = collect(rows, func(row pgx.Rows) error {
+		var s Subcategory
+		if err := row.Scan(&s.ID, &s.CategoryID, &s.Name, &s.Aliases); err != nil {
+			return err
+		}
+		e.catIDs[s.CategoryID] = true
+		e.archive.Subcategories = append(e.archive.Subcategories, s)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	rows, err = e.db.Query(ctx, `SELECT id, name, COALESCE(aliases, '[]') FROM categories WHERE id = ANY($1) ORDER BY id`, keys(e.catIDs))
+	if err != nil {
+		return err
+	}
+	return collect(rows, func(row pgx.Rows) error {
+		var c Category
+		if err := row.Scan(&c.ID, &c.Name, &c.Aliases); err != nil {
+			return err
+		}
+		e.archive.Categories = append(e.archive.Categories, c)
+		return nil
+	})
+}
+
+func (e *exporter) userRows(ctx context.Context) error {
+	rows, err := e.db.Query(ctx, `
+		SELECT telegram_id, COALESCE(username, '') FROM users WHERE telegram_id = ANY($1) ORDER BY telegram_id`, keys(e.users))
+	if err != nil {
+		return err
+	}
+	return collect(rows, func(row pgx.Rows) error {
+		var u User
+		if err := row.Scan(&u.TelegramID, &u.Username); err != nil {
+			return err
+		}
+		e.archive.Users = append(e.archive.Users, u)
+		return nil
+	})
+}
+
+// collect calls fn for every row and closes rows
+func collect(rows pgx.Rows, fn func(pgx.Rows) error) error {
+	defer rows.Close()
+	for rows.Next() {
+		if err := fn(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func keys[K int | int64, V any](set map[K]V) []K {
+	out := make([]K, 0, len(set))
+	for k := range set {
+		out = append(out, k)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
@@ -0,0 +1,554 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/expense-tracker/api-service/internal/merchants"
+	"github.com/expense-tracker/api-service/internal/repository"
+	"github.com/jackc/pgx/v5"
+)
+
+// Result counts the restored rows per table: created now or found from an earlier restore
+type Result struct {
+	Created  map[string]int `json:"created"`
+	Existing map[string]int `json:"existing"`
+}
+
+// Tables whose ids are remapped through restored_rows
+var remappedTables = map[string]string{
+	"account":      "accounts",
+	"expense":      "expenses",
+	"receipt":      "receipts",
+	"receipt_item": "receipt_items",
+	"debt":         "debts",
+	"income":       "expenses",
+	"debt_payment": "debt_payments",
+}
+
+// Conditions on a row (alias t) that may be reused for an archive row: it must belong to one of the
+// users the archive is restored for ($1) and, for a group archive, be in its group ($2)
+var ownedRows = map[string]string{
+	"account":      "t.user_id = ANY($1)",
+	"expense":      "t.user_id = ANY($1) AND ($2::bigint IS NULL OR t.group_id = $2)",
+	"income":       "t.user_id = ANY($1) AND ($2::bigint IS NULL OR t.group_id = $2)",
+	"receipt":      "t.owner_id = ANY($1) AND ($2::bigint IS NULL OR t.group_id = $2)",
+	"receipt_item": "EXISTS (SELECT 1 FROM receipts o WHERE o.id = t.receipt_id AND o.owner_id = ANY($1))",
+	"debt":         "(t.from_user = ANY($1) OR t.to_user = ANY($1))",
+	"debt_payment": "EXISTS (SELECT 1 FROM debts o WHERE o.id = t.debt_id AND (o.from_user = ANY($1) OR o.to_user = ANY($1)))",
+}
+
+// restorer writes an archive inside one transaction and keeps the source -> target id maps
+type restorer struct {
+	tx     pgx.Tx
+	source string
+	self   bool  // the archive was written by this installation
+	caller int64 // telegram id
+	result *Result
+	// Existing rows are reused only when they belong to owners (users.id) and, for a group archive,
+	// are in groupID; anything else gets a new row
+	owners  []int64
+	groupID *int64
+	// Users (telegram ids) a new debt may name besides the users created by this restore: the caller
+	// and the members of the archive's groups that exist here
+	members map[int64]bool
+	created map[int64]bool
+	// Income ids of version 1 archives are ids of the incomes table, kept as expenses.legacy_income_id
+	legacyIncomes bool
+
+	users         map[int64]int64 // telegram_id -> users.id
+	categories    map[int]int
+	subcategories map[int]int
+	ids           map[string]map[int]int
+	transfers     map[int64]int64 // source transfer_id -> new transfer_id
+}
+
+// Restore writes the archive for the caller (telegram id). Rows restored before from the same
+// installation are found through restored_rows and not created again, so restoring an archive twice,
+// or two overlapping archives, creates every row once.
+func Restore(ctx context.Context, db interface {
+	Begin(context.Context) (pgx.Tx, error)
+}, a *Archive, callerTelegramID int64) (*Result, error) {
+	if err := a.Validate(); err != nil {
+		return nil, err
+	}
+	if err := a.authorize(callerTelegramID); err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Concurrent restores from the same installation would race on restored_rows
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext('backup-restore:' || $1))", a.Instance); err != nil {
+		return nil, err
+	}
+	local, err := InstanceID(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rows can only be restored into groups that are new here or that the caller is a member of. The
+	// members of a group that exists here are the ones of group_members, not of the archive: an archive
+	// cannot add anyone to a group
+	members := map[int64]bool{callerTelegramID: true}
+	for _, g := range a.Groups {
+		rows, err := tx.Query(ctx, "SELECT user_id FROM group_members WHERE group_id = $1", g.ID)
+		if err != nil {
+			return nil, err
+		}
+		existing, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+		if err != nil {
+			return nil, err
+		}
+		if len(existing) == 0 {
+			continue
+		}
+		if !slices.Contains(existing, callerTelegramID) {
+			return nil, ErrForbidden
+		}
+		for _, m := range a.GroupMembers {
+			if m.GroupID == g.ID && !slices.Contains(existing, m.TelegramID) {
+				return nil, fmt.Errorf("%w: user %d is not a member of group %d", ErrForbidden, m.TelegramID, g.ID)
+			}
+		}
+		for _, id := range existing {
+			members[id] = true
+		}
+	}
+
+	r := &restorer{
+		tx:      tx,
+		source:  a.Instance,
+		caller:  callerTelegramID,
+		self:    a.Instance == local,
+		result:  &Result{Created: make(map[string]int), Existing: make(map[string]int)},
+		members: members,
+
+		legacyIncomes: a.Version < 2,
+
+		users:         make(map[int64]int64),
+		created:       make(map[int64]bool),
+		categories:    make(map[int]int),
+		subcategories: make(map[int]int),
+		ids:           make(map[string]map[int]int),
+		transfers:     make(map[int64]int64),
+	}
+	if a.Scope == ScopeGroup {
+		r.groupID = &a.GroupID
+	}
+	steps := []func(context.Context, *Archive) error{
+		r.restoreUsers, r.restoreGroups, r.restoreCategories, r.restoreAccounts,
+		r.restoreExpenses, r.restoreReceipts, r.restoreDebts, r.restoreIncomes, r.restorePayments,
+	}
+	for _, step := range steps {
+		if err := step(ctx, a); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return r.result, nil
+}
+
+func (r *restorer) count(table string, created bool) {
+	if created {
+		r.result.Created[table]++
+	} else {
+		r.result.Existing[table]++
+	}
+}
+
+// lookup returns the target id of a source row restored before. Only rows the archive may own are
+// reused, so an archive cannot map its rows onto rows of other users.
+func (r *restorer) lookup(ctx context.Context, entity string, sourceID int) (int, bool, error) {
+	table := remappedTables[entity]
+	var targetID int
+	err := r.tx.QueryRow(ctx, `
+		SELECT m.target_id FROM restored_rows m
+		WHERE m.source_instance = $3 AND m.entity = $4 AND m.source_id = $5
+			AND EXISTS (SELECT 1 FROM `+table+` t WHERE t.id = m.target_id AND `+ownedRows[entity]+`)
+	`, r.owners, r.groupID, r.source, entity, sourceID).Scan(&targetID)
+	if err == nil {
+		return targetID, true, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, err
+	}
+	if r.self {
+		// Restoring on the installation that wrote the archive: rows that still exist keep their ids
+		query := `SELECT t.id FROM ` + table + ` t WHERE t.id = $3 AND ` + ownedRows[entity]
+		if entity == "income" && r.legacyIncomes {
+			query = `SELECT t.id FROM expenses t WHERE t.legacy_income_id = $3 AND ` + ownedRows[entity]
+		}
+		err := r.tx.QueryRow(ctx, query, r.owners, r.groupID, sourceID).Scan(&targetID)
+		if err == nil {
+			return targetID, true, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return 0, false, err
+		}
+	}
+	return 0, false, nil
+}
+
+// remember records the target id of a source row
+func (r *restorer) remember(ctx context.Context, entity string, sourceID, targetID int) error {
+	if r.ids[entity] == nil {
+		r.ids[entity] = make(map[int]int)
+	}
+	r.ids[entity][sourceID] = targetID
+	_, err := r.tx.Exec(ctx, `
+		INSERT INTO restored_rows (source_instance, entity, source_id, target_id) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (source_instance, entity, source_id) DO UPDATE SET target_id = EXCLUDED.target_id, restored_at = NOW()
+	`, r.source, entity, sourceID, targetID)
+	return err
+}
+
+// restoreRow maps a source row to an existing target or inserts it with insert
+func (r *restorer) restoreRow(ctx context.Context, entity string, sourceID int, insert func() (int, error)) (int, bool, error) {
+	targetID, found, err := r.lookup(ctx, entity, sourceID)
+	if err != nil {
+		return 0, false, err
+	}
+	if !found {
+		if targetID, err = insert(); err != nil {
+			return 0, false, err
+		}
+	}
+	r.count(remappedTables[entity], !found)
+	return targetID, !found, r.remember(ctx, entity, sourceID, targetID)
+}
+
+// mapped translates an optional source id of an entity restored earlier
+func (r *restorer) mapped(entity string, id *int) *int {
+	if id == nil {
+		return nil
+	}
+	target, ok := r.ids[entity][*id]
+	if !ok {
+		return nil
+	}
+	return &target
+}
+
+func (r *restorer) user(telegramID *int64) *int64 {
+	if telegramID == nil {
+		return nil
+	}
+	id := r.users[*telegramID]
+	return &id
+}
+
+func (r *restorer) restoreUsers(ctx context.Context, a *Archive) error {
+	for _, u := range a.Users {
+		var id int64
+		var created bool
+		err := r.tx.QueryRow(ctx, `
+			INSERT INTO users (telegram_id, username) VALUES ($1, NULLIF($2, ''))
+			ON CONFLICT (telegram_id) DO UPDATE SET username = COALESCE(users.username, EXCLUDED.username)
+			RETURNING id, xmax = 0
+		`, u.TelegramID, u.Username).Scan(&id, &created)
+		if err != nil {
+			return err
+		}
+		r.users[u.TelegramID] = id
+		r.created[u.TelegramID] = created
+		r.count("users", created)
+	}
+	for telegramID := range a.owners(r.caller) {
+		r.owners = append(r.owners, r.users[telegramID])
+	}
+	return nil
+}
+
+func (r *restorer) restoreGroups(ctx context.Context, a *Archive) error {
+	for _, g := range a.Groups {
+		tag, err := r.tx.Exec(ctx, `
+			INSERT INTO telegram_groups (id, name, type) VALUES ($1, NULLIF($2, ''), $3) ON CONFLICT (id) DO NOTHING
+		`, g.ID, g.Name, g.Type)
+		if err != nil {
+			return err
+		}
+		r.count("telegram_groups", tag.RowsAffected() > 0)
+	}
+	for _, m := range a.GroupMembers {
+		tag, err := r.tx.Exec(ctx, `
+			INSERT INTO group_members (group_id, user_id, role, joined_at) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (group_id, user_id) DO NOTHING
+		`, m.GroupID, m.TelegramID, m.Role, m.JoinedAt)
+		if err != nil {
+			return err
+		}
+		r.count("group_members", tag.RowsAffected() > 0)
+	}
+	return nil
+}
+
+// restoreCategories matches categories by name (case-insensitive) and subcategories by name within the category
+func (r *restorer) restoreCategories(ctx context.Context, a *Archive) error {
+	for _, c := range a.Categories {
+		var id int
+		err := r.tx.QueryRow(ctx, "SELECT id FROM categories WHERE LOWER(name) = LOWER($1) ORDER BY id LIMIT 1", c.Name).Scan(&id)
+		created := errors.Is(err, pgx.ErrNoRows)
+		if created {
+			err = r.tx.QueryRow(ctx, "INSERT INTO categories (name, aliases) VALUES ($1, $2) RETURNING id", c.Name, nonNil(c.Aliases)).Scan(&id)
+		}
+		if err != nil {
+			return err
+		}
+		r.categories[c.ID] = id
+		r.count("categories", created)
+	}
+	for _, s := range a.Subcategories {
+		var id int
+		categoryID := r.categories[s.CategoryID]
+		err := r.tx.QueryRow(ctx, "SELECT id FROM subcategories WHERE category_id = $1 AND LOWER(name) = LOWER($2) ORDER BY id LIMIT 1", categoryID, s.Name).Scan(&id)
+		created := errors.Is(err, pgx.ErrNoRows)
+		if created {
+			err = r.tx.QueryRow(ctx, "INSERT INTO subcategories (name, category_id, aliases) VALUES ($1, $2, $3) RETURNING id",
+				s.Name, categoryID, nonNil(s.Aliases)).Scan(&id)
+		}
+		if err != nil {
+			return err
+		}
+		r.subcategories[s.ID] = id
+		r.count("subcategories", created)
+	}
+	return nil
+}
+
+// restoreAccounts matches accounts by name within their user, so a restore adds to the accounts the user already has
+func (r *restorer) restoreAccounts(ctx context.Context, a *Archive) error {
+	for _, acc := range a.Accounts {
+		userID := r.users[acc.TelegramID]
+		_, _, err := r.restoreRow(ctx, "account", acc.ID, func() (int, error) {
+			var id int
+			err := r.tx.QueryRow(ctx, `
+				INSERT INTO accounts (user_id, name, type, currency, opening_balance_cents, is_archived)
+				VALUES ($1, $2, $3, $4, $5, $6)
+				ON CONFLICT (user_id, name) DO NOTHING
+				RETURNING id
+			`, userID, acc.Name, acc.Type, acc.Currency, acc.OpeningBalanceCents, acc.IsArchived).Scan(&id)
+			if errors.Is(err, pgx.ErrNoRows) {
+				err = r.tx.QueryRow(ctx, "SELECT id FROM accounts WHERE user_id = $1 AND name = $2", userID, acc.Name).Scan(&id)
+			}
+			return id, err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transfer returns the transfer id the legs of a source transfer get here
+func (r *restorer) transfer(ctx context.Context, sourceID *int64) (*int64, error) {
+	if sourceID == nil {
+		return nil, nil
+	}
+	if id, ok := r.transfers[*sourceID]; ok {
+		return &id, nil
+	}
+	var id int64
+	if err := r.tx.QueryRow(ctx, "SELECT nextval('transfer_id_seq')").Scan(&id); err != nil {
+		return nil, err
+	}
+	r.transfers[*sourceID] = id
+	return &id, nil
+}
+
+func (r *restorer) restoreExpenses(ctx context.Context, a *Archive) error {
+	for _, e := range a.Expenses {
+		var categoryID, subcategoryID *int
+		if e.CategoryID != nil {
+			id := r.categories[*e.CategoryID]
+			categoryID = &id
+		}
+		if e.SubcategoryID != nil {
+			id := r.subcategories[*e.SubcategoryID]
+			subcategoryID = &id
+		}
+		userID := r.users[e.TelegramID]
+		_, _, err := r.restoreRow(ctx, "expense", e.ID, func() (int, error) {
+			var merchantID *int
+			if e.Merchant != nil {
+				var err error
+				if merchantID, err = merchants.Resolve(ctx, r.tx, *e.Merchant); err != nil {
+					return 0, err
+				}
+			}
+			transferID, err := r.transfer(ctx, e.TransferID)
+			if err != nil {
+				return 0, err
+			}
+			t := repository.Transaction{
+				UserID:        userID,
+				AmountCents:   int64(e.AmountCents),
+				OperationType: e.OperationType,
+				CategoryID:    categoryID,
+				SubcategoryID: subcategoryID,
+				Timestamp:     e.Timestamp,
+				IsShared:      e.IsShared,
+				IsPrivate:     e.IsPrivate,
+				GroupID:       e.GroupID,
+				Description:   deref(e.Description),
+				MerchantID:    merchantID,
+				Currency:      e.Currency,
+				AccountID:     r.mapped("account", e.AccountID),
+				TransferID:    transferID,
+				TransferLeg:   deref(e.TransferLeg),
+				ExternalID:    deref(e.ExternalID),
+				DeletedAt:     e.DeletedAt,
+			}
+			err = repository.Insert(ctx, r.tx, &t)
+			if errors.Is(err, repository.ErrDuplicate) {
+				// The same bank transaction was imported here already
+				err = r.tx.QueryRow(ctx, "SELECT id FROM expenses WHERE user_id = $1 AND external_id = $2", userID, e.ExternalID).Scan(&t.ID)
+			}
+			return t.ID, err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *restorer) restoreReceipts(ctx context.Context, a *Archive) error {
+	for _, rec := range a.Receipts {
+		recorded := false // the fiscal receipt was recorded here already, with its items
+		_, created, err := r.restoreRow(ctx, "receipt", rec.ID, func() (int, error) {
+			var id int
+			err := r.tx.QueryRow(ctx, `
+				INSERT INTO receipts (owner_id, merchant, receipt_date, total_cents, tax_cents, fiscal_fn, fiscal_fd, fiscal_fp,
+					group_id, status, expense_id, created_at, finalized_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+				ON CONFLICT (fiscal_fn, fiscal_fd, fiscal_fp) WHERE fiscal_fn IS NOT NULL AND status <> 'cancelled' DO NOTHING
+				RETURNING id
+			`, r.users[rec.OwnerTelegramID], rec.Merchant, rec.ReceiptDate, rec.TotalCents, rec.TaxCents, rec.FiscalFN, rec.FiscalFD, rec.FiscalFP,
+				rec.GroupID, rec.Status, r.mapped("expense", rec.ExpenseID), rec.CreatedAt, rec.FinalizedAt).Scan(&id)
+			if errors.Is(err, pgx.ErrNoRows) {
+				// The same fiscal receipt is recorded here already; it is reused only if it is the archive's
+				recorded = true
+				err = r.tx.QueryRow(ctx, `
+					SELECT id FROM receipts WHERE fiscal_fn = $1 AND fiscal_fd = $2 AND fiscal_fp = $3 AND status <> 'cancelled'
+						AND owner_id = ANY($4)
+				`, rec.FiscalFN, rec.FiscalFD, rec.FiscalFP, r.owners).Scan(&id)
+				if errors.Is(err, pgx.ErrNoRows) {
+					return 0, fmt.Errorf("%w: receipt %d is recorded by another user", ErrForbidden, rec.ID)
+				}
+			}
+			return id, err
+		})
+		if err != nil {
+			return err
+		}
+		if !created || recorded {
+			continue
+		}
+		receiptID := r.ids["receipt"][rec.ID]
+		for _, item := range rec.Items {
+			_, _, err := r.restoreRow(ctx, "receipt_item", item.ID, func() (int, error) {
+				var id int
+				err := r.tx.QueryRow(ctx, `
+					INSERT INTO receipt_items (receipt_id, name, price_cents, quantity, selected_by) VALUES ($1, $2, $3, $4, $5) RETURNING id
+				`, receiptID, item.Name, item.PriceCents, item.Quantity, nonNil(item.SelectedBy)).Scan(&id)
+				return id, err
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *restorer) restoreDebts(ctx context.Context, a *Archive) error {
+	for _, d := range a.Debts {
+		_, _, err := r.restoreRow(ctx, "debt", d.ID, func() (int, error) {
+			// A debt is a claim on its parties: one of a user who was here before needs them to share a group
+			for _, party := range []int64{d.FromTelegramID, d.ToTelegramID} {
+				if !r.created[party] && !r.members[party] {
+					return 0, fmt.Errorf("%w: debt %d names user %d outside the archive's groups", ErrForbidden, d.ID, party)
+				}
+			}
+			var id int
+			err := r.tx.QueryRow(ctx, `
+				INSERT INTO debts (from_user, to_user, amount_cents, created_at, is_paid, paid_at, receipt_id)
+				VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id
+			`, r.users[d.FromTelegramID], r.users[d.ToTelegramID], d.AmountCents, d.CreatedAt, d.IsPaid, d.PaidAt,
+				r.mapped("receipt", d.ReceiptID)).Scan(&id)
+			return id, err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *restorer) restoreIncomes(ctx context.Context, a *Archive) error {
+	for _, i := range a.Incomes {
+		_, _, err := r.restoreRow(ctx, "income", i.ID, func() (int, error) {
+			t := repository.Transaction{
+				UserID:        r.users[i.TelegramID],
+				AmountCents:   int64(i.AmountCents),
+				OperationType: repository.TypeIncome,
+				Timestamp:     i.Timestamp,
+				IsPrivate:     i.IsPrivate,
+				GroupID:       i.GroupID,
+				Description:   deref(i.Description),
+				Currency:      i.Currency,
+				AccountID:     r.mapped("account", i.AccountID),
+				IncomeType:    repository.IncomeType(i.IncomeType),
+				RelatedDebtID: r.mapped("debt", i.RelatedDebtID),
+			}
+			err := repository.Insert(ctx, r.tx, &t)
+			return t.ID, err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *restorer) restorePayments(ctx context.Context, a *Archive) error {
+	for _, p := range a.DebtPayments {
+		_, _, err := r.restoreRow(ctx, "debt_payment", p.ID, func() (int, error) {
+			var id int
+			err := r.tx.QueryRow(ctx, `
+				INSERT INTO debt_payments (debt_id, amount_cents, recorded_by, income_id, note, paid_at)
+				VALUES ($1, $2, $3, $4, $5, $6) RETURNING id
+			`, r.ids["debt"][p.DebtID], p.AmountCents, r.user(p.RecordedByTelegramID), r.mapped("income", p.IncomeID), p.Note, p.PaidAt).Scan(&id)
+			return id, err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deref returns the string or "" for nil
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// nonNil keeps JSON columns from getting null instead of an empty array
+func nonNil[T any](values []T) []T {
+	if values == nil {
+		return []T{}
+	}
+	return values
+}
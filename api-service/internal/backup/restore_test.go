@@ -0,0 +1,155 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/expense-tracker/api-service/internal/dbtest"
+)
+
+func TestRestoreRejectsForgedArchive(t *testing.T) {
+	a := userArchive()
+	a.Expenses[0].TelegramID, a.Expenses[0].AccountID = 2, nil
+
+	db := dbtest.New(nil)
+	if _, err := Restore(context.Background(), db, a, 1); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("Restore() = %v, want ErrForbidden", err)
+	}
+	if len(db.Statements) != 0 {
+		t.Errorf("statements ran for a forged archive: %+v", db.Statements)
+	}
+}
+
+func TestRestoreIntoForeignGroup(t *testing.T) {
+	// The group of the archive exists here and the caller is not a member
+	db := dbtest.New(func(sql string, args []any) dbtest.Result {
+		switch {
+		case strings.Contains(sql, "FROM instance_info"):
+			return dbtest.Result{Rows: [][]any{{"6f1c2b1e-0000-4000-8000-000000000002"}}}
+		case strings.Contains(sql, "FROM group_members"):
+			return dbtest.Result{Rows: [][]any{{int64(5)}}}
+		}
+		return dbtest.Result{}
+	})
+	if _, err := Restore(context.Background(), db, userArchive(), 1); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("Restore() = %v, want ErrForbidden", err)
+	}
+	if _, ok := db.Ran("INSERT"); ok || db.Committed {
+		t.Errorf("rows written into a foreign group: %+v", db.Statements)
+	}
+}
+
+// A group archive of a group that exists here lists a user who is not in it, to write debts on them
+func TestRestoreForgedMemberList(t *testing.T) {
+	db := dbtest.New(func(sql string, args []any) dbtest.Result {
+		switch {
+		case strings.Contains(sql, "FROM instance_info"):
+			return dbtest.Result{Rows: [][]any{{"6f1c2b1e-0000-4000-8000-000000000002"}}}
+		case strings.Contains(sql, "FROM group_members"):
+			return dbtest.Result{Rows: [][]any{{int64(1)}}} // user 2 is not in the group here
+		}
+		return dbtest.Result{}
+	})
+	if _, err := Restore(context.Background(), db, groupArchive(), 1); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("Restore() = %v, want ErrForbidden", err)
+	}
+	if _, ok := db.Ran("INSERT"); ok || db.Committed {
+		t.Errorf("rows written for a forged member list: %+v", db.Statements)
+	}
+}
+
+// A debt may only name a user who was here before when they share a group with the caller here
+func TestRestoreDebtOfUnrelatedUser(t *testing.T) {
+	tests := []struct {
+		name    string
+		members map[int64]bool
+		created map[int64]bool
+		want    error
+	}{
+		{name: "member here", members: map[int64]bool{1: true, 2: true}},
+		{name: "created by the restore", members: map[int64]bool{1: true}, created: map[int64]bool{2: true}},
+		{name: "existing user outside the groups", members: map[int64]bool{1: true}, want: ErrForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.New(func(sql string, args []any) dbtest.Result {
+				if strings.Contains(sql, "INSERT INTO debts") {
+					return dbtest.Result{Rows: [][]any{{77}}}
+				}
+				return dbtest.Result{}
+			})
+			a := userArchive()
+			r := &restorer{
+				tx: db, source: a.Instance, caller: 1,
+				result:  &Result{Created: make(map[string]int), Existing: make(map[string]int)},
+				owners:  []int64{1},
+				members: tt.members,
+				created: tt.created,
+				users:   map[int64]int64{1: 1, 2: 2},
+				ids:     make(map[string]map[int]int),
+			}
+			err := r.restoreDebts(context.Background(), a)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("restoreDebts() = %v, want %v", err, tt.want)
+			}
+			if _, ok := db.Ran("INSERT INTO debts"); ok != (tt.want == nil) {
+				t.Errorf("debt inserted = %v, want %v", ok, tt.want == nil)
+			}
+		})
+	}
+}
+
+// The payment of a forged archive names the id of a debt between two other users, and the
+// archive is made to look like one written by this installation
+func TestRestoreForgedPaymentGetsOwnDebt(t *testing.T) {
+	const foreignDebt = 4 // from user 11 to user 12
+	db := dbtest.New(func(sql string, args []any) dbtest.Result {
+		switch {
+		case strings.Contains(sql, "FROM debts t WHERE t.id = $3"):
+			owners := args[0].([]int64)
+			if !strings.Contains(sql, "t.from_user = ANY($1) OR t.to_user = ANY($1)") {
+				t.Errorf("self lookup without ownership: %s", sql)
+			}
+			if args[2] == foreignDebt && (slices.Contains(owners, 11) || slices.Contains(owners, 12)) {
+				return dbtest.Result{Rows: [][]any{{foreignDebt}}}
+			}
+		case strings.Contains(sql, "INSERT INTO debts"):
+			return dbtest.Result{Rows: [][]any{{77}}}
+		case strings.Contains(sql, "INSERT INTO debt_payments"):
+			return dbtest.Result{Rows: [][]any{{88}}}
+		}
+		return dbtest.Result{}
+	})
+
+	a := userArchive()
+	a.Debts[0].ID, a.DebtPayments[0].DebtID, a.DebtPayments[0].IncomeID = foreignDebt, foreignDebt, nil
+	r := &restorer{
+		tx: db, source: a.Instance, self: true, caller: 1,
+		result:  &Result{Created: make(map[string]int), Existing: make(map[string]int)},
+		owners:  []int64{1},
+		members: map[int64]bool{1: true, 2: true},
+		users:   map[int64]int64{1: 1, 2: 2},
+		ids:     make(map[string]map[int]int),
+	}
+	ctx := context.Background()
+	if err := r.restoreDebts(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.restorePayments(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+
+	s, ok := db.Ran("INSERT INTO debt_payments")
+	if !ok || s.Args[0] != 77 {
+		t.Errorf("payment recorded against debt %v, want the restored debt 77", s.Args)
+	}
+	if r.result.Created["debts"] != 1 || r.result.Existing["debts"] != 0 {
+		t.Errorf("result = %+v, the foreign debt must not be reused", r.result)
+	}
+	if s, _ := db.Ran("FROM restored_rows m"); !strings.Contains(s.SQL, "ANY($1)") {
+		t.Errorf("restored_rows lookup without ownership: %s", s.SQL)
+	}
+}
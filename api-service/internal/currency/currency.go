@@ -0,0 +1,65 @@
+// Package currency keeps exchange rates and converts transaction amounts into a user's base currency.
+// Rates are rubles per unit of a currency on a date; amounts are minor units (cents, kopecks, tetri).
+// The conversion itself runs in PostgreSQL (convert_cents), so totals are summed after converting every
+// transaction at the rate of its own date.
+package currency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/expense-tracker/api-service/internal/repository"
+	"github.com/jackc/pgx/v5"
+)
+
+// Settlement is the currency rates are quoted in; debts are kept in it
+const Settlement = "RUB"
+
+var (
+	// ErrInvalidCurrency is returned for a code that is not three latin letters
+	ErrInvalidCurrency = errors.New("invalid currency")
+	// ErrUnsupportedCurrency is returned for a currency without exchange rates
+	ErrUnsupportedCurrency = errors.New("unsupported currency: no exchange rates")
+)
+
+// Normalize returns the upper-case ISO 4217 code
+func Normalize(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 3 {
+		return "", fmt.Errorf("%w: %q", ErrInvalidCurrency, code)
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return "", fmt.Errorf("%w: %q", ErrInvalidCurrency, code)
+		}
+	}
+	return code, nil
+}
+
+// Check normalizes a code and checks that amounts in it can be converted
+func Check(ctx context.Context, q repository.Querier, code string) (string, error) {
+	code, err := Normalize(code)
+	if err != nil || code == Settlement {
+		return code, err
+	}
+	var known bool
+	if err := q.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM exchange_rates WHERE currency = $1)`, code).Scan(&known); err != nil {
+		return "", err
+	}
+	if !known {
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedCurrency, code)
+	}
+	return code, nil
+}
+
+// BaseOf returns the base currency of a user
+func BaseOf(ctx context.Context, q repository.Querier, userID int64) (string, error) {
+	var base string
+	err := q.QueryRow(ctx, `SELECT base_currency FROM users WHERE id = $1`, userID).Scan(&base)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Settlement, nil
+	}
+	return base, err
+}
@@ -0,0 +1,76 @@
+package currency
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalize(t *testing.T) {
+	for _, code := range []string{"eur", " USD ", "Gel"} {
+		if got, err := Normalize(code); err != nil || got != strings.ToUpper(strings.TrimSpace(code)) {
+			t.Errorf("Normalize(%q) = %q, %v", code, got, err)
+		}
+	}
+	for _, code := range []string{"", "EURO", "€", "R1B", "руб"} {
+		if _, err := Normalize(code); !errors.Is(err, ErrInvalidCurrency) {
+			t.Errorf("Normalize(%q) error = %v, want ErrInvalidCurrency", code, err)
+		}
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	rates, err := ParseCSV(strings.NewReader("date,currency,rate\n2026-03-01,eur,98.5\n2026-03-01,GEL,33.2\n"))
+	if err != nil {
+		t.Fatalf("ParseCSV() error = %v", err)
+	}
+	want := []Rate{
+		{Date: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), Currency: "EUR", Rate: 98.5},
+		{Date: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), Currency: "GEL", Rate: 33.2},
+	}
+	if len(rates) != len(want) {
+		t.Fatalf("ParseCSV() = %v", rates)
+	}
+	for i := range want {
+		if rates[i] != want[i] {
+			t.Errorf("rate %d = %+v, want %+v", i, rates[i], want[i])
+		}
+	}
+
+	rates, err = ParseCSV(strings.NewReader("дата;валюта;курс\n2026-03-01;GEL;33,2\n"))
+	if err != nil || len(rates) != 1 || rates[0].Rate != 33.2 {
+		t.Errorf("ParseCSV() with semicolons = %v, %v", rates, err)
+	}
+
+	for _, bad := range []string{
+		"2026-03-01,EUR,abc\n2026-03-02,EUR,zero\n",
+		"01.03.2026,EUR,98\n",
+		"2026-03-01,RUB,1\n",
+		"2026-03-01,EUR,-1\n",
+		"2026-03-01,EUR\n",
+	} {
+		if _, err := ParseCSV(strings.NewReader(bad)); !errors.Is(err, ErrInvalidRates) {
+			t.Errorf("ParseCSV(%q) error = %v, want ErrInvalidRates", bad, err)
+		}
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	rates, err := ParseJSON(strings.NewReader(`[{"date": "2026-03-01", "currency": "usd", "rate": 90.1}]`))
+	if err != nil || len(rates) != 1 || rates[0].Currency != "USD" || rates[0].Rate != 90.1 {
+		t.Fatalf("ParseJSON() = %v, %v", rates, err)
+	}
+	if _, err := ParseJSON(strings.NewReader(`[{"date": "2026-03-01", "currency": "USD"}]`)); !errors.Is(err, ErrInvalidRates) {
+		t.Errorf("ParseJSON() without rate error = %v", err)
+	}
+}
+
+func TestStubRates(t *testing.T) {
+	day := time.Date(2026, 3, 5, 23, 30, 0, 0, time.FixedZone("MSK", 3*60*60))
+	rates, err := Stub{"EUR": 98}.Rates(context.Background(), day)
+	if err != nil || len(rates) != 1 || !rates[0].Date.Equal(time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Stub.Rates() = %v, %v", rates, err)
+	}
+}
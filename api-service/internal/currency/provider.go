@@ -0,0 +1,77 @@
+package currency
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// Provider fetches the rates of a day from an external source
+type Provider interface {
+	Name() string
+	Rates(ctx context.Context, day time.Time) ([]Rate, error)
+}
+
+// Stub is a provider with fixed rates, for development and tests without network access
+type Stub map[string]float64
+
+// DefaultStub holds approximate rates of the currencies the family pays in
+var DefaultStub = Stub{"USD": 90, "EUR": 98, "GEL": 33}
+
+// Name implements Provider
+func (s Stub) Name() string { return "stub" }
+
+// Rates implements Provider: the same rates on every day
+func (s Stub) Rates(_ context.Context, day time.Time) ([]Rate, error) {
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	rates := make([]Rate, 0, len(s))
+	for code, rate := range s {
+		rates = append(rates, Rate{Date: day, Currency: code, Rate: rate})
+	}
+	return rates, nil
+}
+
+// ProviderFromEnv returns the provider named by EXCHANGE_RATES_PROVIDER: stub, or nil when unset
+func ProviderFromEnv() (Provider, error) {
+	switch name := os.Getenv("EXCHANGE_RATES_PROVIDER"); name {
+	case "":
+		return nil, nil
+	case "stub":
+		return DefaultStub, nil
+	default:
+		return nil, fmt.Errorf("unknown exchange rates provider %q", name)
+	}
+}
+
+// Updater stores the rates of the current day from Provider
+type Updater struct {
+	DB       *pgxpool.Pool
+	Provider Provider
+	Location *time.Location // calendar the current day is taken in
+}
+
+// Run updates the rates right away and then on every tick until ctx is done
+func (u *Updater) Run(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		day := time.Now().In(u.Location)
+		if rates, err := u.Provider.Rates(ctx, day); err != nil {
+			log.Error().Err(err).Str("provider", u.Provider.Name()).Msg("fetch exchange rates")
+		} else if err := Store(ctx, u.DB, rates, u.Provider.Name()); err != nil {
+			log.Error().Err(err).Str("provider", u.Provider.Name()).Msg("store exchange rates")
+		} else {
+			log.Info().Int("rates", len(rates)).Str("provider", u.Provider.Name()).Msg("updated exchange rates")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package currency
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/expense-tracker/api-service/internal/repository"
+)
+
+// ErrInvalidRates is returned for a rates file that cannot be parsed
+var ErrInvalidRates = errors.New("invalid exchange rates")
+
+// Rate is the price of one unit of Currency in rubles on Date
+type Rate struct {
+	Date     time.Time `json:"date"`
+	Currency string    `json:"currency"`
+	Rate     float64   `json:"rate"`
+}
+
+// rateJSON is a rate as written in JSON files: the date is YYYY-MM-DD
+type rateJSON struct {
+	Date     string  `json:"date"`
+	Currency string  `json:"currency"`
+	Rate     float64 `json:"rate"`
+}
+
+// newRate validates and normalizes one rate
+func newRate(date, code string, rate float64) (Rate, error) {
+	day, err := time.Parse(time.DateOnly, strings.TrimSpace(date))
+	if err != nil {
+		return Rate{}, fmt.Errorf("%w: date %q, want YYYY-MM-DD", ErrInvalidRates, date)
+	}
+	code, err = Normalize(code)
+	if err != nil {
+		return Rate{}, fmt.Errorf("%w: %v", ErrInvalidRates, err)
+	}
+	if code == Settlement {
+		return Rate{}, fmt.Errorf("%w: %s is the settlement currency", ErrInvalidRates, code)
+	}
+	if rate <= 0 {
+		return Rate{}, fmt.Errorf("%w: rate of %s on %s must be positive", ErrInvalidRates, code, date)
+	}
+	return Rate{Date: day, Currency: code, Rate: rate}, nil
+}
+
+// ParseCSV reads date,currency,rate rows (rubles per unit); a header row and ';' separated files are accepted
+func ParseCSV(r io.Reader) ([]Rate, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	reader := csv.NewReader(bytes.NewReader(data))
+	if first, _, _ := bytes.Cut(data, []byte("\n")); bytes.Contains(first, []byte(";")) {
+		reader.Comma = ';' // spreadsheet exports with decimal commas
+	}
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRates, err)
+	}
+
+	var rates []Rate
+	for i, rec := range records {
+		if len(rec) != 3 {
+			return nil, fmt.Errorf("%w: line %d: want date,currency,rate", ErrInvalidRates, i+1)
+		}
+		value, err := strconv.ParseFloat(strings.Replace(strings.TrimSpace(rec[2]), ",", ".", 1), 64)
+		if err != nil {
+			if i == 0 {
+				continue // header
+			}
+			return nil, fmt.Errorf("%w: line %d: rate %q", ErrInvalidRates, i+1, rec[2])
+		}
+		rate, err := newRate(rec[0], rec[1], value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		rates = append(rates, rate)
+	}
+	return rates, nil
+}
+
+// ParseJSON reads an array of {"date": "2026-03-01", "currency": "EUR", "rate": 98.5}
+func ParseJSON(r io.Reader) ([]Rate, error) {
+	var raw []rateJSON
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRates, err)
+	}
+	rates := make([]Rate, 0, len(raw))
+	for i, rr := range raw {
+		rate, err := newRate(rr.Date, rr.Currency, rr.Rate)
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", i+1, err)
+		}
+		rates = append(rates, rate)
+	}
+	return rates, nil
+}
+
+// Store upserts rates; source tells where they came from (file, provider name, manual)
+func Store(ctx context.Context, q repository.Querier, rates []Rate, source string) error {
+	for _, rate := range rates {
+		_, err := q.Exec(ctx, `
+			INSERT INTO exchange_rates (currency, rate_date, rate, source) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (currency, rate_date) DO UPDATE SET rate = EXCLUDED.rate, source = EXCLUDED.source, updated_at = NOW()
+		`, rate.Currency, rate.Date, rate.Rate, source)
+		if err != nil {
+			return fmt.Errorf("store rate of %s on %s: %w", rate.Currency, rate.Date.Format(time.DateOnly), err)
+		}
+	}
+	return nil
+}
+
+// LoadFile stores the rates of a .csv or .json file
+func LoadFile(ctx context.Context, q repository.Querier, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var rates []Rate
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		rates, err = ParseJSON(f)
+	case ".csv":
+		rates, err = ParseCSV(f)
+	default:
+		return 0, fmt.Errorf("%w: %s is neither .csv nor .json", ErrInvalidRates, path)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(rates), Store(ctx, q, rates, "file")
+}
@@ -0,0 +1,196 @@
+// Package dbtest fakes the database for tests of code that issues SQL: a DB records every statement
+// run on it and answers it with the rows its Handler returns, so tests can check which statements ran,
+// in what order and with which arguments.
+package dbtest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Statement is a statement run on a DB
+type Statement struct {
+	SQL  string
+	Args []any
+}
+
+// Result answers a statement: the rows of a query, or the command tag of an Exec, e.g. "DELETE 3"
+type Result struct {
+	Rows [][]any
+	Tag  string
+	Err  error
+}
+
+// Handler answers a statement; a nil Handler answers every statement with no rows
+type Handler func(sql string, args []any) Result
+
+// DB is a pool and the transactions begun on it at once. Methods of pgx.Tx other than the ones
+// below panic.
+type DB struct {
+	pgx.Tx
+	Handler    Handler
+	Statements []Statement
+	Committed  bool
+}
+
+// New returns a DB answering with handler
+func New(handler Handler) *DB {
+	return &DB{Handler: handler}
+}
+
+func (db *DB) run(sql string, args []any) Result {
+	db.Statements = append(db.Statements, Statement{SQL: sql, Args: args})
+	if db.Handler == nil {
+		return Result{}
+	}
+	return db.Handler(sql, args)
+}
+
+// Ran reports whether a statement containing all the fragments ran, and returns the first one
+func (db *DB) Ran(fragments ...string) (Statement, bool) {
+	for _, s := range db.Statements {
+		if containsAll(s.SQL, fragments) {
+			return s, true
+		}
+	}
+	return Statement{}, false
+}
+
+// Index returns the position of the first statement containing all the fragments, or -1
+func (db *DB) Index(fragments ...string) int {
+	for i, s := range db.Statements {
+		if containsAll(s.SQL, fragments) {
+			return i
+		}
+	}
+	return -1
+}
+
+func containsAll(sql string, fragments []string) bool {
+	for _, f := range fragments {
+		if !strings.Contains(sql, f) {
+			return false
+		}
+	}
+	return true
+}
+
+// Begin starts a transaction, the DB itself
+func (db *DB) Begin(ctx context.Context) (pgx.Tx, error) { return db, nil }
+
+// BeginTx starts a transaction, the DB itself
+func (db *DB) BeginTx(ctx context.Context, opts pgx.TxOptions) (pgx.Tx, error) { return db, nil }
+
+// Commit marks the DB committed
+func (db *DB) Commit(ctx context.Context) error {
+	db.Committed = true
+	return nil
+}
+
+// Rollback does nothing, the statements stay recorded
+func (db *DB) Rollback(ctx context.Context) error { return nil }
+
+// Exec runs a statement
+func (db *DB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	r := db.run(sql, args)
+	return pgconn.NewCommandTag(r.Tag), r.Err
+}
+
+// Query runs a query
+func (db *DB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	r := db.run(sql, args)
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	return &rows{values: r.Rows, index: -1}, nil
+}
+
+// QueryRow runs a query returning at most one row; Scan returns pgx.ErrNoRows without rows
+func (db *DB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	r := db.run(sql, args)
+	return row{values: r.Rows, err: r.Err}
+}
+
+type row struct {
+	values [][]any
+	err    error
+}
+
+func (r row) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	if len(r.values) == 0 {
+		return pgx.ErrNoRows
+	}
+	return scan(r.values[0], dest)
+}
+
+// rows implements pgx.Rows over values
+type rows struct {
+	values [][]any
+	index  int
+	err    error
+}
+
+func (r *rows) Close()                                       {}
+func (r *rows) Err() error                                   { return r.err }
+func (r *rows) CommandTag() pgconn.CommandTag                { return pgconn.NewCommandTag("SELECT") }
+func (r *rows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (r *rows) RawValues() [][]byte                          { return nil }
+func (r *rows) Conn() *pgx.Conn                              { return nil }
+
+func (r *rows) Next() bool {
+	if r.err != nil || r.index+1 >= len(r.values) {
+		return false
+	}
+	r.index++
+	return true
+}
+
+func (r *rows) Scan(dest ...any) error {
+	if err := scan(r.values[r.index], dest); err != nil {
+		r.err = err
+		return err
+	}
+	return nil
+}
+
+func (r *rows) Values() ([]any, error) { return r.values[r.index], nil }
+
+// scan assigns values to the pointers of dest, converting between numeric types and allocating
+// pointer destinations for non-nil values
+func scan(values []any, dest []any) error {
+	if len(values) != len(dest) {
+		return fmt.Errorf("dbtest: scanning %d values into %d destinations", len(values), len(dest))
+	}
+	for i, d := range dest {
+		if d == nil {
+			continue
+		}
+		target := reflect.ValueOf(d)
+		if target.Kind() != reflect.Pointer {
+			return fmt.Errorf("dbtest: destination %d is not a pointer", i)
+		}
+		target = target.Elem()
+		if values[i] == nil {
+			target.SetZero()
+			continue
+		}
+		if target.Kind() == reflect.Pointer {
+			target.Set(reflect.New(target.Type().Elem()))
+			target = target.Elem()
+		}
+		v := reflect.ValueOf(values[i])
+		if !v.CanConvert(target.Type()) {
+			return fmt.Errorf("dbtest: cannot scan %T into %s", values[i], target.Type())
+		}
+		target.Set(v.Convert(target.Type()))
+	}
+	return nil
+}
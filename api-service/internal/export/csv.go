@@ -0,0 +1,55 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+type csvWriter struct {
+	w    *csv.Writer
+	rows int
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	// The byte order mark makes Excel open the file as UTF-8
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return nil, err
+	}
+	cw := &csvWriter{w: csv.NewWriter(w)}
+	return cw, cw.w.Write(header)
+}
+
+func (c *csvWriter) Write(rec Record) error {
+	group := ""
+	if rec.GroupID != nil {
+		group = strconv.FormatInt(*rec.GroupID, 10)
+	}
+	err := c.w.Write([]string{
+		strconv.Itoa(rec.ID),
+		rec.Timestamp.Format("2006-01-02 15:04:05"),
+		operationLabel(rec.OperationType),
+		strconv.FormatFloat(float64(rec.AmountCents)/100, 'f', 2, 64),
+		rec.Currency,
+		rec.Category,
+		rec.Subcategory,
+		rec.Username,
+		rec.Description,
+		yesNo(rec.IsShared),
+		group,
+	})
+	if err != nil {
+		return err
+	}
+	// Hand rows to the client in batches instead of buffering the whole file
+	if c.rows++; c.rows%500 == 0 {
+		c.w.Flush()
+		return c.w.Error()
+	}
+	return nil
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
@@ -0,0 +1,85 @@
+// Package export writes transactions as CSV, XLSX or JSON one record at a time,
+// so an export never holds the whole result in memory.
+package export
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// Export formats
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+	FormatJSON = "json"
+)
+
+// ErrUnknownFormat is returned for formats other than csv, xlsx and json
+var ErrUnknownFormat = errors.New("format must be csv, xlsx or json")
+
+// Record is one exported transaction; Timestamp is already in the calendar it should be shown in
+type Record struct {
+	ID            int
+	Timestamp     time.Time
+	OperationType string // expense or income
+	AmountCents   int
+	Currency      string // ISO 4217 code the amount is in
+	Category      string
+	Subcategory   string
+	Username      string
+	Description   string
+	IsShared      bool
+	GroupID       *int64
+}
+
+// Writer writes records; Close completes the file and must be called even when nothing was written
+type Writer interface {
+	Write(rec Record) error
+	Close() error
+}
+
+// header of the spreadsheet formats
+var header = []string{"ID", "Дата", "Тип", "Сумма", "Валюта", "Категория", "Подкатегория", "Пользователь", "Описание", "Общий", "Группа"}
+
+// NewWriter returns a writer of the format on top of w
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w)
+	case FormatXLSX:
+		return newXLSXWriter(w)
+	case FormatJSON:
+		return newJSONWriter(w), nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+// ContentType returns the MIME type of the format
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "application/json"
+}
+
+// operationLabel names the operation type for spreadsheet readers
+func operationLabel(operationType string) string {
+	switch operationType {
+	case "income":
+		return "Доход"
+	case "transfer":
+		return "Перевод"
+	}
+	return "Расход"
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "да"
+	}
+	return "нет"
+}
@@ -0,0 +1,124 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testRecords() []Record {
+	moscow := time.FixedZone("MSK", 3*3600)
+	group := int64(-100123)
+	return []Record{
+		{ID: 1, Timestamp: time.Date(2026, 3, 5, 12, 30, 0, 0, moscow), OperationType: "expense", AmountCents: 125050, Currency: "RUB",
+			Category: "Продукты", Subcategory: "Овощи", Username: "anna", Description: `Пятёрочка "у дома", <Москва>`},
+		{ID: 2, Timestamp: time.Date(2026, 3, 6, 9, 0, 0, 0, moscow), OperationType: "income", AmountCents: 5000000, Currency: "EUR",
+			Username: "anna", IsShared: true, GroupID: &group},
+	}
+}
+
+func write(t *testing.T, format string, records []Record) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(format, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range records {
+		if err := w.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCSV(t *testing.T) {
+	got := string(write(t, FormatCSV, testRecords()))
+	want := "\ufeffID,Дата,Тип,Сумма,Валюта,Категория,Подкатегория,Пользователь,Описание,Общий,Группа\n" +
+		"1,2026-03-05 12:30:00,Расход,1250.50,RUB,Продукты,Овощи,anna,\"Пятёрочка \"\"у дома\"\", <Москва>\",нет,\n" +
+		"2,2026-03-06 09:00:00,Доход,50000.00,EUR,,,anna,,да,-100123\n"
+	if got != want {
+		t.Errorf("csv =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var records []jsonRecord
+	if err := json.Unmarshal(write(t, FormatJSON, testRecords()), &records); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Timestamp != "2026-03-05T12:30:00+03:00" || records[1].GroupID == nil || *records[1].GroupID != -100123 {
+		t.Errorf("json = %+v", records)
+	}
+
+	if got := string(write(t, FormatJSON, nil)); got != "[]\n" {
+		t.Errorf("empty json = %q", got)
+	}
+}
+
+func TestXLSX(t *testing.T) {
+	data := write(t, FormatXLSX, testRecords())
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := make(map[string]string)
+	for _, f := range archive.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		parts[f.Name] = string(content)
+
+		// Every part must be well-formed XML
+		decoder := xml.NewDecoder(bytes.NewReader(content))
+		for {
+			if _, err := decoder.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: %v", f.Name, err)
+			}
+		}
+	}
+
+	sheet, ok := parts["xl/worksheets/sheet1.xml"]
+	if !ok {
+		t.Fatal("no sheet in workbook")
+	}
+	for _, want := range []string{
+		`<c r="D2" s="2"><v>1250.50</v></c>`,
+		// 2026-03-05 12:30 wall clock
+		`<c r="B2" s="1"><v>46086.520833</v></c>`,
+		`&lt;Москва&gt;`,
+		`<c r="K3" s="0"><v>-100123</v></c>`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet has no %s", want)
+		}
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	for col, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if got := columnName(col); got != want {
+			t.Errorf("columnName(%d) = %s, want %s", col, got, want)
+		}
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if _, err := NewWriter("pdf", io.Discard); err != ErrUnknownFormat {
+		t.Errorf("NewWriter(pdf) error = %v", err)
+	}
+}
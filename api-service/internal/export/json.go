@@ -0,0 +1,66 @@
+package export
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+type jsonRecord struct {
+	ID              int    `json:"id"`
+	Timestamp       string `json:"timestamp"`
+	OperationType   string `json:"operation_type"`
+	AmountCents     int    `json:"amount_cents"`
+	Currency        string `json:"currency"`
+	CategoryName    string `json:"category_name"`
+	SubcategoryName string `json:"subcategory_name"`
+	Username        string `json:"username"`
+	Description     string `json:"description"`
+	IsShared        bool   `json:"is_shared"`
+	GroupID         *int64 `json:"group_id"`
+}
+
+// jsonWriter writes a JSON array, one element per record
+type jsonWriter struct {
+	w     io.Writer
+	count int
+}
+
+func newJSONWriter(w io.Writer) *jsonWriter {
+	return &jsonWriter{w: w}
+}
+
+func (j *jsonWriter) Write(rec Record) error {
+	prefix := ",\n"
+	if j.count == 0 {
+		prefix = "[\n"
+	}
+	j.count++
+	data, err := json.Marshal(jsonRecord{
+		ID:              rec.ID,
+		Timestamp:       rec.Timestamp.Format(time.RFC3339),
+		OperationType:   rec.OperationType,
+		AmountCents:     rec.AmountCents,
+		Currency:        rec.Currency,
+		CategoryName:    rec.Category,
+		SubcategoryName: rec.Subcategory,
+		Username:        rec.Username,
+		Description:     rec.Description,
+		IsShared:        rec.IsShared,
+		GroupID:         rec.GroupID,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(j.w, prefix+string(data))
+	return err
+}
+
+func (j *jsonWriter) Close() error {
+	if j.count == 0 {
+		_, err := io.WriteString(j.w, "[]\n")
+		return err
+	}
+	_, err := io.WriteString(j.w, "\n]\n")
+	return err
+}
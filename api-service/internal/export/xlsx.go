@@ -0,0 +1,175 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The workbook parts besides the sheet are fixed
+var xlsxParts = []struct{ name, content string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+</Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Операции" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`},
+	// Cell styles: 0 default, 1 date and time, 2 amount with two decimals, 3 bold header
+	{"xl/styles.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="1"><numFmt numFmtId="164" formatCode="dd.mm.yyyy hh:mm"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="4">
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="4" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>
+</cellXfs>
+</styleSheet>`},
+}
+
+const (
+	styleDate   = 1
+	styleAmount = 2
+	styleHeader = 3
+)
+
+// excelEpoch is day zero of Excel's 1900 date system (with its leap year bug accounted for)
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// xlsxWriter writes a single-sheet workbook; the sheet is compressed into the zip as rows arrive
+type xlsxWriter struct {
+	zip   *zip.Writer
+	sheet io.Writer
+	row   int
+	buf   strings.Builder
+}
+
+func newXLSXWriter(w io.Writer) (*xlsxWriter, error) {
+	x := &xlsxWriter{zip: zip.NewWriter(w)}
+	for _, part := range xlsxParts {
+		f, err := x.zip.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	sheet, err := x.zip.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	x.sheet = sheet
+	_, err = io.WriteString(sheet, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>
+<cols><col min="2" max="2" width="17" customWidth="1"/><col min="6" max="9" width="22" customWidth="1"/></cols>
+<sheetData>`)
+	if err != nil {
+		return nil, err
+	}
+
+	x.startRow()
+	for col, title := range header {
+		x.stringCell(col, title, styleHeader)
+	}
+	return x, x.endRow()
+}
+
+func (x *xlsxWriter) Write(rec Record) error {
+	x.startRow()
+	x.numberCell(0, strconv.Itoa(rec.ID), 0)
+	days := rec.Timestamp.Sub(excelEpoch.Add(-offset(rec.Timestamp))).Hours() / 24
+	x.numberCell(1, strconv.FormatFloat(days, 'f', 6, 64), styleDate)
+	x.stringCell(2, operationLabel(rec.OperationType), 0)
+	x.numberCell(3, strconv.FormatFloat(float64(rec.AmountCents)/100, 'f', 2, 64), styleAmount)
+	x.stringCell(4, rec.Currency, 0)
+	x.stringCell(5, rec.Category, 0)
+	x.stringCell(6, rec.Subcategory, 0)
+	x.stringCell(7, rec.Username, 0)
+	x.stringCell(8, rec.Description, 0)
+	x.stringCell(9, yesNo(rec.IsShared), 0)
+	if rec.GroupID != nil {
+		x.numberCell(10, strconv.FormatInt(*rec.GroupID, 10), 0)
+	}
+	return x.endRow()
+}
+
+func (x *xlsxWriter) Close() error {
+	if _, err := io.WriteString(x.sheet, "</sheetData>\n</worksheet>"); err != nil {
+		return err
+	}
+	return x.zip.Close()
+}
+
+// offset returns the UTC offset of t, so that the serial date shows the wall clock of t's location
+func offset(t time.Time) time.Duration {
+	_, seconds := t.Zone()
+	return time.Duration(seconds) * time.Second
+}
+
+func (x *xlsxWriter) startRow() {
+	x.row++
+	x.buf.Reset()
+	fmt.Fprintf(&x.buf, `<row r="%d">`, x.row)
+}
+
+func (x *xlsxWriter) endRow() error {
+	x.buf.WriteString("</row>\n")
+	_, err := io.WriteString(x.sheet, x.buf.String())
+	return err
+}
+
+func (x *xlsxWriter) numberCell(col int, value string, style int) {
+	fmt.Fprintf(&x.buf, `<c r="%s%d" s="%d"><v>%s</v></c>`, columnName(col), x.row, style, value)
+}
+
+func (x *xlsxWriter) stringCell(col int, value string, style int) {
+	if value == "" {
+		return
+	}
+	fmt.Fprintf(&x.buf, `<c r="%s%d" s="%d" t="inlineStr"><is><t xml:space="preserve">`, columnName(col), x.row, style)
+	xml.EscapeText(&x.buf, []byte(strings.Map(xmlChar, value)))
+	x.buf.WriteString("</t></is></c>")
+}
+
+// xmlChar drops the control characters XML 1.0 does not allow
+func xmlChar(r rune) rune {
+	if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+		return -1
+	}
+	return r
+}
+
+// columnName converts a 0-based column index to A, B, ..., Z, AA, ...
+func columnName(col int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name
+}
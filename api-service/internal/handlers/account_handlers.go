@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/expense-tracker/api-service/internal/auth"
+	"github.com/expense-tracker/api-service/internal/currency"
+	"github.com/expense-tracker/api-service/internal/repository"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// Account types
+const (
+	accountCash       = "cash"
+	accountDebitCard  = "debit_card"
+	accountCreditCard = "credit_card"
+	accountSavings    = "savings"
+)
+
+// maxAccountNameLength limits account names, as the accounts.name column does
+const maxAccountNameLength = 100
+
+// errUnknownAccount is returned for an account that is missing, archived or belongs to another user
+var errUnknownAccount = errors.New("account not found")
+
+// AccountHandlers handles the user's accounts: cash, cards and savings
+type AccountHandlers struct {
+	DB   *pgxpool.Pool
+	Auth *auth.Auth
+}
+
+// NewAccountHandlers creates a new AccountHandlers instance
+func NewAccountHandlers(db *pgxpool.Pool, auth *auth.Auth) *AccountHandlers {
+	return &AccountHandlers{
+		DB:   db,
+		Auth: auth,
+	}
+}
+
+type accountRequest struct {
+	Name                string `json:"name"`
+	Type                string `json:"type"`     // cash, debit_card, credit_card or savings
+	Currency            string `json:"currency"` // the user's base currency by default
+	OpeningBalanceCents int64  `json:"opening_balance_cents"`
+	IsArchived          bool   `json:"is_archived"` // updates only
+}
+
+type accountResponse struct {
+	ID                  int    `json:"id"`
+	Name                string `json:"name"`
+	Type                string `json:"type"`
+	Currency            string `json:"currency"`
+	OpeningBalanceCents int64  `json:"opening_balance_cents"`
+	BalanceCents        int64  `json:"balance_cents"` // opening balance plus the account's transactions, in its currency
+	IsArchived          bool   `json:"is_archived"`
+}
+
+// validate normalizes the request; the currency is checked against the rates separately
+func (req *accountRequest) validate() error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return errors.New("name is required")
+	}
+	if utf8.RuneCountInString(req.Name) > maxAccountNameLength {
+		return errors.New("name is too long")
+	}
+	switch req.Type {
+	case accountCash, accountDebitCard, accountCreditCard, accountSavings:
+	default:
+		return errors.New("type must be cash, debit_card, credit_card or savings")
+	}
+	return nil
+}
+
+// accountBalanceColumns selects an account (alias a) with its balance in the account currency
+var accountBalanceColumns = `a.id, a.name, a.type, a.currency, a.opening_balance_cents, a.is_archived,
+	` + repository.AccountBalanceSQL("a")
+
+func scanAccount(row pgx.Row) (accountResponse, error) {
+	var a accountResponse
+	err := row.Scan(&a.ID, &a.Name, &a.Type, &a.Currency, &a.OpeningBalanceCents, &a.IsArchived, &a.BalanceCents)
+	return a, err
+}
+
+// accountBalances returns the user's accounts with their running balances, archived ones last
+func accountBalances(ctx context.Context, db *pgxpool.Pool, userID int64) ([]accountResponse, error) {
+	rows, err := db.Query(ctx, `SELECT `+accountBalanceColumns+` FROM accounts a WHERE a.user_id = $1 ORDER BY a.is_archived, a.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []accountResponse{}
+	for rows.Next() {
+		a, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, a)
+	}
+	return accounts, rows.Err()
+}
+
+// accountCurrency returns the currency of an active account of the user, or errUnknownAccount
+func accountCurrency(ctx context.Context, q repository.Querier, userID int64, accountID int) (string, error) {
+	var code string
+	err := q.QueryRow(ctx, `SELECT currency FROM accounts WHERE id = $1 AND user_id = $2 AND NOT is_archived`, accountID, userID).Scan(&code)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("%w: %d", errUnknownAccount, accountID)
+	}
+	return code, err
+}
+
+// isUniqueViolation tells whether err is a unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// decodeAccountRequest reads and validates a create/update request; it writes the error response itself
+func (h *AccountHandlers) decodeAccountRequest(w http.ResponseWriter, r *http.Request, userID int64) (*accountRequest, bool) {
+	var req accountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return nil, false
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	var err error
+	if req.Currency == "" {
+		req.Currency, err = currency.BaseOf(r.Context(), h.DB, userID)
+	} else {
+		req.Currency, err = currency.Check(r.Context(), h.DB, req.Currency)
+	}
+	if err != nil {
+		writeCurrencyError(w, err)
+		return nil, false
+	}
+	return &req, true
+}
+
+// GetAccounts returns the user's accounts with their balances.
+// GET /api/accounts
+func (h *AccountHandlers) GetAccounts(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	accounts, err := accountBalances(r.Context(), h.DB, userID)
+	if err != nil {
+		log.Error().Err(err).Msg("select accounts")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"accounts": accounts})
+}
+
+// CreateAccount creates an account of the user.
+// POST /api/accounts
+func (h *AccountHandlers) CreateAccount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	req, ok := h.decodeAccountRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	account, err := scanAccount(h.DB.QueryRow(r.Context(), `
+		INSERT INTO accounts AS a (user_id, name, type, currency, opening_balance_cents)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+accountBalanceColumns,
+		userID, req.Name, req.Type, req.Currency, req.OpeningBalanceCents))
+	if isUniqueViolation(err) {
+		http.Error(w, "account name already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("insert account")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(account)
+	log.Info().Int64("user_id", userID).Int("account_id", account.ID).Str("type", account.Type).Msg("account created")
+}
+
+// UpdateAccount replaces an account's settings. The currency of an account with transactions cannot change,
+// their amounts are in it.
+// PUT /api/accounts/{id}
+func (h *AccountHandlers) UpdateAccount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	accountID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid account id", http.StatusBadRequest)
+		return
+	}
+	req, ok := h.decodeAccountRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	var changesCurrency bool
+	err = h.DB.QueryRow(r.Context(), `
+		SELECT currency <> $3 AND EXISTS (SELECT 1 FROM expenses WHERE account_id = a.id)
+		FROM accounts a WHERE a.id = $1 AND a.user_id = $2
+	`, accountID, userID, req.Currency).Scan(&changesCurrency)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "account not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("select account")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+	if changesCurrency {
+		http.Error(w, "the currency of an account with transactions cannot be changed", http.StatusBadRequest)
+		return
+	}
+
+	account, err := scanAccount(h.DB.QueryRow(r.Context(), `
+		UPDATE accounts a SET name = $3, type = $4, currency = $5, opening_balance_cents = $6, is_archived = $7
+		WHERE a.id = $1 AND a.user_id = $2
+		RETURNING `+accountBalanceColumns,
+		accountID, userID, req.Name, req.Type, req.Currency, req.OpeningBalanceCents, req.IsArchived))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "account not found", http.StatusNotFound)
+		return
+	}
+	if isUniqueViolation(err) {
+		http.Error(w, "account name already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("update account")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(account)
+	log.Info().Int64("user_id", userID).Int("account_id", accountID).Msg("account updated")
+}
+
+// DeleteAccount deletes an account without transactions and archives one with transactions,
+// so their history keeps the account.
+// DELETE /api/accounts/{id}
+func (h *AccountHandlers) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	accountID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid account id", http.StatusBadRequest)
+		return
+	}
+
+	var status string
+	err = h.DB.QueryRow(r.Context(), `
+		WITH used AS (
+			SELECT EXISTS (SELECT 1 FROM expenses WHERE account_id = $1) AS used
+		), archived AS (
+			UPDATE accounts SET is_archived = true
+			WHERE id = $1 AND user_id = $2 AND (SELECT used FROM used)
+			RETURNING 'archived'::text AS status
+		), deleted AS (
+			DELETE FROM accounts
+			WHERE id = $1 AND user_id = $2 AND NOT (SELECT used FROM used)
+			RETURNING 'deleted'::text AS status
+		)
+		SELECT status FROM archived UNION ALL SELECT status FROM deleted
+	`, accountID, userID).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "account not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("delete account")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": status})
+	log.Info().Int64("user_id", userID).Int("account_id", accountID).Str("status", status).Msg("account deleted")
+}
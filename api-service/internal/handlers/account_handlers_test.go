@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccountRequestValidate(t *testing.T) {
+	req := accountRequest{Name: "  Наличные ", Type: accountCash}
+	if err := req.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if req.Name != "Наличные" {
+		t.Errorf("name = %q, want it trimmed", req.Name)
+	}
+
+	tests := []struct {
+		name string
+		req  accountRequest
+		ok   bool
+	}{
+		{"credit card with debt", accountRequest{Name: "Кредитка", Type: accountCreditCard, OpeningBalanceCents: -500000}, true},
+		{"savings", accountRequest{Name: "Вклад", Type: accountSavings, Currency: "USD"}, true},
+		{"longest name", accountRequest{Name: strings.Repeat("я", maxAccountNameLength), Type: accountDebitCard}, true},
+		{"no name", accountRequest{Name: " ", Type: accountCash}, false},
+		{"name too long", accountRequest{Name: strings.Repeat("я", maxAccountNameLength+1), Type: accountCash}, false},
+		{"no type", accountRequest{Name: "Кошелёк"}, false},
+		{"unknown type", accountRequest{Name: "Кошелёк", Type: "crypto"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.req.validate(); (err == nil) != tt.ok {
+				t.Errorf("validate() err = %v, want ok = %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestTransferRequestValidate(t *testing.T) {
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	toAmount := func(v int64) *int64 { return &v }
+
+	req := transferRequest{FromAccountID: 1, ToAccountID: 2, AmountCents: 100000, Description: " снял наличные "}
+	ts, err := req.validate(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ts.Equal(now) || req.Description != "снял наличные" {
+		t.Errorf("defaults: timestamp = %v, description = %q", ts, req.Description)
+	}
+
+	tests := []struct {
+		name string
+		req  transferRequest
+		ok   bool
+	}{
+		{"with timestamp", transferRequest{FromAccountID: 1, ToAccountID: 2, AmountCents: 100, Timestamp: "2026-03-01T10:00:00+03:00"}, true},
+		{"with destination amount", transferRequest{FromAccountID: 1, ToAccountID: 2, AmountCents: 100, ToAmountCents: toAmount(1)}, true},
+		{"same account", transferRequest{FromAccountID: 1, ToAccountID: 1, AmountCents: 100}, false},
+		{"no source", transferRequest{ToAccountID: 2, AmountCents: 100}, false},
+		{"zero amount", transferRequest{FromAccountID: 1, ToAccountID: 2}, false},
+		{"negative destination amount", transferRequest{FromAccountID: 1, ToAccountID: 2, AmountCents: 100, ToAmountCents: toAmount(-1)}, false},
+		{"bad timestamp", transferRequest{FromAccountID: 1, ToAccountID: 2, AmountCents: 100, Timestamp: "15.03.2026"}, false},
+		{"long cyrillic description", transferRequest{FromAccountID: 1, ToAccountID: 2, AmountCents: 100, Description: strings.Repeat("я", maxDescriptionLength)}, true},
+		{"description too long", transferRequest{FromAccountID: 1, ToAccountID: 2, AmountCents: 100, Description: strings.Repeat("я", maxDescriptionLength+1)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.req.validate(now); (err == nil) != tt.ok {
+				t.Errorf("validate() err = %v, want ok = %v", err, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/expense-tracker/api-service/internal/auth"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// analyticsTimeout bounds a proxied request; analyses may wait for the LLM, analytics-service
+// itself gives up after a minute
+const analyticsTimeout = 60 * time.Second
+
+// analyticsDenied are the analytics-service endpoints web users may not call: sending
+// Telegram messages to arbitrary chats is for the scheduler and operators
+var analyticsDenied = map[string]bool{"POST /api/v1/messages/send": true}
+
+// AnalyticsHandlers proxies /api/analytics/* (and /internal/analytics/* for the bot) to
+// analytics-service /api/v1/* on behalf of the caller
+type AnalyticsHandlers struct {
+	DB      *pgxpool.Pool
+	Auth    *auth.Auth
+	proxy   *httputil.ReverseProxy
+	timeout time.Duration
+}
+
+// NewAnalyticsHandlers creates a new AnalyticsHandlers instance proxying to ANALYTICS_URL
+func NewAnalyticsHandlers(db *pgxpool.Pool, auth *auth.Auth) *AnalyticsHandlers {
+	target, err := url.Parse(analyticsURL())
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid ANALYTICS_URL")
+	}
+	return &AnalyticsHandlers{
+		DB:      db,
+		Auth:    auth,
+		proxy:   newAnalyticsProxy(target),
+		timeout: analyticsTimeout,
+	}
+}
+
+// analyticsURL returns the base URL of analytics-service
+func analyticsURL() string {
+	if u := os.Getenv("ANALYTICS_URL"); u != "" {
+		return u
+	}
+	return "http://analytics:8081"
+}
+
+// newAnalyticsProxy creates the reverse proxy to target. Bodies are streamed both ways; upstream
+// errors and error responses become JSON errors like the ones of the proxy itself.
+func newAnalyticsProxy(target *url.URL) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+		},
+		FlushInterval:  -1,
+		ModifyResponse: jsonAnalyticsError,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			switch {
+			case errors.Is(err, context.DeadlineExceeded):
+				writeAnalyticsError(w, http.StatusGatewayTimeout, "Analytics service timed out")
+			case errors.Is(err, context.Canceled):
+				// The client went away, there is nobody to answer
+			default:
+				log.Error().Err(err).Str("path", r.URL.Path).Msg("analytics proxy")
+				writeAnalyticsError(w, http.StatusBadGateway, "Analytics service unavailable")
+			}
+		},
+	}
+}
+
+// writeAnalyticsError writes the error body of the analytics endpoints
+func writeAnalyticsError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"status": "error", "message": message})
+}
+
+// jsonAnalyticsError turns a plain text error response of analytics-service into a JSON error,
+// keeping its status code
+func jsonAnalyticsError(resp *http.Response) error {
+	if resp.StatusCode < 400 || strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return nil
+	}
+	text, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	message := strings.TrimSpace(string(text))
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+	body, _ := json.Marshal(map[string]string{"status": "error", "message": message})
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Header.Set("Content-Type", "application/json")
+	return nil
+}
+
+// forward proxies r to analytics-service /api/v1/<rest>. A non-zero telegramID replaces any
+// telegram_id of the request, analytics-service resolves the scope and checks group membership from it.
+func (h *AnalyticsHandlers) forward(w http.ResponseWriter, r *http.Request, rest string, telegramID int64) {
+	target := path.Clean("/api/v1/" + rest)
+	if !strings.HasPrefix(target, "/api/v1/") {
+		writeAnalyticsError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+	defer cancel()
+	// The server's write timeout is shorter than an analysis may take
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(h.timeout + 5*time.Second)); err != nil {
+		log.Warn().Err(err).Msg("extend write deadline for analytics")
+	}
+
+	out := r.Clone(ctx)
+	out.URL.Path, out.URL.RawPath = target, ""
+	if telegramID != 0 {
+		query := out.URL.Query()
+		query.Set("telegram_id", strconv.FormatInt(telegramID, 10))
+		out.URL.RawQuery = query.Encode()
+	}
+	// analytics-service trusts its callers, the credentials stay here
+	out.Header.Del("Authorization")
+	out.Header.Del("X-BOT-KEY")
+	out.Header.Del("Cookie")
+	h.proxy.ServeHTTP(w, out)
+}
+
+// ProxyAnalytics forwards /api/analytics/* to analytics-service /api/v1/* as the authenticated user:
+// GET /api/analytics/forecast, GET /api/analytics/analyze, POST /api/analytics/summary, GET /api/analytics/health ...
+func (h *AnalyticsHandlers) ProxyAnalytics(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	rest := chi.URLParam(r, "*")
+	if analyticsDenied[r.Method+" "+path.Clean("/api/v1/"+rest)] {
+		writeAnalyticsError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	var telegramID int64
+	if err := h.DB.QueryRow(r.Context(), "SELECT telegram_id FROM users WHERE id = $1", userID).Scan(&telegramID); err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	h.forward(w, r, rest, telegramID)
+}
+
+// InternalProxyAnalytics forwards /internal/analytics/* to analytics-service /api/v1/* for the bot,
+// which passes the telegram_id of the user itself
+func (h *AnalyticsHandlers) InternalProxyAnalytics(w http.ResponseWriter, r *http.Request) {
+	if !botAuthorized(w, r) {
+		return
+	}
+	h.forward(w, r, chi.URLParam(r, "*"), 0)
+}
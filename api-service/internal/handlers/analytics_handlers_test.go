@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// analyticsStub starts a fake analytics-service and returns handlers proxying to it
+func analyticsStub(t *testing.T, handler http.HandlerFunc) *AnalyticsHandlers {
+	t.Helper()
+	upstream := httptest.NewServer(handler)
+	t.Cleanup(upstream.Close)
+	target, _ := url.Parse(upstream.URL)
+	return &AnalyticsHandlers{proxy: newAnalyticsProxy(target), timeout: time.Second}
+}
+
+func decodeAnalyticsError(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || body["status"] != "error" {
+		t.Fatalf("error body = %v, %v", body, err)
+	}
+	return body["message"]
+}
+
+func TestAnalyticsProxyForwards(t *testing.T) {
+	h := analyticsStub(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/forecast" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		if got := r.URL.Query(); got.Get("telegram_id") != "42" || got.Get("period") != "week" {
+			t.Errorf("query = %v, want the caller's telegram_id and the period", got)
+		}
+		if r.Header.Get("Authorization") != "" || r.Header.Get("X-BOT-KEY") != "" {
+			t.Errorf("credentials forwarded: %v", r.Header)
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/analytics/forecast?period=week&telegram_id=7", strings.NewReader(`{"a":1}`))
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set("X-BOT-KEY", "key")
+	rec := httptest.NewRecorder()
+	h.forward(rec, req, "forecast", 42)
+
+	if rec.Code != http.StatusCreated || rec.Body.String() != `{"a":1}` {
+		t.Errorf("response = %d %q, want the upstream status and body", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAnalyticsProxyKeepsBotTelegramID(t *testing.T) {
+	h := analyticsStub(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("telegram_id") != "7" {
+			t.Errorf("query = %v", r.URL.Query())
+		}
+	})
+	rec := httptest.NewRecorder()
+	h.forward(rec, httptest.NewRequest(http.MethodGet, "/internal/analytics/analyze?telegram_id=7", nil), "analyze", 0)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d", rec.Code)
+	}
+}
+
+func TestAnalyticsProxyErrors(t *testing.T) {
+	h := analyticsStub(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/analyze":
+			http.Error(w, "forbidden", http.StatusForbidden)
+		case "/api/v1/slow":
+			time.Sleep(200 * time.Millisecond)
+		}
+	})
+	h.timeout = 50 * time.Millisecond
+
+	rec := httptest.NewRecorder()
+	h.forward(rec, httptest.NewRequest(http.MethodGet, "/", nil), "analyze", 42)
+	if rec.Code != http.StatusForbidden || decodeAnalyticsError(t, rec) != "forbidden" {
+		t.Errorf("upstream error: status = %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.forward(rec, httptest.NewRequest(http.MethodGet, "/", nil), "slow", 42)
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("timeout: status = %d, want 504", rec.Code)
+	}
+	decodeAnalyticsError(t, rec)
+
+	rec = httptest.NewRecorder()
+	h.forward(rec, httptest.NewRequest(http.MethodGet, "/", nil), "../../summary", 42)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("path outside /api/v1: status = %d, want 404", rec.Code)
+	}
+
+	down := &AnalyticsHandlers{proxy: newAnalyticsProxy(&url.URL{Scheme: "http", Host: "127.0.0.1:1"}), timeout: time.Second}
+	rec = httptest.NewRecorder()
+	down.forward(rec, httptest.NewRequest(http.MethodGet, "/", nil), "health", 42)
+	if rec.Code != http.StatusBadGateway || decodeAnalyticsError(t, rec) != "Analytics service unavailable" {
+		t.Errorf("service down: status = %d, want 502", rec.Code)
+	}
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/expense-tracker/api-service/internal/auth"
+	"github.com/expense-tracker/api-service/internal/backup"
+	"github.com/expense-tracker/api-service/internal/recurring"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// maxBackupSize limits uploaded backup archives
+const maxBackupSize = 50 << 20
+
+// BackupHandlers handles backups of a user's or a group's data for moving between installations
+type BackupHandlers struct {
+	DB   *pgxpool.Pool
+	Auth *auth.Auth
+}
+
+// NewBackupHandlers creates a new BackupHandlers instance
+func NewBackupHandlers(db *pgxpool.Pool, auth *auth.Auth) *BackupHandlers {
+	return &BackupHandlers{
+		DB:   db,
+		Auth: auth,
+	}
+}
+
+// GetBackup downloads the archive of the current user or, with group_id, of a group the user is a member of.
+// GET /api/backup?group_id=
+func (h *BackupHandlers) GetBackup(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var archive *backup.Archive
+	var err error
+	name := "user"
+	if raw := r.URL.Query().Get("group_id"); raw != "" {
+		groupID, parseErr := strconv.ParseInt(raw, 10, 64)
+		if parseErr != nil {
+			http.Error(w, "invalid group_id", http.StatusBadRequest)
+			return
+		}
+		member, memberErr := isUserInGroup(r.Context(), h.DB, groupID, userID)
+		if memberErr != nil {
+			log.Error().Err(memberErr).Msg("check group membership")
+			http.Error(w, "internal", http.StatusInternalServerError)
+			return
+		}
+		if !member {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		archive, err = backup.ExportGroup(r.Context(), h.DB, groupID)
+		name = fmt.Sprintf("group%d", groupID)
+	} else {
+		archive, err = backup.ExportUser(r.Context(), h.DB, userID)
+	}
+	if err != nil {
+		log.Error().Err(err).Int64("user_id", userID).Msg("export backup")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("expense-tracker_%s_%s.json", name, time.Now().In(recurring.Calendar()).Format(time.DateOnly))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	json.NewEncoder(w).Encode(archive)
+	log.Info().Int64("user_id", userID).Str("scope", archive.Scope).Int("expenses", len(archive.Expenses)).Msg("exported backup")
+}
+
+// RestoreBackup restores an archive uploaded as the request body. The caller must own a user archive
+// or be a member of the group of a group archive. Restoring the same archive again creates nothing.
+// POST /api/backup/restore
+func (h *BackupHandlers) RestoreBackup(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var telegramID int64
+	if err := h.DB.QueryRow(r.Context(), "SELECT telegram_id FROM users WHERE id = $1", userID).Scan(&telegramID); err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	var archive backup.Archive
+	r.Body = http.MaxBytesReader(w, r.Body, maxBackupSize)
+	if err := json.NewDecoder(r.Body).Decode(&archive); err != nil {
+		http.Error(w, "expected a backup archive up to 50 MB", http.StatusBadRequest)
+		return
+	}
+
+	result, err := backup.Restore(r.Context(), h.DB, &archive, telegramID)
+	switch {
+	case errors.Is(err, backup.ErrInvalidArchive), errors.Is(err, backup.ErrUnsupportedVersion):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, backup.ErrForbidden):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
+		log.Error().Err(err).Int64("user_id", userID).Msg("restore backup")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+
+	log.Info().Int64("user_id", userID).Str("instance", archive.Instance).Interface("created", result.Created).Msg("restored backup")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,431 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/expense-tracker/api-service/internal/auth"
+	"github.com/expense-tracker/api-service/internal/recurring"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// Budget periods
+const (
+	budgetPeriodMonth  = "month"
+	budgetPeriodWeek   = "week"
+	budgetPeriodCustom = "custom"
+)
+
+// Budget alert thresholds, in percent of the limit
+const (
+	budgetWarningPercent  = 80
+	budgetExceededPercent = 100
+)
+
+// budgetAccess limits budgets (alias b) to the user's own ones and those of the user's groups; $1 is users.id
+const budgetAccess = `(b.user_id = $1 OR b.group_id IN (
+	SELECT gm.group_id FROM group_members gm JOIN users u ON u.telegram_id = gm.user_id WHERE u.id = $1))`
+
+// budgetOwner limits budgets (alias b) to the ones the user created; group members may read a group
+// budget but only its author may change or delete it
+const budgetOwner = `b.user_id = $1`
+
+// BudgetHandlers handles budget CRUD and spent vs. limit status
+type BudgetHandlers struct {
+	DB   *pgxpool.Pool
+	Auth *auth.Auth
+}
+
+// NewBudgetHandlers creates a new BudgetHandlers instance
+func NewBudgetHandlers(db *pgxpool.Pool, auth *auth.Auth) *BudgetHandlers {
+	return &BudgetHandlers{
+		DB:   db,
+		Auth: auth,
+	}
+}
+
+type budgetRequest struct {
+	Name          string `json:"name"`
+	CategoryID    *int   `json:"category_id"`    // optional, all expenses when empty
+	SubcategoryID *int   `json:"subcategory_id"` // optional
+	GroupID       *int64 `json:"group_id"`       // optional, a family group budget
+	LimitCents    int    `json:"limit_cents"`
+	Period        string `json:"period"`     // month (default), week or custom
+	StartDate     string `json:"start_date"` // YYYY-MM-DD, default today
+	EndDate       string `json:"end_date"`   // YYYY-MM-DD, required for custom
+	Rollover      bool   `json:"rollover"`
+	IsActive      *bool  `json:"is_active"` // updates only
+}
+
+type budgetResponse struct {
+	ID            int     `json:"id"`
+	Name          string  `json:"name"`
+	CategoryID    *int    `json:"category_id"`
+	SubcategoryID *int    `json:"subcategory_id"`
+	GroupID       *int64  `json:"group_id"`
+	LimitCents    int     `json:"limit_cents"`
+	Period        string  `json:"period"`
+	StartDate     string  `json:"start_date"`
+	EndDate       *string `json:"end_date"`
+	Rollover      bool    `json:"rollover"`
+	IsActive      bool    `json:"is_active"`
+}
+
+type budgetStatusResponse struct {
+	BudgetID            int     `json:"budget_id"`
+	Name                string  `json:"name"`
+	CategoryID          *int    `json:"category_id"`
+	CategoryName        string  `json:"category_name"`
+	SubcategoryID       *int    `json:"subcategory_id"`
+	GroupID             *int64  `json:"group_id"`
+	Period              string  `json:"period"`
+	PeriodStart         string  `json:"period_start"`
+	PeriodEnd           string  `json:"period_end"`
+	LimitCents          int     `json:"limit_cents"`
+	RolloverCents       int     `json:"rollover_cents"`
+	EffectiveLimitCents int     `json:"effective_limit_cents"`
+	SpentCents          int     `json:"spent_cents"`
+	RemainingCents      int     `json:"remaining_cents"`
+	Currency            string  `json:"currency"` // the owner's base currency
+	Percent             float64 `json:"percent"`
+	Status              string  `json:"status"` // "ok", "warning" (80%+) or "exceeded" (100%+)
+}
+
+// validate normalizes the request and parses its dates
+func (req *budgetRequest) validate(today time.Time) (start time.Time, end *time.Time, err error) {
+	if req.LimitCents <= 0 {
+		return start, nil, errors.New("limit_cents must be positive")
+	}
+	if req.Period == "" {
+		req.Period = budgetPeriodMonth
+	}
+	switch req.Period {
+	case budgetPeriodMonth, budgetPeriodWeek, budgetPeriodCustom:
+	default:
+		return start, nil, fmt.Errorf("unknown period %q", req.Period)
+	}
+
+	start = today
+	if req.StartDate != "" {
+		if start, err = time.Parse(time.DateOnly, req.StartDate); err != nil {
+			return start, nil, errors.New("start_date must be YYYY-MM-DD")
+		}
+	}
+	if req.EndDate != "" {
+		parsed, err := time.Parse(time.DateOnly, req.EndDate)
+		if err != nil {
+			return start, nil, errors.New("end_date must be YYYY-MM-DD")
+		}
+		if parsed.Before(start) {
+			return start, nil, errors.New("end_date is before start_date")
+		}
+		end = &parsed
+	}
+	if req.Period == budgetPeriodCustom {
+		if end == nil {
+			return start, nil, errors.New("end_date is required for a custom period")
+		}
+		if req.Rollover {
+			return start, nil, errors.New("rollover is not supported for a custom period")
+		}
+	}
+	return start, end, nil
+}
+
+// budgetLevel returns the share of the limit spent, in percent, and the budget status
+func budgetLevel(spentCents, limitCents int) (float64, string) {
+	if limitCents <= 0 {
+		if spentCents > 0 {
+			return 100, "exceeded"
+		}
+		return 0, "ok"
+	}
+	percent := math.Round(float64(spentCents)*10000/float64(limitCents)) / 100
+	switch {
+	case spentCents*100 >= limitCents*budgetExceededPercent:
+		return percent, "exceeded"
+	case spentCents*100 >= limitCents*budgetWarningPercent:
+		return percent, "warning"
+	default:
+		return percent, "ok"
+	}
+}
+
+// checkExpenseTargets verifies the group membership and the category/subcategory pair of a budget or a
+// recurring transaction. A subcategory without a category gets the subcategory's category.
+func checkExpenseTargets(ctx context.Context, db *pgxpool.Pool, userID int64, groupID *int64, categoryID **int, subcategoryID *int) (int, error) {
+	if groupID != nil {
+		member, err := isUserInGroup(ctx, db, *groupID, userID)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if !member {
+			return http.StatusForbidden, errors.New("not a member of the group")
+		}
+	}
+	if subcategoryID != nil {
+		var parentID int
+		err := db.QueryRow(ctx, "SELECT category_id FROM subcategories WHERE id = $1", *subcategoryID).Scan(&parentID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return http.StatusBadRequest, errors.New("subcategory not found")
+		}
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if *categoryID == nil {
+			*categoryID = &parentID
+		} else if **categoryID != parentID {
+			return http.StatusBadRequest, errors.New("subcategory does not belong to the category")
+		}
+	} else if *categoryID != nil {
+		var exists bool
+		if err := db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM categories WHERE id = $1)", **categoryID).Scan(&exists); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if !exists {
+			return http.StatusBadRequest, errors.New("category not found")
+		}
+	}
+	return 0, nil
+}
+
+// writeTargetError writes the error returned by checkExpenseTargets
+func writeTargetError(w http.ResponseWriter, status int, err error) {
+	if status == http.StatusInternalServerError {
+		log.Error().Err(err).Msg("check expense targets")
+		http.Error(w, "internal", status)
+		return
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// decodeBudgetRequest reads, validates and checks a create/update request; it writes the error response itself
+func (h *BudgetHandlers) decodeBudgetRequest(w http.ResponseWriter, r *http.Request, userID int64) (*budgetRequest, time.Time, *time.Time, bool) {
+	var req budgetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return nil, time.Time{}, nil, false
+	}
+	start, end, err := req.validate(recurring.Today())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, start, nil, false
+	}
+	if status, err := checkExpenseTargets(r.Context(), h.DB, userID, req.GroupID, &req.CategoryID, req.SubcategoryID); err != nil {
+		writeTargetError(w, status, err)
+		return nil, start, nil, false
+	}
+	return &req, start, end, true
+}
+
+// scanBudget reads a budget row selected with budgetColumns
+func scanBudget(row pgx.Row) (budgetResponse, error) {
+	var b budgetResponse
+	var start time.Time
+	var end *time.Time
+	err := row.Scan(&b.ID, &b.Name, &b.CategoryID, &b.SubcategoryID, &b.GroupID, &b.LimitCents, &b.Period, &start, &end, &b.Rollover, &b.IsActive)
+	b.StartDate = start.Format(time.DateOnly)
+	if end != nil {
+		formatted := end.Format(time.DateOnly)
+		b.EndDate = &formatted
+	}
+	return b, err
+}
+
+const budgetColumns = `b.id, COALESCE(b.name, ''), b.category_id, b.subcategory_id, b.group_id, b.limit_cents, b.period, b.start_date, b.end_date, b.rollover, b.is_active`
+
+// CreateBudget creates a personal or group budget
+func (h *BudgetHandlers) CreateBudget(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	req, start, end, ok := h.decodeBudgetRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	budget, err := scanBudget(h.DB.QueryRow(r.Context(), `
+		INSERT INTO budgets AS b (user_id, group_id, category_id, subcategory_id, name, limit_cents, period, start_date, end_date, rollover)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9, $10)
+		RETURNING `+budgetColumns,
+		userID, req.GroupID, req.CategoryID, req.SubcategoryID, req.Name, req.LimitCents, req.Period, start, end, req.Rollover))
+	if err != nil {
+		log.Error().Err(err).Msg("insert budget")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(budget)
+	log.Info().Int64("user_id", userID).Int("budget_id", budget.ID).Int("limit_cents", budget.LimitCents).Str("period", budget.Period).Msg("budget created")
+}
+
+// GetBudgets returns the user's budgets and the budgets of the user's groups
+func (h *BudgetHandlers) GetBudgets(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := h.DB.Query(r.Context(), `SELECT `+budgetColumns+` FROM budgets b WHERE `+budgetAccess+` ORDER BY b.is_active DESC, b.id`, userID)
+	if err != nil {
+		log.Error().Err(err).Msg("select budgets")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	budgets := []budgetResponse{}
+	for rows.Next() {
+		budget, err := scanBudget(rows)
+		if err != nil {
+			log.Error().Err(err).Msg("scan budget")
+			http.Error(w, "internal", http.StatusInternalServerError)
+			return
+		}
+		budgets = append(budgets, budget)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(budgets)
+}
+
+// UpdateBudget replaces a budget's settings
+func (h *BudgetHandlers) UpdateBudget(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	budgetID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid budget id", http.StatusBadRequest)
+		return
+	}
+	req, start, end, ok := h.decodeBudgetRequest(w, r, userID)
+	if !ok {
+		return
+	}
+	isActive := true
+	if req.IsActive != nil {
+		isActive = *req.IsActive
+	}
+
+	budget, err := scanBudget(h.DB.QueryRow(r.Context(), `
+		UPDATE budgets b SET group_id = $3, category_id = $4, subcategory_id = $5, name = NULLIF($6, ''), limit_cents = $7,
+			period = $8, start_date = $9, end_date = $10, rollover = $11, is_active = $12, updated_at = NOW()
+		WHERE b.id = $2 AND `+budgetOwner+`
+		RETURNING `+budgetColumns,
+		userID, budgetID, req.GroupID, req.CategoryID, req.SubcategoryID, req.Name, req.LimitCents, req.Period, start, end, req.Rollover, isActive))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "budget not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("update budget")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(budget)
+	log.Info().Int64("user_id", userID).Int("budget_id", budgetID).Msg("budget updated")
+}
+
+// DeleteBudget deletes a budget together with its sent alerts
+func (h *BudgetHandlers) DeleteBudget(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	budgetID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid budget id", http.StatusBadRequest)
+		return
+	}
+
+	tag, err := h.DB.Exec(r.Context(), `DELETE FROM budgets b WHERE b.id = $2 AND `+budgetOwner, userID, budgetID)
+	if err != nil {
+		log.Error().Err(err).Msg("delete budget")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "budget not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	log.Info().Int64("user_id", userID).Int("budget_id", budgetID).Msg("budget deleted")
+}
+
+// GetBudgetStatus reports spent vs. limit for every active budget in its current period.
+// Optional query: group_id - only the budgets of that group.
+func (h *BudgetHandlers) GetBudgetStatus(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var groupID *int64
+	if v := r.URL.Query().Get("group_id"); v != "" {
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid group_id", http.StatusBadRequest)
+			return
+		}
+		groupID = &parsed
+	}
+
+	rows, err := h.DB.Query(r.Context(), `
+		SELECT b.budget_id, COALESCE(b.name, ''), b.category_id, COALESCE(c.name, ''), b.subcategory_id, b.group_id,
+			b.period, b.period_start, b.period_end, b.limit_cents, b.rollover_cents, b.spent_cents, b.currency
+		FROM v_budget_status b
+		LEFT JOIN categories c ON c.id = b.category_id
+		WHERE b.is_current AND `+budgetAccess+` AND ($2::bigint IS NULL OR b.group_id = $2)
+		ORDER BY b.budget_id
+	`, userID, groupID)
+	if err != nil {
+		log.Error().Err(err).Msg("select budget status")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	statuses := []budgetStatusResponse{}
+	for rows.Next() {
+		var s budgetStatusResponse
+		var start, end time.Time
+		if err := rows.Scan(&s.BudgetID, &s.Name, &s.CategoryID, &s.CategoryName, &s.SubcategoryID, &s.GroupID,
+			&s.Period, &start, &end, &s.LimitCents, &s.RolloverCents, &s.SpentCents, &s.Currency); err != nil {
+			log.Error().Err(err).Msg("scan budget status")
+			http.Error(w, "internal", http.StatusInternalServerError)
+			return
+		}
+		s.PeriodStart = start.Format(time.DateOnly)
+		s.PeriodEnd = end.Format(time.DateOnly)
+		s.EffectiveLimitCents = s.LimitCents + s.RolloverCents
+		s.RemainingCents = s.EffectiveLimitCents - s.SpentCents
+		s.Percent, s.Status = budgetLevel(s.SpentCents, s.EffectiveLimitCents)
+		statuses = append(statuses, s)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+	log.Info().Int64("user_id", userID).Int("count", len(statuses)).Msg("returned budget status")
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBudgetRequestValidate(t *testing.T) {
+	today := time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	req := budgetRequest{LimitCents: 1500000}
+	start, end, err := req.validate(today)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Period != budgetPeriodMonth || !start.Equal(today) || end != nil {
+		t.Errorf("defaults: period = %q, start = %v, end = %v", req.Period, start, end)
+	}
+
+	tests := []struct {
+		name string
+		req  budgetRequest
+		ok   bool
+	}{
+		{"week", budgetRequest{LimitCents: 100, Period: "week", Rollover: true}, true},
+		{"custom", budgetRequest{LimitCents: 100, Period: "custom", StartDate: "2026-03-01", EndDate: "2026-03-10"}, true},
+		{"zero limit", budgetRequest{LimitCents: 0}, false},
+		{"unknown period", budgetRequest{LimitCents: 100, Period: "year"}, false},
+		{"custom without end", budgetRequest{LimitCents: 100, Period: "custom"}, false},
+		{"custom with rollover", budgetRequest{LimitCents: 100, Period: "custom", EndDate: "2026-04-01", Rollover: true}, false},
+		{"end before start", budgetRequest{LimitCents: 100, StartDate: "2026-03-10", EndDate: "2026-03-01"}, false},
+		{"bad date", budgetRequest{LimitCents: 100, StartDate: "15.03.2026"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := tt.req.validate(today); (err == nil) != tt.ok {
+				t.Errorf("validate() err = %v, want ok = %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestBudgetLevel(t *testing.T) {
+	tests := []struct {
+		spent, limit int
+		percent      float64
+		status       string
+	}{
+		{0, 1000, 0, "ok"},
+		{799, 1000, 79.9, "ok"},
+		{800, 1000, 80, "warning"},
+		{999, 1000, 99.9, "warning"},
+		{1000, 1000, 100, "exceeded"},
+		{1500, 1000, 150, "exceeded"},
+		{1, 3, 33.33, "ok"},
+		{100, 0, 100, "exceeded"}, // rollover ate the whole limit
+	}
+	for _, tt := range tests {
+		percent, status := budgetLevel(tt.spent, tt.limit)
+		if percent != tt.percent || status != tt.status {
+			t.Errorf("budgetLevel(%d, %d) = %v, %q, want %v, %q", tt.spent, tt.limit, percent, status, tt.percent, tt.status)
+		}
+	}
+}
@@ -104,62 +104,79 @@ func (h *CategoryHandlers) DetectCategory(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Simple keyword matching for category detection
-	description := strings.ToLower(req.Description)
-
-	rows, err := h.DB.Query(r.Context(), "SELECT id, name, aliases FROM categories")
+	matcher, err := loadCategoryMatcher(r.Context(), h.DB)
 	if err != nil {
 		log.Error().Err(err).Msg("select categories for detection")
 		http.Error(w, "internal", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
 
-	var bestMatch *struct {
-		ID    int    `json:"id"`
-		Name  string `json:"name"`
-		Score int    `json:"score"`
+	w.Header().Set("Content-Type", "application/json")
+	if match, ok := matcher.match(req.Description); ok {
+		json.NewEncoder(w).Encode(match)
+	} else {
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": nil, "name": "Не определено", "score": 0})
 	}
+}
+
+type categoryMatch struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Score int    `json:"score"`
+}
+
+type matchableCategory struct {
+	id      int
+	name    string
+	aliases []string
+}
+
+// categoryMatcher detects categories by keywords; used by DetectCategory and the statement import
+type categoryMatcher []matchableCategory
 
+// loadCategoryMatcher reads all categories with their aliases
+func loadCategoryMatcher(ctx context.Context, db *pgxpool.Pool) (categoryMatcher, error) {
+	rows, err := db.Query(ctx, "SELECT id, name, aliases FROM categories ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var m categoryMatcher
 	for rows.Next() {
-		var id int
-		var name string
+		var c matchableCategory
 		var aliasesJSON []byte
-		if err := rows.Scan(&id, &name, &aliasesJSON); err != nil {
+		if err := rows.Scan(&c.id, &c.name, &aliasesJSON); err != nil {
 			continue
 		}
+		json.Unmarshal(aliasesJSON, &c.aliases)
+		m = append(m, c)
+	}
+	return m, rows.Err()
+}
 
-		var aliases []string
-		json.Unmarshal(aliasesJSON, &aliases)
-
+// match returns the category scoring best for the description: 2 points when it contains
+// the category name and 1 per contained alias
+func (m categoryMatcher) match(description string) (categoryMatch, bool) {
+	description = strings.ToLower(description)
+	var best categoryMatch
+	for _, c := range m {
 		score := 0
 		// Check if description contains category name
-		if strings.Contains(description, strings.ToLower(name)) {
+		if strings.Contains(description, strings.ToLower(c.name)) {
 			score += 2
 		}
 		// Check aliases
-		for _, alias := range aliases {
-			if strings.Contains(description, strings.ToLower(alias)) {
+		for _, alias := range c.aliases {
+			if alias != "" && strings.Contains(description, strings.ToLower(alias)) {
 				score += 1
 			}
 		}
-
-		if bestMatch == nil || score > bestMatch.Score {
-			bestMatch = &struct {
-				ID    int    `json:"id"`
-				Name  string `json:"name"`
-				Score int    `json:"score"`
-			}{ID: id, Name: name, Score: score}
+		if score > best.Score {
+			best = categoryMatch{ID: c.id, Name: c.name, Score: score}
 		}
 	}
-
-	if bestMatch != nil && bestMatch.Score > 0 {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(bestMatch)
-	} else {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{"id": nil, "name": "Не определено", "score": 0})
-	}
+	return best, best.Score > 0
 }
 
 // CreateSubcategory creates a new subcategory
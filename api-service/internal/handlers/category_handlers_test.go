@@ -0,0 +1,29 @@
+package handlers
+
+import "testing"
+
+func TestCategoryMatcher(t *testing.T) {
+	m := categoryMatcher{
+		{id: 1, name: "Продукты", aliases: []string{"пятерочка", "магнит", ""}},
+		{id: 2, name: "Транспорт", aliases: []string{"такси", "метро"}},
+		{id: 3, name: "Такси", aliases: []string{"яндекс go"}},
+	}
+
+	tests := []struct {
+		description string
+		want        int
+		score       int
+	}{
+		{"ПЯТЕРОЧКА 1234 МОСКВА", 1, 1},
+		// The name scores 2 and beats the alias of another category
+		{"Яндекс Такси", 3, 2},
+		{"Продукты в Магнит", 1, 3},
+		{"Аптека", 0, 0},
+	}
+	for _, tt := range tests {
+		match, ok := m.match(tt.description)
+		if ok != (tt.want != 0) || match.ID != tt.want || match.Score != tt.score {
+			t.Errorf("match(%q) = %+v, %v; want id %d score %d", tt.description, match, ok, tt.want, tt.score)
+		}
+	}
+}
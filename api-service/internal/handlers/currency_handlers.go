@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/expense-tracker/api-service/internal/auth"
+	"github.com/expense-tracker/api-service/internal/currency"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// maxRatesBody limits uploaded exchange rate files
+const maxRatesBody = 5 << 20
+
+// CurrencyHandlers handles currencies, exchange rates and the users' base currency
+type CurrencyHandlers struct {
+	DB   *pgxpool.Pool
+	Auth *auth.Auth
+}
+
+// NewCurrencyHandlers creates a new CurrencyHandlers instance
+func NewCurrencyHandlers(db *pgxpool.Pool, auth *auth.Auth) *CurrencyHandlers {
+	return &CurrencyHandlers{
+		DB:   db,
+		Auth: auth,
+	}
+}
+
+// writeCurrencyError maps invalid and unsupported currencies to 400 and everything else to 500
+func writeCurrencyError(w http.ResponseWriter, err error) {
+	if errors.Is(err, currency.ErrInvalidCurrency) || errors.Is(err, currency.ErrUnsupportedCurrency) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Error().Err(err).Msg("check currency")
+	http.Error(w, "internal", http.StatusInternalServerError)
+}
+
+type currencyInfo struct {
+	Code     string   `json:"code"`
+	Rate     *float64 `json:"rate"`      // rubles per unit, null for rubles
+	RateDate *string  `json:"rate_date"` // of the latest rate
+}
+
+// GetCurrencies lists the currencies transactions can be recorded in, with their latest rates,
+// and the user's base currency.
+// GET /api/currencies
+func (h *CurrencyHandlers) GetCurrencies(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	base, err := currency.BaseOf(r.Context(), h.DB, userID)
+	if err != nil {
+		log.Error().Err(err).Msg("select base currency")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := h.DB.Query(r.Context(), `
+		SELECT DISTINCT ON (currency) currency, rate::float8, rate_date
+		FROM exchange_rates
+		ORDER BY currency, rate_date DESC
+	`)
+	if err != nil {
+		log.Error().Err(err).Msg("select exchange rates")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	currencies := []currencyInfo{{Code: currency.Settlement}}
+	for rows.Next() {
+		var c currencyInfo
+		var rate float64
+		var day time.Time
+		if err := rows.Scan(&c.Code, &rate, &day); err != nil {
+			log.Error().Err(err).Msg("scan exchange rate")
+			http.Error(w, "internal", http.StatusInternalServerError)
+			return
+		}
+		date := day.Format(time.DateOnly)
+		c.Rate, c.RateDate = &rate, &date
+		currencies = append(currencies, c)
+	}
+	if err := rows.Err(); err != nil {
+		log.Error().Err(err).Msg("read exchange rates")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"base_currency": base,
+		"currencies":    currencies,
+	})
+}
+
+// SetBaseCurrency changes the currency the user's totals, balances and budgets are reported in.
+// PUT /api/currencies/base {"currency": "EUR"}
+func (h *CurrencyHandlers) SetBaseCurrency(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Currency string `json:"currency"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	writeBaseCurrency(w, r, h.DB, userID, req.Currency)
+}
+
+// writeBaseCurrency checks and stores the base currency of a user and writes it back
+func writeBaseCurrency(w http.ResponseWriter, r *http.Request, db *pgxpool.Pool, userID int64, code string) {
+	code, err := currency.Check(r.Context(), db, code)
+	if err != nil {
+		writeCurrencyError(w, err)
+		return
+	}
+	if _, err := db.Exec(r.Context(), `UPDATE users SET base_currency = $2 WHERE id = $1`, userID, code); err != nil {
+		log.Error().Err(err).Msg("update base currency")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"base_currency": code})
+	log.Info().Int64("user_id", userID).Str("currency", code).Msg("base currency changed")
+}
+
+// ImportExchangeRates stores exchange rates from a CSV (date,currency,rate) or JSON body,
+// rates are rubles per unit. Existing rates of the same currency and date are replaced.
+// POST /api/exchange-rates with Content-Type text/csv or application/json
+func (h *CurrencyHandlers) ImportExchangeRates(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	body := http.MaxBytesReader(w, r.Body, maxRatesBody)
+
+	var rates []currency.Rate
+	var err error
+	if strings.Contains(r.Header.Get("Content-Type"), "json") {
+		rates, err = currency.ParseJSON(body)
+	} else {
+		rates, err = currency.ParseCSV(body)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		log.Error().Err(err).Msg("begin exchange rates import")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+	if err := currency.Store(r.Context(), tx, rates, "manual"); err != nil {
+		log.Error().Err(err).Msg("store exchange rates")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		log.Error().Err(err).Msg("commit exchange rates")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"imported": len(rates)})
+	log.Info().Int64("user_id", userID).Int("rates", len(rates)).Msg("exchange rates imported")
+}
+
+// InternalSetBaseCurrency is SetBaseCurrency for the bot: {"telegram_id": 123, "currency": "EUR"}
+func (h *InternalHandlers) InternalSetBaseCurrency(w http.ResponseWriter, r *http.Request) {
+	if !botAuthorized(w, r) {
+		return
+	}
+	var req struct {
+		TelegramID int64  `json:"telegram_id"`
+		Currency   string `json:"currency"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	var userID int64
+	if err := h.DB.QueryRow(r.Context(), "SELECT id FROM users WHERE telegram_id=$1", req.TelegramID).Scan(&userID); err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	writeBaseCurrency(w, r, h.DB, userID, req.Currency)
+}
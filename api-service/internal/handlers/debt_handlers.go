@@ -1,11 +1,19 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"unicode/utf8"
 
 	"github.com/expense-tracker/api-service/internal/auth"
+	"github.com/expense-tracker/api-service/internal/currency"
+	"github.com/expense-tracker/api-service/internal/merchants"
+	"github.com/expense-tracker/api-service/internal/repository"
+	"github.com/expense-tracker/api-service/internal/split"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/zerolog/log"
 )
@@ -24,83 +32,237 @@ func NewDebtHandlers(db *pgxpool.Pool, auth *auth.Auth) *DebtHandlers {
 	}
 }
 
-// CreateSharedExpense creates a shared expense that can be split between users
-func (h *DebtHandlers) CreateSharedExpense(w http.ResponseWriter, r *http.Request) {
-	uid := r.Context().Value(auth.UserIDKey)
-	if uid == nil {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
-		return
+// sharedParticipant is a member of a shared expense split. Exactly one of the amount fields is used,
+// depending on the split mode.
+type sharedParticipant struct {
+	TelegramID  int64   `json:"telegram_id"`
+	AmountCents int     `json:"amount_cents,omitempty"` // exact
+	Percent     float64 `json:"percent,omitempty"`      // percent
+	Shares      int64   `json:"shares,omitempty"`       // shares
+}
+
+type sharedExpenseRequest struct {
+	AmountCents  int                 `json:"amount_cents"`
+	Description  string              `json:"description"`
+	Merchant     string              `json:"merchant"`
+	Currency     string              `json:"currency"` // the creator's base currency by default
+	CategoryID   *int                `json:"category_id"`
+	GroupID      *int64              `json:"group_id"`
+	SplitMode    string              `json:"split_mode"`   // equal (default), exact, percent, shares
+	SplitWith    []int64             `json:"split_with"`   // Telegram IDs for an equal split with the creator
+	Participants []sharedParticipant `json:"participants"` // everyone sharing the expense, may include the creator
+}
+
+type sharedExpenseShare struct {
+	TelegramID  int64 `json:"telegram_id"`
+	AmountCents int   `json:"amount_cents"`
+	DebtID      *int  `json:"debt_id,omitempty"`
+	DebtCents   int   `json:"debt_cents,omitempty"` // the debt in rubles, debts are settled in them
+}
+
+type sharedExpenseResponse struct {
+	ExpenseID   int                  `json:"expense_id"`
+	Currency    string               `json:"currency"`
+	SplitMode   string               `json:"split_mode"`
+	SplitAmount int                  `json:"split_amount"` // largest single share, kept for older clients
+	TotalPeople int                  `json:"total_people"`
+	SplitWith   []int64              `json:"split_with"`
+	Shares      []sharedExpenseShare `json:"shares"`
+}
+
+// errUnknownParticipant is returned when a participant has never used the bot or the site
+var errUnknownParticipant = errors.New("participant not found")
+
+// errTextTooLong is returned for a description or merchant over the length limit
+var errTextTooLong = errors.New("description or merchant is too long")
+
+// splitSharedExpense validates the request and computes every participant's share.
+// The creator is always part of an equal split; in the other modes the creator pays only
+// what is explicitly assigned to them.
+func splitSharedExpense(req *sharedExpenseRequest, creatorTelegramID int64) ([]sharedExpenseShare, error) {
+	if req.AmountCents <= 0 {
+		return nil, fmt.Errorf("%w: amount_cents must be positive", split.ErrInvalidWeight)
 	}
-	userID, ok := uid.(int64)
-	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
-		return
+	if utf8.RuneCountInString(req.Description) > maxDescriptionLength || utf8.RuneCountInString(req.Merchant) > merchants.MaxNameLength {
+		return nil, errTextTooLong
+	}
+	mode := req.SplitMode
+	if mode == "" {
+		mode = split.ModeEqual
 	}
+	switch mode {
+	case split.ModeEqual, split.ModeExact, split.ModePercent, split.ModeShares:
+	default:
+		return nil, fmt.Errorf("%w: unknown split_mode %q", split.ErrInvalidWeight, mode)
+	}
+	req.SplitMode = mode
 
-	var req struct {
-		AmountCents int     `json:"amount_cents"`
-		Description string  `json:"description"`
-		CategoryID  *int    `json:"category_id"`
-		SplitWith   []int64 `json:"split_with"` // Telegram IDs of users to split with
+	participants := req.Participants
+	if len(participants) == 0 {
+		for _, telegramID := range req.SplitWith {
+			participants = append(participants, sharedParticipant{TelegramID: telegramID})
+		}
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "bad request", http.StatusBadRequest)
-		return
+	if mode == split.ModeEqual {
+		hasCreator := false
+		for _, p := range participants {
+			hasCreator = hasCreator || p.TelegramID == creatorTelegramID
+		}
+		if !hasCreator {
+			participants = append([]sharedParticipant{{TelegramID: creatorTelegramID}}, participants...)
+		}
 	}
 
-	// Create the shared expense
-	var expenseID int
-	err := h.DB.QueryRow(r.Context(), `INSERT INTO expenses (user_id, amount_cents, category_id, timestamp, is_shared) VALUES ($1,$2,$3,NOW(),true) RETURNING id`,
-		userID, req.AmountCents, req.CategoryID).Scan(&expenseID)
+	seen := make(map[int64]bool, len(participants))
+	for _, p := range participants {
+		if seen[p.TelegramID] {
+			return nil, fmt.Errorf("%w: participant %d is listed twice", split.ErrInvalidWeight, p.TelegramID)
+		}
+		seen[p.TelegramID] = true
+	}
+	if len(participants) < 2 {
+		return nil, fmt.Errorf("%w: at least one other participant is required", split.ErrNoWeights)
+	}
+
+	var amounts []int
+	var err error
+	switch mode {
+	case split.ModeEqual:
+		amounts, err = split.Equal(req.AmountCents, len(participants))
+	case split.ModeExact:
+		exact := make([]int, len(participants))
+		for i, p := range participants {
+			exact[i] = p.AmountCents
+		}
+		amounts, err = split.Exact(req.AmountCents, exact)
+	case split.ModePercent:
+		percents := make([]float64, len(participants))
+		for i, p := range participants {
+			percents[i] = p.Percent
+		}
+		amounts, err = split.Percent(req.AmountCents, percents)
+	case split.ModeShares:
+		shares := make([]int64, len(participants))
+		for i, p := range participants {
+			shares[i] = p.Shares
+		}
+		amounts, err = split.Shares(req.AmountCents, shares)
+	}
 	if err != nil {
-		log.Error().Err(err).Msg("insert shared expense")
-		http.Error(w, "internal", http.StatusInternalServerError)
-		return
+		return nil, err
+	}
+
+	result := make([]sharedExpenseShare, len(participants))
+	for i, p := range participants {
+		result[i] = sharedExpenseShare{TelegramID: p.TelegramID, AmountCents: amounts[i]}
 	}
+	return result, nil
+}
 
-	// Calculate split amount per person
-	totalPeople := len(req.SplitWith) + 1 // +1 for the creator
-	splitAmount := req.AmountCents / totalPeople
-	remainder := req.AmountCents % totalPeople
+// createSharedExpense records the expense paid by creatorID and a debt for every other participant's share.
+// Everything happens in one transaction: an unknown participant or any failed insert leaves nothing behind.
+func createSharedExpense(ctx context.Context, db *pgxpool.Pool, creatorID int64, req *sharedExpenseRequest) (*sharedExpenseResponse, error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
 
-	// Create debt records for each person
-	for i, telegramID := range req.SplitWith {
-		// Get internal user ID
-		var splitUserID int64
-		err := h.DB.QueryRow(r.Context(), "SELECT id FROM users WHERE telegram_id=$1", telegramID).Scan(&splitUserID)
-		if err != nil {
-			log.Error().Err(err).Int64("telegram_id", telegramID).Msg("user not found for split")
-			continue
+	var creatorTelegramID int64
+	if err := tx.QueryRow(ctx, "SELECT telegram_id FROM users WHERE id=$1", creatorID).Scan(&creatorTelegramID); err != nil {
+		return nil, fmt.Errorf("select creator: %w", err)
+	}
+
+	shares, err := splitSharedExpense(req, creatorTelegramID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &sharedExpenseResponse{SplitMode: req.SplitMode, TotalPeople: len(shares), SplitWith: []int64{}, Shares: shares}
+	if req.Currency != "" {
+		if req.Currency, err = currency.Check(ctx, tx, req.Currency); err != nil {
+			return nil, err
 		}
+	}
+	merchantID, err := merchants.ForExpense(ctx, tx, req.Merchant, req.Description)
+	if err != nil {
+		return nil, fmt.Errorf("resolve merchant: %w", err)
+	}
+	expense := repository.Transaction{
+		UserID:      creatorID,
+		AmountCents: int64(req.AmountCents),
+		CategoryID:  req.CategoryID,
+		IsShared:    true,
+		GroupID:     req.GroupID,
+		Description: req.Description,
+		MerchantID:  merchantID,
+		Currency:    req.Currency,
+	}
+	if err := repository.Insert(ctx, tx, &expense); err != nil {
+		return nil, fmt.Errorf("insert shared expense: %w", err)
+	}
+	resp.ExpenseID, resp.Currency = expense.ID, expense.Currency
 
-		// Calculate amount for this person (add remainder to first person)
-		amount := splitAmount
-		if i == 0 {
-			amount += remainder
+	for i := range shares {
+		share := &shares[i]
+		if share.AmountCents > resp.SplitAmount {
+			resp.SplitAmount = share.AmountCents
+		}
+		if share.TelegramID == creatorTelegramID {
+			continue
 		}
+		resp.SplitWith = append(resp.SplitWith, share.TelegramID)
 
-		// Create debt record
-		_, err = h.DB.Exec(r.Context(), `INSERT INTO debts (from_user, to_user, amount_cents) VALUES ($1,$2,$3)`,
-			splitUserID, userID, amount)
-		if err != nil {
-			log.Error().Err(err).Msg("insert debt record")
+		var userID int64
+		if err := tx.QueryRow(ctx, "SELECT id FROM users WHERE telegram_id=$1", share.TelegramID).Scan(&userID); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, fmt.Errorf("%w: %d", errUnknownParticipant, share.TelegramID)
+			}
+			return nil, fmt.Errorf("select participant: %w", err)
+		}
+		share.DebtCents = share.AmountCents
+		if resp.Currency != currency.Settlement && share.AmountCents > 0 {
+			// Debts are kept in rubles, converted at today's rate
+			if err := tx.QueryRow(ctx, `SELECT convert_cents($1, $2, $3, (NOW() AT TIME ZONE 'Europe/Moscow')::date)`,
+				share.AmountCents, resp.Currency, currency.Settlement).Scan(&share.DebtCents); err != nil {
+				return nil, fmt.Errorf("convert debt: %w", err)
+			}
+		}
+		if share.DebtCents <= 0 {
+			continue
 		}
+		var debtID int
+		if err := tx.QueryRow(ctx, `INSERT INTO debts (from_user, to_user, amount_cents, expense_id) VALUES ($1,$2,$3,$4) RETURNING id`,
+			userID, creatorID, share.DebtCents, resp.ExpenseID).Scan(&debtID); err != nil {
+			return nil, fmt.Errorf("insert debt record: %w", err)
+		}
+		share.DebtID = &debtID
 	}
 
-	response := map[string]interface{}{
-		"expense_id":   expenseID,
-		"split_amount": splitAmount,
-		"total_people": totalPeople,
-		"split_with":   req.SplitWith,
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
 	}
+	return resp, nil
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
-	log.Info().Int64("user_id", userID).Int("expense_id", expenseID).Int("amount_cents", req.AmountCents).Msg("created shared expense")
+// writeSharedExpenseError maps split validation errors to 400 and everything else to 500
+func writeSharedExpenseError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errUnknownParticipant), errors.Is(err, errTextTooLong),
+		errors.Is(err, currency.ErrInvalidCurrency), errors.Is(err, currency.ErrUnsupportedCurrency):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, split.ErrInvalidWeight), errors.Is(err, split.ErrNoWeights), errors.Is(err, split.ErrSumMismatch):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Error().Err(err).Msg("create shared expense")
+		http.Error(w, "internal", http.StatusInternalServerError)
+	}
 }
 
-// GetDebts returns debts for the authenticated user
-func (h *DebtHandlers) GetDebts(w http.ResponseWriter, r *http.Request) {
+// CreateSharedExpense creates a shared expense paid by the authenticated user and split between participants.
+// Split modes: equal (default), exact amounts, percentages and shares; the parts always sum to amount_cents.
+// The expense and all debts are written atomically.
+func (h *DebtHandlers) CreateSharedExpense(w http.ResponseWriter, r *http.Request) {
 	uid := r.Context().Value(auth.UserIDKey)
 	if uid == nil {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
@@ -112,60 +274,42 @@ func (h *DebtHandlers) GetDebts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get debts where user owes money
-	rows, err := h.DB.Query(r.Context(), `
-		SELECT d.id, d.amount_cents, u.username, u.telegram_id
-		FROM debts d
-		JOIN users u ON d.from_user = u.id
-		WHERE d.to_user = $1
-		ORDER BY d.id DESC
-	`, userID)
-	if err != nil {
-		log.Error().Err(err).Msg("select debts")
-		http.Error(w, "internal", http.StatusInternalServerError)
+	var req sharedExpenseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
 		return
 	}
-	defer rows.Close()
 
-	type debt struct {
-		ID          int    `json:"id"`
-		AmountCents int    `json:"amount_cents"`
-		Username    string `json:"username"`
-		TelegramID  int64  `json:"telegram_id"`
-		Type        string `json:"type"` // "owed_to_me" or "i_owe"
+	response, err := createSharedExpense(r.Context(), h.DB, userID, &req)
+	if err != nil {
+		writeSharedExpenseError(w, err)
+		return
 	}
 
-	var debts []debt
-	for rows.Next() {
-		var d debt
-		if err := rows.Scan(&d.ID, &d.AmountCents, &d.Username, &d.TelegramID); err == nil {
-			d.Type = "owed_to_me"
-			debts = append(debts, d)
-		}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+	log.Info().Int64("user_id", userID).Int("expense_id", response.ExpenseID).Int("amount_cents", req.AmountCents).Str("split_mode", req.SplitMode).Msg("created shared expense")
+}
+
+// GetDebts returns unpaid debts for the authenticated user with outstanding amounts net of payments
+func (h *DebtHandlers) GetDebts(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(auth.UserIDKey)
+	if uid == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, ok := uid.(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
 	}
 
-	// Get debts where user owes money to others
-	rows2, err := h.DB.Query(r.Context(), `
-		SELECT d.id, d.amount_cents, u.username, u.telegram_id
-		FROM debts d
-		JOIN users u ON d.to_user = u.id
-		WHERE d.from_user = $1
-		ORDER BY d.id DESC
-	`, userID)
+	debts, err := outstandingDebts(r.Context(), h.DB, userID)
 	if err != nil {
-		log.Error().Err(err).Msg("select debts owed")
+		log.Error().Err(err).Msg("select debts")
 		http.Error(w, "internal", http.StatusInternalServerError)
 		return
 	}
-	defer rows2.Close()
-
-	for rows2.Next() {
-		var d debt
-		if err := rows2.Scan(&d.ID, &d.AmountCents, &d.Username, &d.TelegramID); err == nil {
-			d.Type = "i_owe"
-			debts = append(debts, d)
-		}
-	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(debts)
@@ -196,49 +340,31 @@ func (h *DebtHandlers) GetBalance(w http.ResponseWriter, r *http.Request) {
 	}
 
 	period := r.URL.Query().Get("period")
-	var timeFilter string
 
-	switch period {
-	case "week":
-		timeFilter = "AND timestamp >= NOW() - INTERVAL '7 days'"
-	case "month":
-		timeFilter = "AND timestamp >= NOW() - INTERVAL '30 days'"
-	default:
-		timeFilter = ""
+	// Amounts are converted into the user's base currency at the rate of their dates
+	base, err := currency.BaseOf(r.Context(), h.DB, userID)
+	if err != nil {
+		log.Error().Err(err).Msg("select base currency for balance")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
 	}
 
-	// Get total expenses
-	expensesQuery := fmt.Sprintf(`
-		SELECT COALESCE(SUM(e.amount_cents), 0) 
-		FROM expenses e
-		LEFT JOIN users u ON e.user_id = u.id
-		WHERE u.telegram_id = ANY($1) %s
-	`, timeFilter)
-
-	var totalExpensesCents int
-	if err := h.DB.QueryRow(r.Context(), expensesQuery, whitelistIDs).Scan(&totalExpensesCents); err != nil {
-		log.Error().Err(err).Msg("select expenses for balance")
+	totals, err := repository.SumTotals(r.Context(), h.DB, repository.Scope{TelegramIDs: whitelistIDs, Days: repository.PeriodDays(period)}, base)
+	if err != nil {
+		log.Error().Err(err).Msg("select totals for balance")
 		http.Error(w, "internal", http.StatusInternalServerError)
 		return
 	}
+	totalExpensesCents, totalIncomesCents, balanceCents := totals.ExpenseCents, totals.IncomeCents, totals.BalanceCents()
 
-	// Get total incomes
-	incomesQuery := fmt.Sprintf(`
-		SELECT COALESCE(SUM(i.amount_cents), 0) 
-		FROM incomes i
-		LEFT JOIN users u ON i.user_id = u.id
-		WHERE u.telegram_id = ANY($1) %s
-	`, timeFilter)
-
-	var totalIncomesCents int
-	if err := h.DB.QueryRow(r.Context(), incomesQuery, whitelistIDs).Scan(&totalIncomesCents); err != nil {
-		log.Error().Err(err).Msg("select incomes for balance")
+	// Running balances of the user's own accounts, each in its currency
+	accounts, err := accountBalances(r.Context(), h.DB, userID)
+	if err != nil {
+		log.Error().Err(err).Msg("select accounts for balance")
 		http.Error(w, "internal", http.StatusInternalServerError)
 		return
 	}
 
-	balanceCents := totalIncomesCents - totalExpensesCents
-
 	response := map[string]interface{}{
 		"balance_cents":         balanceCents,
 		"balance_rubles":        float64(balanceCents) / 100.0,
@@ -246,10 +372,12 @@ func (h *DebtHandlers) GetBalance(w http.ResponseWriter, r *http.Request) {
 		"total_incomes_rubles":  float64(totalIncomesCents) / 100.0,
 		"total_expenses_cents":  totalExpensesCents,
 		"total_expenses_rubles": float64(totalExpensesCents) / 100.0,
+		"currency":              base, // of all amounts; the *_rubles names are legacy
 		"period":                period,
+		"accounts":              accounts,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
-	log.Info().Int64("user_id", userID).Str("period", period).Int("balance_cents", balanceCents).Msg("returned family balance")
+	log.Info().Int64("user_id", userID).Str("period", period).Int64("balance_cents", balanceCents).Msg("returned family balance")
 }
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/expense-tracker/api-service/internal/split"
+)
+
+func TestSplitSharedExpenseEqualIncludesCreator(t *testing.T) {
+	req := &sharedExpenseRequest{AmountCents: 1000, SplitWith: []int64{2, 3}}
+	shares, err := splitSharedExpense(req, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shares) != 3 || shares[0].TelegramID != 1 || shares[0].AmountCents != 334 || shares[1].AmountCents != 333 {
+		t.Errorf("shares = %+v", shares)
+	}
+	if req.SplitMode != split.ModeEqual {
+		t.Errorf("split mode = %q", req.SplitMode)
+	}
+}
+
+func TestSplitSharedExpenseModes(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     sharedExpenseRequest
+		want    []int
+		wantErr error
+	}{
+		{
+			name: "exact",
+			req: sharedExpenseRequest{AmountCents: 1000, SplitMode: "exact", Participants: []sharedParticipant{
+				{TelegramID: 1, AmountCents: 700}, {TelegramID: 2, AmountCents: 300}}},
+			want: []int{700, 300},
+		},
+		{
+			name: "exact mismatch",
+			req: sharedExpenseRequest{AmountCents: 1000, SplitMode: "exact", Participants: []sharedParticipant{
+				{TelegramID: 1, AmountCents: 700}, {TelegramID: 2, AmountCents: 299}}},
+			wantErr: split.ErrSumMismatch,
+		},
+		{
+			name: "percent without creator",
+			req: sharedExpenseRequest{AmountCents: 999, SplitMode: "percent", Participants: []sharedParticipant{
+				{TelegramID: 2, Percent: 50}, {TelegramID: 3, Percent: 50}}},
+			want: []int{500, 499},
+		},
+		{
+			name: "shares",
+			req: sharedExpenseRequest{AmountCents: 1000, SplitMode: "shares", Participants: []sharedParticipant{
+				{TelegramID: 1, Shares: 3}, {TelegramID: 2, Shares: 1}}},
+			want: []int{750, 250},
+		},
+		{
+			name:    "duplicate participant",
+			req:     sharedExpenseRequest{AmountCents: 1000, SplitWith: []int64{2, 2}},
+			wantErr: split.ErrInvalidWeight,
+		},
+		{
+			name:    "nobody to split with",
+			req:     sharedExpenseRequest{AmountCents: 1000},
+			wantErr: split.ErrNoWeights,
+		},
+		{
+			name:    "unknown mode",
+			req:     sharedExpenseRequest{AmountCents: 1000, SplitMode: "random", SplitWith: []int64{2}},
+			wantErr: split.ErrInvalidWeight,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shares, err := splitSharedExpense(&tt.req, 1)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, want := range tt.want {
+				if shares[i].AmountCents != want {
+					t.Errorf("share %d = %d, want %d", i, shares[i].AmountCents, want)
+				}
+			}
+		})
+	}
+}
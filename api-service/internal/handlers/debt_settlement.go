@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/expense-tracker/api-service/internal/auth"
+	"github.com/expense-tracker/api-service/internal/currency"
+	"github.com/expense-tracker/api-service/internal/repository"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	errDebtNotFound    = errors.New("debt not found")
+	errDebtSettled     = errors.New("debt is already paid")
+	errPaymentTooLarge = errors.New("payment exceeds the outstanding amount")
+	errNotCreditor     = errors.New("only the creditor can record a payment of a debt")
+)
+
+// debtResponse is a debt as seen by one of its parties. AmountCents is what is still outstanding.
+type debtResponse struct {
+	ID            int    `json:"id"`
+	AmountCents   int    `json:"amount_cents"`
+	OriginalCents int    `json:"original_cents"`
+	PaidCents     int    `json:"paid_cents"`
+	Username      string `json:"username"`
+	TelegramID    int64  `json:"telegram_id"`
+	Type          string `json:"type"` // "owed_to_me" or "i_owe"
+}
+
+// debtPayment is the outcome of one payment against one debt
+type debtPayment struct {
+	PaymentID        int  `json:"payment_id"`
+	DebtID           int  `json:"debt_id"`
+	AmountCents      int  `json:"amount_cents"`
+	OutstandingCents int  `json:"outstanding_cents"`
+	Settled          bool `json:"settled"`
+	IncomeID         *int `json:"income_id,omitempty"`
+}
+
+// paymentOptions describe how a payment is recorded
+type paymentOptions struct {
+	RecordedBy   int64 // users.id, must be the creditor
+	Note         string
+	CreateIncome bool // record a debt_return income for the creditor
+	IncomeID     *int // link an already created income instead
+}
+
+// outstandingDebts returns the user's unpaid debts in both directions, net of payments.
+// Debts owed to the user come first.
+func outstandingDebts(ctx context.Context, db *pgxpool.Pool, userID int64) ([]debtResponse, error) {
+	rows, err := db.Query(ctx, `
+		SELECT d.id, d.amount_cents, COALESCE(p.paid, 0), COALESCE(u.username, ''), u.telegram_id,
+			CASE WHEN d.to_user = $1 THEN 'owed_to_me' ELSE 'i_owe' END
+		FROM debts d
+		LEFT JOIN (SELECT debt_id, SUM(amount_cents) AS paid FROM debt_payments GROUP BY debt_id) p ON p.debt_id = d.id
+		JOIN users u ON u.id = CASE WHEN d.to_user = $1 THEN d.from_user ELSE d.to_user END
+		WHERE (d.to_user = $1 OR d.from_user = $1)
+			AND d.is_paid = false
+			AND d.amount_cents > COALESCE(p.paid, 0)
+		ORDER BY (d.to_user = $1) DESC, d.id DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	debts := []debtResponse{}
+	for rows.Next() {
+		var d debtResponse
+		if err := rows.Scan(&d.ID, &d.OriginalCents, &d.PaidCents, &d.Username, &d.TelegramID, &d.Type); err != nil {
+			return nil, err
+		}
+		d.AmountCents = d.OriginalCents - d.PaidCents
+		debts = append(debts, d)
+	}
+	return debts, rows.Err()
+}
+
+// payDebt records a payment against a single debt inside tx and marks the debt paid once nothing is outstanding.
+// An amount of 0 pays the whole outstanding balance. Only the creditor records payments: a debtor cannot mark
+// their own debt paid or give the creditor an income.
+func payDebt(ctx context.Context, tx pgx.Tx, debtID int, amountCents int, opts paymentOptions) (*debtPayment, error) {
+	var originalCents int
+	var creditorID int64
+	var isPaid bool
+	err := tx.QueryRow(ctx, `SELECT amount_cents, to_user, is_paid FROM debts WHERE id = $1 FOR UPDATE`, debtID).Scan(&originalCents, &creditorID, &isPaid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errDebtNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if opts.RecordedBy != creditorID {
+		return nil, errNotCreditor
+	}
+
+	var paidCents int
+	if err := tx.QueryRow(ctx, `SELECT COALESCE(SUM(amount_cents), 0) FROM debt_payments WHERE debt_id = $1`, debtID).Scan(&paidCents); err != nil {
+		return nil, err
+	}
+	outstanding := originalCents - paidCents
+	if isPaid || outstanding <= 0 {
+		return nil, errDebtSettled
+	}
+	if amountCents == 0 {
+		amountCents = outstanding
+	}
+	if amountCents < 0 || amountCents > outstanding {
+		return nil, fmt.Errorf("%w: %d > %d", errPaymentTooLarge, amountCents, outstanding)
+	}
+
+	payment := &debtPayment{DebtID: debtID, AmountCents: amountCents, OutstandingCents: outstanding - amountCents, IncomeID: opts.IncomeID}
+	payment.Settled = payment.OutstandingCents == 0
+
+	if opts.CreateIncome && payment.IncomeID == nil {
+		description := opts.Note
+		if description == "" {
+			description = "Возврат долга"
+		}
+		income := repository.Transaction{
+			UserID:        creditorID,
+			AmountCents:   int64(amountCents),
+			OperationType: repository.TypeIncome,
+			Description:   description,
+			Currency:      currency.Settlement,
+			IncomeType:    repository.IncomeDebtReturn,
+			RelatedDebtID: &debtID,
+		}
+		if err := repository.Insert(ctx, tx, &income); err != nil {
+			return nil, fmt.Errorf("insert debt_return income: %w", err)
+		}
+		payment.IncomeID = &income.ID
+	}
+
+	var recordedBy *int64
+	if opts.RecordedBy != 0 {
+		recordedBy = &opts.RecordedBy
+	}
+	if err := tx.QueryRow(ctx, `INSERT INTO debt_payments (debt_id, amount_cents, recorded_by, income_id, note) VALUES ($1, $2, $3, $4, NULLIF($5, '')) RETURNING id`,
+		debtID, amountCents, recordedBy, payment.IncomeID, opts.Note).Scan(&payment.PaymentID); err != nil {
+		return nil, fmt.Errorf("insert debt payment: %w", err)
+	}
+
+	if payment.Settled {
+		if _, err := tx.Exec(ctx, `UPDATE debts SET is_paid = true, paid_at = NOW() WHERE id = $1`, debtID); err != nil {
+			return nil, fmt.Errorf("mark debt paid: %w", err)
+		}
+	}
+	return payment, nil
+}
+
+// writeDebtPaymentError maps settlement errors to HTTP statuses
+func writeDebtPaymentError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errDebtNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errNotCreditor):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, errDebtSettled):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, errPaymentTooLarge):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Error().Err(err).Msg("settle debt")
+		http.Error(w, "internal", http.StatusInternalServerError)
+	}
+}
+
+// SettleDebt records a full or partial payment of a debt owed to the caller.
+// Payload: { amount_cents?: number (default: everything outstanding), create_income?: bool, note?: string }
+// With create_income a debt_return income is recorded for the caller.
+func (h *DebtHandlers) SettleDebt(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	debtID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid debt id", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		AmountCents  int    `json:"amount_cents"`
+		CreateIncome bool   `json:"create_income"`
+		Note         string `json:"note"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.AmountCents < 0 {
+		http.Error(w, "amount_cents must be positive", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		writeDebtPaymentError(w, err)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	payment, err := payDebt(r.Context(), tx, debtID, req.AmountCents, paymentOptions{RecordedBy: userID, Note: req.Note, CreateIncome: req.CreateIncome})
+	if err != nil {
+		writeDebtPaymentError(w, err)
+		return
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		writeDebtPaymentError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payment)
+	log.Info().Int64("user_id", userID).Int("debt_id", debtID).Int("amount_cents", payment.AmountCents).Bool("settled", payment.Settled).Msg("debt payment recorded")
+}
+
+// InternalPayDebts records that a Telegram user was paid back by another one (for the bot /paid command).
+// The payment is applied to the oldest unpaid debts first and may span several of them.
+// Payload: { telegram_id (creditor), debtor_telegram_id, amount_cents?: number (default: everything), create_income?: bool }
+func (h *InternalHandlers) InternalPayDebts(w http.ResponseWriter, r *http.Request) {
+	if !botAuthorized(w, r) {
+		return
+	}
+
+	var req struct {
+		TelegramID       int64 `json:"telegram_id"`
+		DebtorTelegramID int64 `json:"debtor_telegram_id"`
+		AmountCents      int   `json:"amount_cents"`
+		CreateIncome     bool  `json:"create_income"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.TelegramID == 0 || req.DebtorTelegramID == 0 || req.AmountCents < 0 {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	var debtorID, creditorID int64
+	if err := h.DB.QueryRow(r.Context(), "SELECT id FROM users WHERE telegram_id=$1", req.TelegramID).Scan(&creditorID); err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	if err := h.DB.QueryRow(r.Context(), "SELECT id FROM users WHERE telegram_id=$1", req.DebtorTelegramID).Scan(&debtorID); err != nil {
+		http.Error(w, "debtor not found", http.StatusNotFound)
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		writeDebtPaymentError(w, err)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	rows, err := tx.Query(r.Context(), `SELECT id FROM debts WHERE from_user = $1 AND to_user = $2 AND is_paid = false ORDER BY created_at, id`, debtorID, creditorID)
+	if err != nil {
+		writeDebtPaymentError(w, err)
+		return
+	}
+	var debtIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			writeDebtPaymentError(w, err)
+			return
+		}
+		debtIDs = append(debtIDs, id)
+	}
+	rows.Close()
+
+	payAll := req.AmountCents == 0
+	remaining := req.AmountCents
+	response := struct {
+		PaidCents        int           `json:"paid_cents"`
+		OutstandingCents int           `json:"outstanding_cents"`
+		Payments         []debtPayment `json:"payments"`
+	}{Payments: []debtPayment{}}
+
+	for _, debtID := range debtIDs {
+		amount := 0 // pays the whole debt
+		if !payAll {
+			if remaining == 0 {
+				break
+			}
+			amount = remaining
+		}
+		payment, err := payDebt(r.Context(), tx, debtID, amount, paymentOptions{RecordedBy: creditorID, CreateIncome: req.CreateIncome})
+		if errors.Is(err, errPaymentTooLarge) {
+			// The debt is smaller than what is left to pay: close it and continue with the next one
+			payment, err = payDebt(r.Context(), tx, debtID, 0, paymentOptions{RecordedBy: creditorID, CreateIncome: req.CreateIncome})
+		}
+		if errors.Is(err, errDebtSettled) {
+			continue
+		}
+		if err != nil {
+			writeDebtPaymentError(w, err)
+			return
+		}
+		remaining -= payment.AmountCents
+		response.PaidCents += payment.AmountCents
+		response.Payments = append(response.Payments, *payment)
+	}
+
+	if response.PaidCents == 0 {
+		http.Error(w, "no outstanding debts of this user", http.StatusConflict)
+		return
+	}
+	if !payAll && remaining > 0 {
+		writeDebtPaymentError(w, fmt.Errorf("%w: only %d outstanding", errPaymentTooLarge, response.PaidCents))
+		return
+	}
+
+	if err := tx.QueryRow(r.Context(), `
+		SELECT COALESCE(SUM(d.amount_cents - COALESCE((SELECT SUM(p.amount_cents) FROM debt_payments p WHERE p.debt_id = d.id), 0)), 0)
+		FROM debts d
+		WHERE d.from_user = $1 AND d.to_user = $2 AND d.is_paid = false
+	`, debtorID, creditorID).Scan(&response.OutstandingCents); err != nil {
+		writeDebtPaymentError(w, err)
+		return
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		writeDebtPaymentError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+	log.Info().Int64("telegram_id", req.TelegramID).Int64("debtor_telegram_id", req.DebtorTelegramID).Int("paid_cents", response.PaidCents).Msg("debt payments recorded internal")
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/expense-tracker/api-service/internal/dbtest"
+)
+
+// debtDB answers payDebt for a debt of 1000 owed to user 1, of which paid is paid already
+func debtDB(paid int, isPaid bool) *dbtest.DB {
+	return dbtest.New(func(sql string, args []any) dbtest.Result {
+		switch {
+		case strings.Contains(sql, "FROM debts WHERE id = $1 FOR UPDATE"):
+			return dbtest.Result{Rows: [][]any{{1000, int64(1), isPaid}}}
+		case strings.Contains(sql, "FROM debt_payments WHERE debt_id"):
+			return dbtest.Result{Rows: [][]any{{paid}}}
+		case strings.Contains(sql, "INSERT INTO expenses"):
+			return dbtest.Result{Rows: [][]any{{31, "RUB"}}}
+		case strings.Contains(sql, "INSERT INTO debt_payments"):
+			return dbtest.Result{Rows: [][]any{{5}}}
+		}
+		return dbtest.Result{}
+	})
+}
+
+func TestPayDebt(t *testing.T) {
+	tests := []struct {
+		name            string
+		paid            int
+		isPaid          bool
+		amount          int
+		recordedBy      int64
+		wantErr         error
+		wantAmount      int
+		wantOutstanding int
+	}{
+		{name: "partial", amount: 300, recordedBy: 1, wantAmount: 300, wantOutstanding: 700},
+		{name: "rest of a partly paid debt", paid: 600, amount: 0, recordedBy: 1, wantAmount: 400},
+		{name: "overpayment", paid: 600, amount: 500, recordedBy: 1, wantErr: errPaymentTooLarge},
+		{name: "already settled", isPaid: true, recordedBy: 1, wantErr: errDebtSettled},
+		{name: "paid in full by payments", paid: 1000, recordedBy: 1, wantErr: errDebtSettled},
+		{name: "recorded by the debtor", amount: 300, recordedBy: 2, wantErr: errNotCreditor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := debtDB(tt.paid, tt.isPaid)
+			payment, err := payDebt(context.Background(), db, 17, tt.amount, paymentOptions{RecordedBy: tt.recordedBy})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("payDebt() = %v, want %v", err, tt.wantErr)
+				}
+				if _, ok := db.Ran("INSERT"); ok {
+					t.Errorf("payment recorded: %+v", db.Statements)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if payment.AmountCents != tt.wantAmount || payment.OutstandingCents != tt.wantOutstanding {
+				t.Errorf("payment = %+v, want %d paid and %d outstanding", payment, tt.wantAmount, tt.wantOutstanding)
+			}
+			settled := tt.wantOutstanding == 0
+			if _, ok := db.Ran("UPDATE debts SET is_paid = true"); payment.Settled != settled || ok != settled {
+				t.Errorf("settled = %v, debt marked paid = %v, want %v", payment.Settled, ok, settled)
+			}
+		})
+	}
+}
+
+func TestPayDebtLinksIncome(t *testing.T) {
+	t.Run("created for the creditor", func(t *testing.T) {
+		db := debtDB(0, false)
+		payment, err := payDebt(context.Background(), db, 17, 300, paymentOptions{RecordedBy: 1, CreateIncome: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		income, ok := db.Ran("INSERT INTO expenses")
+		if !ok || income.Args[0] != int64(1) || income.Args[1] != int64(300) {
+			t.Fatalf("income = %+v, want 300 for the creditor", income.Args)
+		}
+		if debtID, ok := income.Args[14].(*int); !ok || debtID == nil || *debtID != 17 {
+			t.Errorf("income related_debt_id = %v, want 17", income.Args[14])
+		}
+		s, _ := db.Ran("INSERT INTO debt_payments")
+		if payment.IncomeID == nil || *payment.IncomeID != 31 || s.Args[3] != payment.IncomeID {
+			t.Errorf("payment income = %v (recorded %v), want 31", payment.IncomeID, s.Args[3])
+		}
+	})
+	t.Run("existing income", func(t *testing.T) {
+		db := debtDB(0, false)
+		incomeID := 44
+		payment, err := payDebt(context.Background(), db, 17, 300, paymentOptions{RecordedBy: 1, CreateIncome: true, IncomeID: &incomeID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := db.Ran("INSERT INTO expenses"); ok {
+			t.Error("income created for a payment with an income")
+		}
+		if s, _ := db.Ran("INSERT INTO debt_payments"); payment.IncomeID != &incomeID || s.Args[3] != &incomeID {
+			t.Errorf("payment income = %v (recorded %v), want %d", payment.IncomeID, s.Args[3], incomeID)
+		}
+	})
+}
@@ -7,6 +7,8 @@ import (
 	"time"
 
 	"github.com/expense-tracker/api-service/internal/auth"
+	"github.com/expense-tracker/api-service/internal/currency"
+	"github.com/expense-tracker/api-service/internal/repository"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/zerolog/log"
 )
@@ -52,9 +54,9 @@ func (h *ExpenseHandlers) AddExpense(w http.ResponseWriter, r *http.Request) {
 
 	// Validate operation_type
 	if req.OperationType == "" {
-		req.OperationType = "expense" // default
+		req.OperationType = repository.TypeExpense // default
 	}
-	if req.OperationType != "expense" && req.OperationType != "income" {
+	if req.OperationType != repository.TypeExpense && req.OperationType != repository.TypeIncome {
 		http.Error(w, "invalid operation_type", http.StatusBadRequest)
 		return
 	}
@@ -79,20 +81,23 @@ func (h *ExpenseHandlers) AddExpense(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	var expenseID int
-	err := h.DB.QueryRow(r.Context(),
-		`INSERT INTO expenses (user_id, amount_cents, category_id, subcategory_id, operation_type, timestamp, is_shared) 
-		 VALUES ($1,$2,$3,$4,$5,$6,$7) RETURNING id`,
-		userID, req.AmountCents, req.CategoryID, req.SubcategoryID, req.OperationType, ts, req.IsShared).Scan(&expenseID)
-
-	if err != nil {
+	expense := repository.Transaction{
+		UserID:        userID,
+		AmountCents:   int64(req.AmountCents),
+		OperationType: req.OperationType,
+		CategoryID:    req.CategoryID,
+		SubcategoryID: req.SubcategoryID,
+		Timestamp:     ts,
+		IsShared:      req.IsShared,
+	}
+	if err := repository.Insert(r.Context(), h.DB, &expense); err != nil {
 		log.Error().Err(err).Msg("insert expense")
 		http.Error(w, "internal", http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]int{"id": expenseID})
+	json.NewEncoder(w).Encode(map[string]int{"id": expense.ID})
 	log.Info().Int64("user_id", userID).Int("amount_cents", req.AmountCents).Str("operation_type", req.OperationType).Msg("expense added")
 }
 
@@ -123,7 +128,7 @@ func (h *ExpenseHandlers) GetExpenses(w http.ResponseWriter, r *http.Request) {
 		SELECT e.id, e.user_id, e.amount_cents, e.category_id, e.subcategory_id, e.operation_type, e.timestamp, e.is_shared, u.username 
 		FROM expenses e
 		LEFT JOIN users u ON e.user_id = u.id
-		WHERE u.telegram_id = ANY($1)
+		WHERE u.telegram_id = ANY($1) AND ` + repository.Counted + `
 		ORDER BY e.timestamp DESC 
 		LIMIT 200
 	`
@@ -191,39 +196,32 @@ func (h *ExpenseHandlers) GetTotalExpenses(w http.ResponseWriter, r *http.Reques
 	}
 
 	period := r.URL.Query().Get("period")
-	var timeFilter string
 
-	switch period {
-	case "week":
-		timeFilter = "AND e.timestamp >= NOW() - INTERVAL '7 days'"
-	case "month":
-		timeFilter = "AND e.timestamp >= NOW() - INTERVAL '30 days'"
-	default:
-		timeFilter = ""
+	// Amounts are converted into the user's base currency at the rate of their dates
+	base, err := currency.BaseOf(r.Context(), h.DB, userID)
+	if err != nil {
+		log.Error().Err(err).Msg("select base currency")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
 	}
 
-	query := fmt.Sprintf(`
-		SELECT COALESCE(SUM(e.amount_cents), 0) 
-		FROM expenses e
-		LEFT JOIN users u ON e.user_id = u.id
-		WHERE u.telegram_id = ANY($1) %s
-	`, timeFilter)
-
-	var totalCents int
-	err := h.DB.QueryRow(r.Context(), query, whitelistIDs).Scan(&totalCents)
+	totals, err := repository.SumTotals(r.Context(), h.DB, repository.Scope{TelegramIDs: whitelistIDs, Days: repository.PeriodDays(period)}, base)
 	if err != nil {
 		log.Error().Err(err).Msg("select total expenses")
 		http.Error(w, "internal", http.StatusInternalServerError)
 		return
 	}
+	totalCents := totals.ExpenseCents
 
 	response := map[string]interface{}{
 		"total_cents":  totalCents,
-		"total_rubles": float64(totalCents) / 100.0,
+		"total":        float64(totalCents) / 100.0,
+		"total_rubles": float64(totalCents) / 100.0, // legacy name, the amount is in currency
+		"currency":     base,
 		"period":       period,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
-	log.Info().Int64("user_id", userID).Str("period", period).Int("total_cents", totalCents).Msg("returned family total expenses")
+	log.Info().Int64("user_id", userID).Str("period", period).Int64("total_cents", totalCents).Msg("returned family total expenses")
 }
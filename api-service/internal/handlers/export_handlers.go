@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/expense-tracker/api-service/internal/auth"
+	"github.com/expense-tracker/api-service/internal/export"
+	"github.com/expense-tracker/api-service/internal/recurring"
+	"github.com/expense-tracker/api-service/internal/repository"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// exportTimeout bounds writing an export; the server's write timeout is too short for a large file
+const exportTimeout = 10 * time.Minute
+
+// ExportTransactions streams the transactions matching the GetTransactions filters as a file.
+// GET /api/transactions/export?format=csv|xlsx|json plus operation_type, category_id, subcategory_id,
+// start_date, end_date and scope.
+func (h *TransactionHandlers) ExportTransactions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	writeTransactionsExport(w, r, h.DB, userID, parseTransactionFilter(r.URL.Query()))
+}
+
+// InternalExportTransactions is ExportTransactions for the bot: the user comes from telegram_id
+// and period=week|month sets start_date to 7 or 30 days ago, as in /internal/expenses/total
+func (h *InternalHandlers) InternalExportTransactions(w http.ResponseWriter, r *http.Request) {
+	if !botAuthorized(w, r) {
+		return
+	}
+	telegramID, err := strconv.ParseInt(r.URL.Query().Get("telegram_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid telegram_id", http.StatusBadRequest)
+		return
+	}
+	var userID int64
+	if err := h.DB.QueryRow(r.Context(), "SELECT id FROM users WHERE telegram_id=$1", telegramID).Scan(&userID); err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	filter := parseTransactionFilter(r.URL.Query())
+	if filter.StartDate == "" {
+		switch r.URL.Query().Get("period") {
+		case "week":
+			filter.StartDate = time.Now().AddDate(0, 0, -7).UTC().Format(time.RFC3339)
+		case "month":
+			filter.StartDate = time.Now().AddDate(0, 0, -30).UTC().Format(time.RFC3339)
+		}
+	}
+	writeTransactionsExport(w, r, h.DB, userID, filter)
+}
+
+// writeTransactionsExport writes the export response. Rows go to the client as they are read,
+// so errors after the first row can only be logged.
+func writeTransactionsExport(w http.ResponseWriter, r *http.Request, db *pgxpool.Pool, userID int64, filter repository.Filter) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = export.FormatCSV
+	}
+	if format != export.FormatCSV && format != export.FormatXLSX && format != export.FormatJSON {
+		http.Error(w, export.ErrUnknownFormat.Error(), http.StatusBadRequest)
+		return
+	}
+
+	groupIDs, err := repository.UserGroupIDs(r.Context(), db, userID)
+	if err != nil {
+		log.Error().Err(err).Msg("select groups for export")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+	rows, err := repository.Export(r.Context(), db, filter, userID, groupIDs)
+	if err != nil {
+		log.Error().Err(err).Msg("select transactions for export")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	// Extend the server's write deadline for this response only
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(exportTimeout)); err != nil {
+		log.Warn().Err(err).Msg("extend write deadline for export")
+	}
+
+	calendar := recurring.Calendar()
+	filename := fmt.Sprintf("transactions_%s.%s", time.Now().In(calendar).Format(time.DateOnly), format)
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	out, err := export.NewWriter(format, w)
+	if err != nil {
+		log.Error().Err(err).Msg("start transactions export")
+		return
+	}
+	count := 0
+	for rows.Next() {
+		t, err := rows.Transaction()
+		if err != nil {
+			log.Error().Err(err).Msg("scan exported transaction")
+			return
+		}
+		rec := export.Record{
+			ID: t.ID, Timestamp: t.Timestamp.In(calendar), OperationType: t.OperationType,
+			AmountCents: t.AmountCents, Currency: t.Currency,
+			Category: valueOrEmpty(t.CategoryName), Subcategory: valueOrEmpty(t.SubcategoryName),
+			Username: valueOrEmpty(t.Username), Description: valueOrEmpty(t.Description),
+			IsShared: t.IsShared, GroupID: t.GroupID,
+		}
+		if err := out.Write(rec); err != nil {
+			// The client went away
+			log.Warn().Err(err).Msg("write exported transaction")
+			return
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		log.Error().Err(err).Msg("read transactions for export")
+		return
+	}
+	if err := out.Close(); err != nil {
+		log.Warn().Err(err).Msg("finish transactions export")
+		return
+	}
+	log.Info().Int64("user_id", userID).Str("format", format).Int("count", count).Msg("exported transactions")
+}
+
+// valueOrEmpty returns the string s points to, empty for nil
+func valueOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,493 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/expense-tracker/api-service/internal/auth"
+	"github.com/expense-tracker/api-service/internal/currency"
+	"github.com/expense-tracker/api-service/internal/importer"
+	"github.com/expense-tracker/api-service/internal/merchants"
+	"github.com/expense-tracker/api-service/internal/recurring"
+	"github.com/expense-tracker/api-service/internal/repository"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	maxStatementSize     = 10 << 20
+	defaultImportWindow  = 48 * time.Hour
+	maxImportWindowHours = 24 * 14
+)
+
+// ImportHandlers handles bank statement imports: upload and preview, then commit or cancel
+type ImportHandlers struct {
+	DB   *pgxpool.Pool
+	Auth *auth.Auth
+}
+
+// NewImportHandlers creates a new ImportHandlers instance
+func NewImportHandlers(db *pgxpool.Pool, auth *auth.Auth) *ImportHandlers {
+	return &ImportHandlers{
+		DB:   db,
+		Auth: auth,
+	}
+}
+
+type importRow struct {
+	importer.Transaction
+	CategoryID   *int   `json:"category_id"`
+	CategoryName string `json:"category_name,omitempty"`
+	DuplicateOf  *int   `json:"duplicate_of"` // id of the existing expense this line repeats
+	Skip         bool   `json:"skip"`         // duplicates are skipped unless included on commit
+}
+
+type importPreview struct {
+	BatchID       int         `json:"batch_id"`
+	Status        string      `json:"status"`
+	Format        string      `json:"format"`
+	Preset        string      `json:"preset,omitempty"`
+	Filename      string      `json:"filename,omitempty"`
+	Rows          []importRow `json:"rows"`
+	Total         int         `json:"total"`
+	New           int         `json:"new"`
+	Duplicates    int         `json:"duplicates"`
+	ExpenseCents  int         `json:"expense_cents"` // rows that will be imported
+	IncomeCents   int         `json:"income_cents"`
+	ImportedCount int         `json:"imported_count"`
+}
+
+type importCommitRequest struct {
+	Skip       []int       `json:"skip"`       // rows to leave out
+	Include    []int       `json:"include"`    // duplicate rows to import anyway
+	Categories map[int]int `json:"categories"` // row -> category_id
+}
+
+// summarize fills the totals from the rows
+func (p *importPreview) summarize() {
+	p.Total, p.New, p.Duplicates, p.ExpenseCents, p.IncomeCents = len(p.Rows), 0, 0, 0, 0
+	for _, row := range p.Rows {
+		if row.DuplicateOf != nil {
+			p.Duplicates++
+		}
+		if row.Skip {
+			continue
+		}
+		p.New++
+		if row.OperationType == "income" {
+			p.IncomeCents += row.AmountCents
+		} else {
+			p.ExpenseCents += row.AmountCents
+		}
+	}
+}
+
+// Import parses an uploaded statement and stores it as a pending batch.
+// multipart/form-data: file, optional format (csv, ofx, qif), preset (generic, sber, tinkoff),
+// date_column, amount_column, description_column, date_format, window_hours and currency
+// (of the statement, the user's base currency by default).
+func (h *ImportHandlers) Import(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxStatementSize+1<<20)
+	if err := r.ParseMultipartForm(maxStatementSize); err != nil {
+		http.Error(w, "expected multipart form with a statement file up to 10 MB", http.StatusBadRequest)
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, "failed to read file", http.StatusBadRequest)
+		return
+	}
+
+	format := r.FormValue("format")
+	if format == "" {
+		if format, err = importer.DetectFormat(header.Filename, data); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	window := defaultImportWindow
+	if v := r.FormValue("window_hours"); v != "" {
+		hours, err := strconv.Atoi(v)
+		if err != nil || hours < 0 || hours > maxImportWindowHours {
+			http.Error(w, "window_hours must be between 0 and 336", http.StatusBadRequest)
+			return
+		}
+		window = time.Duration(hours) * time.Hour
+	}
+
+	opts := importer.Options{
+		Preset: r.FormValue("preset"),
+		Mapping: importer.Mapping{
+			Date:        r.FormValue("date_column"),
+			Amount:      r.FormValue("amount_column"),
+			Description: r.FormValue("description_column"),
+			DateFormat:  r.FormValue("date_format"),
+		},
+		Location: recurring.Calendar(),
+	}
+	txs, err := importer.Parse(format, data, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	code := r.FormValue("currency")
+	if code == "" {
+		code, err = currency.BaseOf(r.Context(), h.DB, userID)
+	} else {
+		code, err = currency.Check(r.Context(), h.DB, code)
+	}
+	if err != nil {
+		writeCurrencyError(w, err)
+		return
+	}
+	for i := range txs {
+		txs[i].Currency = code
+	}
+
+	rows, err := h.previewRows(r.Context(), userID, txs, window)
+	if err != nil {
+		log.Error().Err(err).Msg("preview statement import")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+
+	preview := importPreview{Status: "pending", Format: format, Filename: header.Filename, Rows: rows}
+	if format == importer.FormatCSV {
+		preview.Preset = opts.Preset
+		if preview.Preset == "" {
+			preview.Preset = importer.PresetGeneric
+		}
+	}
+	rowsJSON, _ := json.Marshal(rows)
+	err = h.DB.QueryRow(r.Context(), `
+		INSERT INTO import_batches (user_id, format, preset, filename, rows)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5)
+		RETURNING id
+	`, userID, format, preview.Preset, preview.Filename, rowsJSON).Scan(&preview.BatchID)
+	if err != nil {
+		log.Error().Err(err).Msg("insert import batch")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+	preview.summarize()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(preview)
+}
+
+// previewRows assigns categories and marks the lines that are already recorded
+func (h *ImportHandlers) previewRows(ctx context.Context, userID int64, txs []importer.Transaction, window time.Duration) ([]importRow, error) {
+	matcher, err := loadCategoryMatcher(ctx, h.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	from, to := txs[0].Timestamp, txs[0].Timestamp
+	var externalIDs []string
+	for _, tx := range txs {
+		if tx.Timestamp.Before(from) {
+			from = tx.Timestamp
+		}
+		if tx.Timestamp.After(to) {
+			to = tx.Timestamp
+		}
+		if tx.ExternalID != "" {
+			externalIDs = append(externalIDs, tx.ExternalID)
+		}
+	}
+
+	dbRows, err := h.DB.Query(ctx, `
+		SELECT id, timestamp, amount_cents, COALESCE(operation_type, 'expense'), currency, COALESCE(description, '')
+		FROM expenses
+		WHERE user_id = $1 AND deleted_at IS NULL AND timestamp BETWEEN $2 AND $3
+		ORDER BY timestamp
+	`, userID, from.Add(-window), to.Add(window))
+	if err != nil {
+		return nil, err
+	}
+	var existing []importer.Existing
+	for dbRows.Next() {
+		var e importer.Existing
+		if err := dbRows.Scan(&e.ID, &e.Timestamp, &e.AmountCents, &e.OperationType, &e.Currency, &e.Description); err != nil {
+			dbRows.Close()
+			return nil, err
+		}
+		existing = append(existing, e)
+	}
+	dbRows.Close()
+	if err := dbRows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Bank transaction ids imported before, even from a statement for another period
+	imported := make(map[string]int)
+	if len(externalIDs) > 0 {
+		dbRows, err := h.DB.Query(ctx, `SELECT external_id, id FROM expenses WHERE user_id = $1 AND external_id = ANY($2)`, userID, externalIDs)
+		if err != nil {
+			return nil, err
+		}
+		for dbRows.Next() {
+			var externalID string
+			var id int
+			if err := dbRows.Scan(&externalID, &id); err != nil {
+				dbRows.Close()
+				return nil, err
+			}
+			imported[externalID] = id
+		}
+		dbRows.Close()
+		if err := dbRows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	duplicates := importer.FindDuplicates(txs, existing, window)
+	rows := make([]importRow, len(txs))
+	for i, tx := range txs {
+		row := importRow{Transaction: tx}
+		if tx.OperationType == "expense" {
+			if match, ok := matcher.match(tx.Description); ok {
+				row.CategoryID, row.CategoryName = &match.ID, match.Name
+			}
+		}
+		if id, ok := imported[tx.ExternalID]; ok && tx.ExternalID != "" {
+			row.DuplicateOf = &id
+		} else if id, ok := duplicates[tx.Row]; ok {
+			row.DuplicateOf = &id
+		}
+		row.Skip = row.DuplicateOf != nil
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+const importBatchSelect = `
+	SELECT id, status, format, COALESCE(preset, ''), COALESCE(filename, ''), rows, imported_count
+	FROM import_batches WHERE id = $1 AND user_id = $2`
+
+// scanImportBatch reads a row selected with importBatchSelect
+func scanImportBatch(row pgx.Row) (*importPreview, error) {
+	var p importPreview
+	var rowsJSON []byte
+	if err := row.Scan(&p.BatchID, &p.Status, &p.Format, &p.Preset, &p.Filename, &rowsJSON, &p.ImportedCount); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(rowsJSON, &p.Rows); err != nil {
+		return nil, err
+	}
+	p.summarize()
+	return &p, nil
+}
+
+// importBatchParams reads the {id} URL parameter and the user; it writes the error response itself
+func importBatchParams(w http.ResponseWriter, r *http.Request) (int, int64, bool) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return 0, 0, false
+	}
+	batchID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid import id", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return batchID, userID, true
+}
+
+// GetImport returns the preview of an import batch
+func (h *ImportHandlers) GetImport(w http.ResponseWriter, r *http.Request) {
+	batchID, userID, ok := importBatchParams(w, r)
+	if !ok {
+		return
+	}
+	preview, err := scanImportBatch(h.DB.QueryRow(r.Context(), importBatchSelect, batchID, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "import not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("select import batch")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(preview)
+}
+
+// CommitImport creates expenses from the rows of a pending batch. The body may skip rows,
+// include duplicates and override categories. Committing twice is rejected with 409.
+func (h *ImportHandlers) CommitImport(w http.ResponseWriter, r *http.Request) {
+	batchID, userID, ok := importBatchParams(w, r)
+	if !ok {
+		return
+	}
+	var req importCommitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Categories) > 0 {
+		distinct := make(map[int]bool)
+		var ids []int
+		for _, id := range req.Categories {
+			if !distinct[id] {
+				distinct[id] = true
+				ids = append(ids, id)
+			}
+		}
+		var found int
+		if err := h.DB.QueryRow(r.Context(), "SELECT COUNT(*) FROM categories WHERE id = ANY($1)", ids).Scan(&found); err != nil {
+			log.Error().Err(err).Msg("check import categories")
+			http.Error(w, "internal", http.StatusInternalServerError)
+			return
+		}
+		if found != len(ids) {
+			http.Error(w, "category not found", http.StatusBadRequest)
+			return
+		}
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		log.Error().Err(err).Msg("begin import commit")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	preview, err := scanImportBatch(tx.QueryRow(r.Context(), importBatchSelect+" FOR UPDATE", batchID, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "import not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("select import batch")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+	if preview.Status != "pending" {
+		http.Error(w, "import is already "+preview.Status, http.StatusConflict)
+		return
+	}
+
+	skip, include := make(map[int]bool), make(map[int]bool)
+	for _, row := range req.Skip {
+		skip[row] = true
+	}
+	for _, row := range req.Include {
+		include[row] = true
+	}
+
+	imported := 0
+	for i := range preview.Rows {
+		row := &preview.Rows[i]
+		if categoryID, ok := req.Categories[row.Row]; ok {
+			row.CategoryID, row.CategoryName = &categoryID, ""
+		}
+		row.Skip = skip[row.Row] || row.DuplicateOf != nil && !include[row.Row]
+		if row.Skip {
+			continue
+		}
+		merchantID, err := merchants.Find(r.Context(), tx, row.Description)
+		if err != nil {
+			log.Error().Err(err).Int("row", row.Row).Msg("find merchant of imported expense")
+			http.Error(w, "internal", http.StatusInternalServerError)
+			return
+		}
+		err = repository.Insert(r.Context(), tx, &repository.Transaction{
+			UserID:        userID,
+			AmountCents:   int64(row.AmountCents),
+			OperationType: row.OperationType,
+			CategoryID:    row.CategoryID,
+			Timestamp:     row.Timestamp,
+			Description:   row.Description,
+			MerchantID:    merchantID,
+			Currency:      row.Currency,
+			ImportBatchID: &batchID,
+			ExternalID:    row.ExternalID,
+		})
+		if errors.Is(err, repository.ErrDuplicate) {
+			// Imported by another batch since the preview
+			row.Skip = true
+			continue
+		}
+		if err != nil {
+			log.Error().Err(err).Int("row", row.Row).Msg("insert imported expense")
+			http.Error(w, "internal", http.StatusInternalServerError)
+			return
+		}
+		imported++
+	}
+
+	rowsJSON, _ := json.Marshal(preview.Rows)
+	_, err = tx.Exec(r.Context(), `
+		UPDATE import_batches SET status = 'committed', rows = $2, imported_count = $3, committed_at = NOW()
+		WHERE id = $1
+	`, batchID, rowsJSON, imported)
+	if err != nil {
+		log.Error().Err(err).Msg("update import batch")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		log.Error().Err(err).Msg("commit import")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+
+	preview.Status, preview.ImportedCount = "committed", imported
+	preview.summarize()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(preview)
+}
+
+// CancelImport discards a pending batch
+func (h *ImportHandlers) CancelImport(w http.ResponseWriter, r *http.Request) {
+	batchID, userID, ok := importBatchParams(w, r)
+	if !ok {
+		return
+	}
+	var status string
+	err := h.DB.QueryRow(r.Context(), `SELECT status FROM import_batches WHERE id = $1 AND user_id = $2`, batchID, userID).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "import not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("select import batch")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+	tag, err := h.DB.Exec(r.Context(), `UPDATE import_batches SET status = 'cancelled' WHERE id = $1 AND status = 'pending'`, batchID)
+	if err != nil {
+		log.Error().Err(err).Msg("cancel import batch")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "import is already "+status, http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
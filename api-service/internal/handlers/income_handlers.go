@@ -4,9 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/expense-tracker/api-service/internal/auth"
+	"github.com/expense-tracker/api-service/internal/currency"
+	"github.com/expense-tracker/api-service/internal/repository"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/zerolog/log"
 )
@@ -31,6 +34,7 @@ type incomeRequest struct {
 	Description   string `json:"description"`
 	RelatedDebtID *int   `json:"related_debt_id"` // optional, for debt_return type
 	Timestamp     string `json:"timestamp"`       // RFC3339 optional
+	Currency      string `json:"currency"`        // optional, the user's base currency by default
 }
 
 // AddIncome creates an income for the authenticated user
@@ -51,14 +55,8 @@ func (h *IncomeHandlers) AddIncome(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate income type
-	validTypes := map[string]bool{
-		"salary": true, "debt_return": true, "prize": true,
-		"gift": true, "refund": true, "other": true,
-	}
-	if !validTypes[req.IncomeType] {
-		req.IncomeType = "other"
-	}
+	// Unknown income types are recorded as other
+	req.IncomeType = repository.IncomeType(req.IncomeType)
 
 	// parse timestamp if provided
 	ts := time.Now().UTC()
@@ -68,27 +66,60 @@ func (h *IncomeHandlers) AddIncome(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// If this is a debt_return and related_debt_id is provided, mark debt as paid
-	if req.IncomeType == "debt_return" && req.RelatedDebtID != nil {
-		_, err := h.DB.Exec(r.Context(),
-			`UPDATE debts SET is_paid = true, paid_at = NOW() WHERE id = $1`,
-			*req.RelatedDebtID)
-		if err != nil {
-			log.Error().Err(err).Msg("update debt status")
+	// Debts are kept in rubles, so are their returns
+	if req.IncomeType == repository.IncomeDebtReturn && req.RelatedDebtID != nil {
+		if req.Currency != "" && !strings.EqualFold(req.Currency, currency.Settlement) {
+			http.Error(w, "debt returns are recorded in "+currency.Settlement, http.StatusBadRequest)
+			return
+		}
+		req.Currency = currency.Settlement
+	}
+	if req.Currency != "" {
+		var err error
+		if req.Currency, err = currency.Check(r.Context(), h.DB, req.Currency); err != nil {
+			writeCurrencyError(w, err)
+			return
 		}
 	}
 
-	var incomeID int
-	err := h.DB.QueryRow(r.Context(),
-		`INSERT INTO incomes (user_id, amount_cents, income_type, description, related_debt_id, timestamp) 
-		 VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
-		userID, req.AmountCents, req.IncomeType, req.Description, req.RelatedDebtID, ts).Scan(&incomeID)
-
+	tx, err := h.DB.Begin(r.Context())
 	if err != nil {
+		log.Error().Err(err).Msg("begin income tx")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	income := repository.Transaction{
+		UserID:        userID,
+		AmountCents:   int64(req.AmountCents),
+		OperationType: repository.TypeIncome,
+		Timestamp:     ts,
+		Description:   req.Description,
+		Currency:      req.Currency,
+		IncomeType:    req.IncomeType,
+		RelatedDebtID: req.RelatedDebtID,
+	}
+	if err := repository.Insert(r.Context(), tx, &income); err != nil {
 		log.Error().Err(err).Msg("insert income")
 		http.Error(w, "internal", http.StatusInternalServerError)
 		return
 	}
+	incomeID := income.ID
+
+	// A debt_return for a debt owed to this user is recorded as a payment of that debt
+	if req.IncomeType == repository.IncomeDebtReturn && req.RelatedDebtID != nil {
+		if _, err := payDebt(r.Context(), tx, *req.RelatedDebtID, req.AmountCents, paymentOptions{RecordedBy: userID, Note: req.Description, IncomeID: &incomeID}); err != nil {
+			writeDebtPaymentError(w, err)
+			return
+		}
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		log.Error().Err(err).Msg("commit income")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
 
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]int{"id": incomeID})
@@ -118,51 +149,16 @@ func (h *IncomeHandlers) GetIncomes(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	query := `
-		SELECT i.id, i.user_id, i.amount_cents, i.income_type, i.description, i.related_debt_id, i.timestamp, u.username 
-		FROM incomes i
-		LEFT JOIN users u ON i.user_id = u.id
-		WHERE u.telegram_id = ANY($1)
-		ORDER BY i.timestamp DESC 
-		LIMIT 200
-	`
-
-	rows, err := h.DB.Query(r.Context(), query, whitelistIDs)
+	incomes, err := repository.Incomes(r.Context(), h.DB, repository.Scope{TelegramIDs: whitelistIDs}, 200)
 	if err != nil {
 		log.Error().Err(err).Msg("select incomes")
 		http.Error(w, "internal", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	type income struct {
-		ID            int     `json:"id"`
-		UserID        int64   `json:"user_id"`
-		AmountCents   int     `json:"amount_cents"`
-		IncomeType    string  `json:"income_type"`
-		Description   *string `json:"description"`
-		RelatedDebtID *int    `json:"related_debt_id"`
-		Timestamp     string  `json:"timestamp"`
-		Username      string  `json:"username"`
-	}
-
-	var res []income
-	for rows.Next() {
-		var it income
-		var ts time.Time
-		var username *string
-		if err := rows.Scan(&it.ID, &it.UserID, &it.AmountCents, &it.IncomeType, &it.Description, &it.RelatedDebtID, &ts, &username); err == nil {
-			it.Timestamp = ts.UTC().Format(time.RFC3339)
-			if username != nil {
-				it.Username = *username
-			}
-			res = append(res, it)
-		}
-	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(res)
-	log.Info().Int64("user_id", userID).Int("count", len(res)).Msg("returned family incomes")
+	json.NewEncoder(w).Encode(incomes)
+	log.Info().Int64("user_id", userID).Int("count", len(incomes)).Msg("returned family incomes")
 }
 
 // GetTotalIncomes returns total incomes for ALL family members with optional period filter
@@ -189,39 +185,32 @@ func (h *IncomeHandlers) GetTotalIncomes(w http.ResponseWriter, r *http.Request)
 	}
 
 	period := r.URL.Query().Get("period")
-	var timeFilter string
-
-	switch period {
-	case "week":
-		timeFilter = "AND i.timestamp >= NOW() - INTERVAL '7 days'"
-	case "month":
-		timeFilter = "AND i.timestamp >= NOW() - INTERVAL '30 days'"
-	default:
-		timeFilter = ""
-	}
-
-	query := fmt.Sprintf(`
-		SELECT COALESCE(SUM(i.amount_cents), 0) 
-		FROM incomes i
-		LEFT JOIN users u ON i.user_id = u.id
-		WHERE u.telegram_id = ANY($1) %s
-	`, timeFilter)
-
-	var totalCents int
-	err := h.DB.QueryRow(r.Context(), query, whitelistIDs).Scan(&totalCents)
+
+	// Amounts are converted into the user's base currency at the rate of their dates
+	base, err := currency.BaseOf(r.Context(), h.DB, userID)
+	if err != nil {
+		log.Error().Err(err).Msg("select base currency")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+
+	totals, err := repository.SumTotals(r.Context(), h.DB, repository.Scope{TelegramIDs: whitelistIDs, Days: repository.PeriodDays(period)}, base)
 	if err != nil {
 		log.Error().Err(err).Msg("select total incomes")
 		http.Error(w, "internal", http.StatusInternalServerError)
 		return
 	}
+	totalCents := totals.IncomeCents
 
 	response := map[string]interface{}{
 		"total_cents":  totalCents,
-		"total_rubles": float64(totalCents) / 100.0,
+		"total":        float64(totalCents) / 100.0,
+		"total_rubles": float64(totalCents) / 100.0, // legacy name, the amount is in currency
+		"currency":     base,
 		"period":       period,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
-	log.Info().Int64("user_id", userID).Str("period", period).Int("total_cents", totalCents).Msg("returned family total incomes")
+	log.Info().Int64("user_id", userID).Str("period", period).Int64("total_cents", totalCents).Msg("returned family total incomes")
 }
@@ -5,8 +5,13 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/expense-tracker/api-service/internal/currency"
+	"github.com/expense-tracker/api-service/internal/merchants"
+	"github.com/expense-tracker/api-service/internal/repository"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/zerolog/log"
 )
@@ -21,8 +26,23 @@ func NewInternalHandlers(db *pgxpool.Pool) *InternalHandlers {
 	return &InternalHandlers{DB: db}
 }
 
+// botAuthorized checks the X-BOT-KEY header and writes the error response if it does not match
+func botAuthorized(w http.ResponseWriter, r *http.Request) bool {
+	botKey := os.Getenv("BOT_API_KEY")
+	if botKey == "" {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return false
+	}
+	if r.Header.Get("X-BOT-KEY") != botKey {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
 // InternalPostExpense accepts a trusted request from the bot service to create an expense
-// Payload: { telegram_id: number|string, username?: string, amount_cents: number, timestamp?: string }
+// Payload: { telegram_id: number|string, username?: string, amount_cents: number, timestamp?: string,
+// description?: string, merchant?: string }
 // Protected by header X-BOT-KEY matching env BOT_API_KEY
 func (h *InternalHandlers) InternalPostExpense(w http.ResponseWriter, r *http.Request) {
 	botKey := os.Getenv("BOT_API_KEY")
@@ -117,12 +137,49 @@ func (h *InternalHandlers) InternalPostExpense(w http.ResponseWriter, r *http.Re
 			ts = parsed.UTC()
 		}
 	}
-	if _, err := h.DB.Exec(r.Context(), `INSERT INTO expenses (user_id, amount_cents, category_id, timestamp, is_shared, group_id, is_private) VALUES ($1,$2,$3,$4,$5,$6,$7)`, internalID, amountCents, categoryID, ts, false, groupID, isPrivate); err != nil {
+	// free text of the message, e.g. "продукты пятёрочка"
+	description, _ := payload["description"].(string)
+	description = strings.TrimSpace(description)
+	merchant, _ := payload["merchant"].(string)
+	if utf8.RuneCountInString(description) > maxDescriptionLength || utf8.RuneCountInString(merchant) > merchants.MaxNameLength {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	// currency code (optional, the user's base currency by default)
+	code, _ := payload["currency"].(string)
+	if code != "" {
+		var err error
+		if code, err = currency.Check(r.Context(), h.DB, code); err != nil {
+			writeCurrencyError(w, err)
+			return
+		}
+	}
+	merchantID, err := merchants.ForExpense(r.Context(), h.DB, merchant, description)
+	if err != nil {
+		log.Error().Err(err).Msg("resolve merchant internal")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+
+	expense := repository.Transaction{
+		UserID:      internalID,
+		AmountCents: int64(amountCents),
+		CategoryID:  categoryID,
+		Timestamp:   ts,
+		IsPrivate:   isPrivate,
+		GroupID:     groupID,
+		Description: description,
+		MerchantID:  merchantID,
+		Currency:    code,
+	}
+	if err := repository.Insert(r.Context(), h.DB, &expense); err != nil {
 		log.Error().Err(err).Msg("insert expense internal")
 		http.Error(w, "internal", http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": expense.ID, "currency": expense.Currency})
 }
 
 // InternalGetTotalExpenses returns total expenses for a user by telegram_id (for bot)
@@ -157,32 +214,27 @@ func (h *InternalHandlers) InternalGetTotalExpenses(w http.ResponseWriter, r *ht
 	}
 
 	period := r.URL.Query().Get("period")
-	var whereClause string
-	var args []interface{}
-
-	switch period {
-	case "week":
-		whereClause = "WHERE user_id=$1 AND timestamp >= NOW() - INTERVAL '7 days'"
-		args = []interface{}{userID}
-	case "month":
-		whereClause = "WHERE user_id=$1 AND timestamp >= NOW() - INTERVAL '30 days'"
-		args = []interface{}{userID}
-	default:
-		whereClause = "WHERE user_id=$1"
-		args = []interface{}{userID}
+
+	base, err := currency.BaseOf(r.Context(), h.DB, userID)
+	if err != nil {
+		log.Error().Err(err).Msg("select base currency internal")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
 	}
 
-	var totalCents int
-	err := h.DB.QueryRow(r.Context(), fmt.Sprintf("SELECT COALESCE(SUM(amount_cents), 0) FROM expenses %s", whereClause), args...).Scan(&totalCents)
+	totals, err := repository.SumTotals(r.Context(), h.DB, repository.Scope{UserID: userID, Days: repository.PeriodDays(period)}, base)
 	if err != nil {
 		log.Error().Err(err).Msg("select total expenses internal")
 		http.Error(w, "internal", http.StatusInternalServerError)
 		return
 	}
+	totalCents := totals.ExpenseCents
 
 	response := map[string]interface{}{
 		"total_cents":  totalCents,
-		"total_rubles": float64(totalCents) / 100.0,
+		"total":        float64(totalCents) / 100.0,
+		"total_rubles": float64(totalCents) / 100.0, // legacy name, the amount is in currency
+		"currency":     base,
 		"period":       period,
 	}
 
@@ -190,7 +242,7 @@ func (h *InternalHandlers) InternalGetTotalExpenses(w http.ResponseWriter, r *ht
 	json.NewEncoder(w).Encode(response)
 }
 
-// InternalGetDebts returns debts for a user by telegram_id (for bot)
+// InternalGetDebts returns unpaid debts for a user by telegram_id (for bot), net of payments
 func (h *InternalHandlers) InternalGetDebts(w http.ResponseWriter, r *http.Request) {
 	botKey := os.Getenv("BOT_API_KEY")
 	if botKey == "" {
@@ -221,60 +273,12 @@ func (h *InternalHandlers) InternalGetDebts(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Get debts where user owes money
-	rows, err := h.DB.Query(r.Context(), `
-		SELECT d.id, d.amount_cents, u.username, u.telegram_id
-		FROM debts d
-		JOIN users u ON d.from_user = u.id
-		WHERE d.to_user = $1
-		ORDER BY d.id DESC
-	`, userID)
+	debts, err := outstandingDebts(r.Context(), h.DB, userID)
 	if err != nil {
 		log.Error().Err(err).Msg("select debts internal")
 		http.Error(w, "internal", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	type debt struct {
-		ID          int    `json:"id"`
-		AmountCents int    `json:"amount_cents"`
-		Username    string `json:"username"`
-		TelegramID  int64  `json:"telegram_id"`
-		Type        string `json:"type"` // "owed_to_me" or "i_owe"
-	}
-
-	var debts []debt
-	for rows.Next() {
-		var d debt
-		if err := rows.Scan(&d.ID, &d.AmountCents, &d.Username, &d.TelegramID); err == nil {
-			d.Type = "owed_to_me"
-			debts = append(debts, d)
-		}
-	}
-
-	// Get debts where user owes money to others
-	rows2, err := h.DB.Query(r.Context(), `
-		SELECT d.id, d.amount_cents, u.username, u.telegram_id
-		FROM debts d
-		JOIN users u ON d.to_user = u.id
-		WHERE d.from_user = $1
-		ORDER BY d.id DESC
-	`, userID)
-	if err != nil {
-		log.Error().Err(err).Msg("select debts owed internal")
-		http.Error(w, "internal", http.StatusInternalServerError)
-		return
-	}
-	defer rows2.Close()
-
-	for rows2.Next() {
-		var d debt
-		if err := rows2.Scan(&d.ID, &d.AmountCents, &d.Username, &d.TelegramID); err == nil {
-			d.Type = "i_owe"
-			debts = append(debts, d)
-		}
-	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(debts)
@@ -404,3 +408,40 @@ func (h *InternalHandlers) InternalGetUserByUsername(w http.ResponseWriter, r *h
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]int64{"user_id": userID})
 }
+
+// InternalCreateSharedExpense creates a shared expense on behalf of a Telegram user (for the bot split command)
+// Payload: { telegram_id, username?, amount_cents, description?, merchant?, category_id?, group_id?, split_mode?, split_with?, participants? }
+// Split fields are the same as for POST /api/expenses/shared.
+func (h *InternalHandlers) InternalCreateSharedExpense(w http.ResponseWriter, r *http.Request) {
+	if !botAuthorized(w, r) {
+		return
+	}
+
+	var req struct {
+		TelegramID int64  `json:"telegram_id"`
+		Username   string `json:"username"`
+		sharedExpenseRequest
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.TelegramID == 0 {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	var creatorID int64
+	if err := h.DB.QueryRow(r.Context(), "INSERT INTO users (telegram_id, username) VALUES ($1,$2) ON CONFLICT (telegram_id) DO UPDATE SET username=EXCLUDED.username RETURNING id", req.TelegramID, req.Username).Scan(&creatorID); err != nil {
+		log.Error().Err(err).Msg("create user internal")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+
+	response, err := createSharedExpense(r.Context(), h.DB, creatorID, &req.sharedExpenseRequest)
+	if err != nil {
+		writeSharedExpenseError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+	log.Info().Int64("telegram_id", req.TelegramID).Int("expense_id", response.ExpenseID).Str("split_mode", req.SplitMode).Msg("created shared expense internal")
+}
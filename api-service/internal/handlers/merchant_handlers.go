@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/expense-tracker/api-service/internal/auth"
+	"github.com/expense-tracker/api-service/internal/currency"
+	"github.com/expense-tracker/api-service/internal/repository"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// MerchantHandlers handles merchants expenses are paid to
+type MerchantHandlers struct {
+	DB   *pgxpool.Pool
+	Auth *auth.Auth
+}
+
+// NewMerchantHandlers creates a new MerchantHandlers instance
+func NewMerchantHandlers(db *pgxpool.Pool, auth *auth.Auth) *MerchantHandlers {
+	return &MerchantHandlers{
+		DB:   db,
+		Auth: auth,
+	}
+}
+
+type topMerchant struct {
+	MerchantID int    `json:"merchant_id"`
+	Name       string `json:"name"`
+	Count      int    `json:"count"`
+	TotalCents int64  `json:"total_cents"`
+	AvgCents   int64  `json:"avg_cents"`
+	SharePct   int    `json:"share_pct"` // of the spending with a known merchant
+	LastPaidAt string `json:"last_paid_at"`
+}
+
+// GetTopMerchants returns the merchants the user spent most at.
+// GET /api/merchants/top?limit=10 plus the GetTransactions filters (start_date, end_date, category_id, scope)
+func (h *MerchantHandlers) GetTopMerchants(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	limit := 10
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		l, err := strconv.Atoi(raw)
+		if err != nil || l <= 0 || l > 100 {
+			http.Error(w, "limit must be 1..100", http.StatusBadRequest)
+			return
+		}
+		limit = l
+	}
+
+	groupIDs, err := repository.UserGroupIDs(r.Context(), h.DB, userID)
+	if err != nil {
+		log.Error().Err(err).Msg("select groups for top merchants")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+	base, err := currency.BaseOf(r.Context(), h.DB, userID)
+	if err != nil {
+		log.Error().Err(err).Msg("select base currency for top merchants")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+	filter := parseTransactionFilter(r.URL.Query())
+	filter.OperationType = "expense"
+	conditions, args := filter.Conditions(userID, groupIDs)
+	conditions = append(conditions, "e.merchant_id IS NOT NULL")
+	args = append(args, base)
+	amount := repository.ConvertedSQL("e", fmt.Sprintf("$%d", len(args)))
+	args = append(args, limit)
+
+	rows, err := h.DB.Query(r.Context(), fmt.Sprintf(`
+		SELECT m.id, m.name, COUNT(*), SUM(%[1]s), MAX(e.timestamp),
+			ROUND(100.0 * SUM(%[1]s) / SUM(SUM(%[1]s)) OVER ())::int
+		FROM expenses e
+		JOIN merchants m ON m.id = e.merchant_id
+		WHERE %[2]s
+		GROUP BY m.id, m.name
+		ORDER BY SUM(%[1]s) DESC, m.id
+		LIMIT $%[3]d
+	`, amount, strings.Join(conditions, " AND "), len(args)), args...)
+	if err != nil {
+		log.Error().Err(err).Msg("select top merchants")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	top := []topMerchant{}
+	for rows.Next() {
+		var m topMerchant
+		var lastPaid time.Time
+		if err := rows.Scan(&m.MerchantID, &m.Name, &m.Count, &m.TotalCents, &lastPaid, &m.SharePct); err != nil {
+			log.Error().Err(err).Msg("scan top merchant")
+			http.Error(w, "internal", http.StatusInternalServerError)
+			return
+		}
+		m.AvgCents = m.TotalCents / int64(m.Count)
+		m.LastPaidAt = lastPaid.UTC().Format(time.RFC3339)
+		top = append(top, m)
+	}
+	if err := rows.Err(); err != nil {
+		log.Error().Err(err).Msg("read top merchants")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"merchants": top, "currency": base})
+}
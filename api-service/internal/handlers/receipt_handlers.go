@@ -0,0 +1,403 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/expense-tracker/api-service/internal/auth"
+	"github.com/expense-tracker/api-service/internal/receipts"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// ReceiptHandlers exposes receipt splitting to authenticated users
+type ReceiptHandlers struct {
+	DB       *pgxpool.Pool
+	Auth     *auth.Auth
+	Receipts *receipts.Service
+}
+
+// NewReceiptHandlers creates a new ReceiptHandlers instance
+func NewReceiptHandlers(db *pgxpool.Pool, auth *auth.Auth) *ReceiptHandlers {
+	return &ReceiptHandlers{
+		DB:       db,
+		Auth:     auth,
+		Receipts: receipts.NewService(db),
+	}
+}
+
+// GetReceipt returns a receipt owned by the authenticated user
+func (h *ReceiptHandlers) GetReceipt(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	receiptID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid receipt id", http.StatusBadRequest)
+		return
+	}
+
+	rec, err := h.Receipts.Get(r.Context(), receiptID)
+	if err == nil && rec.OwnerID != userID {
+		err = receipts.ErrForbidden
+	}
+	if err != nil {
+		writeReceiptError(w, err, receiptID)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rec)
+}
+
+// PreviewSplit computes each participant's share without writing anything
+// Payload: { tip_cents?, extra_tax_cents?, weights?: { item_id: { telegram_id: weight } } }
+func (h *ReceiptHandlers) PreviewSplit(w http.ResponseWriter, r *http.Request) {
+	h.split(w, r, false)
+}
+
+// FinalizeReceipt splits the receipt and writes one shared expense and the participants' debts in a single transaction
+// Payload: same as PreviewSplit
+func (h *ReceiptHandlers) FinalizeReceipt(w http.ResponseWriter, r *http.Request) {
+	h.split(w, r, true)
+}
+
+func (h *ReceiptHandlers) split(w http.ResponseWriter, r *http.Request, finalize bool) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	receiptID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid receipt id", http.StatusBadRequest)
+		return
+	}
+	var opts receipts.Options
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var result *receipts.Split
+	if finalize {
+		result, err = h.Receipts.Finalize(r.Context(), receiptID, userID, opts)
+	} else {
+		var rec *receipts.Receipt
+		rec, err = h.Receipts.Get(r.Context(), receiptID)
+		if err == nil && rec.OwnerID != userID {
+			err = receipts.ErrForbidden
+		}
+		if err == nil {
+			result, err = receipts.Compute(rec, opts)
+		}
+	}
+	if err != nil {
+		writeReceiptError(w, err, receiptID)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+	if finalize {
+		log.Info().Int64("user_id", userID).Int("receipt_id", receiptID).Int("expense_id", result.ExpenseID).Msg("finalized receipt")
+	}
+}
+
+// InternalCreateReceipt stores a receipt recognized by ocr-service
+// Payload: { telegram_id, username, group_id?, merchant, date?, total_cents, tax_cents, fiscal?: {fn, fd, fp}, items: [{name, quantity, price_cents}] }
+func (h *InternalHandlers) InternalCreateReceipt(w http.ResponseWriter, r *http.Request) {
+	if !botAuthorized(w, r) {
+		return
+	}
+
+	var req struct {
+		TelegramID int64      `json:"telegram_id"`
+		Username   string     `json:"username"`
+		GroupID    *int64     `json:"group_id"`
+		Merchant   string     `json:"merchant"`
+		Date       *time.Time `json:"date"`
+		TotalCents int        `json:"total_cents"`
+		TaxCents   int        `json:"tax_cents"`
+		Fiscal     *struct {
+			FN string `json:"fn"`
+			FD string `json:"fd"`
+			FP string `json:"fp"`
+		} `json:"fiscal"`
+		Items []struct {
+			Name       string  `json:"name"`
+			Quantity   float64 `json:"quantity"`
+			PriceCents int     `json:"price_cents"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if req.TelegramID == 0 || len(req.Items) == 0 {
+		http.Error(w, "telegram_id and items are required", http.StatusBadRequest)
+		return
+	}
+	for _, item := range req.Items {
+		if item.Name == "" || item.PriceCents <= 0 {
+			http.Error(w, "every item needs a name and a positive price_cents", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var fn, fd, fp *string
+	if req.Fiscal != nil && req.Fiscal.FN != "" {
+		fn, fd, fp = &req.Fiscal.FN, &req.Fiscal.FD, &req.Fiscal.FP
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		log.Error().Err(err).Msg("begin create receipt")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	var ownerID int64
+	if err := tx.QueryRow(r.Context(), "INSERT INTO users (telegram_id, username) VALUES ($1,$2) ON CONFLICT (telegram_id) DO UPDATE SET username=EXCLUDED.username RETURNING id", req.TelegramID, req.Username).Scan(&ownerID); err != nil {
+		log.Error().Err(err).Msg("create receipt owner")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+
+	var receiptID int
+	err = tx.QueryRow(r.Context(), `
+		INSERT INTO receipts (owner_id, merchant, receipt_date, total_cents, tax_cents, fiscal_fn, fiscal_fd, fiscal_fp, group_id, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, 'pending')
+		RETURNING id
+	`, ownerID, req.Merchant, req.Date, req.TotalCents, req.TaxCents, fn, fd, fp, req.GroupID).Scan(&receiptID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			http.Error(w, "receipt already recorded", http.StatusConflict)
+			return
+		}
+		log.Error().Err(err).Msg("insert receipt")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+
+	for _, item := range req.Items {
+		quantity := item.Quantity
+		if quantity <= 0 {
+			quantity = 1
+		}
+		if _, err := tx.Exec(r.Context(), `INSERT INTO receipt_items (receipt_id, name, quantity, price_cents, selected_by) VALUES ($1,$2,$3,$4,'[]')`,
+			receiptID, item.Name, quantity, item.PriceCents); err != nil {
+			log.Error().Err(err).Msg("insert receipt item")
+			http.Error(w, "internal", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		log.Error().Err(err).Msg("commit create receipt")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeReceipt(w, r, receiptID, http.StatusCreated)
+	log.Info().Int64("telegram_id", req.TelegramID).Int("receipt_id", receiptID).Int("items", len(req.Items)).Msg("created receipt")
+}
+
+// InternalGetReceipt returns a receipt with its items and current selections
+func (h *InternalHandlers) InternalGetReceipt(w http.ResponseWriter, r *http.Request) {
+	if !botAuthorized(w, r) {
+		return
+	}
+	receiptID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid receipt id", http.StatusBadRequest)
+		return
+	}
+	h.writeReceipt(w, r, receiptID, http.StatusOK)
+}
+
+// InternalToggleReceiptItem adds the user to the item's selected_by list, or removes them if already there
+// Payload: { telegram_id, username }
+func (h *InternalHandlers) InternalToggleReceiptItem(w http.ResponseWriter, r *http.Request) {
+	if !botAuthorized(w, r) {
+		return
+	}
+	receiptID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid receipt id", http.StatusBadRequest)
+		return
+	}
+	itemID, err := strconv.Atoi(chi.URLParam(r, "itemID"))
+	if err != nil {
+		http.Error(w, "invalid item id", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		TelegramID int64  `json:"telegram_id"`
+		Username   string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.TelegramID == 0 {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	rec, err := receipts.NewService(h.DB).Get(r.Context(), receiptID)
+	if err != nil {
+		writeReceiptError(w, err, receiptID)
+		return
+	}
+	if rec.Status != receipts.StatusPending {
+		writeReceiptError(w, receipts.ErrNotPending, receiptID)
+		return
+	}
+
+	// Selections are stored by Telegram ID, but debts need an internal user
+	if _, err := h.DB.Exec(r.Context(), "INSERT INTO users (telegram_id, username) VALUES ($1,$2) ON CONFLICT (telegram_id) DO UPDATE SET username=EXCLUDED.username", req.TelegramID, req.Username); err != nil {
+		log.Error().Err(err).Msg("upsert receipt participant")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+
+	tag, err := h.DB.Exec(r.Context(), `
+		UPDATE receipt_items SET selected_by = CASE
+			WHEN selected_by @> jsonb_build_array($3::bigint)
+				THEN (SELECT COALESCE(jsonb_agg(e), '[]'::jsonb) FROM jsonb_array_elements(selected_by) e WHERE e <> to_jsonb($3::bigint))
+			ELSE selected_by || jsonb_build_array($3::bigint)
+		END
+		WHERE id = $1 AND receipt_id = $2
+	`, itemID, receiptID, req.TelegramID)
+	if err != nil {
+		log.Error().Err(err).Msg("toggle receipt item")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "item not found", http.StatusNotFound)
+		return
+	}
+
+	h.writeReceipt(w, r, receiptID, http.StatusOK)
+}
+
+// InternalFinalizeReceipt splits the receipt by the current selections and records the shared expense and debts.
+// Only the owner can finalize.
+// Payload: { telegram_id, tip_cents?, extra_tax_cents?, weights?: { item_id: { telegram_id: weight } } }
+func (h *InternalHandlers) InternalFinalizeReceipt(w http.ResponseWriter, r *http.Request) {
+	if !botAuthorized(w, r) {
+		return
+	}
+	receiptID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid receipt id", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		TelegramID int64 `json:"telegram_id"`
+		receipts.Options
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	var userID int64
+	if err := h.DB.QueryRow(r.Context(), "SELECT id FROM users WHERE telegram_id=$1", req.TelegramID).Scan(&userID); err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	result, err := receipts.NewService(h.DB).Finalize(r.Context(), receiptID, userID, req.Options)
+	if err != nil {
+		writeReceiptError(w, err, receiptID)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+	log.Info().Int("receipt_id", receiptID).Int("expense_id", result.ExpenseID).Int("participants", len(result.Shares)).Msg("finalized receipt")
+}
+
+// InternalCancelReceipt discards a pending receipt. Only the owner can cancel.
+// Payload: { telegram_id }
+func (h *InternalHandlers) InternalCancelReceipt(w http.ResponseWriter, r *http.Request) {
+	if !botAuthorized(w, r) {
+		return
+	}
+	receiptID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid receipt id", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		TelegramID int64 `json:"telegram_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	rec, err := receipts.NewService(h.DB).Get(r.Context(), receiptID)
+	if err != nil {
+		writeReceiptError(w, err, receiptID)
+		return
+	}
+	if rec.OwnerTelegramID != req.TelegramID {
+		writeReceiptError(w, receipts.ErrForbidden, receiptID)
+		return
+	}
+
+	tag, err := h.DB.Exec(r.Context(), `UPDATE receipts SET status='cancelled' WHERE id=$1 AND status='pending'`, receiptID)
+	if err != nil {
+		log.Error().Err(err).Msg("cancel receipt")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		writeReceiptError(w, receipts.ErrNotPending, receiptID)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": receipts.StatusCancelled})
+}
+
+func (h *InternalHandlers) writeReceipt(w http.ResponseWriter, r *http.Request, receiptID int, status int) {
+	rec, err := receipts.NewService(h.DB).Get(r.Context(), receiptID)
+	if err != nil {
+		writeReceiptError(w, err, receiptID)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(rec)
+}
+
+// writeReceiptError maps receipt service errors to HTTP statuses
+func writeReceiptError(w http.ResponseWriter, err error, receiptID int) {
+	switch {
+	case errors.Is(err, receipts.ErrNotFound):
+		http.Error(w, "receipt not found", http.StatusNotFound)
+	case errors.Is(err, receipts.ErrForbidden):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, receipts.ErrNotPending):
+		http.Error(w, "receipt is already finalized or cancelled", http.StatusConflict)
+	case errors.Is(err, receipts.ErrInvalidSplit):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Error().Err(err).Int("receipt_id", receiptID).Msg("receipt operation failed")
+		http.Error(w, "internal", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,448 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/expense-tracker/api-service/internal/auth"
+	"github.com/expense-tracker/api-service/internal/currency"
+	"github.com/expense-tracker/api-service/internal/recurring"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// RecurringHandlers handles recurring transactions (salary, rent, subscriptions)
+type RecurringHandlers struct {
+	DB   *pgxpool.Pool
+	Auth *auth.Auth
+}
+
+// NewRecurringHandlers creates a new RecurringHandlers instance
+func NewRecurringHandlers(db *pgxpool.Pool, auth *auth.Auth) *RecurringHandlers {
+	return &RecurringHandlers{
+		DB:   db,
+		Auth: auth,
+	}
+}
+
+type recurringRequest struct {
+	AmountCents   int    `json:"amount_cents"`
+	OperationType string `json:"operation_type"` // expense (default) or income
+	CategoryID    *int   `json:"category_id"`
+	SubcategoryID *int   `json:"subcategory_id"`
+	GroupID       *int64 `json:"group_id"`
+	Description   string `json:"description"`
+	Currency      string `json:"currency"`   // of the amount, the user's base currency by default
+	AccountID     *int   `json:"account_id"` // paid from or received to; sets the currency
+	Schedule      string `json:"schedule"`   // monthly, last_business_day or weekly
+	Interval      int    `json:"interval"`   // every N months/weeks, default 1
+	DayOfMonth    int    `json:"day_of_month"`
+	StartDate     string `json:"start_date"` // YYYY-MM-DD, default today
+	EndDate       string `json:"end_date"`   // YYYY-MM-DD, optional
+	IsActive      *bool  `json:"is_active"`  // updates only
+}
+
+type recurringResponse struct {
+	ID            int     `json:"id"`
+	AmountCents   int     `json:"amount_cents"`
+	OperationType string  `json:"operation_type"`
+	CategoryID    *int    `json:"category_id"`
+	SubcategoryID *int    `json:"subcategory_id"`
+	GroupID       *int64  `json:"group_id"`
+	Description   string  `json:"description"`
+	Currency      string  `json:"currency"`
+	AccountID     *int    `json:"account_id"`
+	Schedule      string  `json:"schedule"`
+	Interval      int     `json:"interval"`
+	DayOfMonth    *int    `json:"day_of_month"`
+	StartDate     string  `json:"start_date"`
+	EndDate       *string `json:"end_date"`
+	NextRun       *string `json:"next_run"`
+	IsActive      bool    `json:"is_active"`
+}
+
+type upcomingCharge struct {
+	RecurringID   int    `json:"recurring_id"`
+	Date          string `json:"date"`
+	AmountCents   int    `json:"amount_cents"`
+	Currency      string `json:"currency"`
+	OperationType string `json:"operation_type"`
+	Description   string `json:"description"`
+	CategoryName  string `json:"category_name"`
+}
+
+const recurringColumns = `r.id, r.amount_cents, r.operation_type, r.category_id, r.subcategory_id, r.group_id, COALESCE(r.description, ''),
+	r.currency, r.account_id, r.schedule, r.interval_count, r.day_of_month, r.start_date, r.end_date, r.next_run, r.is_active`
+
+// schedule validates the request and builds its schedule
+func (req *recurringRequest) schedule(today time.Time) (recurring.Schedule, error) {
+	if req.AmountCents <= 0 {
+		return recurring.Schedule{}, errors.New("amount_cents must be positive")
+	}
+	if req.OperationType == "" {
+		req.OperationType = "expense"
+	}
+	if req.OperationType != "expense" && req.OperationType != "income" {
+		return recurring.Schedule{}, errors.New("operation_type must be expense or income")
+	}
+	if req.Interval == 0 {
+		req.Interval = 1
+	}
+
+	s := recurring.Schedule{Kind: req.Schedule, Interval: req.Interval, DayOfMonth: req.DayOfMonth, Start: today}
+	if req.StartDate != "" {
+		start, err := time.Parse(time.DateOnly, req.StartDate)
+		if err != nil {
+			return s, errors.New("start_date must be YYYY-MM-DD")
+		}
+		s.Start = start
+	}
+	if req.EndDate != "" {
+		end, err := time.Parse(time.DateOnly, req.EndDate)
+		if err != nil {
+			return s, errors.New("end_date must be YYYY-MM-DD")
+		}
+		s.End = &end
+	}
+	if s.Kind != recurring.KindMonthly {
+		s.DayOfMonth = 0
+	}
+	if err := s.Validate(); err != nil {
+		return s, errors.New("invalid schedule: use monthly with day_of_month 1-31, last_business_day or weekly, interval 1-52")
+	}
+	return s, nil
+}
+
+// scanRecurring reads a row selected with recurringColumns
+func scanRecurring(row pgx.Row) (recurringResponse, error) {
+	var rec recurringResponse
+	var start time.Time
+	var end, next *time.Time
+	err := row.Scan(&rec.ID, &rec.AmountCents, &rec.OperationType, &rec.CategoryID, &rec.SubcategoryID, &rec.GroupID, &rec.Description,
+		&rec.Currency, &rec.AccountID, &rec.Schedule, &rec.Interval, &rec.DayOfMonth, &start, &end, &next, &rec.IsActive)
+	rec.StartDate = start.Format(time.DateOnly)
+	rec.EndDate = formatOptionalDate(end)
+	rec.NextRun = formatOptionalDate(next)
+	return rec, err
+}
+
+func formatOptionalDate(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	formatted := t.Format(time.DateOnly)
+	return &formatted
+}
+
+// decodeRecurringRequest reads and checks a create/update request and returns it with the next occurrence;
+// it writes the error response itself
+func (h *RecurringHandlers) decodeRecurringRequest(w http.ResponseWriter, r *http.Request, userID int64) (*recurringRequest, recurring.Schedule, *time.Time, bool) {
+	var req recurringRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return nil, recurring.Schedule{}, nil, false
+	}
+	today := recurring.Today()
+	s, err := req.schedule(today)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, s, nil, false
+	}
+	if status, err := checkExpenseTargets(r.Context(), h.DB, userID, req.GroupID, &req.CategoryID, req.SubcategoryID); err != nil {
+		writeTargetError(w, status, err)
+		return nil, s, nil, false
+	}
+	// An account sets the currency, like for a transaction entered by hand
+	if req.AccountID != nil {
+		accountCurrency, err := accountCurrency(r.Context(), h.DB, userID, *req.AccountID)
+		if errors.Is(err, errUnknownAccount) {
+			http.Error(w, "account not found", http.StatusBadRequest)
+			return nil, s, nil, false
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("select account")
+			http.Error(w, "internal", http.StatusInternalServerError)
+			return nil, s, nil, false
+		}
+		if req.Currency != "" && !strings.EqualFold(req.Currency, accountCurrency) {
+			http.Error(w, "currency does not match the account currency", http.StatusBadRequest)
+			return nil, s, nil, false
+		}
+		req.Currency = accountCurrency
+	}
+	if req.Currency != "" {
+		if req.Currency, err = currency.Check(r.Context(), h.DB, req.Currency); err != nil {
+			writeCurrencyError(w, err)
+			return nil, s, nil, false
+		}
+	}
+
+	// Occurrences before today are not backfilled
+	var nextRun *time.Time
+	if next, ok := s.Next(today); ok {
+		nextRun = &next
+	}
+	return &req, s, nextRun, true
+}
+
+// nullableDay turns a zero day_of_month into NULL
+func nullableDay(day int) *int {
+	if day == 0 {
+		return nil
+	}
+	return &day
+}
+
+// CreateRecurring creates a recurring expense or income
+func (h *RecurringHandlers) CreateRecurring(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	req, s, nextRun, ok := h.decodeRecurringRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	rec, err := scanRecurring(h.DB.QueryRow(r.Context(), `
+		INSERT INTO recurring_transactions AS r (user_id, group_id, amount_cents, operation_type, category_id, subcategory_id, description,
+			currency, account_id, schedule, interval_count, day_of_month, start_date, end_date, next_run)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), $9, $10, $11, $12, $13, $14, $15)
+		RETURNING `+recurringColumns,
+		userID, req.GroupID, req.AmountCents, req.OperationType, req.CategoryID, req.SubcategoryID, req.Description,
+		req.Currency, req.AccountID, s.Kind, s.Interval, nullableDay(s.DayOfMonth), s.Start, s.End, nextRun))
+	if err != nil {
+		log.Error().Err(err).Msg("insert recurring transaction")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rec)
+	log.Info().Int64("user_id", userID).Int("recurring_id", rec.ID).Str("schedule", rec.Schedule).Msg("recurring transaction created")
+}
+
+// GetRecurring returns the user's recurring transactions
+func (h *RecurringHandlers) GetRecurring(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := h.DB.Query(r.Context(), `SELECT `+recurringColumns+` FROM recurring_transactions r WHERE r.user_id = $1 ORDER BY r.is_active DESC, r.next_run NULLS LAST, r.id`, userID)
+	if err != nil {
+		log.Error().Err(err).Msg("select recurring transactions")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	list := []recurringResponse{}
+	for rows.Next() {
+		rec, err := scanRecurring(rows)
+		if err != nil {
+			log.Error().Err(err).Msg("scan recurring transaction")
+			http.Error(w, "internal", http.StatusInternalServerError)
+			return
+		}
+		list = append(list, rec)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// UpdateRecurring replaces a recurring transaction's settings; already created expenses are kept
+func (h *RecurringHandlers) UpdateRecurring(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid recurring id", http.StatusBadRequest)
+		return
+	}
+	req, s, nextRun, ok := h.decodeRecurringRequest(w, r, userID)
+	if !ok {
+		return
+	}
+	isActive := true
+	if req.IsActive != nil {
+		isActive = *req.IsActive
+	}
+
+	rec, err := scanRecurring(h.DB.QueryRow(r.Context(), `
+		UPDATE recurring_transactions r SET group_id = $3, amount_cents = $4, operation_type = $5, category_id = $6, subcategory_id = $7,
+			description = NULLIF($8, ''), currency = COALESCE(NULLIF($9, ''), r.currency), account_id = $10, schedule = $11,
+			interval_count = $12, day_of_month = $13, start_date = $14, end_date = $15, next_run = $16, is_active = $17, updated_at = NOW()
+		WHERE r.id = $1 AND r.user_id = $2
+		RETURNING `+recurringColumns,
+		id, userID, req.GroupID, req.AmountCents, req.OperationType, req.CategoryID, req.SubcategoryID, req.Description,
+		req.Currency, req.AccountID, s.Kind, s.Interval, nullableDay(s.DayOfMonth), s.Start, s.End, nextRun, isActive))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "recurring transaction not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("update recurring transaction")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rec)
+	log.Info().Int64("user_id", userID).Int("recurring_id", id).Msg("recurring transaction updated")
+}
+
+// DeleteRecurring deletes a recurring transaction; already created expenses are kept
+func (h *RecurringHandlers) DeleteRecurring(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid recurring id", http.StatusBadRequest)
+		return
+	}
+
+	tag, err := h.DB.Exec(r.Context(), `DELETE FROM recurring_transactions WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		log.Error().Err(err).Msg("delete recurring transaction")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "recurring transaction not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	log.Info().Int64("user_id", userID).Int("recurring_id", id).Msg("recurring transaction deleted")
+}
+
+// upcomingRecurring lists the occurrences of the user's active recurring transactions in [from, to], by date
+func upcomingRecurring(ctx context.Context, db *pgxpool.Pool, userID int64, from, to time.Time) ([]upcomingCharge, error) {
+	rows, err := db.Query(ctx, `
+		SELECT r.id, r.amount_cents, r.currency, r.operation_type, COALESCE(r.description, ''), COALESCE(c.name, ''),
+			r.schedule, r.interval_count, COALESCE(r.day_of_month, 0), r.start_date, r.end_date
+		FROM recurring_transactions r
+		LEFT JOIN categories c ON c.id = r.category_id
+		WHERE r.user_id = $1 AND r.is_active AND r.next_run IS NOT NULL
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	charges := []upcomingCharge{}
+	for rows.Next() {
+		var charge upcomingCharge
+		var s recurring.Schedule
+		if err := rows.Scan(&charge.RecurringID, &charge.AmountCents, &charge.Currency, &charge.OperationType, &charge.Description, &charge.CategoryName,
+			&s.Kind, &s.Interval, &s.DayOfMonth, &s.Start, &s.End); err != nil {
+			return nil, err
+		}
+		for _, d := range s.Between(from, to) {
+			charge.Date = d.Format(time.DateOnly)
+			charges = append(charges, charge)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(charges, func(i, j int) bool {
+		if charges[i].Date != charges[j].Date {
+			return charges[i].Date < charges[j].Date
+		}
+		return charges[i].RecurringID < charges[j].RecurringID
+	})
+	return charges, nil
+}
+
+// upcomingDays parses the "days" query parameter: 30 by default, at most a year
+func upcomingDays(r *http.Request) (int, bool) {
+	v := r.URL.Query().Get("days")
+	if v == "" {
+		return 30, true
+	}
+	days, err := strconv.Atoi(v)
+	if err != nil || days < 1 || days > 366 {
+		return 0, false
+	}
+	return days, true
+}
+
+// GetUpcomingRecurring lists the user's upcoming charges and incomes for the next `days` days (default 30)
+func (h *RecurringHandlers) GetUpcomingRecurring(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	days, ok := upcomingDays(r)
+	if !ok {
+		http.Error(w, "days must be 1-366", http.StatusBadRequest)
+		return
+	}
+
+	today := recurring.Today()
+	charges, err := upcomingRecurring(r.Context(), h.DB, userID, today, today.AddDate(0, 0, days))
+	if err != nil {
+		log.Error().Err(err).Msg("select upcoming recurring transactions")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(charges)
+}
+
+// InternalGetUpcomingRecurring lists upcoming recurring charges by telegram_id (for the bot /recurring command)
+func (h *InternalHandlers) InternalGetUpcomingRecurring(w http.ResponseWriter, r *http.Request) {
+	if !botAuthorized(w, r) {
+		return
+	}
+	telegramID, err := strconv.ParseInt(r.URL.Query().Get("telegram_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid telegram_id", http.StatusBadRequest)
+		return
+	}
+	days, ok := upcomingDays(r)
+	if !ok {
+		http.Error(w, "days must be 1-366", http.StatusBadRequest)
+		return
+	}
+
+	var userID int64
+	if err := h.DB.QueryRow(r.Context(), "SELECT id FROM users WHERE telegram_id=$1", telegramID).Scan(&userID); err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	today := recurring.Today()
+	charges, err := upcomingRecurring(r.Context(), h.DB, userID, today, today.AddDate(0, 0, days))
+	if err != nil {
+		log.Error().Err(err).Msg("select upcoming recurring transactions internal")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(charges)
+}
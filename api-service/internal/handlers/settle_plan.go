@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/expense-tracker/api-service/internal/auth"
+	"github.com/expense-tracker/api-service/internal/split"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+type settleMember struct {
+	TelegramID   int64  `json:"telegram_id"`
+	Username     string `json:"username"`
+	BalanceCents int    `json:"balance_cents"` // positive: is owed money
+}
+
+type settleTransfer struct {
+	FromTelegramID int64  `json:"from_telegram_id"`
+	FromUsername   string `json:"from_username"`
+	ToTelegramID   int64  `json:"to_telegram_id"`
+	ToUsername     string `json:"to_username"`
+	AmountCents    int    `json:"amount_cents"`
+}
+
+type settlePlanResponse struct {
+	GroupID          int64            `json:"group_id"`
+	Members          []settleMember   `json:"members"`
+	Transfers        []settleTransfer `json:"transfers"`
+	DebtsCount       int              `json:"debts_count"`
+	OutstandingCents int              `json:"outstanding_cents"`
+}
+
+// isGroupMember reports whether the Telegram user belongs to the group
+func isGroupMember(ctx context.Context, db *pgxpool.Pool, groupID, telegramID int64) (bool, error) {
+	var member bool
+	err := db.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM group_members WHERE group_id = $1 AND user_id = $2)`, groupID, telegramID).Scan(&member)
+	return member, err
+}
+
+// isUserInGroup reports whether the user (users.id) belongs to the group
+func isUserInGroup(ctx context.Context, db *pgxpool.Pool, groupID, userID int64) (bool, error) {
+	var member bool
+	err := db.QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM group_members gm JOIN users u ON u.telegram_id = gm.user_id WHERE gm.group_id = $1 AND u.id = $2)
+	`, groupID, userID).Scan(&member)
+	return member, err
+}
+
+// groupSettlePlan nets the unpaid debts between group members (after partial payments)
+// and returns the minimal set of transfers that clears them.
+func groupSettlePlan(ctx context.Context, db *pgxpool.Pool, groupID int64) (*settlePlanResponse, error) {
+	plan := &settlePlanResponse{GroupID: groupID, Members: []settleMember{}, Transfers: []settleTransfer{}}
+
+	rows, err := db.Query(ctx, `
+		SELECT u.telegram_id, COALESCE(u.username, '')
+		FROM group_members gm
+		JOIN users u ON u.telegram_id = gm.user_id
+		WHERE gm.group_id = $1
+		ORDER BY u.telegram_id
+	`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	index := map[int64]int{}
+	for rows.Next() {
+		var m settleMember
+		if err := rows.Scan(&m.TelegramID, &m.Username); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		index[m.TelegramID] = len(plan.Members)
+		plan.Members = append(plan.Members, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Only debts where both sides are in the group take part in the plan
+	rows, err = db.Query(ctx, `
+		SELECT fu.telegram_id, tu.telegram_id, d.amount_cents - COALESCE(p.paid, 0)
+		FROM debts d
+		JOIN users fu ON fu.id = d.from_user
+		JOIN users tu ON tu.id = d.to_user
+		JOIN group_members fm ON fm.group_id = $1 AND fm.user_id = fu.telegram_id
+		JOIN group_members tm ON tm.group_id = $1 AND tm.user_id = tu.telegram_id
+		LEFT JOIN (SELECT debt_id, SUM(amount_cents) AS paid FROM debt_payments GROUP BY debt_id) p ON p.debt_id = d.id
+		WHERE d.is_paid = false AND d.amount_cents > COALESCE(p.paid, 0)
+	`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := make(map[int64]int, len(plan.Members))
+	for rows.Next() {
+		var from, to int64
+		var outstanding int
+		if err := rows.Scan(&from, &to, &outstanding); err != nil {
+			return nil, err
+		}
+		balances[from] -= outstanding
+		balances[to] += outstanding
+		plan.DebtsCount++
+		plan.OutstandingCents += outstanding
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	transfers, err := split.Settle(balances)
+	if err != nil {
+		return nil, err
+	}
+	for i := range plan.Members {
+		plan.Members[i].BalanceCents = balances[plan.Members[i].TelegramID]
+	}
+	for _, t := range transfers {
+		plan.Transfers = append(plan.Transfers, settleTransfer{
+			FromTelegramID: t.From,
+			FromUsername:   plan.Members[index[t.From]].Username,
+			ToTelegramID:   t.To,
+			ToUsername:     plan.Members[index[t.To]].Username,
+			AmountCents:    t.AmountCents,
+		})
+	}
+	return plan, nil
+}
+
+// GetSettlePlan returns who should pay whom to clear all debts inside a family group
+func (h *FamilyHandlers) GetSettlePlan(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	groupID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid group id", http.StatusBadRequest)
+		return
+	}
+
+	var telegramID int64
+	if err := h.DB.QueryRow(r.Context(), "SELECT telegram_id FROM users WHERE id=$1", userID).Scan(&telegramID); err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	member, err := isGroupMember(r.Context(), h.DB, groupID, telegramID)
+	if err != nil {
+		log.Error().Err(err).Int64("group_id", groupID).Msg("check group membership")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if !member {
+		http.Error(w, "group not found", http.StatusNotFound)
+		return
+	}
+
+	plan, err := groupSettlePlan(r.Context(), h.DB, groupID)
+	if err != nil {
+		log.Error().Err(err).Int64("group_id", groupID).Msg("failed to build settle plan")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plan)
+	log.Info().Int64("user_id", userID).Int64("group_id", groupID).Int("transfers", len(plan.Transfers)).Msg("returned settle plan")
+}
+
+// InternalGetSettlePlan returns the settle plan of a group for the bot /settle command.
+// Query: telegram_id - the requesting user, who must be a member of the group.
+func (h *InternalHandlers) InternalGetSettlePlan(w http.ResponseWriter, r *http.Request) {
+	if !botAuthorized(w, r) {
+		return
+	}
+	groupID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid group id", http.StatusBadRequest)
+		return
+	}
+	telegramID, err := strconv.ParseInt(r.URL.Query().Get("telegram_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid telegram_id", http.StatusBadRequest)
+		return
+	}
+
+	member, err := isGroupMember(r.Context(), h.DB, groupID, telegramID)
+	if err != nil {
+		log.Error().Err(err).Int64("group_id", groupID).Msg("check group membership internal")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if !member {
+		http.Error(w, "group not found", http.StatusNotFound)
+		return
+	}
+
+	plan, err := groupSettlePlan(r.Context(), h.DB, groupID)
+	if err != nil {
+		log.Error().Err(err).Int64("group_id", groupID).Msg("failed to build settle plan internal")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plan)
+}
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/expense-tracker/api-service/internal/auth"
+	"github.com/expense-tracker/api-service/internal/repository"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// maxBulkItems limits how many transactions one bulk request changes
+const maxBulkItems = 1000
+
+// Bulk operations
+const (
+	bulkRecategorize   = "recategorize"    // category_id, clears the subcategory
+	bulkSetSubcategory = "set_subcategory" // subcategory_id and its category; null clears the subcategory
+	bulkMarkPrivate    = "mark_private"    // hide from the group
+	bulkMarkShared     = "mark_shared"     // show to the group
+	bulkMoveToGroup    = "move_to_group"   // group_id, null makes them personal
+	bulkDelete         = "delete"
+	bulkRestore        = "restore"
+)
+
+// Per-item statuses of a bulk operation
+const (
+	bulkUpdated   = "updated"
+	bulkUnchanged = "unchanged"
+	bulkNotFound  = "not_found" // missing, foreign, or already deleted/restored
+	bulkInvalid   = "invalid"
+)
+
+var errInvalidBulkRequest = errors.New("invalid bulk request")
+
+// bulkFilter selects the user's own transactions with the GetTransactions filters
+type bulkFilter struct {
+	OperationType string `json:"operation_type"`
+	CategoryID    *int   `json:"category_id"`
+	SubcategoryID *int   `json:"subcategory_id"`
+	MerchantID    *int   `json:"merchant_id"`
+	StartDate     string `json:"start_date"` // RFC3339
+	EndDate       string `json:"end_date"`   // RFC3339
+}
+
+// transactionFilter converts the filter; restore looks in the trash
+func (f bulkFilter) transactionFilter(deleted bool) repository.Filter {
+	itoa := func(id *int) string {
+		if id == nil {
+			return ""
+		}
+		return strconv.Itoa(*id)
+	}
+	return repository.Filter{
+		OperationType: f.OperationType,
+		CategoryID:    itoa(f.CategoryID),
+		SubcategoryID: itoa(f.SubcategoryID),
+		MerchantID:    itoa(f.MerchantID),
+		StartDate:     f.StartDate,
+		EndDate:       f.EndDate,
+		Scope:         "personal",
+		Deleted:       deleted,
+	}
+}
+
+// bulkRequest applies one operation to the listed transactions or to the ones matching the filter
+type bulkRequest struct {
+	Operation     string      `json:"operation"`
+	IDs           []int       `json:"ids"`
+	Filter        *bulkFilter `json:"filter"`
+	CategoryID    *int        `json:"category_id"`
+	SubcategoryID *int        `json:"subcategory_id"`
+	GroupID       *int64      `json:"group_id"`
+}
+
+type bulkItemResult struct {
+	ID     int    `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// validate checks the operation, its arguments and the target selection
+func (req *bulkRequest) validate() error {
+	switch req.Operation {
+	case bulkRecategorize:
+		if req.CategoryID == nil {
+			return fmt.Errorf("%w: category_id is required", errInvalidBulkRequest)
+		}
+	case bulkSetSubcategory, bulkMarkPrivate, bulkMarkShared, bulkMoveToGroup, bulkDelete, bulkRestore:
+	default:
+		return fmt.Errorf("%w: unknown operation %q", errInvalidBulkRequest, req.Operation)
+	}
+	if (len(req.IDs) > 0) == (req.Filter != nil) {
+		return fmt.Errorf("%w: either ids or filter is required", errInvalidBulkRequest)
+	}
+	if len(req.IDs) > maxBulkItems {
+		return fmt.Errorf("%w: at most %d ids", errInvalidBulkRequest, maxBulkItems)
+	}
+	return nil
+}
+
+// update returns the change an update operation makes; parentID is the category of the new subcategory
+func (req *bulkRequest) update(parentID *int) *updateTransactionRequest {
+	update := &updateTransactionRequest{}
+	switch req.Operation {
+	case bulkRecategorize:
+		update.CategoryID = optionalInt{Set: true, Value: req.CategoryID}
+	case bulkSetSubcategory:
+		if req.SubcategoryID != nil {
+			update.CategoryID = optionalInt{Set: true, Value: parentID}
+		}
+		update.SubcategoryID = optionalInt{Set: true, Value: req.SubcategoryID}
+	case bulkMarkPrivate, bulkMarkShared:
+		private := req.Operation == bulkMarkPrivate
+		update.IsPrivate = &private
+	case bulkMoveToGroup:
+		update.GroupID = optionalInt64{Set: true, Value: req.GroupID}
+	}
+	return update
+}
+
+// bulkTargets returns the ids the request applies to, without duplicates
+func bulkTargets(ctx context.Context, tx pgx.Tx, userID int64, req *bulkRequest) ([]int, error) {
+	if req.Filter == nil {
+		seen := make(map[int]bool, len(req.IDs))
+		ids := make([]int, 0, len(req.IDs))
+		for _, id := range req.IDs {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		return ids, nil
+	}
+
+	conditions, args := req.Filter.transactionFilter(req.Operation == bulkRestore).Conditions(userID, nil)
+	args = append(args, maxBulkItems+1)
+	rows, err := tx.Query(ctx, fmt.Sprintf(`SELECT e.id FROM expenses e WHERE %s ORDER BY e.id LIMIT $%d`,
+		strings.Join(conditions, " AND "), len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) > maxBulkItems {
+		return nil, fmt.Errorf("%w: filter matches more than %d transactions", errInvalidBulkRequest, maxBulkItems)
+	}
+	return ids, nil
+}
+
+// applyBulk runs the operation on every target in one transaction. Each item runs in its own savepoint,
+// so a missing or invalid item is reported and skipped without undoing the others.
+func applyBulk(ctx context.Context, tx pgx.Tx, userID int64, req *bulkRequest, ids []int, parentID *int) ([]bulkItemResult, error) {
+	update := req.update(parentID)
+	results := make([]bulkItemResult, 0, len(ids))
+	for _, id := range ids {
+		item, err := tx.Begin(ctx)
+		if err != nil {
+			return nil, err
+		}
+		changed := true
+		switch req.Operation {
+		case bulkDelete, bulkRestore:
+			err = setTransactionDeletedTx(ctx, item, userID, id, req.Operation == bulkDelete, sourceWeb)
+		default:
+			_, changed, err = updateTransactionTx(ctx, item, userID, id, update, sourceWeb)
+		}
+
+		result := bulkItemResult{ID: id, Status: bulkUpdated}
+		switch {
+		case errors.Is(err, errTransactionNotFound):
+			result.Status, result.Error = bulkNotFound, err.Error()
+		case errors.Is(err, errInvalidTransaction):
+			result.Status, result.Error = bulkInvalid, err.Error()
+		case err != nil:
+			item.Rollback(ctx)
+			return nil, fmt.Errorf("bulk %s transaction %d: %w", req.Operation, id, err)
+		case !changed:
+			result.Status = bulkUnchanged
+		}
+		if result.Status == bulkUpdated {
+			err = item.Commit(ctx)
+		} else {
+			err = item.Rollback(ctx)
+		}
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// BulkTransactions applies one operation to many transactions of the user at once:
+// recategorize, set_subcategory, mark_private, mark_shared, move_to_group, delete or restore.
+// Targets are listed in ids or selected by filter (up to 1000); the response reports every item.
+// POST /api/transactions/bulk
+func (h *TransactionHandlers) BulkTransactions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req bulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("begin bulk transaction")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var parentID *int
+	if req.Operation == bulkSetSubcategory && req.SubcategoryID != nil {
+		parentID = new(int)
+		err := tx.QueryRow(ctx, "SELECT category_id FROM subcategories WHERE id = $1", *req.SubcategoryID).Scan(parentID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "subcategory not found", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("select bulk subcategory")
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Arguments shared by all items are checked once, so a bad category or group fails the whole request
+	switch req.Operation {
+	case bulkRecategorize:
+		err = validateTransactionCategories(ctx, tx, req.CategoryID, nil)
+	case bulkMoveToGroup:
+		err = validateTransactionGroup(ctx, tx, userID, req.GroupID)
+	}
+	if errors.Is(err, errInvalidTransaction) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("validate bulk arguments")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	ids, err := bulkTargets(ctx, tx, userID, &req)
+	if errors.Is(err, errInvalidBulkRequest) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Int64("user_id", userID).Msg("select bulk targets")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	results, err := applyBulk(ctx, tx, userID, &req, ids, parentID)
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		log.Error().Err(err).Int64("user_id", userID).Str("operation", req.Operation).Msg("bulk transactions")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	summary := map[string]int{bulkUpdated: 0, bulkUnchanged: 0, bulkNotFound: 0, bulkInvalid: 0}
+	for _, res := range results {
+		summary[res.Status]++
+	}
+	if summary[bulkUpdated] > 0 {
+		h.Cache.Clear()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"operation": req.Operation,
+		"results":   results,
+		"summary":   summary,
+	})
+	log.Info().Int64("user_id", userID).Str("operation", req.Operation).Int("count", len(results)).Int("updated", summary[bulkUpdated]).Msg("bulk transactions")
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestBulkRequestValidate(t *testing.T) {
+	cat := 3
+	tests := []struct {
+		name    string
+		req     bulkRequest
+		wantErr bool
+	}{
+		{name: "recategorize ids", req: bulkRequest{Operation: bulkRecategorize, CategoryID: &cat, IDs: []int{1, 2}}},
+		{name: "delete by filter", req: bulkRequest{Operation: bulkDelete, Filter: &bulkFilter{}}},
+		{name: "recategorize without category", req: bulkRequest{Operation: bulkRecategorize, IDs: []int{1}}, wantErr: true},
+		{name: "unknown operation", req: bulkRequest{Operation: "archive", IDs: []int{1}}, wantErr: true},
+		{name: "no targets", req: bulkRequest{Operation: bulkRestore}, wantErr: true},
+		{name: "ids and filter", req: bulkRequest{Operation: bulkRestore, IDs: []int{1}, Filter: &bulkFilter{}}, wantErr: true},
+		{name: "too many ids", req: bulkRequest{Operation: bulkMarkPrivate, IDs: make([]int, maxBulkItems+1)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		err := tt.req.validate()
+		if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, errInvalidBulkRequest)) {
+			t.Errorf("%s: validate() = %v", tt.name, err)
+		}
+	}
+}
+
+func TestBulkRequestUpdate(t *testing.T) {
+	cat, sub := 3, 7
+	before := transactionSnapshot{AmountCents: 100, OperationType: "expense", CategoryID: &sub, SubcategoryID: &sub}
+
+	req := bulkRequest{Operation: bulkSetSubcategory, SubcategoryID: &sub}
+	if got := req.update(&cat).apply(before); *got.CategoryID != cat || *got.SubcategoryID != sub {
+		t.Errorf("set_subcategory = %+v", got)
+	}
+	req = bulkRequest{Operation: bulkSetSubcategory}
+	if got := req.update(nil).apply(before); got.SubcategoryID != nil || *got.CategoryID != sub {
+		t.Errorf("clearing subcategory = %+v", got)
+	}
+	req = bulkRequest{Operation: bulkRecategorize, CategoryID: &cat}
+	if got := req.update(nil).apply(before); *got.CategoryID != cat || got.SubcategoryID != nil {
+		t.Errorf("recategorize = %+v", got)
+	}
+	req = bulkRequest{Operation: bulkMarkPrivate}
+	if got := req.update(nil).apply(before); !got.IsPrivate {
+		t.Errorf("mark_private = %+v", got)
+	}
+	group := int64(-100)
+	req = bulkRequest{Operation: bulkMoveToGroup, GroupID: &group}
+	if got := req.update(nil).apply(before); got.GroupID == nil || *got.GroupID != group {
+		t.Errorf("move_to_group = %+v", got)
+	}
+}
+
+func TestBulkFilterConditions(t *testing.T) {
+	cat := 3
+	conditions, args := bulkFilter{CategoryID: &cat}.transactionFilter(true).Conditions(7, []int64{-100})
+	wantConditions := []string{"e.deleted_at IS NOT NULL", "e.category_id = $1", "e.user_id = $2"}
+	if !reflect.DeepEqual(conditions, wantConditions) || !reflect.DeepEqual(args, []interface{}{3, int64(7)}) {
+		t.Errorf("conditions = %v %v", conditions, args)
+	}
+}
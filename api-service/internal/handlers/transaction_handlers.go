@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -10,6 +11,10 @@ import (
 
 	"github.com/expense-tracker/api-service/internal/auth"
 	"github.com/expense-tracker/api-service/internal/cache"
+	"github.com/expense-tracker/api-service/internal/currency"
+	"github.com/expense-tracker/api-service/internal/merchants"
+	"github.com/expense-tracker/api-service/internal/repository"
+	"github.com/expense-tracker/api-service/internal/trash"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/zerolog/log"
 )
@@ -22,6 +27,7 @@ type TransactionHandlers struct {
 	Auth             *auth.Auth
 	Queries          *TransactionQueries
 	Validator        *TransactionValidator
+	TrashRetention   time.Duration // how long deleted transactions are kept, 0 is forever
 }
 
 // NewTransactionHandlers creates a new TransactionHandlers instance
@@ -33,6 +39,7 @@ func NewTransactionHandlers(db *pgxpool.Pool, auth *auth.Auth) *TransactionHandl
 		Auth:             auth,
 		Queries:          &TransactionQueries{DB: db},
 		Validator:        &TransactionValidator{},
+		TrashRetention:   trash.RetentionFromEnv(),
 	}
 }
 
@@ -40,6 +47,7 @@ type transactionResponse struct {
 	ID              int     `json:"id"`
 	UserID          int64   `json:"user_id"`
 	AmountCents     int     `json:"amount_cents"`
+	Currency        string  `json:"currency"`
 	CategoryID      *int    `json:"category_id"`
 	SubcategoryID   *int    `json:"subcategory_id"`
 	OperationType   string  `json:"operation_type"`
@@ -48,24 +56,28 @@ type transactionResponse struct {
 	Username        string  `json:"username"`
 	CategoryName    *string `json:"category_name"`
 	SubcategoryName *string `json:"subcategory_name"`
+	Description     *string `json:"description"`
+	MerchantID      *int    `json:"merchant_id"`
+	Merchant        *string `json:"merchant"`
+	AccountID       *int    `json:"account_id"`
+	TransferID      *int64  `json:"transfer_id"`     // set on both legs of a transfer
+	TransferLeg     *string `json:"transfer_leg"`    // "debit" or "credit"
+	IncomeType      *string `json:"income_type"`     // incomes recorded as such: salary, debt_return...
+	RelatedDebtID   *int    `json:"related_debt_id"` // the debt a debt_return income repays
 }
 
 // GetTransactions returns paginated transactions with filters using keyset pagination
 func (h *TransactionHandlers) GetTransactions(w http.ResponseWriter, r *http.Request) {
-	log.Info().Msg("GetTransactions: Starting request")
-	
-	// TEMPORARY: Skip auth for debugging
-	var userID int64 = 260144148 // Use your Telegram ID for testing
-	
-	log.Info().Int64("user_id", userID).Msg("GetTransactions: User authenticated (debug mode)")
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
 
 	// Parse query parameters
-	operationType := r.URL.Query().Get("operation_type")
-	categoryID := r.URL.Query().Get("category_id")
-	subcategoryID := r.URL.Query().Get("subcategory_id")
-	startDate := r.URL.Query().Get("start_date")
-	endDate := r.URL.Query().Get("end_date")
-	scope := r.URL.Query().Get("scope")   // Filter: all, personal, family
+	filter := parseTransactionFilter(r.URL.Query())
+	operationType, categoryID, subcategoryID := filter.OperationType, filter.CategoryID, filter.SubcategoryID
+	startDate, endDate, scope := filter.StartDate, filter.EndDate, filter.Scope
 	cursor := r.URL.Query().Get("cursor") // timestamp for keyset pagination
 	limitStr := r.URL.Query().Get("limit")
 
@@ -78,8 +90,8 @@ func (h *TransactionHandlers) GetTransactions(w http.ResponseWriter, r *http.Req
 	}
 
 	// Check cache first
-	cacheKey := fmt.Sprintf("transactions_%d_%s_%s_%s_%s_%s_%s_%s",
-		userID, operationType, categoryID, subcategoryID, startDate, endDate, scope, cursor)
+	cacheKey := fmt.Sprintf("transactions_%d_%s_%s_%s_%s_%s_%s_%s_%s",
+		userID, operationType, categoryID, subcategoryID, filter.MerchantID, startDate, endDate, scope, cursor)
 
 	if cached, found := h.Cache.Get(cacheKey); found {
 		w.Header().Set("Content-Type", "application/json")
@@ -87,177 +99,42 @@ func (h *TransactionHandlers) GetTransactions(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	// Build WHERE clause
-	var whereConditions []string
-	var args []interface{}
-	argIndex := 1
-
-	// Always exclude soft-deleted transactions
-	whereConditions = append(whereConditions, "e.deleted_at IS NULL")
-
-	// Operation type filter
-	if operationType != "" && operationType != "both" {
-		whereConditions = append(whereConditions, fmt.Sprintf("e.operation_type = $%d", argIndex))
-		args = append(args, operationType)
-		argIndex++
-	}
-
-	// Category filter
-	if categoryID != "" {
-		if catID, err := strconv.Atoi(categoryID); err == nil {
-			whereConditions = append(whereConditions, fmt.Sprintf("e.category_id = $%d", argIndex))
-			args = append(args, catID)
-			argIndex++
-		}
-	}
-
-	// Subcategory filter
-	if subcategoryID != "" {
-		if subID, err := strconv.Atoi(subcategoryID); err == nil {
-			whereConditions = append(whereConditions, fmt.Sprintf("e.subcategory_id = $%d", argIndex))
-			args = append(args, subID)
-			argIndex++
-		}
-	}
-
-	// Date filters
-	if startDate != "" {
-		if _, err := time.Parse(time.RFC3339, startDate); err == nil {
-			whereConditions = append(whereConditions, fmt.Sprintf("e.timestamp >= $%d", argIndex))
-			args = append(args, startDate)
-			argIndex++
-		}
-	}
-	if endDate != "" {
-		if _, err := time.Parse(time.RFC3339, endDate); err == nil {
-			whereConditions = append(whereConditions, fmt.Sprintf("e.timestamp <= $%d", argIndex))
-			args = append(args, endDate)
-			argIndex++
-		}
-	}
-
 	// Get user's groups for filtering
-	var userGroupIDs []int64
-	groupRows, err := h.DB.Query(r.Context(),
-		"SELECT group_id FROM group_members WHERE user_id = $1", userID)
+	groupIDs, err := repository.UserGroupIDs(r.Context(), h.DB, userID)
 	if err != nil {
-		// Log error but continue - user might not be in any groups yet
-		log.Warn().Err(err).Int64("user_id", userID).Msg("failed to query group_members, continuing without group filtering")
-	} else {
-		defer groupRows.Close()
-		for groupRows.Next() {
-			var groupID int64
-			if err := groupRows.Scan(&groupID); err != nil {
-				log.Warn().Err(err).Int64("user_id", userID).Msg("failed to scan group_id, skipping")
-				continue
-			}
-			userGroupIDs = append(userGroupIDs, groupID)
-		}
-		// Check for iteration errors
-		if err := groupRows.Err(); err != nil {
-			log.Warn().Err(err).Int64("user_id", userID).Msg("error during group_members iteration")
-		}
-	}
-
-	// Apply scope filter (personal, family, all)
-	switch scope {
-	case "personal":
-		// Show only user's own expenses
-		whereConditions = append(whereConditions, fmt.Sprintf("e.user_id = $%d", argIndex))
-		args = append(args, userID)
-		argIndex++
-	case "family":
-		// Show only group expenses (non-private) that user is a member of
-		if len(userGroupIDs) > 0 {
-			whereConditions = append(whereConditions, fmt.Sprintf(
-				"(e.group_id = ANY($%d) AND e.is_private = false AND e.user_id != $%d)",
-				argIndex, argIndex+1))
-			args = append(args, userGroupIDs, userID)
-			argIndex += 2
-		} else {
-			// User not in any group, return empty result
-			whereConditions = append(whereConditions, "1=0")
-		}
-	default:
-		// "all" or empty: show user's own expenses + group expenses (non-private)
-		if len(userGroupIDs) > 0 {
-			// User is in groups: show own expenses + non-private group expenses
-			whereConditions = append(whereConditions, fmt.Sprintf(
-				"(e.user_id = $%d OR (e.group_id = ANY($%d) AND e.is_private = false))",
-				argIndex, argIndex+1))
-			args = append(args, userID, userGroupIDs)
-			argIndex += 2
-		} else {
-			// User not in any group: show only own expenses
-			whereConditions = append(whereConditions, fmt.Sprintf("e.user_id = $%d", argIndex))
-			args = append(args, userID)
-			argIndex++
-		}
-	}
-
-	// Add keyset pagination condition
-	if cursor != "" {
-		if cursorTime, err := time.Parse(time.RFC3339, cursor); err == nil {
-			whereConditions = append(whereConditions, fmt.Sprintf("e.timestamp < $%d", argIndex))
-			args = append(args, cursorTime)
-			argIndex++
-		}
+		log.Error().Err(err).Int64("user_id", userID).Msg("select groups for transactions")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
 	}
 
-	// Build WHERE clause
-	whereClause := ""
-	if len(whereConditions) > 0 {
-		whereClause = "WHERE " + strings.Join(whereConditions, " AND ")
+	// Keyset pagination: a malformed cursor starts from the newest transaction
+	var before *time.Time
+	if cursorTime, err := time.Parse(time.RFC3339, cursor); err == nil {
+		before = &cursorTime
 	}
-
-	// Optimized query with keyset pagination (no COUNT for performance)
-	query := fmt.Sprintf(`
-		SELECT e.id, e.user_id, e.amount_cents, e.category_id, e.subcategory_id, 
-			   e.operation_type, e.timestamp, e.is_shared, u.username,
-			   c.name as category_name, s.name as subcategory_name
-		FROM expenses e
-		LEFT JOIN users u ON u.telegram_id = e.user_id
-		LEFT JOIN categories c ON e.category_id = c.id
-		LEFT JOIN subcategories s ON e.subcategory_id = s.id
-		%s
-		ORDER BY e.timestamp DESC, e.id DESC
-		LIMIT $%d
-	`, whereClause, argIndex)
-
-	args = append(args, limit+1) // Get one extra to check if there are more
-
-	rows, err := h.DB.Query(r.Context(), query, args...)
+	// Get one extra to check if there are more
+	listed, err := repository.List(r.Context(), h.DB, filter, userID, groupIDs, before, limit+1)
 	if err != nil {
 		log.Error().Err(err).Msg("select transactions")
 		http.Error(w, "internal", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
 
 	var transactions []transactionResponse
 	var nextCursor string
-
-	for rows.Next() {
-		var t transactionResponse
-		var ts time.Time
-		var username *string
-		var categoryName *string
-		var subcategoryName *string
-
-		if err := rows.Scan(&t.ID, &t.UserID, &t.AmountCents, &t.CategoryID, &t.SubcategoryID,
-			&t.OperationType, &ts, &t.IsShared, &username, &categoryName, &subcategoryName); err == nil {
-			t.Timestamp = ts.UTC().Format(time.RFC3339)
-			if username != nil {
-				t.Username = *username
-			}
-			if categoryName != nil {
-				t.CategoryName = categoryName
-			}
-			if subcategoryName != nil {
-				t.SubcategoryName = subcategoryName
-			}
-			transactions = append(transactions, t)
+	for _, l := range listed {
+		t := transactionResponse{
+			ID: l.ID, UserID: l.UserID, AmountCents: l.AmountCents, Currency: l.Currency,
+			CategoryID: l.CategoryID, SubcategoryID: l.SubcategoryID, OperationType: l.OperationType,
+			Timestamp: l.Timestamp.UTC().Format(time.RFC3339), IsShared: l.IsShared,
+			CategoryName: l.CategoryName, SubcategoryName: l.SubcategoryName, Description: l.Description,
+			MerchantID: l.MerchantID, Merchant: l.Merchant, AccountID: l.AccountID, TransferID: l.TransferID,
+			TransferLeg: l.TransferLeg, IncomeType: l.IncomeType, RelatedDebtID: l.RelatedDebtID,
+		}
+		if l.Username != nil {
+			t.Username = *l.Username
 		}
+		transactions = append(transactions, t)
 	}
 
 	// Check if there are more records (keyset pagination)
@@ -279,6 +156,7 @@ func (h *TransactionHandlers) GetTransactions(w http.ResponseWriter, r *http.Req
 			"operation_type": operationType,
 			"category_id":    categoryID,
 			"subcategory_id": subcategoryID,
+			"merchant_id":    filter.MerchantID,
 			"start_date":     startDate,
 			"end_date":       endDate,
 		},
@@ -326,9 +204,7 @@ func (h *TransactionHandlers) SoftDeleteTransaction(w http.ResponseWriter, r *ht
 	}
 
 	// Soft delete the transaction
-	_, err = h.DB.Exec(r.Context(),
-		"UPDATE expenses SET deleted_at = NOW() WHERE id = $1 AND user_id = $2",
-		transactionID, userID)
+	err = setTransactionDeleted(r.Context(), h.DB, userID, transactionID, true, sourceWeb)
 	if err != nil {
 		log.Error().Err(err).Int64("user_id", userID).Int("transaction_id", transactionID).Msg("failed to soft delete transaction")
 		http.Error(w, "internal error", http.StatusInternalServerError)
@@ -375,9 +251,7 @@ func (h *TransactionHandlers) RestoreTransaction(w http.ResponseWriter, r *http.
 	}
 
 	// Restore the transaction
-	_, err = h.DB.Exec(r.Context(),
-		"UPDATE expenses SET deleted_at = NULL WHERE id = $1 AND user_id = $2",
-		transactionID, userID)
+	err = setTransactionDeleted(r.Context(), h.DB, userID, transactionID, false, sourceWeb)
 	if err != nil {
 		log.Error().Err(err).Int64("user_id", userID).Int("transaction_id", transactionID).Msg("failed to restore transaction")
 		http.Error(w, "internal error", http.StatusInternalServerError)
@@ -392,7 +266,8 @@ func (h *TransactionHandlers) RestoreTransaction(w http.ResponseWriter, r *http.
 	log.Info().Int64("user_id", userID).Int("transaction_id", transactionID).Msg("transaction restored")
 }
 
-// GetDeletedTransactions returns soft-deleted transactions for management
+// GetDeletedTransactions returns soft-deleted transactions for management.
+// purge_at tells when the purge job removes a transaction for good.
 func (h *TransactionHandlers) GetDeletedTransactions(w http.ResponseWriter, r *http.Request) {
 	uid := r.Context().Value(auth.UserIDKey)
 	if uid == nil {
@@ -418,7 +293,8 @@ func (h *TransactionHandlers) GetDeletedTransactions(w http.ResponseWriter, r *h
 	query := `
 		SELECT e.id, e.user_id, e.amount_cents, e.category_id, e.subcategory_id, 
 			   e.operation_type, e.timestamp, e.is_shared, e.deleted_at, u.username,
-			   c.name as category_name, s.name as subcategory_name
+			   c.name as category_name, s.name as subcategory_name, e.currency,
+			   e.account_id, e.transfer_id, e.transfer_leg
 		FROM expenses e
 		LEFT JOIN users u ON u.telegram_id = e.user_id
 		LEFT JOIN categories c ON e.category_id = c.id
@@ -445,7 +321,8 @@ func (h *TransactionHandlers) GetDeletedTransactions(w http.ResponseWriter, r *h
 		var subcategoryName *string
 
 		if err := rows.Scan(&t.ID, &t.UserID, &t.AmountCents, &t.CategoryID, &t.SubcategoryID,
-			&t.OperationType, &ts, &t.IsShared, &deletedAt, &username, &categoryName, &subcategoryName); err == nil {
+			&t.OperationType, &ts, &t.IsShared, &deletedAt, &username, &categoryName, &subcategoryName, &t.Currency,
+			&t.AccountID, &t.TransferID, &t.TransferLeg); err == nil {
 			t.Timestamp = ts.UTC().Format(time.RFC3339)
 			if username != nil {
 				t.Username = *username
@@ -461,6 +338,7 @@ func (h *TransactionHandlers) GetDeletedTransactions(w http.ResponseWriter, r *h
 				"id":               t.ID,
 				"user_id":          t.UserID,
 				"amount_cents":     t.AmountCents,
+				"currency":         t.Currency,
 				"category_id":      t.CategoryID,
 				"subcategory_id":   t.SubcategoryID,
 				"operation_type":   t.OperationType,
@@ -469,15 +347,23 @@ func (h *TransactionHandlers) GetDeletedTransactions(w http.ResponseWriter, r *h
 				"username":         t.Username,
 				"category_name":    t.CategoryName,
 				"subcategory_name": t.SubcategoryName,
+				"account_id":       t.AccountID,
+				"transfer_id":      t.TransferID,
+				"transfer_leg":     t.TransferLeg,
 				"deleted_at":       deletedAt.UTC().Format(time.RFC3339),
+				"purge_at":         nil,
+			}
+			if h.TrashRetention > 0 {
+				transaction["purge_at"] = deletedAt.Add(h.TrashRetention).UTC().Format(time.RFC3339)
 			}
 			transactions = append(transactions, transaction)
 		}
 	}
 
 	response := map[string]interface{}{
-		"transactions": transactions,
-		"count":        len(transactions),
+		"transactions":   transactions,
+		"count":          len(transactions),
+		"retention_days": int(h.TrashRetention.Hours() / 24),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -493,6 +379,10 @@ type createTransactionRequest struct {
 	Timestamp     string `json:"timestamp"`
 	IsShared      bool   `json:"is_shared"`
 	GroupID       *int64 `json:"group_id"`
+	Description   string `json:"description"`
+	Merchant      string `json:"merchant"` // optional, otherwise a known merchant is looked up in the description
+	Currency      string `json:"currency"`   // ISO 4217 code, the account's or the user's base currency by default
+	AccountID     *int   `json:"account_id"` // optional account the money comes from or goes to
 }
 
 // CreateTransaction creates a new transaction
@@ -545,19 +435,71 @@ func (h *TransactionHandlers) CreateTransaction(w http.ResponseWriter, r *http.R
 		}
 	}
 
-	// Insert transaction
-	var transactionID int
-	err = h.DB.QueryRow(r.Context(), `
-		INSERT INTO expenses (user_id, amount_cents, category_id, subcategory_id, operation_type, timestamp, is_shared, group_id)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		RETURNING id
-	`, userID, req.AmountCents, req.CategoryID, req.SubcategoryID, req.OperationType, timestamp, req.IsShared, req.GroupID).Scan(&transactionID)
+	// An account sets the currency, the amount is in the account's money
+	if req.AccountID != nil {
+		accountCurrency, err := accountCurrency(r.Context(), h.DB, userID, *req.AccountID)
+		if errors.Is(err, errUnknownAccount) {
+			http.Error(w, "account not found", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("select account")
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if req.Currency != "" && !strings.EqualFold(req.Currency, accountCurrency) {
+			http.Error(w, "currency does not match the account currency", http.StatusBadRequest)
+			return
+		}
+		req.Currency = accountCurrency
+	}
+
+	// Validate currency if provided
+	if req.Currency != "" {
+		if req.Currency, err = currency.Check(r.Context(), h.DB, req.Currency); err != nil {
+			writeCurrencyError(w, err)
+			return
+		}
+	}
 
+	merchantID, err := merchants.ForExpense(r.Context(), h.DB, req.Merchant, req.Description)
 	if err != nil {
+		log.Error().Err(err).Msg("resolve merchant")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Insert transaction
+	transaction := repository.Transaction{
+		UserID:        userID,
+		AmountCents:   int64(req.AmountCents),
+		OperationType: req.OperationType,
+		CategoryID:    req.CategoryID,
+		SubcategoryID: req.SubcategoryID,
+		Timestamp:     timestamp,
+		IsShared:      req.IsShared,
+		GroupID:       req.GroupID,
+		Description:   req.Description,
+		MerchantID:    merchantID,
+		Currency:      req.Currency,
+		AccountID:     req.AccountID,
+	}
+	if err := repository.Insert(r.Context(), h.DB, &transaction); err != nil {
 		log.Error().Err(err).Msg("create transaction")
 		http.Error(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
+	transactionID := transaction.ID
+	req.Currency = transaction.Currency
+
+	var merchantName *string
+	if merchantID != nil {
+		if err := h.DB.QueryRow(r.Context(), `SELECT name FROM merchants WHERE id = $1`, *merchantID).Scan(&merchantName); err != nil {
+			log.Error().Err(err).Msg("select merchant name")
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
 
 	// Clear relevant caches
 	h.Cache.ClearPattern("/api/transactions")
@@ -569,12 +511,17 @@ func (h *TransactionHandlers) CreateTransaction(w http.ResponseWriter, r *http.R
 		"id":             transactionID,
 		"user_id":        userID,
 		"amount_cents":   req.AmountCents,
+		"currency":       req.Currency,
 		"category_id":    req.CategoryID,
 		"subcategory_id": req.SubcategoryID,
 		"operation_type": req.OperationType,
 		"timestamp":      req.Timestamp,
 		"is_shared":      req.IsShared,
 		"group_id":       req.GroupID,
+		"description":    strings.TrimSpace(req.Description),
+		"merchant_id":    merchantID,
+		"merchant":       merchantName,
+		"account_id":     req.AccountID,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -3,10 +3,11 @@ package handlers
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"strings"
 
+	"github.com/expense-tracker/api-service/internal/repository"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/rs/zerolog/log"
 )
 
 // TransactionQueries handles database queries for transactions
@@ -19,30 +20,9 @@ func NewTransactionQueries(db *pgxpool.Pool) *TransactionQueries {
 	return &TransactionQueries{DB: db}
 }
 
-// GetUserGroupIDs returns group IDs for a user
+// GetUserGroupIDs returns group IDs for a user (by internal id)
 func (q *TransactionQueries) GetUserGroupIDs(ctx context.Context, userID int64) ([]int64, error) {
-	var groupIDs []int64
-	rows, err := q.DB.Query(ctx, "SELECT group_id FROM group_members WHERE user_id = $1", userID)
-	if err != nil {
-		log.Warn().Err(err).Int64("user_id", userID).Msg("failed to query group_members")
-		return groupIDs, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var groupID int64
-		if err := rows.Scan(&groupID); err != nil {
-			log.Warn().Err(err).Int64("user_id", userID).Msg("failed to scan group_id")
-			continue
-		}
-		groupIDs = append(groupIDs, groupID)
-	}
-
-	if err := rows.Err(); err != nil {
-		log.Warn().Err(err).Int64("user_id", userID).Msg("error during group_members iteration")
-	}
-
-	return groupIDs, nil
+	return repository.UserGroupIDs(ctx, q.DB, userID)
 }
 
 // BuildTransactionQuery builds the SQL query for fetching transactions
@@ -60,11 +40,13 @@ func (q *TransactionQueries) BuildTransactionQuery(
 	query := fmt.Sprintf(`
 		SELECT e.id, e.user_id, e.amount_cents, e.category_id, e.subcategory_id, 
 			   e.operation_type, e.timestamp, e.is_shared, u.username,
-			   c.name as category_name, s.name as subcategory_name
+			   c.name as category_name, s.name as subcategory_name,
+			   e.description, e.merchant_id, m.name as merchant_name, e.currency
 		FROM expenses e
 		LEFT JOIN users u ON u.telegram_id = e.user_id
 		LEFT JOIN categories c ON e.category_id = c.id
 		LEFT JOIN subcategories s ON e.subcategory_id = s.id
+		LEFT JOIN merchants m ON e.merchant_id = m.id
 		%s
 		ORDER BY e.timestamp DESC, e.id DESC
 		LIMIT $%d
@@ -87,3 +69,16 @@ func (q *TransactionQueries) ValidateSubcategory(ctx context.Context, subcategor
 	err := q.DB.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM subcategories WHERE id = $1)", subcategoryID).Scan(&exists)
 	return exists, err
 }
+
+// parseTransactionFilter reads the filters from query parameters
+func parseTransactionFilter(q url.Values) repository.Filter {
+	return repository.Filter{
+		OperationType: q.Get("operation_type"),
+		CategoryID:    q.Get("category_id"),
+		SubcategoryID: q.Get("subcategory_id"),
+		MerchantID:    q.Get("merchant_id"),
+		StartDate:     q.Get("start_date"),
+		EndDate:       q.Get("end_date"),
+		Scope:         q.Get("scope"),
+	}
+}
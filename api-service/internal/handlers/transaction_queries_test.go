@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/expense-tracker/api-service/internal/repository"
+)
+
+func TestTransactionFilterConditions(t *testing.T) {
+	q, _ := url.ParseQuery("operation_type=expense&category_id=3&subcategory_id=x&merchant_id=5&start_date=2026-03-01T00:00:00Z&end_date=bad&scope=family")
+	conditions, args := parseTransactionFilter(q).Conditions(7, []int64{-100})
+
+	wantConditions := []string{
+		"e.deleted_at IS NULL",
+		"e.operation_type = $1",
+		"e.category_id = $2",
+		"e.merchant_id = $3",
+		"e.timestamp >= $4",
+		"(e.group_id = ANY($5) AND e.is_private = false AND e.user_id != $6)",
+	}
+	wantArgs := []interface{}{"expense", 3, 5, "2026-03-01T00:00:00Z", []int64{-100}, int64(7)}
+	if !reflect.DeepEqual(conditions, wantConditions) || !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("conditions = %v %v", conditions, args)
+	}
+
+	// No groups: everything but own transactions is out of scope
+	conditions, args = repository.Filter{OperationType: "both"}.Conditions(7, nil)
+	if strings.Join(conditions, " AND ") != "e.deleted_at IS NULL AND e.user_id = $1" || len(args) != 1 {
+		t.Errorf("default scope = %v %v", conditions, args)
+	}
+	conditions, _ = repository.Filter{Scope: "family"}.Conditions(7, nil)
+	if conditions[len(conditions)-1] != "1=0" {
+		t.Errorf("family scope without groups = %v", conditions)
+	}
+}
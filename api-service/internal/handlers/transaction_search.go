@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/expense-tracker/api-service/internal/auth"
+	"github.com/expense-tracker/api-service/internal/repository"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// Search query length limits, in characters
+	minSearchQuery = 2
+	maxSearchQuery = 100
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// searchResult is a transaction found by search. Source named the table before incomes were folded
+// into expenses and is kept for clients; it is always expense now, operation_type tells incomes apart.
+type searchResult struct {
+	Source          string  `json:"source"` // expense
+	ID              int     `json:"id"`
+	UserID          int64   `json:"user_id"`
+	AmountCents     int     `json:"amount_cents"`
+	Currency        string  `json:"currency"`
+	OperationType   string  `json:"operation_type"`
+	Timestamp       string  `json:"timestamp"`
+	CategoryName    string  `json:"category_name"`
+	SubcategoryName string  `json:"subcategory_name"`
+	Description     string  `json:"description"`
+	Merchant        string  `json:"merchant"`
+	Username        string  `json:"username"`
+	GroupID         *int64  `json:"group_id"`
+	Rank            float64 `json:"rank"` // above 1 for full-text matches, the trigram similarity for typo matches
+}
+
+// searchCursor is the repository.SearchPosition of the last result of a page
+type searchCursor struct {
+	Rank      string    `json:"r"` // rounded rank as returned by PostgreSQL, compared exactly
+	Timestamp time.Time `json:"t"`
+	ID        int       `json:"i"`
+}
+
+func (c searchCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeSearchCursor(s string) (*searchCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	var c searchCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Rank == "" {
+		return nil, errInvalidCursor
+	}
+	if _, err := strconv.ParseFloat(c.Rank, 64); err != nil {
+		return nil, errInvalidCursor
+	}
+	return &c, nil
+}
+
+// normalizeSearchQuery trims the query and checks its length
+func normalizeSearchQuery(q string) (string, error) {
+	q = strings.Join(strings.Fields(q), " ")
+	if n := utf8.RuneCountInString(q); n < minSearchQuery || n > maxSearchQuery {
+		return "", fmt.Errorf("q must be %d to %d characters", minSearchQuery, maxSearchQuery)
+	}
+	return q, nil
+}
+
+// searchTransactions finds the transactions of a user matching q and the filter, best matches first.
+// It returns up to limit results and the cursor of the next page, nil on the last one.
+func searchTransactions(ctx context.Context, db *pgxpool.Pool, userID int64, q string, filter repository.Filter, after *searchCursor, limit int) ([]searchResult, *searchCursor, error) {
+	groupIDs, err := repository.UserGroupIDs(ctx, db, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The extra match only tells there is another page
+	matches, err := repository.Search(ctx, db, filter, userID, groupIDs, q, (*repository.SearchPosition)(after), limit+1)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results := []searchResult{}
+	for _, m := range matches[:min(len(matches), limit)] {
+		res := searchResult{
+			Source: "expense", ID: m.ID, UserID: m.UserID, AmountCents: m.AmountCents, Currency: m.Currency,
+			OperationType: m.OperationType, Timestamp: m.Timestamp.UTC().Format(time.RFC3339),
+			CategoryName: valueOrEmpty(m.CategoryName), SubcategoryName: valueOrEmpty(m.SubcategoryName),
+			Description: valueOrEmpty(m.Description), Merchant: valueOrEmpty(m.Merchant), Username: valueOrEmpty(m.Username),
+			GroupID: m.GroupID,
+		}
+		res.Rank, _ = strconv.ParseFloat(m.Rank, 64)
+		results = append(results, res)
+	}
+	if len(matches) <= limit {
+		return results, nil, nil
+	}
+	next := searchCursor(matches[limit-1].Position())
+	return results, &next, nil
+}
+
+// writeSearchResponse parses the search parameters, runs the search and writes the page
+func writeSearchResponse(w http.ResponseWriter, r *http.Request, db *pgxpool.Pool, userID int64, defaultLimit int) {
+	q, err := normalizeSearchQuery(r.URL.Query().Get("q"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := defaultLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		if limit, err = strconv.Atoi(raw); err != nil || limit <= 0 || limit > 50 {
+			http.Error(w, "limit must be 1..50", http.StatusBadRequest)
+			return
+		}
+	}
+	var after *searchCursor
+	if raw := r.URL.Query().Get("cursor"); raw != "" {
+		if after, err = decodeSearchCursor(raw); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	results, next, err := searchTransactions(r.Context(), db, userID, q, parseTransactionFilter(r.URL.Query()), after, limit)
+	if err != nil {
+		log.Error().Err(err).Msg("search transactions")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+	nextCursor := ""
+	if next != nil {
+		nextCursor = next.encode()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"query":   q,
+		"results": results,
+		"pagination": map[string]interface{}{
+			"limit":       limit,
+			"has_more":    next != nil,
+			"next_cursor": nextCursor,
+		},
+	})
+	log.Info().Int64("user_id", userID).Int("count", len(results)).Msg("searched transactions")
+}
+
+// SearchTransactions finds transactions by free text: descriptions, merchants, category and subcategory names
+// and aliases, usernames and income descriptions, with Russian stemming and a trigram fallback for typos.
+// GET /api/transactions/search?q=аптека&limit=20&cursor= plus the GetTransactions filters
+func (h *TransactionHandlers) SearchTransactions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	writeSearchResponse(w, r, h.DB, userID, 20)
+}
+
+// InternalSearchTransactions is SearchTransactions for the bot: the user comes from telegram_id
+func (h *InternalHandlers) InternalSearchTransactions(w http.ResponseWriter, r *http.Request) {
+	if !botAuthorized(w, r) {
+		return
+	}
+	telegramID, err := strconv.ParseInt(r.URL.Query().Get("telegram_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid telegram_id", http.StatusBadRequest)
+		return
+	}
+	var userID int64
+	if err := h.DB.QueryRow(r.Context(), "SELECT id FROM users WHERE telegram_id=$1", telegramID).Scan(&userID); err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	writeSearchResponse(w, r, h.DB, userID, 10)
+}
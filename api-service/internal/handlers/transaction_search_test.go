@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestSearchCursorRoundTrip(t *testing.T) {
+	want := searchCursor{Rank: "1.060793", Timestamp: time.Date(2026, 3, 5, 9, 30, 0, 123456000, time.UTC), ID: 42}
+	got, err := decodeSearchCursor(want.encode())
+	if err != nil {
+		t.Fatalf("decodeSearchCursor() error = %v", err)
+	}
+	if got.Rank != want.Rank || !got.Timestamp.Equal(want.Timestamp) || got.ID != want.ID {
+		t.Errorf("decodeSearchCursor() = %+v, want %+v", *got, want)
+	}
+}
+
+func TestDecodeSearchCursorInvalid(t *testing.T) {
+	for _, raw := range []string{
+		"not base64!",
+		base64.RawURLEncoding.EncodeToString([]byte("[]")),
+		base64.RawURLEncoding.EncodeToString([]byte(`{"t":"2026-03-05T09:30:00Z","i":1}`)),
+		base64.RawURLEncoding.EncodeToString([]byte(`{"r":"1; DROP","t":"2026-03-05T09:30:00Z","i":1}`)),
+	} {
+		if _, err := decodeSearchCursor(raw); err != errInvalidCursor {
+			t.Errorf("decodeSearchCursor(%q) error = %v, want errInvalidCursor", raw, err)
+		}
+	}
+}
+
+func TestNormalizeSearchQuery(t *testing.T) {
+	tests := []struct {
+		q       string
+		want    string
+		wantErr bool
+	}{
+		{q: "  аптека   март ", want: "аптека март"},
+		{q: "я", wantErr: true},
+		{q: "   ", wantErr: true},
+		{q: "ёж", want: "ёж"},
+	}
+	for _, tt := range tests {
+		got, err := normalizeSearchQuery(tt.q)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("normalizeSearchQuery(%q) = %q, %v", tt.q, got, err)
+		}
+	}
+}
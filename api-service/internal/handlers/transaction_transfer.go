@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/expense-tracker/api-service/internal/auth"
+	"github.com/expense-tracker/api-service/internal/repository"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// Legs of a transfer
+const (
+	transferDebit  = "debit"  // leaves the source account
+	transferCredit = "credit" // arrives at the destination account
+)
+
+type transferRequest struct {
+	FromAccountID int    `json:"from_account_id"`
+	ToAccountID   int    `json:"to_account_id"`
+	AmountCents   int64  `json:"amount_cents"`    // in the source account's currency
+	ToAmountCents *int64 `json:"to_amount_cents"` // in the destination account's currency; converted at the day's rate when absent
+	Timestamp     string `json:"timestamp"`       // RFC3339, now by default
+	Description   string `json:"description"`
+}
+
+type transferLeg struct {
+	ID          int    `json:"id"`
+	AccountID   int    `json:"account_id"`
+	AmountCents int64  `json:"amount_cents"`
+	Currency    string `json:"currency"`
+	Leg         string `json:"transfer_leg"`
+}
+
+type transferResponse struct {
+	TransferID  int64       `json:"transfer_id"`
+	Timestamp   string      `json:"timestamp"`
+	Description string      `json:"description"`
+	Debit       transferLeg `json:"debit"`
+	Credit      transferLeg `json:"credit"`
+}
+
+// validate checks the request and returns its moment
+func (req *transferRequest) validate(now time.Time) (time.Time, error) {
+	if req.FromAccountID <= 0 || req.ToAccountID <= 0 {
+		return time.Time{}, errors.New("from_account_id and to_account_id are required")
+	}
+	if req.FromAccountID == req.ToAccountID {
+		return time.Time{}, errors.New("cannot transfer to the same account")
+	}
+	if req.AmountCents <= 0 {
+		return time.Time{}, errors.New("amount_cents must be positive")
+	}
+	if req.ToAmountCents != nil && *req.ToAmountCents <= 0 {
+		return time.Time{}, errors.New("to_amount_cents must be positive")
+	}
+	req.Description = strings.TrimSpace(req.Description)
+	if utf8.RuneCountInString(req.Description) > maxDescriptionLength {
+		return time.Time{}, errors.New("description is too long")
+	}
+	if req.Timestamp == "" {
+		return now, nil
+	}
+	ts, err := time.Parse(time.RFC3339, req.Timestamp)
+	if err != nil {
+		return time.Time{}, errors.New("invalid timestamp format")
+	}
+	return ts, nil
+}
+
+// createTransfer writes both legs of a transfer in one transaction. The debit leg is in the source
+// account's currency, the credit leg in the destination's; without to_amount_cents the amount is
+// converted at the rate of the transfer's day.
+func createTransfer(ctx context.Context, tx pgx.Tx, userID int64, req *transferRequest, ts time.Time) (*transferResponse, error) {
+	fromCurrency, err := accountCurrency(ctx, tx, userID, req.FromAccountID)
+	if err != nil {
+		return nil, err
+	}
+	toCurrency, err := accountCurrency(ctx, tx, userID, req.ToAccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	creditCents := req.AmountCents
+	switch {
+	case req.ToAmountCents != nil:
+		creditCents = *req.ToAmountCents
+	case fromCurrency != toCurrency:
+		var converted *int64
+		err := tx.QueryRow(ctx, `SELECT convert_cents($1, $2, $3, ($4::timestamptz AT TIME ZONE 'Europe/Moscow')::date)`,
+			req.AmountCents, fromCurrency, toCurrency, ts).Scan(&converted)
+		if err != nil {
+			return nil, err
+		}
+		if converted == nil {
+			return nil, fmt.Errorf("%w: no exchange rate from %s to %s, pass to_amount_cents", errInvalidTransaction, fromCurrency, toCurrency)
+		}
+		creditCents = *converted
+	}
+
+	resp := &transferResponse{
+		Timestamp:   ts.UTC().Format(time.RFC3339),
+		Description: req.Description,
+		Debit:       transferLeg{AccountID: req.FromAccountID, AmountCents: req.AmountCents, Currency: fromCurrency, Leg: transferDebit},
+		Credit:      transferLeg{AccountID: req.ToAccountID, AmountCents: creditCents, Currency: toCurrency, Leg: transferCredit},
+	}
+	if err := tx.QueryRow(ctx, `SELECT nextval('transfer_id_seq')`).Scan(&resp.TransferID); err != nil {
+		return nil, err
+	}
+	for _, leg := range []*transferLeg{&resp.Debit, &resp.Credit} {
+		t := repository.Transaction{
+			UserID:        userID,
+			AmountCents:   leg.AmountCents,
+			OperationType: repository.TypeTransfer,
+			Timestamp:     ts,
+			Description:   req.Description,
+			Currency:      leg.Currency,
+			AccountID:     &leg.AccountID,
+			TransferID:    &resp.TransferID,
+			TransferLeg:   leg.Leg,
+		}
+		if err := repository.Insert(ctx, tx, &t); err != nil {
+			return nil, err
+		}
+		leg.ID = t.ID
+	}
+	return resp, nil
+}
+
+// CreateTransfer moves money between two accounts of the user. The transfer is stored as a debit and
+// a credit leg linked by transfer_id; it changes account balances but not expense or income totals.
+// POST /api/transfers
+func (h *TransactionHandlers) CreateTransfer(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req transferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	ts, err := req.validate(time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		log.Error().Err(err).Msg("begin transfer")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	resp, err := createTransfer(r.Context(), tx, userID, &req, ts)
+	if err == nil {
+		err = tx.Commit(r.Context())
+	}
+	switch {
+	case errors.Is(err, errUnknownAccount), errors.Is(err, errInvalidTransaction):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Error().Err(err).Int64("user_id", userID).Msg("create transfer")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.Cache.Clear()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+	log.Info().Int64("user_id", userID).Int64("transfer_id", resp.TransferID).
+		Int("from_account_id", req.FromAccountID).Int("to_account_id", req.ToAccountID).Msg("transfer created")
+}
@@ -0,0 +1,523 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/expense-tracker/api-service/internal/auth"
+	"github.com/expense-tracker/api-service/internal/currency"
+	"github.com/expense-tracker/api-service/internal/merchants"
+	"github.com/expense-tracker/api-service/internal/repository"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// Sources of transaction changes
+const (
+	sourceWeb = "web"
+	sourceBot = "bot"
+)
+
+var (
+	// errTransactionNotFound is returned for a missing, deleted or foreign transaction
+	errTransactionNotFound = errors.New("transaction not found")
+	// errInvalidTransaction is returned when the updated transaction fails validation
+	errInvalidTransaction = errors.New("invalid transaction")
+)
+
+// optionalInt is a JSON field that can be absent, null (clear it) or a number
+type optionalInt struct {
+	Set   bool
+	Value *int
+}
+
+func (o *optionalInt) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	return json.Unmarshal(data, &o.Value)
+}
+
+// optionalInt64 is optionalInt for int64 ids
+type optionalInt64 struct {
+	Set   bool
+	Value *int64
+}
+
+func (o *optionalInt64) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	return json.Unmarshal(data, &o.Value)
+}
+
+// updateTransactionRequest changes only the fields present in the body
+type updateTransactionRequest struct {
+	AmountCents   *int          `json:"amount_cents"`
+	Currency      *string       `json:"currency"`
+	OperationType *string       `json:"operation_type"`
+	CategoryID    optionalInt   `json:"category_id"`    // null clears; a new category without subcategory_id clears the subcategory
+	SubcategoryID optionalInt   `json:"subcategory_id"` // null clears
+	Timestamp     *string       `json:"timestamp"`
+	Description   *string       `json:"description"` // "" clears
+	Merchant      *string       `json:"merchant"`    // "" clears
+	IsShared      *bool         `json:"is_shared"`
+	IsPrivate     *bool         `json:"is_private"` // private transactions are hidden from the group
+	GroupID       optionalInt64 `json:"group_id"`   // null makes it personal; the user must be a member of the group
+	AccountID     optionalInt   `json:"account_id"` // null detaches; the amount must be in the account's currency
+}
+
+// transactionSnapshot is the editable state of a transaction, as stored in the history
+type transactionSnapshot struct {
+	AmountCents   int       `json:"amount_cents"`
+	Currency      string    `json:"currency"`
+	OperationType string    `json:"operation_type"`
+	CategoryID    *int      `json:"category_id"`
+	SubcategoryID *int      `json:"subcategory_id"`
+	Timestamp     time.Time `json:"timestamp"`
+	Description   *string   `json:"description"`
+	MerchantID    *int      `json:"merchant_id"`
+	IsShared      bool      `json:"is_shared"`
+	IsPrivate     bool      `json:"is_private"`
+	GroupID       *int64    `json:"group_id"`
+	AccountID     *int      `json:"account_id"`
+	IncomeType    *string   `json:"income_type"`     // not editable, dropped when an income becomes an expense
+	RelatedDebtID *int      `json:"related_debt_id"` // the debt a debt_return income repays, not editable
+}
+
+// apply returns the snapshot with the request's fields; the merchant is resolved separately
+func (req *updateTransactionRequest) apply(s transactionSnapshot) transactionSnapshot {
+	if req.AmountCents != nil {
+		s.AmountCents = *req.AmountCents
+	}
+	if req.Currency != nil {
+		s.Currency = strings.ToUpper(strings.TrimSpace(*req.Currency))
+	}
+	if req.OperationType != nil {
+		s.OperationType = *req.OperationType
+		if s.OperationType != repository.TypeIncome {
+			s.IncomeType, s.RelatedDebtID = nil, nil
+		}
+	}
+	if req.CategoryID.Set {
+		if !intPtrEqual(s.CategoryID, req.CategoryID.Value) && !req.SubcategoryID.Set {
+			s.SubcategoryID = nil
+		}
+		s.CategoryID = req.CategoryID.Value
+	}
+	if req.SubcategoryID.Set {
+		s.SubcategoryID = req.SubcategoryID.Value
+	}
+	if req.Timestamp != nil {
+		if ts, err := time.Parse(time.RFC3339, *req.Timestamp); err == nil {
+			s.Timestamp = ts.UTC()
+		}
+	}
+	if req.Description != nil {
+		s.Description = nil
+		if d := strings.TrimSpace(*req.Description); d != "" {
+			s.Description = &d
+		}
+	}
+	if req.IsShared != nil {
+		s.IsShared = *req.IsShared
+	}
+	if req.IsPrivate != nil {
+		s.IsPrivate = *req.IsPrivate
+	}
+	if req.GroupID.Set {
+		s.GroupID = req.GroupID.Value
+	}
+	if req.AccountID.Set {
+		s.AccountID = req.AccountID.Value
+	}
+	return s
+}
+
+// diffSnapshots returns the before and after values of the changed fields
+func diffSnapshots(before, after transactionSnapshot) (map[string]interface{}, map[string]interface{}) {
+	var b, a map[string]interface{}
+	beforeJSON, _ := json.Marshal(before)
+	afterJSON, _ := json.Marshal(after)
+	json.Unmarshal(beforeJSON, &b)
+	json.Unmarshal(afterJSON, &a)
+	for field, value := range a {
+		if fmt.Sprint(b[field]) == fmt.Sprint(value) {
+			delete(a, field)
+			delete(b, field)
+		}
+	}
+	return b, a
+}
+
+func intPtrEqual(a, b *int) bool {
+	return a == nil && b == nil || a != nil && b != nil && *a == *b
+}
+
+// validateTransactionCategories checks that the category and subcategory exist and the subcategory belongs to the category
+func validateTransactionCategories(ctx context.Context, q repository.Querier, categoryID, subcategoryID *int) error {
+	if subcategoryID != nil && categoryID == nil {
+		return fmt.Errorf("%w: subcategory requires a category", errInvalidTransaction)
+	}
+	if categoryID != nil {
+		var exists bool
+		if err := q.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM categories WHERE id = $1)", *categoryID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("%w: category not found", errInvalidTransaction)
+		}
+	}
+	if subcategoryID != nil {
+		var parentID int
+		err := q.QueryRow(ctx, "SELECT category_id FROM subcategories WHERE id = $1", *subcategoryID).Scan(&parentID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: subcategory not found", errInvalidTransaction)
+		}
+		if err != nil {
+			return err
+		}
+		if parentID != *categoryID {
+			return fmt.Errorf("%w: subcategory does not belong to category", errInvalidTransaction)
+		}
+	}
+	return nil
+}
+
+// validateTransactionGroup checks that the user is a member of the group
+func validateTransactionGroup(ctx context.Context, q repository.Querier, userID int64, groupID *int64) error {
+	if groupID == nil {
+		return nil
+	}
+	var member bool
+	err := q.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM group_members gm JOIN users u ON u.telegram_id = gm.user_id WHERE gm.group_id = $1 AND u.id = $2)
+	`, *groupID, userID).Scan(&member)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return fmt.Errorf("%w: not a member of the group", errInvalidTransaction)
+	}
+	return nil
+}
+
+// recordTransactionHistory writes one change of an expense
+func recordTransactionHistory(ctx context.Context, tx pgx.Tx, expenseID int, actorID int64, source, action string, before, after interface{}) error {
+	beforeJSON, _ := json.Marshal(before)
+	afterJSON, _ := json.Marshal(after)
+	_, err := tx.Exec(ctx, `
+		INSERT INTO transaction_history (expense_id, actor_id, source, action, before, after) VALUES ($1, $2, $3, $4, $5, $6)
+	`, expenseID, actorID, source, action, beforeJSON, afterJSON)
+	return err
+}
+
+// updateTransaction applies the request to a transaction of the user and records the change.
+// It returns the new state and whether anything changed.
+func updateTransaction(ctx context.Context, db *pgxpool.Pool, userID int64, transactionID int, req *updateTransactionRequest, source string) (*transactionSnapshot, bool, error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback(ctx)
+
+	after, changed, err := updateTransactionTx(ctx, tx, userID, transactionID, req, source)
+	if err != nil || !changed {
+		return after, false, err
+	}
+	return after, true, tx.Commit(ctx)
+}
+
+// updateTransactionTx is updateTransaction inside the caller's transaction
+func updateTransactionTx(ctx context.Context, tx pgx.Tx, userID int64, transactionID int, req *updateTransactionRequest, source string) (*transactionSnapshot, bool, error) {
+	var before transactionSnapshot
+	var transferID *int64
+	err := tx.QueryRow(ctx, `
+		SELECT amount_cents, currency, COALESCE(operation_type, 'expense'), category_id, subcategory_id, COALESCE(timestamp, NOW()),
+			description, merchant_id, COALESCE(is_shared, false), COALESCE(is_private, false), group_id, account_id,
+			income_type, related_debt_id, transfer_id
+		FROM expenses WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+		FOR UPDATE
+	`, transactionID, userID).Scan(&before.AmountCents, &before.Currency, &before.OperationType, &before.CategoryID, &before.SubcategoryID,
+		&before.Timestamp, &before.Description, &before.MerchantID, &before.IsShared, &before.IsPrivate, &before.GroupID, &before.AccountID,
+		&before.IncomeType, &before.RelatedDebtID, &transferID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, errTransactionNotFound
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if transferID != nil {
+		// The legs of a transfer only change together: delete it and make a new one
+		return nil, false, fmt.Errorf("%w: transfers cannot be edited", errInvalidTransaction)
+	}
+	before.Timestamp = before.Timestamp.UTC()
+
+	after := req.apply(before)
+	if after.AccountID != nil {
+		accountCurrency, err := accountCurrency(ctx, tx, userID, *after.AccountID)
+		if errors.Is(err, errUnknownAccount) {
+			return nil, false, fmt.Errorf("%w: %v", errInvalidTransaction, err)
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if req.Currency == nil {
+			after.Currency = accountCurrency
+		} else if after.Currency != accountCurrency {
+			return nil, false, fmt.Errorf("%w: currency does not match the account currency", errInvalidTransaction)
+		}
+	}
+	if before.RelatedDebtID != nil && (after.AmountCents != before.AmountCents || after.Currency != before.Currency ||
+		after.OperationType != before.OperationType) {
+		// The payment of the debt keeps the amount it was recorded with
+		return nil, false, fmt.Errorf("%w: the amount, currency and type of a debt repayment cannot be edited", errInvalidTransaction)
+	}
+	if req.Merchant != nil {
+		if after.MerchantID, err = merchants.Resolve(ctx, tx, *req.Merchant); err != nil {
+			return nil, false, err
+		}
+	}
+	if !intPtrEqual(before.CategoryID, after.CategoryID) || !intPtrEqual(before.SubcategoryID, after.SubcategoryID) {
+		if err := validateTransactionCategories(ctx, tx, after.CategoryID, after.SubcategoryID); err != nil {
+			return nil, false, err
+		}
+	}
+	if after.Currency != before.Currency {
+		if _, err := currency.Check(ctx, tx, after.Currency); err != nil {
+			if errors.Is(err, currency.ErrInvalidCurrency) || errors.Is(err, currency.ErrUnsupportedCurrency) {
+				return nil, false, fmt.Errorf("%w: %v", errInvalidTransaction, err)
+			}
+			return nil, false, err
+		}
+	}
+	if after.GroupID != nil && (before.GroupID == nil || *before.GroupID != *after.GroupID) {
+		if err := validateTransactionGroup(ctx, tx, userID, after.GroupID); err != nil {
+			return nil, false, err
+		}
+	}
+
+	changedBefore, changedAfter := diffSnapshots(before, after)
+	if len(changedAfter) == 0 {
+		return &after, false, nil
+	}
+	err = repository.Update(ctx, tx, transactionID, repository.Transaction{
+		AmountCents: int64(after.AmountCents), OperationType: after.OperationType,
+		CategoryID: after.CategoryID, SubcategoryID: after.SubcategoryID, Timestamp: after.Timestamp,
+		Description: valueOrEmpty(after.Description), MerchantID: after.MerchantID,
+		IsShared: after.IsShared, IsPrivate: after.IsPrivate, GroupID: after.GroupID,
+		Currency: after.Currency, AccountID: after.AccountID,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if err := recordTransactionHistory(ctx, tx, transactionID, userID, source, "update", changedBefore, changedAfter); err != nil {
+		return nil, false, err
+	}
+	return &after, true, nil
+}
+
+// setTransactionDeleted soft deletes or restores a transaction of the user and records it in the history
+func setTransactionDeleted(ctx context.Context, db *pgxpool.Pool, userID int64, transactionID int, deleted bool, source string) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := setTransactionDeletedTx(ctx, tx, userID, transactionID, deleted, source); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// setTransactionDeletedTx is setTransactionDeleted inside the caller's transaction.
+// Deleting a deleted transaction or restoring a live one returns errTransactionNotFound.
+// Both legs of a transfer are deleted and restored together.
+func setTransactionDeletedTx(ctx context.Context, tx pgx.Tx, userID int64, transactionID int, deleted bool, source string) error {
+	changes, err := repository.SetDeleted(ctx, tx, userID, transactionID, deleted)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		return errTransactionNotFound
+	}
+
+	action := "restore"
+	if deleted {
+		action = "delete"
+	}
+	for _, c := range changes {
+		err := recordTransactionHistory(ctx, tx, c.ID, userID, source, action,
+			map[string]interface{}{"deleted_at": c.Before}, map[string]interface{}{"deleted_at": c.After})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTransactionUpdate validates and applies an update and writes the response
+// onChange is called after a change, e.g. to drop cached transaction lists.
+func writeTransactionUpdate(w http.ResponseWriter, r *http.Request, db *pgxpool.Pool, onChange func(), userID int64, transactionID int, req *updateTransactionRequest, source string) {
+	if errorMsg, statusCode := NewTransactionValidator().ValidateUpdateRequest(*req); errorMsg != "" {
+		http.Error(w, errorMsg, statusCode)
+		return
+	}
+
+	updated, changed, err := updateTransaction(r.Context(), db, userID, transactionID, req, source)
+	switch {
+	case errors.Is(err, errTransactionNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, errInvalidTransaction):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Error().Err(err).Int64("user_id", userID).Int("transaction_id", transactionID).Msg("update transaction")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if changed && onChange != nil {
+		onChange()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":             transactionID,
+		"amount_cents":   updated.AmountCents,
+		"currency":       updated.Currency,
+		"operation_type": updated.OperationType,
+		"category_id":    updated.CategoryID,
+		"subcategory_id": updated.SubcategoryID,
+		"timestamp":      updated.Timestamp.Format(time.RFC3339),
+		"description":    updated.Description,
+		"merchant_id":    updated.MerchantID,
+		"is_shared":      updated.IsShared,
+		"is_private":     updated.IsPrivate,
+		"group_id":       updated.GroupID,
+		"account_id":     updated.AccountID,
+		"changed":        changed,
+	})
+	log.Info().Int64("user_id", userID).Int("transaction_id", transactionID).Str("source", source).Bool("changed", changed).Msg("transaction updated")
+}
+
+// UpdateTransaction changes fields of the user's transaction; every change is recorded in its history.
+// PATCH /api/transactions/{id}
+func (h *TransactionHandlers) UpdateTransaction(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	transactionID, errorMsg, statusCode := h.Validator.ValidateTransactionID(chi.URLParam(r, "id"))
+	if errorMsg != "" {
+		http.Error(w, errorMsg, statusCode)
+		return
+	}
+	var req updateTransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	writeTransactionUpdate(w, r, h.DB, h.Cache.Clear, userID, transactionID, &req, sourceWeb)
+}
+
+// InternalUpdateTransaction is UpdateTransaction for the bot, the user comes from telegram_id in the body.
+// PATCH /internal/transactions/{id}
+func (h *InternalHandlers) InternalUpdateTransaction(w http.ResponseWriter, r *http.Request) {
+	if !botAuthorized(w, r) {
+		return
+	}
+	transactionID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid transaction id", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		TelegramID int64 `json:"telegram_id"`
+		updateTransactionRequest
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.TelegramID == 0 {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	var userID int64
+	if err := h.DB.QueryRow(r.Context(), "SELECT id FROM users WHERE telegram_id=$1", req.TelegramID).Scan(&userID); err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	writeTransactionUpdate(w, r, h.DB, nil, userID, transactionID, &req.updateTransactionRequest, sourceBot)
+}
+
+type transactionHistoryEntry struct {
+	ID        int                    `json:"id"`
+	Action    string                 `json:"action"`
+	Source    string                 `json:"source"`
+	ActorID   *int64                 `json:"actor_id"`
+	Actor     string                 `json:"actor"`
+	Before    map[string]interface{} `json:"before"`
+	After     map[string]interface{} `json:"after"`
+	ChangedAt string                 `json:"changed_at"`
+}
+
+// GetTransactionHistory returns the changes of the user's transaction, newest first.
+// GET /api/transactions/{id}/history
+func (h *TransactionHandlers) GetTransactionHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	transactionID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid transaction id", http.StatusBadRequest)
+		return
+	}
+
+	var exists bool
+	err = h.DB.QueryRow(r.Context(), "SELECT EXISTS(SELECT 1 FROM expenses WHERE id = $1 AND user_id = $2)", transactionID, userID).Scan(&exists)
+	if err != nil || !exists {
+		http.Error(w, "transaction not found", http.StatusNotFound)
+		return
+	}
+
+	rows, err := h.DB.Query(r.Context(), `
+		SELECT th.id, th.action, th.source, th.actor_id, COALESCE(u.username, ''), th.before, th.after, th.changed_at
+		FROM transaction_history th
+		LEFT JOIN users u ON u.id = th.actor_id
+		WHERE th.expense_id = $1
+		ORDER BY th.changed_at DESC, th.id DESC
+	`, transactionID)
+	if err != nil {
+		log.Error().Err(err).Msg("select transaction history")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	history := []transactionHistoryEntry{}
+	for rows.Next() {
+		var e transactionHistoryEntry
+		var changedAt time.Time
+		if err := rows.Scan(&e.ID, &e.Action, &e.Source, &e.ActorID, &e.Actor, &e.Before, &e.After, &changedAt); err != nil {
+			log.Error().Err(err).Msg("scan transaction history")
+			http.Error(w, "internal", http.StatusInternalServerError)
+			return
+		}
+		e.ChangedAt = changedAt.UTC().Format(time.RFC3339)
+		history = append(history, e)
+	}
+	if err := rows.Err(); err != nil {
+		log.Error().Err(err).Msg("read transaction history")
+		http.Error(w, "internal", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"transaction_id": transactionID, "history": history})
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/expense-tracker/api-service/internal/dbtest"
+)
+
+func TestUpdateTransactionRequestApply(t *testing.T) {
+	cat, sub, otherCat := 1, 5, 2
+	before := transactionSnapshot{
+		AmountCents: 10000, OperationType: "expense", CategoryID: &cat, SubcategoryID: &sub,
+		Timestamp: time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want func(s *transactionSnapshot)
+	}{
+		{name: "empty body changes nothing", body: `{}`, want: func(s *transactionSnapshot) {}},
+		{name: "amount", body: `{"amount_cents": 12000}`, want: func(s *transactionSnapshot) { s.AmountCents = 12000 }},
+		{name: "new category clears subcategory", body: `{"category_id": 2}`, want: func(s *transactionSnapshot) {
+			s.CategoryID, s.SubcategoryID = &otherCat, nil
+		}},
+		{name: "same category keeps subcategory", body: `{"category_id": 1}`, want: func(s *transactionSnapshot) {}},
+		{name: "null clears subcategory", body: `{"subcategory_id": null}`, want: func(s *transactionSnapshot) { s.SubcategoryID = nil }},
+		{name: "timestamp", body: `{"timestamp": "2026-03-02T12:00:00+03:00"}`, want: func(s *transactionSnapshot) {
+			s.Timestamp = time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+		}},
+		{name: "blank description clears it", body: `{"description": "  "}`, want: func(s *transactionSnapshot) { s.Description = nil }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req updateTransactionRequest
+			if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+				t.Fatal(err)
+			}
+			want := before
+			tt.want(&want)
+			if got := req.apply(before); !reflect.DeepEqual(got, want) {
+				t.Errorf("apply() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestApplyTurnsIncomeIntoExpense(t *testing.T) {
+	salary, debtID := "salary", 17
+	before := transactionSnapshot{AmountCents: 10000, OperationType: "income", IncomeType: &salary, RelatedDebtID: &debtID}
+	expense := "expense"
+	after := (&updateTransactionRequest{OperationType: &expense}).apply(before)
+	if after.IncomeType != nil || after.RelatedDebtID != nil {
+		t.Errorf("apply() = %+v, want the income fields dropped", after)
+	}
+	if _, changed := diffSnapshots(before, after); changed["income_type"] != nil || len(changed) != 3 {
+		t.Errorf("history of the change = %v, want operation_type, income_type and related_debt_id", changed)
+	}
+}
+
+// A debt_return income keeps the amount, currency and type its debt payment was recorded with
+func TestUpdateDebtRepayment(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr bool
+	}{
+		{name: "amount", body: `{"amount_cents": 5000}`, wantErr: true},
+		{name: "currency", body: `{"currency": "EUR"}`, wantErr: true},
+		{name: "type", body: `{"operation_type": "expense"}`, wantErr: true},
+		{name: "account in another currency", body: `{"account_id": 3}`, wantErr: true},
+		{name: "description", body: `{"description": "вернул наличными"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.New(func(sql string, args []any) dbtest.Result {
+				switch {
+				case strings.Contains(sql, "FROM expenses WHERE id = $1"):
+					return dbtest.Result{Rows: [][]any{{10000, "RUB", "income", nil, nil, time.Now(), nil, nil, false, false, nil, nil,
+						"debt_return", 17, nil}}}
+				case strings.Contains(sql, "FROM accounts"):
+					return dbtest.Result{Rows: [][]any{{"EUR"}}}
+				}
+				return dbtest.Result{}
+			})
+			var req updateTransactionRequest
+			if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+				t.Fatal(err)
+			}
+			_, changed, err := updateTransactionTx(context.Background(), db, 1, 8, &req, sourceWeb)
+			if tt.wantErr {
+				if !errors.Is(err, errInvalidTransaction) {
+					t.Fatalf("updateTransactionTx() = %v, want errInvalidTransaction", err)
+				}
+				if _, ok := db.Ran("UPDATE expenses"); ok {
+					t.Error("debt repayment updated")
+				}
+				return
+			}
+			if err != nil || !changed {
+				t.Fatalf("updateTransactionTx() = %v, %v", changed, err)
+			}
+		})
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	cat, sub := 1, 5
+	before := transactionSnapshot{AmountCents: 10000, OperationType: "expense", CategoryID: &cat, SubcategoryID: &sub}
+	after := before
+	after.AmountCents = 12000
+	after.SubcategoryID = nil
+
+	b, a := diffSnapshots(before, after)
+	wantBefore := map[string]interface{}{"amount_cents": float64(10000), "subcategory_id": float64(5)}
+	wantAfter := map[string]interface{}{"amount_cents": float64(12000), "subcategory_id": nil}
+	if !reflect.DeepEqual(b, wantBefore) || !reflect.DeepEqual(a, wantAfter) {
+		t.Errorf("diffSnapshots() = %v, %v", b, a)
+	}
+
+	if b, a := diffSnapshots(before, before); len(b) != 0 || len(a) != 0 {
+		t.Errorf("diffSnapshots() of equal snapshots = %v, %v", b, a)
+	}
+}
+
+func TestValidateUpdateRequest(t *testing.T) {
+	zero, income, bad := 0, "income", "refund"
+	badTime := "yesterday"
+	tests := []struct {
+		name string
+		req  updateTransactionRequest
+		want int
+	}{
+		{name: "empty", req: updateTransactionRequest{}},
+		{name: "income", req: updateTransactionRequest{OperationType: &income}},
+		{name: "zero amount", req: updateTransactionRequest{AmountCents: &zero}, want: http.StatusBadRequest},
+		{name: "unknown operation type", req: updateTransactionRequest{OperationType: &bad}, want: http.StatusBadRequest},
+		{name: "bad timestamp", req: updateTransactionRequest{Timestamp: &badTime}, want: http.StatusBadRequest},
+	}
+	v := NewTransactionValidator()
+	for _, tt := range tests {
+		if _, status := v.ValidateUpdateRequest(tt.req); status != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, status, tt.want)
+		}
+	}
+}
@@ -4,8 +4,14 @@ import (
 	"net/http"
 	"strconv"
 	"time"
+	"unicode/utf8"
+
+	"github.com/expense-tracker/api-service/internal/merchants"
 )
 
+// maxDescriptionLength limits the free-text description of a transaction
+const maxDescriptionLength = 500
+
 // TransactionValidator handles validation for transaction operations
 type TransactionValidator struct{}
 
@@ -28,6 +34,41 @@ func (v *TransactionValidator) ValidateCreateRequest(req createTransactionReques
 		return "invalid timestamp format", http.StatusBadRequest
 	}
 
+	if utf8.RuneCountInString(req.Description) > maxDescriptionLength {
+		return "description is too long", http.StatusBadRequest
+	}
+
+	if utf8.RuneCountInString(req.Merchant) > merchants.MaxNameLength {
+		return "merchant is too long", http.StatusBadRequest
+	}
+
+	return "", 0
+}
+
+// ValidateUpdateRequest validates the fields present in an update transaction request
+func (v *TransactionValidator) ValidateUpdateRequest(req updateTransactionRequest) (string, int) {
+	if req.AmountCents != nil && *req.AmountCents <= 0 {
+		return "amount must be positive", http.StatusBadRequest
+	}
+
+	if req.OperationType != nil && *req.OperationType != "expense" && *req.OperationType != "income" {
+		return "operation_type must be 'expense' or 'income'", http.StatusBadRequest
+	}
+
+	if req.Timestamp != nil {
+		if _, err := time.Parse(time.RFC3339, *req.Timestamp); err != nil {
+			return "invalid timestamp format", http.StatusBadRequest
+		}
+	}
+
+	if req.Description != nil && utf8.RuneCountInString(*req.Description) > maxDescriptionLength {
+		return "description is too long", http.StatusBadRequest
+	}
+
+	if req.Merchant != nil && utf8.RuneCountInString(*req.Merchant) > merchants.MaxNameLength {
+		return "merchant is too long", http.StatusBadRequest
+	}
+
 	return "", 0
 }
 
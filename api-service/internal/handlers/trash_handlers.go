@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/expense-tracker/api-service/internal/auth"
+	"github.com/expense-tracker/api-service/internal/trash"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// PermanentDeleteTransaction purges a transaction from the trash right away, with its debts and receipt.
+// Only transactions the user deleted before can be purged.
+// DELETE /api/transactions/{id}/permanent
+func (h *TransactionHandlers) PermanentDeleteTransaction(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	transactionID, errorMsg, statusCode := h.Validator.ValidateTransactionID(chi.URLParam(r, "id"))
+	if errorMsg != "" {
+		http.Error(w, errorMsg, statusCode)
+		return
+	}
+
+	purged, err := trash.PurgeUser(r.Context(), h.DB, userID, &transactionID)
+	if err != nil {
+		log.Error().Err(err).Int64("user_id", userID).Int("transaction_id", transactionID).Msg("failed to purge transaction")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if purged == 0 {
+		http.Error(w, "deleted transaction not found", http.StatusNotFound)
+		return
+	}
+	h.Cache.Clear()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "purged"})
+	log.Info().Int64("user_id", userID).Int("transaction_id", transactionID).Msg("transaction purged")
+}
+
+// EmptyTrash purges all deleted transactions of the user.
+// DELETE /api/transactions/deleted
+func (h *TransactionHandlers) EmptyTrash(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	purged, err := trash.PurgeUser(r.Context(), h.DB, userID, nil)
+	if err != nil {
+		log.Error().Err(err).Int64("user_id", userID).Int("purged", purged).Msg("failed to empty trash")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if purged > 0 {
+		h.Cache.Clear()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"purged": purged})
+	log.Info().Int64("user_id", userID).Int("purged", purged).Msg("trash emptied")
+}
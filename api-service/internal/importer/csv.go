@@ -0,0 +1,188 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// CSV presets
+const (
+	PresetGeneric = "generic"
+	PresetSber    = "sber"
+	PresetTinkoff = "tinkoff"
+)
+
+// Mapping names the CSV columns to read. Empty fields keep the preset's columns.
+type Mapping struct {
+	Date        string
+	Amount      string
+	Description string
+	DateFormat  string // Go layout, e.g. 02.01.2006
+}
+
+// preset is a CSV layout. Columns are candidate header names, the first one present wins.
+type preset struct {
+	date, amount, description []string
+	dateLayouts               []string
+	// status column and the value of completed operations; other rows are skipped
+	status, statusOK string
+	// Expenses come without a sign and incomes with an explicit '+'
+	unsignedIsExpense bool
+}
+
+var commonDateLayouts = []string{
+	"02.01.2006 15:04:05", "02.01.2006 15:04", "02.01.2006",
+	"2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02",
+	"02/01/2006", "02.01.06",
+}
+
+var presets = map[string]preset{
+	PresetGeneric: {
+		date:        []string{"date", "дата", "дата операции"},
+		amount:      []string{"amount", "сумма", "сумма операции"},
+		description: []string{"description", "описание", "назначение платежа"},
+		dateLayouts: commonDateLayouts,
+	},
+	// Sber: amounts in the account currency, incomes marked with '+'
+	PresetSber: {
+		date:              []string{"дата операции", "дата"},
+		amount:            []string{"сумма в валюте счета", "сумма"},
+		description:       []string{"описание операции", "описание", "назначение платежа"},
+		dateLayouts:       []string{"02.01.2006 15:04", "02.01.2006"},
+		unsignedIsExpense: true,
+	},
+	// Tinkoff: signed amounts, failed operations are listed too
+	PresetTinkoff: {
+		date:        []string{"дата операции"},
+		amount:      []string{"сумма платежа", "сумма операции"},
+		description: []string{"описание"},
+		dateLayouts: []string{"02.01.2006 15:04:05", "02.01.2006"},
+		status:      "статус",
+		statusOK:    "ok",
+	},
+}
+
+// Presets lists the supported CSV presets
+func Presets() []string {
+	return []string{PresetGeneric, PresetSber, PresetTinkoff}
+}
+
+func parseCSV(data []byte, opts Options) ([]Transaction, error) {
+	name := opts.Preset
+	if name == "" {
+		name = PresetGeneric
+	}
+	p, ok := presets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown preset %q", name)
+	}
+	if opts.Mapping.Date != "" {
+		p.date = []string{opts.Mapping.Date}
+	}
+	if opts.Mapping.Amount != "" {
+		p.amount = []string{opts.Mapping.Amount}
+	}
+	if opts.Mapping.Description != "" {
+		p.description = []string{opts.Mapping.Description}
+	}
+	if opts.Mapping.DateFormat != "" {
+		p.dateLayouts = []string{opts.Mapping.DateFormat}
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = delimiter(data)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("empty csv")
+	}
+	columns := make(map[string]int, len(header))
+	for i, h := range header {
+		columns[normalizeHeader(h)] = i
+	}
+	find := func(candidates []string) int {
+		for _, c := range candidates {
+			if i, ok := columns[normalizeHeader(c)]; ok {
+				return i
+			}
+		}
+		return -1
+	}
+	dateCol, amountCol, descCol, statusCol := find(p.date), find(p.amount), find(p.description), -1
+	if p.status != "" {
+		statusCol = find([]string{p.status})
+	}
+	if dateCol < 0 || amountCol < 0 {
+		return nil, fmt.Errorf("csv has no date or amount column for preset %q, map them explicitly", name)
+	}
+
+	var txs []Transaction
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", row, err)
+		}
+		if isBlank(record) || len(record) <= max(dateCol, amountCol) {
+			continue
+		}
+		if statusCol >= 0 && statusCol < len(record) && !strings.EqualFold(strings.TrimSpace(record[statusCol]), p.statusOK) {
+			continue
+		}
+
+		tx := Transaction{Row: row}
+		if tx.Timestamp, err = parseDate(record[dateCol], p.dateLayouts, opts.Location); err != nil {
+			return nil, fmt.Errorf("row %d: %w", row, err)
+		}
+		raw := strings.TrimSpace(record[amountCol])
+		cents, err := parseAmount(raw)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: invalid amount %q", row, raw)
+		}
+		if cents == 0 {
+			continue
+		}
+		if p.unsignedIsExpense && !strings.HasPrefix(raw, "+") && cents > 0 {
+			cents = -cents
+		}
+		signed(&tx, cents)
+		if descCol >= 0 && descCol < len(record) {
+			tx.Description = cleanDescription(record[descCol])
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// delimiter picks the most frequent of ';', ',' and tab in the header line
+func delimiter(data []byte) rune {
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	best, count := ';', 0
+	for _, d := range []rune{';', ',', '\t'} {
+		if n := bytes.Count(line, []byte(string(d))); n > count {
+			best, count = d, n
+		}
+	}
+	return best
+}
+
+func normalizeHeader(s string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(s)), "ё", "е")
+}
+
+func isBlank(record []string) bool {
+	for _, field := range record {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
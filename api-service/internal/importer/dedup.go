@@ -0,0 +1,92 @@
+package importer
+
+import (
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Existing is an already recorded expense or income that a statement line may duplicate
+type Existing struct {
+	ID            int
+	Timestamp     time.Time
+	AmountCents   int
+	OperationType string
+	Currency      string
+	Description   string // empty for entries made by hand or through the bot
+}
+
+// FindDuplicates matches statement lines to existing entries with the same amount, currency and operation
+// type within window of each other. Entries with a description must also have a similar one; entries without
+// a description match on amount and time alone. Every existing entry matches at most one line.
+// The result maps Transaction.Row to Existing.ID.
+func FindDuplicates(txs []Transaction, existing []Existing, window time.Duration) map[int]int {
+	duplicates := make(map[int]int)
+	used := make(map[int]bool)
+	for _, tx := range txs {
+		best, bestScore := -1, 0
+		var bestDistance time.Duration
+		for i, e := range existing {
+			if used[e.ID] || e.AmountCents != tx.AmountCents || e.Currency != tx.Currency || e.OperationType != tx.OperationType {
+				continue
+			}
+			distance := tx.Timestamp.Sub(e.Timestamp).Abs()
+			if distance > window {
+				continue
+			}
+			// A matching description beats a missing one, then the closest in time wins
+			score := 1
+			if e.Description != "" {
+				if !SimilarDescription(tx.Description, e.Description) {
+					continue
+				}
+				score = 2
+			}
+			if best < 0 || score > bestScore || score == bestScore && distance < bestDistance {
+				best, bestScore, bestDistance = i, score, distance
+			}
+		}
+		if best >= 0 {
+			used[existing[best].ID] = true
+			duplicates[tx.Row] = existing[best].ID
+		}
+	}
+	return duplicates
+}
+
+// SimilarDescription reports whether two descriptions name the same operation: equal after
+// normalization, one containing the other, or sharing at least half of the longer one's words
+func SimilarDescription(a, b string) bool {
+	a, b = normalizeDescription(a), normalizeDescription(b)
+	if a == "" || b == "" {
+		return a == b
+	}
+	if a == b || strings.Contains(a, b) || strings.Contains(b, a) {
+		return true
+	}
+
+	wordsA, wordsB := strings.Fields(a), strings.Fields(b)
+	set := make(map[string]bool, len(wordsA))
+	for _, w := range wordsA {
+		set[w] = true
+	}
+	common := 0
+	for _, w := range wordsB {
+		if set[w] {
+			common++
+			delete(set, w)
+		}
+	}
+	return common*2 >= max(len(wordsA), len(wordsB))
+}
+
+// normalizeDescription lowercases and keeps letters and digits only
+func normalizeDescription(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return ' '
+	}, strings.ReplaceAll(s, "ё", "е"))
+	return strings.Join(strings.Fields(s), " ")
+}
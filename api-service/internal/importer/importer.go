@@ -0,0 +1,172 @@
+// Package importer parses bank statement exports (CSV, OFX, QIF) into transactions
+// and finds the ones that are already recorded as expenses.
+package importer
+
+import (
+	"errors"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Statement formats
+const (
+	FormatCSV = "csv"
+	FormatOFX = "ofx"
+	FormatQIF = "qif"
+)
+
+var (
+	// ErrUnknownFormat is returned when the format is neither given nor recognizable
+	ErrUnknownFormat = errors.New("unknown statement format, use csv, ofx or qif")
+	// ErrNoTransactions is returned when the statement contains no transactions
+	ErrNoTransactions = errors.New("no transactions found in the statement")
+)
+
+// Transaction is one statement line. AmountCents is always positive, the sign goes to OperationType.
+type Transaction struct {
+	Row           int       `json:"row"` // 1-based position in the statement
+	Timestamp     time.Time `json:"timestamp"`
+	AmountCents   int       `json:"amount_cents"`
+	OperationType string    `json:"operation_type"` // expense or income
+	Description   string    `json:"description"`
+	ExternalID    string    `json:"external_id,omitempty"` // bank transaction id (OFX FITID)
+	Currency      string    `json:"currency,omitempty"`    // ISO 4217 code of the statement, set by the caller
+}
+
+// Options control parsing
+type Options struct {
+	Preset   string         // CSV column layout: sber, tinkoff or generic
+	Mapping  Mapping        // CSV columns for the generic preset, overrides the preset's columns
+	Location *time.Location // timezone of dates without an offset, UTC if nil
+}
+
+// Parse parses a statement in the given format
+func Parse(format string, data []byte, opts Options) ([]Transaction, error) {
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+	data = decodeText(data)
+
+	var (
+		txs []Transaction
+		err error
+	)
+	switch format {
+	case FormatCSV:
+		txs, err = parseCSV(data, opts)
+	case FormatOFX:
+		txs, err = parseOFX(data, opts)
+	case FormatQIF:
+		txs, err = parseQIF(data, opts)
+	default:
+		return nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(txs) == 0 {
+		return nil, ErrNoTransactions
+	}
+	return txs, nil
+}
+
+// DetectFormat guesses the format from the file name, then from the content
+func DetectFormat(filename string, data []byte) (string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv", ".txt":
+		return FormatCSV, nil
+	case ".ofx", ".qfx":
+		return FormatOFX, nil
+	case ".qif":
+		return FormatQIF, nil
+	}
+
+	head := strings.ToUpper(strings.TrimSpace(string(data[:min(len(data), 512)])))
+	switch {
+	case strings.Contains(head, "OFXHEADER") || strings.Contains(head, "<OFX>"):
+		return FormatOFX, nil
+	case strings.HasPrefix(head, "!TYPE:") || strings.HasPrefix(head, "!ACCOUNT"):
+		return FormatQIF, nil
+	case strings.ContainsAny(head, ";,\t"):
+		return FormatCSV, nil
+	}
+	return "", ErrUnknownFormat
+}
+
+// decodeText converts Windows-1251 exports (the default of most Russian banks) to UTF-8
+// and strips the byte order mark
+func decodeText(data []byte) []byte {
+	if !utf8.Valid(data) {
+		if decoded, err := charmap.Windows1251.NewDecoder().Bytes(data); err == nil {
+			data = decoded
+		}
+	}
+	return []byte(strings.TrimPrefix(string(data), "\ufeff"))
+}
+
+// parseAmount parses a signed amount such as "-1 234,56", "+500.00" or "1,234.56" into cents.
+// The last of ',' and '.' is the decimal separator; spaces group thousands.
+func parseAmount(s string) (int, error) {
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\u00a0', '\u202f', '\'':
+			return -1
+		case '\u2212': // minus sign
+			return '-'
+		}
+		return r
+	}, strings.TrimSpace(s))
+
+	if dot, comma := strings.LastIndex(s, "."), strings.LastIndex(s, ","); comma > dot {
+		s = strings.ReplaceAll(s[:comma], ".", "") + "." + s[comma+1:]
+	} else if comma >= 0 {
+		s = strings.ReplaceAll(s, ",", "")
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) || math.Abs(f) > math.MaxInt32/100 {
+		return 0, errors.New("invalid amount")
+	}
+	return int(math.Round(f * 100)), nil
+}
+
+// signed turns a signed amount into a transaction amount and operation type
+func signed(tx *Transaction, cents int) {
+	tx.AmountCents = cents
+	tx.OperationType = "expense"
+	if cents > 0 {
+		tx.OperationType = "income"
+	} else {
+		tx.AmountCents = -cents
+	}
+}
+
+// parseDate tries the layouts in order
+func parseDate(s string, layouts []string, loc *time.Location) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			if !strings.Contains(layout, "15:04") {
+				// Date only: noon keeps the day stable in every neighbouring timezone
+				t = t.Add(12 * time.Hour)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("invalid date " + strconv.Quote(s))
+}
+
+// cleanDescription collapses whitespace
+func cleanDescription(parts ...string) string {
+	var words []string
+	for _, p := range parts {
+		words = append(words, strings.Fields(p)...)
+	}
+	return strings.Join(words, " ")
+}
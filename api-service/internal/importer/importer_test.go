@@ -0,0 +1,198 @@
+package importer
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+func ts(s string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04:05", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func checkTransactions(t *testing.T, got, want []Transaction) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d transactions, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if !got[i].Timestamp.Equal(want[i].Timestamp) {
+			t.Errorf("#%d timestamp = %v, want %v", i, got[i].Timestamp, want[i].Timestamp)
+		}
+		g, w := got[i], want[i]
+		g.Timestamp, w.Timestamp = time.Time{}, time.Time{}
+		if g != w {
+			t.Errorf("#%d = %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := map[string]int{
+		"-1 234,56":     -123456,
+		"+500.00":       50000,
+		"1,234.56":      123456,
+		"1.234,5":       123450,
+		"−99,99":        -9999,
+		"1\u00a0000,00": 100000,
+		"42":            4200,
+	}
+	for in, want := range tests {
+		got, err := parseAmount(in)
+		if err != nil || got != want {
+			t.Errorf("parseAmount(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	if _, err := parseAmount("abc"); err == nil {
+		t.Error("parseAmount(abc) should fail")
+	}
+}
+
+func TestParseTinkoffCSV(t *testing.T) {
+	data := "Дата операции;Дата платежа;Номер карты;Статус;Сумма операции;Валюта операции;Сумма платежа;Валюта платежа;Кэшбэк;Категория;MCC;Описание\n" +
+		"03.03.2026 19:20:11;04.03.2026;*1234;OK;-1250,50;RUB;-1250,50;RUB;;Супермаркеты;5411;Пятёрочка\n" +
+		"03.03.2026 10:00:00;03.03.2026;*1234;FAILED;-300,00;RUB;-300,00;RUB;;Кафе;5814;Кофейня\n" +
+		"01.03.2026 09:00:00;01.03.2026;;OK;50000,00;RUB;50000,00;RUB;;Пополнения;;Зарплата\n"
+	got, err := Parse(FormatCSV, []byte(data), Options{Preset: PresetTinkoff})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTransactions(t, got, []Transaction{
+		{Row: 1, Timestamp: ts("2026-03-03 19:20:11"), AmountCents: 125050, OperationType: "expense", Description: "Пятёрочка"},
+		{Row: 3, Timestamp: ts("2026-03-01 09:00:00"), AmountCents: 5000000, OperationType: "income", Description: "Зарплата"},
+	})
+}
+
+func TestParseSberCSVWindows1251(t *testing.T) {
+	data := "Дата операции;Категория;Описание операции;Сумма в валюте счёта\n" +
+		"05.03.2026 12:30;Транспорт;Яндекс Такси;450,00\n" +
+		"06.03.2026;Перевод;Перевод от Анны;+1 500,00\n"
+	encoded, err := charmap.Windows1251.NewEncoder().String(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Parse(FormatCSV, []byte(encoded), Options{Preset: PresetSber})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTransactions(t, got, []Transaction{
+		{Row: 1, Timestamp: ts("2026-03-05 12:30:00"), AmountCents: 45000, OperationType: "expense", Description: "Яндекс Такси"},
+		{Row: 2, Timestamp: ts("2026-03-06 12:00:00"), AmountCents: 150000, OperationType: "income", Description: "Перевод от Анны"},
+	})
+}
+
+func TestParseGenericCSVMapping(t *testing.T) {
+	data := "when,what,value\n2026-03-07,Coffee,-3.50\n"
+	opts := Options{Mapping: Mapping{Date: "when", Amount: "value", Description: "what", DateFormat: "2006-01-02"}}
+	got, err := Parse(FormatCSV, []byte(data), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTransactions(t, got, []Transaction{
+		{Row: 1, Timestamp: ts("2026-03-07 12:00:00"), AmountCents: 350, OperationType: "expense", Description: "Coffee"},
+	})
+
+	if _, err := Parse(FormatCSV, []byte(data), Options{}); err == nil {
+		t.Error("unmapped columns should fail")
+	}
+}
+
+func TestParseOFX(t *testing.T) {
+	data := `OFXHEADER:100
+DATA:OFXSGML
+
+<OFX><BANKMSGSRSV1><STMTTRNRS><STMTRS><BANKTRANLIST>
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20260308143000.000[+3:MSK]
+<TRNAMT>-799.00
+<FITID>A-1001
+<NAME>OZON
+<MEMO>Order 42
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20260309
+<TRNAMT>1000.00
+<FITID>A-1002
+<NAME>Cashback
+</STMTTRN>
+</BANKTRANLIST></STMTRS></STMTTRNRS></BANKMSGSRSV1></OFX>`
+	got, err := Parse(FormatOFX, []byte(data), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTransactions(t, got, []Transaction{
+		{Row: 1, Timestamp: ts("2026-03-08 11:30:00"), AmountCents: 79900, OperationType: "expense", Description: "OZON Order 42", ExternalID: "A-1001"},
+		{Row: 2, Timestamp: ts("2026-03-09 12:00:00"), AmountCents: 100000, OperationType: "income", Description: "Cashback", ExternalID: "A-1002"},
+	})
+}
+
+func TestParseQIF(t *testing.T) {
+	data := "!Type:Bank\nD03/10'26\nT-1,200.00\nPMetro\nMMonthly pass\n^\nD11.03.2026\nU250.00\nPRefund\n^\n!Type:Invst\nD03/12/2026\nT-5.00\n^\n"
+	got, err := Parse(FormatQIF, []byte(data), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTransactions(t, got, []Transaction{
+		{Row: 1, Timestamp: ts("2026-03-10 12:00:00"), AmountCents: 120000, OperationType: "expense", Description: "Metro Monthly pass"},
+		{Row: 2, Timestamp: ts("2026-03-11 12:00:00"), AmountCents: 25000, OperationType: "income", Description: "Refund"},
+	})
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		filename, data, want string
+	}{
+		{"statement.CSV", "", FormatCSV},
+		{"export.qfx", "", FormatOFX},
+		{"upload", "OFXHEADER:100\n", FormatOFX},
+		{"upload", "!Type:Bank\n", FormatQIF},
+		{"upload", "date;amount\n", FormatCSV},
+	}
+	for _, tt := range tests {
+		if got, err := DetectFormat(tt.filename, []byte(tt.data)); err != nil || got != tt.want {
+			t.Errorf("DetectFormat(%q) = %q, %v; want %q", tt.filename, got, err, tt.want)
+		}
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	txs := []Transaction{
+		{Row: 1, Timestamp: ts("2026-03-05 12:30:00"), AmountCents: 45000, OperationType: "expense", Description: "YANDEX*TAXI Moscow"},
+		{Row: 2, Timestamp: ts("2026-03-05 19:00:00"), AmountCents: 45000, OperationType: "expense", Description: "YANDEX*TAXI Moscow"},
+		{Row: 3, Timestamp: ts("2026-03-06 10:00:00"), AmountCents: 30000, OperationType: "expense", Description: "Кофейня"},
+		{Row: 4, Timestamp: ts("2026-03-06 10:00:00"), AmountCents: 99900, OperationType: "expense", Description: "OZON"},
+	}
+	existing := []Existing{
+		// Entered by hand in the bot without a description
+		{ID: 10, Timestamp: ts("2026-03-05 20:00:00"), AmountCents: 45000, OperationType: "expense"},
+		// Same amount but another merchant
+		{ID: 11, Timestamp: ts("2026-03-06 10:05:00"), AmountCents: 30000, OperationType: "expense", Description: "Аптека"},
+		// Imported earlier, outside the window
+		{ID: 12, Timestamp: ts("2026-03-01 10:00:00"), AmountCents: 99900, OperationType: "expense", Description: "OZON"},
+		// Same amount and time but in another currency
+		{ID: 13, Timestamp: ts("2026-03-06 10:00:00"), AmountCents: 99900, OperationType: "expense", Currency: "EUR", Description: "OZON"},
+	}
+	got := FindDuplicates(txs, existing, 24*time.Hour)
+	if len(got) != 1 || got[1] != 10 {
+		t.Errorf("FindDuplicates = %v, want map[1:10]", got)
+	}
+}
+
+func TestSimilarDescription(t *testing.T) {
+	if !SimilarDescription("YANDEX*TAXI", "yandex taxi moscow") {
+		t.Error("contained description should match")
+	}
+	if !SimilarDescription("Пятёрочка 1234 Москва", "ПЯТЕРОЧКА 5678 МОСКВА") {
+		t.Error("descriptions sharing most words should match")
+	}
+	if SimilarDescription("Аптека", "Кофейня") {
+		t.Error("different descriptions should not match")
+	}
+}
@@ -0,0 +1,74 @@
+package importer
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ofxTransaction = regexp.MustCompile(`(?is)<STMTTRN>(.*?)</STMTTRN>`)
+	// Leaf elements; OFX 1.x (SGML) leaves them unclosed, so the value ends at the next tag or line break
+	ofxElement = regexp.MustCompile(`(?i)<([A-Z0-9.]+)>([^<\r\n]*)`)
+	ofxOffset  = regexp.MustCompile(`\[([+-]?\d+(?:\.\d+)?)(?::[^\]]*)?\]`)
+)
+
+// parseOFX reads the STMTTRN aggregates of OFX 1.x (SGML) and 2.x (XML) statements
+func parseOFX(data []byte, opts Options) ([]Transaction, error) {
+	var txs []Transaction
+	for i, block := range ofxTransaction.FindAllSubmatch(data, -1) {
+		fields := make(map[string]string)
+		for _, m := range ofxElement.FindAllSubmatch(block[1], -1) {
+			fields[strings.ToUpper(string(m[1]))] = strings.TrimSpace(string(m[2]))
+		}
+
+		row := i + 1
+		tx := Transaction{Row: row, ExternalID: fields["FITID"]}
+		posted, err := parseOFXDate(fields["DTPOSTED"], opts.Location)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: %w", row, err)
+		}
+		tx.Timestamp = posted
+		cents, err := parseAmount(fields["TRNAMT"])
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: invalid amount %q", row, fields["TRNAMT"])
+		}
+		if cents == 0 {
+			continue
+		}
+		signed(&tx, cents)
+
+		tx.Description = cleanDescription(fields["NAME"])
+		if memo := cleanDescription(fields["MEMO"]); memo != "" && !strings.Contains(tx.Description, memo) {
+			tx.Description = cleanDescription(tx.Description, memo)
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// parseOFXDate parses YYYYMMDD[HHMMSS[.XXX]][[offset:TZ]]
+func parseOFXDate(s string, loc *time.Location) (time.Time, error) {
+	if m := ofxOffset.FindStringSubmatch(s); m != nil {
+		hours, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date %q", s)
+		}
+		loc = time.FixedZone("", int(hours*3600))
+		s = s[:strings.Index(s, "[")]
+	}
+	if dot := strings.Index(s, "."); dot >= 0 {
+		s = s[:dot]
+	}
+	switch len(s) {
+	case 8:
+		return parseDate(s, []string{"20060102"}, loc)
+	case 12:
+		return time.ParseInLocation("200601021504", s, loc)
+	case 14:
+		return time.ParseInLocation("20060102150405", s, loc)
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
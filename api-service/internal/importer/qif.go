@@ -0,0 +1,76 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// QIF dates come in the exporting program's locale; dotted dates are day first, slashed ones month first
+var qifDateLayouts = []string{"02.01.2006", "2.1.2006", "02.01.06", "2006-01-02", "1/2/2006", "1/2/06"}
+
+// parseQIF reads the records of bank and card QIF exports; investment and memorized lists are skipped
+func parseQIF(data []byte, opts Options) ([]Transaction, error) {
+	var (
+		txs     []Transaction
+		tx      Transaction
+		payee   string
+		memo    string
+		amount  string
+		hasDate bool
+		skip    bool
+		row     int
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		value := strings.TrimSpace(line[1:])
+		switch line[0] {
+		case '!':
+			header := strings.ToLower(line)
+			skip = strings.HasPrefix(header, "!type:") &&
+				!strings.HasPrefix(header, "!type:bank") && !strings.HasPrefix(header, "!type:ccard") &&
+				!strings.HasPrefix(header, "!type:cash") && !strings.HasPrefix(header, "!type:oth")
+		case 'D':
+			// 1/ 2'06 → 1/2/06
+			date := strings.ReplaceAll(strings.ReplaceAll(value, " ", ""), "'", "/")
+			t, err := parseDate(date, qifDateLayouts, opts.Location)
+			if err != nil {
+				return nil, fmt.Errorf("record %d: %w", row+1, err)
+			}
+			tx.Timestamp, hasDate = t, true
+		case 'T', 'U':
+			amount = value
+		case 'P':
+			payee = value
+		case 'M':
+			memo = value
+		case '^':
+			row++
+			if !skip && hasDate && amount != "" {
+				cents, err := parseAmount(amount)
+				if err != nil {
+					return nil, fmt.Errorf("record %d: invalid amount %q", row, amount)
+				}
+				if cents != 0 {
+					tx.Row = row
+					signed(&tx, cents)
+					tx.Description = cleanDescription(payee)
+					if memo != "" && !strings.Contains(tx.Description, memo) {
+						tx.Description = cleanDescription(payee, memo)
+					}
+					txs = append(txs, tx)
+				}
+			}
+			tx, payee, memo, amount, hasDate = Transaction{}, "", "", "", false
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return txs, nil
+}
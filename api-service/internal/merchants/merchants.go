@@ -0,0 +1,118 @@
+// Package merchants keeps the shops and services expenses are paid to as normalized entities,
+// so "ООО «Пятёрочка»", "пятерочка 1234" and "Пятёрочка" are the same merchant.
+package merchants
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/expense-tracker/api-service/internal/repository"
+	"github.com/jackc/pgx/v5"
+)
+
+// MaxNameLength limits merchant names accepted from clients
+const MaxNameLength = 100
+
+// minMatchLength is the shortest normalized name Find looks for in a description
+const minMatchLength = 3
+
+// Legal forms dropped from merchant names
+var legalForms = map[string]bool{
+	"ооо": true, "оао": true, "зао": true, "пао": true, "ао": true, "ип": true, "нко": true,
+	"llc": true, "ltd": true, "inc": true, "gmbh": true,
+}
+
+// words splits a name into words without quotes, punctuation, legal forms and store numbers
+func words(name string) []string {
+	fields := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '&'
+	})
+	out := fields[:0]
+	for _, f := range fields {
+		if legalForms[strings.ToLower(f)] {
+			continue
+		}
+		out = append(out, f)
+	}
+	// "Пятёрочка 1234": numbers after the name are store numbers, not part of the merchant
+	kept := out[:0]
+	for i, f := range out {
+		if i > 0 && isNumber(f) && !isNumber(kept[0]) {
+			continue
+		}
+		kept = append(kept, f)
+	}
+	return kept
+}
+
+func isNumber(s string) bool {
+	return strings.IndexFunc(s, func(r rune) bool { return !unicode.IsDigit(r) }) < 0
+}
+
+// Normalize returns the key merchants are matched by: lowercase words with ё as е,
+// without punctuation, legal forms and store numbers. Empty means no merchant.
+func Normalize(name string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.Join(words(name), " ")), "ё", "е")
+}
+
+// DisplayName cleans a merchant name for display, keeping its case and capitalizing the first letter
+func DisplayName(name string) string {
+	display := strings.Join(words(name), " ")
+	r, size := utf8.DecodeRuneInString(display)
+	if r == utf8.RuneError {
+		return display
+	}
+	return string(unicode.ToUpper(r)) + display[size:]
+}
+
+// Resolve returns the id of the merchant with the name, creating it on first use. An empty name gives nil.
+func Resolve(ctx context.Context, q repository.Querier, name string) (*int, error) {
+	normalized := Normalize(name)
+	if normalized == "" {
+		return nil, nil
+	}
+	var id int
+	err := q.QueryRow(ctx, `
+		INSERT INTO merchants (name, normalized_name) VALUES ($1, $2)
+		ON CONFLICT (normalized_name) DO UPDATE SET normalized_name = EXCLUDED.normalized_name
+		RETURNING id
+	`, DisplayName(name), normalized).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// Find returns the known merchant mentioned in a free-text description ("продукты пятёрочка"),
+// preferring the longest name, or nil
+func Find(ctx context.Context, q repository.Querier, description string) (*int, error) {
+	normalized := Normalize(description)
+	if utf8.RuneCountInString(normalized) < minMatchLength {
+		return nil, nil
+	}
+	var id int
+	err := q.QueryRow(ctx, `
+		SELECT id FROM merchants
+		WHERE char_length(normalized_name) >= $2 AND ' ' || $1 || ' ' LIKE '% ' || normalized_name || ' %'
+		ORDER BY char_length(normalized_name) DESC, id
+		LIMIT 1
+	`, normalized, minMatchLength).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// ForExpense returns the merchant of a new expense: the named one, otherwise a known merchant from the description
+func ForExpense(ctx context.Context, q repository.Querier, merchant, description string) (*int, error) {
+	if strings.TrimSpace(merchant) != "" {
+		return Resolve(ctx, q, merchant)
+	}
+	return Find(ctx, q, description)
+}
@@ -0,0 +1,53 @@
+package merchants
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "Пятёрочка", want: "пятерочка"},
+		{name: `ООО "Пятёрочка"`, want: "пятерочка"},
+		{name: "ООО «Пятерочка» 1234", want: "пятерочка"},
+		{name: "  ВкусВилл,  магазин ", want: "вкусвилл магазин"},
+		{name: "IP Petrov", want: "ip petrov"},
+		{name: "ИП Петров", want: "петров"},
+		{name: "H&M", want: "h&m"},
+		{name: "7 11", want: "7 11"},
+		{name: "7-Eleven", want: "7 eleven"},
+		{name: "ООО", want: ""},
+		{name: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.name); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDisplayName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: `ООО "Пятёрочка"`, want: "Пятёрочка"},
+		{name: "пятёрочка 1234", want: "Пятёрочка"},
+		{name: "Coffee  Like", want: "Coffee Like"},
+		{name: "«»", want: ""},
+	}
+	for _, tt := range tests {
+		if got := DisplayName(tt.name); got != tt.want {
+			t.Errorf("DisplayName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSameMerchant(t *testing.T) {
+	names := []string{"ООО «Пятёрочка»", "пятерочка 1234", "ПЯТЁРОЧКА"}
+	for _, name := range names[1:] {
+		if Normalize(name) != Normalize(names[0]) {
+			t.Errorf("%q and %q normalize differently", name, names[0])
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package receipts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/expense-tracker/api-service/internal/merchants"
+	"github.com/expense-tracker/api-service/internal/repository"
+	"github.com/expense-tracker/api-service/internal/split"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Receipt statuses
+const (
+	StatusPending   = "pending"
+	StatusFinalized = "finalized"
+	StatusCancelled = "cancelled"
+)
+
+var (
+	// ErrNotFound is returned when the receipt does not exist
+	ErrNotFound = errors.New("receipt not found")
+	// ErrForbidden is returned when the user is not the receipt owner
+	ErrForbidden = errors.New("only the receipt owner can do this")
+	// ErrNotPending is returned when the receipt is already finalized or cancelled
+	ErrNotPending = errors.New("receipt is not pending")
+	// ErrInvalidSplit is returned for split options that do not match the receipt
+	ErrInvalidSplit = errors.New("invalid split options")
+)
+
+// Item is a receipt line with the Telegram IDs of the users who selected it
+type Item struct {
+	ID         int     `json:"id"`
+	Name       string  `json:"name"`
+	Quantity   float64 `json:"quantity"`
+	PriceCents int     `json:"price_cents"`
+	SelectedBy []int64 `json:"selected_by"`
+}
+
+// Participant is the receipt owner or a user who selected at least one item
+type Participant struct {
+	TelegramID int64  `json:"telegram_id"`
+	Username   string `json:"username"`
+}
+
+// Receipt is a stored receipt with its items and selections
+type Receipt struct {
+	ID              int           `json:"id"`
+	OwnerID         int64         `json:"-"`
+	OwnerTelegramID int64         `json:"owner_telegram_id"`
+	Merchant        string        `json:"merchant"`
+	Date            *time.Time    `json:"date,omitempty"`
+	TotalCents      int           `json:"total_cents"`
+	TaxCents        int           `json:"tax_cents"`
+	GroupID         *int64        `json:"group_id,omitempty"`
+	Status          string        `json:"status"`
+	ExpenseID       *int          `json:"expense_id,omitempty"`
+	Items           []Item        `json:"items"`
+	Participants    []Participant `json:"participants"`
+}
+
+// ItemsTotalCents returns the sum of all item prices
+func (r *Receipt) ItemsTotalCents() int {
+	sum := 0
+	for _, item := range r.Items {
+		sum += item.PriceCents
+	}
+	return sum
+}
+
+// Options tune how a receipt is split
+type Options struct {
+	// TipCents is added on top of the receipt and allocated proportionally
+	TipCents int `json:"tip_cents"`
+	// ExtraTaxCents is tax not already included in item prices (Russian VAT always is).
+	// It is allocated proportionally like the tip.
+	ExtraTaxCents int `json:"extra_tax_cents"`
+	// Weights overrides the even split of selected items: item ID -> Telegram ID -> weight
+	// (grams, pieces, or any other unit). Weights replace the item's selected_by list.
+	Weights map[int]map[int64]int64 `json:"weights"`
+}
+
+// Share is what a single participant owes for the receipt
+type Share struct {
+	TelegramID  int64  `json:"telegram_id"`
+	Username    string `json:"username"`
+	ItemsCents  int    `json:"items_cents"`
+	ExtraCents  int    `json:"extra_cents"`
+	AmountCents int    `json:"amount_cents"`
+}
+
+// Split is the computed division of a receipt
+type Split struct {
+	ReceiptID   int     `json:"receipt_id"`
+	ExpenseID   int     `json:"expense_id,omitempty"`
+	AmountCents int     `json:"amount_cents"`
+	ExtraCents  int     `json:"extra_cents"`
+	Shares      []Share `json:"shares"`
+}
+
+// Service reads receipts and turns their selections into expenses and debts
+type Service struct {
+	DB *pgxpool.Pool
+}
+
+// NewService creates a new receipt service
+func NewService(db *pgxpool.Pool) *Service {
+	return &Service{DB: db}
+}
+
+type queryer interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Get loads a receipt with its items and participants
+func (s *Service) Get(ctx context.Context, receiptID int) (*Receipt, error) {
+	return load(ctx, s.DB, receiptID, false)
+}
+
+// Preview computes the split of a pending receipt without writing anything
+func (s *Service) Preview(ctx context.Context, receiptID int, opts Options) (*Split, error) {
+	rec, err := s.Get(ctx, receiptID)
+	if err != nil {
+		return nil, err
+	}
+	return Compute(rec, opts)
+}
+
+// Finalize splits the receipt and, in a single transaction, records one shared expense paid by the owner,
+// a debt from every other participant to the owner, and marks the receipt finalized.
+// ownerID is the internal users.id of the acting user, who must own the receipt.
+func (s *Service) Finalize(ctx context.Context, receiptID int, ownerID int64, opts Options) (*Split, error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rec, err := load(ctx, tx, receiptID, true)
+	if err != nil {
+		return nil, err
+	}
+	if rec.OwnerID != ownerID {
+		return nil, ErrForbidden
+	}
+	if rec.Status != StatusPending {
+		return nil, ErrNotPending
+	}
+
+	result, err := Compute(rec, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ts := time.Now().UTC()
+	if rec.Date != nil {
+		ts = rec.Date.UTC()
+	}
+	merchantID, err := merchants.Resolve(ctx, tx, rec.Merchant)
+	if err != nil {
+		return nil, fmt.Errorf("resolve receipt merchant: %w", err)
+	}
+	expense := repository.Transaction{
+		UserID:      rec.OwnerID,
+		AmountCents: int64(result.AmountCents),
+		Timestamp:   ts,
+		IsShared:    len(result.Shares) > 1,
+		GroupID:     rec.GroupID,
+		MerchantID:  merchantID,
+		Currency:    "RUB",
+	}
+	if err := repository.Insert(ctx, tx, &expense); err != nil {
+		return nil, fmt.Errorf("insert receipt expense: %w", err)
+	}
+	result.ExpenseID = expense.ID
+
+	for _, share := range result.Shares {
+		if share.TelegramID == rec.OwnerTelegramID || share.AmountCents <= 0 {
+			continue
+		}
+		tag, err := tx.Exec(ctx, `INSERT INTO debts (from_user, to_user, amount_cents, receipt_id, expense_id) SELECT id, $2, $3, $4, $5 FROM users WHERE telegram_id = $1`,
+			share.TelegramID, rec.OwnerID, share.AmountCents, receiptID, result.ExpenseID)
+		if err != nil {
+			return nil, fmt.Errorf("insert receipt debt: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return nil, fmt.Errorf("%w: unknown participant %d", ErrInvalidSplit, share.TelegramID)
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE receipts SET status='finalized', expense_id=$2, finalized_at=NOW() WHERE id=$1`, receiptID, result.ExpenseID); err != nil {
+		return nil, fmt.Errorf("mark receipt finalized: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Compute splits a receipt between its participants.
+// Selected items are split evenly between the users who selected them, or by opts.Weights.
+// Items nobody selected go to the owner. The difference between the receipt total and the items sum
+// (discounts, rounding, service charges) plus tip and extra tax is allocated proportionally to each
+// participant's items subtotal.
+func Compute(rec *Receipt, opts Options) (*Split, error) {
+	itemsByID := make(map[int]bool, len(rec.Items))
+	items := make([]split.Item, 0, len(rec.Items))
+	for _, item := range rec.Items {
+		itemsByID[item.ID] = true
+		weights := make(map[int64]int64, len(item.SelectedBy))
+		if override, ok := opts.Weights[item.ID]; ok {
+			for telegramID, w := range override {
+				if w < 0 {
+					return nil, fmt.Errorf("%w: negative weight for item %d", ErrInvalidSplit, item.ID)
+				}
+				weights[telegramID] = w
+			}
+		} else {
+			for _, telegramID := range item.SelectedBy {
+				weights[telegramID] = 1
+			}
+		}
+		items = append(items, split.Item{PriceCents: item.PriceCents, Weights: weights})
+	}
+	for itemID := range opts.Weights {
+		if !itemsByID[itemID] {
+			return nil, fmt.Errorf("%w: item %d is not on the receipt", ErrInvalidSplit, itemID)
+		}
+	}
+	if opts.TipCents < 0 || opts.ExtraTaxCents < 0 {
+		return nil, fmt.Errorf("%w: tip and tax cannot be negative", ErrInvalidSplit)
+	}
+
+	itemsTotal := rec.ItemsTotalCents()
+	receiptTotal := rec.TotalCents
+	if receiptTotal <= 0 {
+		receiptTotal = itemsTotal
+	}
+	extra := receiptTotal - itemsTotal + opts.TipCents + opts.ExtraTaxCents
+	if itemsTotal+extra <= 0 {
+		return nil, fmt.Errorf("%w: receipt total is not positive", ErrInvalidSplit)
+	}
+
+	shares, err := split.Receipt(items, extra, rec.OwnerTelegramID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSplit, err)
+	}
+
+	names := make(map[int64]string, len(rec.Participants))
+	for _, p := range rec.Participants {
+		names[p.TelegramID] = p.Username
+	}
+
+	result := &Split{ReceiptID: rec.ID, AmountCents: itemsTotal + extra, ExtraCents: extra, Shares: make([]Share, 0, len(shares))}
+	for _, sh := range shares {
+		if sh.AmountCents < 0 {
+			return nil, fmt.Errorf("%w: discount exceeds the share of %d", ErrInvalidSplit, sh.Participant)
+		}
+		result.Shares = append(result.Shares, Share{
+			TelegramID:  sh.Participant,
+			Username:    names[sh.Participant],
+			ItemsCents:  sh.ItemsCents,
+			ExtraCents:  sh.ExtraCents,
+			AmountCents: sh.AmountCents,
+		})
+	}
+	return result, nil
+}
+
+// load reads a receipt, optionally locking its row for the rest of the transaction
+func load(ctx context.Context, q queryer, receiptID int, forUpdate bool) (*Receipt, error) {
+	rec := &Receipt{ID: receiptID, Items: []Item{}, Participants: []Participant{}}
+	query := `
+		SELECT r.owner_id, u.telegram_id, COALESCE(r.merchant, ''), r.receipt_date, COALESCE(r.total_cents, 0),
+			r.tax_cents, r.group_id, r.status, r.expense_id
+		FROM receipts r
+		JOIN users u ON u.id = r.owner_id
+		WHERE r.id = $1`
+	if forUpdate {
+		query += " FOR UPDATE OF r"
+	}
+	err := q.QueryRow(ctx, query, receiptID).Scan(&rec.OwnerID, &rec.OwnerTelegramID, &rec.Merchant, &rec.Date, &rec.TotalCents,
+		&rec.TaxCents, &rec.GroupID, &rec.Status, &rec.ExpenseID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.Query(ctx, `
+		SELECT id, name, quantity::float8, price_cents, selected_by
+		FROM receipt_items
+		WHERE receipt_id = $1
+		ORDER BY id
+	`, receiptID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var item Item
+		var selectedBy []byte
+		if err := rows.Scan(&item.ID, &item.Name, &item.Quantity, &item.PriceCents, &selectedBy); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if err := json.Unmarshal(selectedBy, &item.SelectedBy); err != nil || item.SelectedBy == nil {
+			item.SelectedBy = []int64{}
+		}
+		rec.Items = append(rec.Items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ids := []int64{rec.OwnerTelegramID}
+	seen := map[int64]bool{rec.OwnerTelegramID: true}
+	for _, item := range rec.Items {
+		for _, telegramID := range item.SelectedBy {
+			if !seen[telegramID] {
+				seen[telegramID] = true
+				ids = append(ids, telegramID)
+			}
+		}
+	}
+	participants, err := q.Query(ctx, `SELECT telegram_id, COALESCE(username, '') FROM users WHERE telegram_id = ANY($1)`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer participants.Close()
+	for participants.Next() {
+		var p Participant
+		if err := participants.Scan(&p.TelegramID, &p.Username); err != nil {
+			return nil, err
+		}
+		rec.Participants = append(rec.Participants, p)
+	}
+	sort.Slice(rec.Participants, func(i, j int) bool { return rec.Participants[i].TelegramID < rec.Participants[j].TelegramID })
+	return rec, participants.Err()
+}
@@ -0,0 +1,66 @@
+package receipts
+
+import (
+	"errors"
+	"testing"
+)
+
+func testReceipt() *Receipt {
+	return &Receipt{
+		ID:              1,
+		OwnerTelegramID: 100,
+		TotalCents:      1000, // 1 kopeck discount against the items sum
+		Items: []Item{
+			{ID: 10, Name: "Пицца", PriceCents: 701, SelectedBy: []int64{100, 200, 300}},
+			{ID: 11, Name: "Сок", PriceCents: 200, SelectedBy: []int64{200}},
+			{ID: 12, Name: "Хлеб", PriceCents: 100},
+		},
+		Participants: []Participant{{100, "owner"}, {200, "anna"}, {300, "boris"}},
+	}
+}
+
+func TestCompute(t *testing.T) {
+	result, err := Compute(testReceipt(), Options{TipCents: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.AmountCents != 1100 || result.ExtraCents != 99 {
+		t.Errorf("amount = %d, extra = %d", result.AmountCents, result.ExtraCents)
+	}
+
+	sum := 0
+	for _, share := range result.Shares {
+		sum += share.AmountCents
+	}
+	if sum != result.AmountCents {
+		t.Errorf("shares sum to %d, want %d: %+v", sum, result.AmountCents, result.Shares)
+	}
+
+	// Pizza: 234/234/233, the unselected bread goes to the owner
+	want := map[int64]int{100: 234 + 100, 200: 234 + 200, 300: 233}
+	for _, share := range result.Shares {
+		if share.ItemsCents != want[share.TelegramID] {
+			t.Errorf("%s items = %d, want %d", share.Username, share.ItemsCents, want[share.TelegramID])
+		}
+	}
+}
+
+func TestComputeWeights(t *testing.T) {
+	opts := Options{Weights: map[int]map[int64]int64{10: {100: 1, 300: 3}}}
+	result, err := Compute(testReceipt(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, share := range result.Shares {
+		if share.TelegramID == 300 && share.ItemsCents != 526 {
+			t.Errorf("boris items = %d, want 526", share.ItemsCents)
+		}
+	}
+}
+
+func TestComputeRejectsUnknownItem(t *testing.T) {
+	opts := Options{Weights: map[int]map[int64]int64{99: {100: 1}}}
+	if _, err := Compute(testReceipt(), opts); !errors.Is(err, ErrInvalidSplit) {
+		t.Errorf("err = %v, want ErrInvalidSplit", err)
+	}
+}
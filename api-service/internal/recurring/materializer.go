@@ -0,0 +1,179 @@
+package recurring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/expense-tracker/api-service/internal/merchants"
+	"github.com/expense-tracker/api-service/internal/repository"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// Materializer creates expenses for due occurrences of recurring transactions.
+// Every occurrence is inserted at most once (unique recurring_id + occurrence_date),
+// so running it again after a crash or restart does not create duplicates.
+type Materializer struct {
+	DB       *pgxpool.Pool
+	Location *time.Location // calendar used to decide what is due
+}
+
+// Calendar returns the timezone recurring dates are counted in (Moscow, UTC if tzdata is missing)
+var Calendar = sync.OnceValue(func() *time.Location {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to load Moscow timezone, using UTC")
+		return time.UTC
+	}
+	return moscow
+})
+
+// Today returns the current calendar day in Calendar
+func Today() time.Time {
+	return Day(time.Now().In(Calendar()))
+}
+
+// NewMaterializer creates a materializer working on Calendar
+func NewMaterializer(db *pgxpool.Pool) *Materializer {
+	return &Materializer{DB: db, Location: Calendar()}
+}
+
+// Today returns the current calendar day in the materializer's location
+func (m *Materializer) Today() time.Time {
+	return Day(time.Now().In(m.Location))
+}
+
+// Run materializes due occurrences right away and then on every tick until ctx is done
+func (m *Materializer) Run(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		if created, err := m.MaterializeDue(ctx, m.Today()); err != nil {
+			log.Error().Err(err).Msg("materialize recurring transactions")
+		} else if created > 0 {
+			log.Info().Int("created", created).Msg("materialized recurring transactions")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// MaterializeDue creates the expenses of all occurrences up to and including today
+// and returns how many were created
+func (m *Materializer) MaterializeDue(ctx context.Context, today time.Time) (int, error) {
+	rows, err := m.DB.Query(ctx, `SELECT id FROM recurring_transactions WHERE is_active AND next_run <= $1 ORDER BY id`, today)
+	if err != nil {
+		return 0, err
+	}
+	var due []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	created := 0
+	for _, id := range due {
+		n, err := m.materialize(ctx, id, today)
+		if err != nil {
+			// One broken row must not block the others
+			log.Error().Err(err).Int("recurring_id", id).Msg("materialize recurring transaction")
+			continue
+		}
+		created += n
+	}
+	return created, nil
+}
+
+// materialize creates the due occurrences of one recurring transaction and moves its next_run forward
+func (m *Materializer) materialize(ctx context.Context, id int, today time.Time) (int, error) {
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		userID                    int64
+		groupID                   *int64
+		amountCents               int
+		operationType             string
+		categoryID, subcategoryID *int
+		accountID                 *int
+		description, currency     string
+		schedule                  Schedule
+		nextRun                   time.Time
+	)
+	// SKIP LOCKED: another api-service instance is already on it
+	err = tx.QueryRow(ctx, `
+		SELECT user_id, group_id, amount_cents, operation_type, category_id, subcategory_id, COALESCE(description, ''), currency, account_id,
+			schedule, interval_count, COALESCE(day_of_month, 0), start_date, end_date, next_run
+		FROM recurring_transactions
+		WHERE id = $1 AND is_active AND next_run IS NOT NULL
+		FOR UPDATE SKIP LOCKED
+	`, id).Scan(&userID, &groupID, &amountCents, &operationType, &categoryID, &subcategoryID, &description, &currency, &accountID,
+		&schedule.Kind, &schedule.Interval, &schedule.DayOfMonth, &schedule.Start, &schedule.End, &nextRun)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// Occurrences are described like the expenses entered by hand, with the merchant named in the description
+	merchantID, err := merchants.ForExpense(ctx, tx, "", description)
+	if err != nil {
+		return 0, fmt.Errorf("find merchant: %w", err)
+	}
+
+	created := 0
+	for _, occurrence := range schedule.Between(nextRun, today) {
+		timestamp := time.Date(occurrence.Year(), occurrence.Month(), occurrence.Day(), 12, 0, 0, 0, m.Location)
+		err := repository.Insert(ctx, tx, &repository.Transaction{
+			UserID:         userID,
+			AmountCents:    int64(amountCents),
+			OperationType:  operationType,
+			CategoryID:     categoryID,
+			SubcategoryID:  subcategoryID,
+			Timestamp:      timestamp,
+			GroupID:        groupID,
+			Description:    description,
+			MerchantID:     merchantID,
+			Currency:       currency,
+			AccountID:      accountID,
+			RecurringID:    &id,
+			OccurrenceDate: &occurrence,
+		})
+		if errors.Is(err, repository.ErrDuplicate) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("insert occurrence %s: %w", occurrence.Format(time.DateOnly), err)
+		}
+		created++
+	}
+
+	var next *time.Time
+	if d, ok := schedule.Next(today.AddDate(0, 0, 1)); ok {
+		next = &d
+	}
+	if _, err := tx.Exec(ctx, `UPDATE recurring_transactions SET next_run = $2, updated_at = NOW() WHERE id = $1`, id, next); err != nil {
+		return 0, err
+	}
+	return created, tx.Commit(ctx)
+}
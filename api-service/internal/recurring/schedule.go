@@ -0,0 +1,118 @@
+// Package recurring turns recurring transactions (salary, rent, subscriptions) into dated occurrences
+// and materializes the due ones into expenses.
+package recurring
+
+import (
+	"errors"
+	"time"
+)
+
+// Schedule kinds
+const (
+	// KindMonthly repeats every Interval months on DayOfMonth, clamped to the month's last day
+	KindMonthly = "monthly"
+	// KindLastBusinessDay repeats every Interval months on the last Monday–Friday of the month
+	KindLastBusinessDay = "last_business_day"
+	// KindWeekly repeats every Interval weeks on the weekday of Start
+	KindWeekly = "weekly"
+)
+
+var (
+	// ErrInvalidSchedule is returned for unknown kinds and out of range intervals or days
+	ErrInvalidSchedule = errors.New("invalid recurring schedule")
+)
+
+// Schedule describes when a recurring transaction occurs. Dates are calendar days in UTC.
+type Schedule struct {
+	Kind       string
+	Interval   int // every N months or weeks, at least 1
+	DayOfMonth int // 1..31, KindMonthly only
+	Start      time.Time
+	End        *time.Time // last possible occurrence, inclusive
+}
+
+// Validate checks the schedule's fields
+func (s Schedule) Validate() error {
+	if s.Interval < 1 || s.Interval > 52 {
+		return ErrInvalidSchedule
+	}
+	switch s.Kind {
+	case KindMonthly:
+		if s.DayOfMonth < 1 || s.DayOfMonth > 31 {
+			return ErrInvalidSchedule
+		}
+	case KindLastBusinessDay, KindWeekly:
+	default:
+		return ErrInvalidSchedule
+	}
+	if s.End != nil && s.End.Before(Day(s.Start)) {
+		return ErrInvalidSchedule
+	}
+	return nil
+}
+
+// Day truncates t to midnight UTC of its calendar day
+func Day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Next returns the first occurrence on or after from, or false when the schedule has ended
+func (s Schedule) Next(from time.Time) (time.Time, bool) {
+	start := Day(s.Start)
+	from = Day(from)
+	if from.Before(start) {
+		from = start
+	}
+
+	var next time.Time
+	switch s.Kind {
+	case KindWeekly:
+		period := 7 * s.Interval
+		days := int(from.Sub(start).Hours() / 24)
+		steps := (days + period - 1) / period
+		next = start.AddDate(0, 0, steps*period)
+	case KindMonthly, KindLastBusinessDay:
+		// Skip the months that are certainly before from, then walk forward
+		months := (from.Year()-start.Year())*12 + int(from.Month()-start.Month())
+		k := max(0, months/s.Interval-1)
+		for {
+			next = s.inMonth(start.AddDate(0, 0, 1-start.Day()).AddDate(0, k*s.Interval, 0))
+			if !next.Before(from) {
+				break
+			}
+			k++
+		}
+	default:
+		return time.Time{}, false
+	}
+
+	if s.End != nil && next.After(Day(*s.End)) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+// Between returns the occurrences in [from, to]
+func (s Schedule) Between(from, to time.Time) []time.Time {
+	var dates []time.Time
+	to = Day(to)
+	for next, ok := s.Next(from); ok && !next.After(to); next, ok = s.Next(next.AddDate(0, 0, 1)) {
+		dates = append(dates, next)
+	}
+	return dates
+}
+
+// inMonth returns the occurrence within the month starting at first
+func (s Schedule) inMonth(first time.Time) time.Time {
+	last := first.AddDate(0, 1, -1)
+	if s.Kind == KindLastBusinessDay {
+		for last.Weekday() == time.Saturday || last.Weekday() == time.Sunday {
+			last = last.AddDate(0, 0, -1)
+		}
+		return last
+	}
+	if s.DayOfMonth > last.Day() {
+		return last
+	}
+	return first.AddDate(0, 0, s.DayOfMonth-1)
+}
@@ -0,0 +1,95 @@
+package recurring
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func dates(values ...string) []time.Time {
+	out := make([]time.Time, len(values))
+	for i, v := range values {
+		out[i] = date(v)
+	}
+	return out
+}
+
+func TestScheduleBetween(t *testing.T) {
+	end := date("2026-04-30")
+	tests := []struct {
+		name     string
+		schedule Schedule
+		from, to string
+		want     []time.Time
+	}{
+		{
+			name:     "monthly on the 5th",
+			schedule: Schedule{Kind: KindMonthly, Interval: 1, DayOfMonth: 5, Start: date("2026-01-10")},
+			from:     "2026-01-01", to: "2026-04-05",
+			want: dates("2026-02-05", "2026-03-05", "2026-04-05"),
+		},
+		{
+			name:     "day 31 clamps to the month end",
+			schedule: Schedule{Kind: KindMonthly, Interval: 1, DayOfMonth: 31, Start: date("2026-01-01")},
+			from:     "2026-01-01", to: "2026-04-30",
+			want: dates("2026-01-31", "2026-02-28", "2026-03-31", "2026-04-30"),
+		},
+		{
+			name:     "every second month",
+			schedule: Schedule{Kind: KindMonthly, Interval: 2, DayOfMonth: 1, Start: date("2025-11-01")},
+			from:     "2026-01-15", to: "2026-06-30",
+			want: dates("2026-03-01", "2026-05-01"),
+		},
+		{
+			name:     "last business day",
+			schedule: Schedule{Kind: KindLastBusinessDay, Interval: 1, Start: date("2026-01-01")},
+			from:     "2026-01-01", to: "2026-06-30",
+			// May 31 is a Sunday, January 31 a Saturday
+			want: dates("2026-01-30", "2026-02-27", "2026-03-31", "2026-04-30", "2026-05-29", "2026-06-30"),
+		},
+		{
+			name:     "every two weeks",
+			schedule: Schedule{Kind: KindWeekly, Interval: 2, Start: date("2026-03-02")},
+			from:     "2026-03-10", to: "2026-04-15",
+			want: dates("2026-03-16", "2026-03-30", "2026-04-13"),
+		},
+		{
+			name:     "ends",
+			schedule: Schedule{Kind: KindMonthly, Interval: 1, DayOfMonth: 15, Start: date("2026-01-01"), End: &end},
+			from:     "2026-03-01", to: "2026-12-31",
+			want: dates("2026-03-15", "2026-04-15"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.schedule.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			got := tt.schedule.Between(date(tt.from), date(tt.to))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Between = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleValidate(t *testing.T) {
+	invalid := []Schedule{
+		{Kind: "yearly", Interval: 1, Start: date("2026-01-01")},
+		{Kind: KindMonthly, Interval: 1, DayOfMonth: 0, Start: date("2026-01-01")},
+		{Kind: KindWeekly, Interval: 0, Start: date("2026-01-01")},
+	}
+	for _, s := range invalid {
+		if err := s.Validate(); err != ErrInvalidSchedule {
+			t.Errorf("Validate(%+v) = %v", s, err)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Filter holds the filters of GetTransactions; the export, search and bulk operations accept the same ones
+type Filter struct {
+	OperationType string // expense, income, transfer, both or empty
+	CategoryID    string
+	SubcategoryID string
+	MerchantID    string
+	StartDate     string // RFC3339
+	EndDate       string // RFC3339
+	Scope         string // all (default), personal or family
+	Deleted       bool   // match transactions in the trash instead of live ones
+}
+
+// Conditions builds the WHERE conditions over expenses e for a user in groupIDs.
+// Malformed ids and dates are ignored, as GetTransactions always did.
+func (f Filter) Conditions(userID int64, groupIDs []int64) ([]string, []interface{}) {
+	// Always exclude soft-deleted transactions, unless looking in the trash
+	conditions := []string{"e.deleted_at IS NULL"}
+	if f.Deleted {
+		conditions[0] = "e.deleted_at IS NOT NULL"
+	}
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if f.OperationType != "" && f.OperationType != "both" {
+		conditions = append(conditions, "e.operation_type = "+arg(f.OperationType))
+	}
+	if catID, err := strconv.Atoi(f.CategoryID); err == nil {
+		conditions = append(conditions, "e.category_id = "+arg(catID))
+	}
+	if subID, err := strconv.Atoi(f.SubcategoryID); err == nil {
+		conditions = append(conditions, "e.subcategory_id = "+arg(subID))
+	}
+	if merchantID, err := strconv.Atoi(f.MerchantID); err == nil {
+		conditions = append(conditions, "e.merchant_id = "+arg(merchantID))
+	}
+	if _, err := time.Parse(time.RFC3339, f.StartDate); err == nil {
+		conditions = append(conditions, "e.timestamp >= "+arg(f.StartDate))
+	}
+	if _, err := time.Parse(time.RFC3339, f.EndDate); err == nil {
+		conditions = append(conditions, "e.timestamp <= "+arg(f.EndDate))
+	}
+
+	switch f.Scope {
+	case "personal":
+		// Show only user's own expenses
+		conditions = append(conditions, "e.user_id = "+arg(userID))
+	case "family":
+		// Show only group expenses (non-private) of the user's groups made by others
+		if len(groupIDs) > 0 {
+			conditions = append(conditions, fmt.Sprintf("(e.group_id = ANY(%s) AND e.is_private = false AND e.user_id != %s)", arg(groupIDs), arg(userID)))
+		} else {
+			// User not in any group, return empty result
+			conditions = append(conditions, "1=0")
+		}
+	default:
+		// "all" or empty: show user's own expenses + group expenses (non-private)
+		if len(groupIDs) > 0 {
+			conditions = append(conditions, fmt.Sprintf("(e.user_id = %s OR (e.group_id = ANY(%s) AND e.is_private = false))", arg(userID), arg(groupIDs)))
+		} else {
+			conditions = append(conditions, "e.user_id = "+arg(userID))
+		}
+	}
+	return conditions, args
+}
+
+// UserGroupIDs returns the groups of a user (by internal id). group_members references users by
+// telegram_id; every list of transactions resolves the user's groups here so they all see the same rows.
+func UserGroupIDs(ctx context.Context, q Querier, userID int64) ([]int64, error) {
+	rows, err := q.Query(ctx, `
+		SELECT gm.group_id FROM group_members gm JOIN users u ON u.telegram_id = gm.user_id WHERE u.id = $1
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int64])
+}
+
+// Listed is a transaction as lists, searches and exports return it, with the names of its category,
+// subcategory, merchant and user
+type Listed struct {
+	ID              int
+	UserID          int64
+	AmountCents     int
+	Currency        string
+	OperationType   string
+	Timestamp       time.Time
+	CategoryID      *int
+	SubcategoryID   *int
+	CategoryName    *string
+	SubcategoryName *string
+	Username        *string
+	Description     *string
+	MerchantID      *int
+	Merchant        *string
+	IsShared        bool
+	GroupID         *int64
+	AccountID       *int
+	TransferID      *int64
+	TransferLeg     *string
+	IncomeType      *string
+	RelatedDebtID   *int
+}
+
+// listedFrom selects the transactions e with their names; the user is matched by users.id like everywhere else
+const listedFrom = `
+	FROM expenses e
+	LEFT JOIN users u ON u.id = e.user_id
+	LEFT JOIN categories c ON e.category_id = c.id
+	LEFT JOIN subcategories s ON e.subcategory_id = s.id
+	LEFT JOIN merchants m ON e.merchant_id = m.id`
+
+// listedColumns are the columns scanListed reads
+const listedColumns = `e.id, e.user_id, e.amount_cents, e.currency, COALESCE(e.operation_type, 'expense'), COALESCE(e.timestamp, 'epoch'),
+	e.category_id, e.subcategory_id, c.name, s.name, u.username, e.description, e.merchant_id, m.name,
+	COALESCE(e.is_shared, false), e.group_id, e.account_id, e.transfer_id, e.transfer_leg, e.income_type, e.related_debt_id`
+
+// scanListed reads listedColumns followed by extra
+func scanListed(row pgx.Row, extra ...any) (Listed, error) {
+	var t Listed
+	err := row.Scan(append([]any{&t.ID, &t.UserID, &t.AmountCents, &t.Currency, &t.OperationType, &t.Timestamp,
+		&t.CategoryID, &t.SubcategoryID, &t.CategoryName, &t.SubcategoryName, &t.Username, &t.Description, &t.MerchantID, &t.Merchant,
+		&t.IsShared, &t.GroupID, &t.AccountID, &t.TransferID, &t.TransferLeg, &t.IncomeType, &t.RelatedDebtID}, extra...)...)
+	return t, err
+}
+
+// List returns up to limit transactions of a user in groupIDs matching filter, older than before when
+// it is set, newest first
+func List(ctx context.Context, q Querier, filter Filter, userID int64, groupIDs []int64, before *time.Time, limit int) ([]Listed, error) {
+	conditions, args := filter.Conditions(userID, groupIDs)
+	if before != nil {
+		args = append(args, *before)
+		conditions = append(conditions, fmt.Sprintf("e.timestamp < $%d", len(args)))
+	}
+	args = append(args, limit)
+	rows, err := q.Query(ctx, fmt.Sprintf(`
+		SELECT %s
+		%s
+		WHERE %s
+		ORDER BY e.timestamp DESC, e.id DESC
+		LIMIT $%d
+	`, listedColumns, listedFrom, strings.Join(conditions, " AND "), len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var listed []Listed
+	for rows.Next() {
+		t, err := scanListed(rows)
+		if err != nil {
+			return nil, err
+		}
+		listed = append(listed, t)
+	}
+	return listed, rows.Err()
+}
+
+// Listing is an open export, read one transaction at a time with Next and Transaction
+type Listing struct {
+	rows pgx.Rows
+}
+
+// Next advances to the next transaction, false after the last one or on an error
+func (l *Listing) Next() bool { return l.rows.Next() }
+
+// Transaction returns the current transaction
+func (l *Listing) Transaction() (Listed, error) { return scanListed(l.rows) }
+
+// Err returns the error that stopped Next
+func (l *Listing) Err() error { return l.rows.Err() }
+
+// Close releases the connection; the listing must be closed
+func (l *Listing) Close() { l.rows.Close() }
+
+// Export opens every transaction List pages through for the same filter, in the same order
+func Export(ctx context.Context, q Querier, filter Filter, userID int64, groupIDs []int64) (*Listing, error) {
+	conditions, args := filter.Conditions(userID, groupIDs)
+	rows, err := q.Query(ctx, `
+		SELECT `+listedColumns+`
+		`+listedFrom+`
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY e.timestamp DESC, e.id DESC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &Listing{rows: rows}, nil
+}
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/expense-tracker/api-service/internal/dbtest"
+)
+
+func TestUserGroupIDs(t *testing.T) {
+	db := dbtest.New(func(sql string, args []any) dbtest.Result {
+		return dbtest.Result{Rows: [][]any{{int64(-100)}, {int64(-200)}}}
+	})
+	groupIDs, err := UserGroupIDs(context.Background(), db, 7)
+	if err != nil || !reflect.DeepEqual(groupIDs, []int64{-100, -200}) {
+		t.Fatalf("UserGroupIDs() = %v, %v", groupIDs, err)
+	}
+	// group_members.user_id is a telegram id, the caller is known by users.id
+	s, ok := db.Ran("JOIN users u ON u.telegram_id = gm.user_id", "u.id = $1")
+	if !ok || !reflect.DeepEqual(s.Args, []any{int64(7)}) {
+		t.Errorf("statements = %+v", db.Statements)
+	}
+}
+
+// whereClause returns the conditions of a query between WHERE and ORDER BY
+func whereClause(t *testing.T, query string) string {
+	t.Helper()
+	start, end := strings.Index(query, "WHERE"), strings.Index(query, "ORDER BY")
+	if start < 0 || end < start {
+		t.Fatalf("no WHERE ... ORDER BY in %s", query)
+	}
+	return strings.TrimSpace(query[start:end])
+}
+
+func TestListAndExportMatchSameRows(t *testing.T) {
+	ctx := context.Background()
+	filters := []Filter{
+		{},
+		{Scope: "personal", OperationType: TypeIncome},
+		{Scope: "family", CategoryID: "3", StartDate: "2026-03-01T00:00:00Z", EndDate: "2026-03-31T23:59:59Z"},
+		{OperationType: "both", MerchantID: "5", SubcategoryID: "9"},
+	}
+	for _, filter := range filters {
+		db := dbtest.New(nil)
+		if _, err := List(ctx, db, filter, 7, []int64{-100}, nil, 21); err != nil {
+			t.Fatal(err)
+		}
+		rows, err := Export(ctx, db, filter, 7, []int64{-100})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows.Close()
+
+		list, export := db.Statements[0], db.Statements[1]
+		if whereClause(t, list.SQL) != whereClause(t, export.SQL) {
+			t.Errorf("%+v: list %s, export %s", filter, whereClause(t, list.SQL), whereClause(t, export.SQL))
+		}
+		// The list only adds its page size
+		if !reflect.DeepEqual(list.Args[:len(list.Args)-1], export.Args) || list.Args[len(list.Args)-1] != 21 {
+			t.Errorf("%+v: list args %v, export args %v", filter, list.Args, export.Args)
+		}
+		if !strings.Contains(list.SQL, listedFrom) || !strings.Contains(export.SQL, listedFrom) {
+			t.Errorf("%+v: list and export join different tables", filter)
+		}
+	}
+
+	db := dbtest.New(nil)
+	before := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	if _, err := List(ctx, db, Filter{}, 7, nil, &before, 21); err != nil {
+		t.Fatal(err)
+	}
+	list := db.Statements[0]
+	if !strings.Contains(list.SQL, "e.timestamp < $2") || !strings.Contains(list.SQL, "LIMIT $3") || list.Args[1] != before {
+		t.Errorf("cursor: %s %v", whereClause(t, list.SQL), list.Args)
+	}
+}
+
+func TestSearchFiltersByIndexedColumns(t *testing.T) {
+	db := dbtest.New(nil)
+	after := &SearchPosition{Rank: "1.06", Timestamp: time.Date(2026, 3, 5, 9, 30, 0, 0, time.UTC), ID: 42}
+	if _, err := Search(context.Background(), db, Filter{Scope: "personal"}, 7, nil, "аптека", after, 11); err != nil {
+		t.Fatal(err)
+	}
+	// The threshold of description %> text is set for the search transaction
+	if i, j := db.Index("set_config('pg_trgm.word_similarity_threshold'"), db.Index("SELECT e.id"); i < 0 || j < i {
+		t.Fatalf("statements = %+v", db.Statements)
+	}
+	s, _ := db.Ran("SELECT e.id")
+	where := whereClause(t, s.SQL)
+	for _, indexed := range []string{"e.search_vector @@", "e.description %> $2"} {
+		if !strings.Contains(where, indexed) {
+			t.Errorf("no %q in %s", indexed, where)
+		}
+	}
+	if !strings.Contains(where, "(x.rank, COALESCE(e.timestamp, 'epoch'), e.id) < ($4::numeric, $5, $6)") {
+		t.Errorf("cursor condition missing: %s", where)
+	}
+	if want := []any{int64(7), "аптека", 0.4, "1.06", after.Timestamp, 42, 11}; !reflect.DeepEqual(s.Args, want) {
+		t.Errorf("args = %v, want %v", s.Args, want)
+	}
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// searchSimilarity is the pg_trgm word similarity a typo match needs
+const searchSimilarity = 0.4
+
+// Beginner starts transactions; a pool is one
+type Beginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// SearchPosition is the position of a search result: results are ordered by rank, timestamp and id,
+// all descending
+type SearchPosition struct {
+	Rank      string // rounded rank as returned by PostgreSQL, compared exactly
+	Timestamp time.Time
+	ID        int
+}
+
+// Match is a transaction found by Search
+type Match struct {
+	Listed
+	Rank string // above 1 for full-text matches, the trigram similarity for typo matches
+}
+
+// Position returns the position of the match
+func (m Match) Position() SearchPosition {
+	return SearchPosition{Rank: m.Rank, Timestamp: m.Timestamp, ID: m.ID}
+}
+
+// Search finds up to limit transactions of a user in groupIDs matching text and the filter, best matches
+// first, after the position after when it is set. Text is matched against descriptions and income types,
+// merchants, category and subcategory names and aliases and usernames, with Russian stemming and a trigram
+// fallback for typos.
+// Candidates are picked by indexed conditions only: a description or income type matching any word of text
+// (idx_expenses_search_vector) or close to text (idx_expenses_description_trgm), or a merchant, category,
+// subcategory or user whose name matches. The document over all the names is built and ranked for them alone.
+func Search(ctx context.Context, db Beginner, filter Filter, userID int64, groupIDs []int64, text string, after *SearchPosition, limit int) ([]Match, error) {
+	conditions, args := filter.Conditions(userID, groupIDs)
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	query := arg(text)
+	similarity := arg(searchSimilarity)
+	tsquery := "websearch_to_tsquery('russian', " + query + ")"
+	// Any word of the text: a match of the whole query may take its words from different names
+	anyWord := "replace(plainto_tsquery('russian', " + query + ")::text, ' & ', ' | ')::tsquery"
+	names := func(table, column string) string {
+		return fmt.Sprintf("SELECT id FROM %s WHERE to_tsvector('russian', %s) @@ %s OR word_similarity(%s, %s) >= %s",
+			table, column, anyWord, query, column, similarity)
+	}
+	conditions = append(conditions,
+		fmt.Sprintf("(e.search_vector @@ %s OR e.description %%> %s OR e.merchant_id IN (%s) OR e.category_id IN (%s) OR e.subcategory_id IN (%s) OR e.user_id IN (%s))",
+			anyWord, query,
+			names("merchants", "name"),
+			names("categories", "concat_ws(' ', name, aliases::text)"),
+			names("subcategories", "concat_ws(' ', name, aliases::text)"),
+			names("users", "COALESCE(username, '')")),
+		fmt.Sprintf("(d.doc @@ %s OR word_similarity(%s, d.text) >= %s)", tsquery, query, similarity))
+	if after != nil {
+		conditions = append(conditions, fmt.Sprintf("(x.rank, COALESCE(e.timestamp, 'epoch'), e.id) < (%s::numeric, %s, %s)",
+			arg(after.Rank), arg(after.Timestamp), arg(after.ID)))
+	}
+	limitArg := arg(limit)
+
+	// description %> text uses the trigram index with the threshold of the session, set for this transaction only
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, "SELECT set_config('pg_trgm.word_similarity_threshold', $1, true)",
+		strconv.FormatFloat(searchSimilarity, 'f', -1, 64)); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT `+listedColumns+`, x.rank::text
+		`+listedFrom+`
+		CROSS JOIN LATERAL (
+			SELECT setweight(e.search_vector, 'A')
+					|| setweight(to_tsvector('russian', COALESCE(m.name, '')), 'A')
+					|| setweight(to_tsvector('russian', concat_ws(' ', c.name, s.name)), 'B')
+					|| setweight(to_tsvector('russian', concat_ws(' ', c.aliases::text, s.aliases::text, u.username)), 'C') AS doc,
+				concat_ws(' ', e.description, m.name, c.name, s.name, u.username) AS text
+		) d
+		CROSS JOIN LATERAL (
+			SELECT ROUND((CASE WHEN d.doc @@ `+tsquery+` THEN 1 + ts_rank(d.doc, `+tsquery+`)
+				ELSE word_similarity(`+query+`, d.text) END)::numeric, 6) AS rank
+		) x
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY x.rank DESC, COALESCE(e.timestamp, 'epoch') DESC, e.id DESC
+		LIMIT `+limitArg, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []Match
+	for rows.Next() {
+		var m Match
+		if m.Listed, err = scanListed(rows, &m.Rank); err != nil {
+			return nil, err
+		}
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Counted is the condition on the transaction aliased e that totals, balances and analytics share:
+// live expenses and incomes. Transfers only move money between accounts.
+const Counted = "e.operation_type IN ('expense', 'income') AND e.deleted_at IS NULL"
+
+// Scope selects whose transactions are summed and over which period
+type Scope struct {
+	UserID      int64   // one user (users.id), or
+	TelegramIDs []int64 // the family members by telegram_id
+	Days        int     // only the last Days days, 0 for all time
+}
+
+// PeriodDays returns the days of a period query parameter: week, month or anything else for all time
+func PeriodDays(period string) int {
+	switch period {
+	case "week":
+		return 7
+	case "month":
+		return 30
+	}
+	return 0
+}
+
+// where returns the conditions on e (and the users row u) for the scope; args continue after first
+func (s Scope) where(first int) (string, []any) {
+	conditions := []string{Counted}
+	var args []any
+	if s.TelegramIDs != nil {
+		conditions = append(conditions, fmt.Sprintf("u.telegram_id = ANY($%d)", first+len(args)))
+		args = append(args, s.TelegramIDs)
+	} else {
+		conditions = append(conditions, fmt.Sprintf("e.user_id = $%d", first+len(args)))
+		args = append(args, s.UserID)
+	}
+	if s.Days > 0 {
+		conditions = append(conditions, fmt.Sprintf("e.timestamp >= NOW() - make_interval(days => $%d)", first+len(args)))
+		args = append(args, s.Days)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// Totals are the sums of expenses and incomes in one currency
+type Totals struct {
+	ExpenseCents int64
+	IncomeCents  int64
+}
+
+// BalanceCents is incomes minus expenses
+func (t Totals) BalanceCents() int64 {
+	return t.IncomeCents - t.ExpenseCents
+}
+
+// SumTotals sums the scope's expenses and incomes in the currency code, converting every transaction
+// at the rate of its date
+func SumTotals(ctx context.Context, q Querier, scope Scope, code string) (Totals, error) {
+	where, args := scope.where(2)
+	amount := ConvertedSQL("e", "$1")
+	query := fmt.Sprintf(`
+		SELECT COALESCE(SUM(%[1]s) FILTER (WHERE e.operation_type = 'expense'), 0),
+			COALESCE(SUM(%[1]s) FILTER (WHERE e.operation_type = 'income'), 0)
+		FROM expenses e
+		JOIN users u ON u.id = e.user_id
+		WHERE %[2]s
+	`, amount, where)
+
+	var t Totals
+	err := q.QueryRow(ctx, query, append([]any{code}, args...)...).Scan(&t.ExpenseCents, &t.IncomeCents)
+	return t, err
+}
+
+// Income is an income with the fields of the legacy incomes table
+type Income struct {
+	ID            int     `json:"id"`
+	UserID        int64   `json:"user_id"`
+	AmountCents   int     `json:"amount_cents"`
+	Currency      string  `json:"currency"`
+	IncomeType    string  `json:"income_type"`
+	Description   *string `json:"description"`
+	RelatedDebtID *int    `json:"related_debt_id"`
+	AccountID     *int    `json:"account_id"`
+	Timestamp     string  `json:"timestamp"` // RFC3339, UTC
+	Username      string  `json:"username"`
+}
+
+// Incomes returns the scope's latest incomes, newest first
+func Incomes(ctx context.Context, q Querier, scope Scope, limit int) ([]Income, error) {
+	where, args := scope.where(1)
+	rows, err := q.Query(ctx, fmt.Sprintf(`
+		SELECT e.id, e.user_id, e.amount_cents, e.currency, COALESCE(e.income_type, 'other'), e.description, e.related_debt_id,
+			e.account_id, e.timestamp, COALESCE(u.username, '')
+		FROM expenses e
+		JOIN users u ON u.id = e.user_id
+		WHERE e.operation_type = 'income' AND %s
+		ORDER BY e.timestamp DESC, e.id DESC
+		LIMIT $%d
+	`, where, len(args)+1), append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	incomes := []Income{}
+	for rows.Next() {
+		var i Income
+		var ts time.Time
+		if err := rows.Scan(&i.ID, &i.UserID, &i.AmountCents, &i.Currency, &i.IncomeType, &i.Description, &i.RelatedDebtID,
+			&i.AccountID, &ts, &i.Username); err != nil {
+			return nil, err
+		}
+		i.Timestamp = ts.UTC().Format(time.RFC3339)
+		incomes = append(incomes, i)
+	}
+	return incomes, rows.Err()
+}
+
+// ConvertedSQL returns the expression converting the amount of the transaction aliased alias into the currency
+// passed as the query parameter param (e.g. "$2"), at the rate of the transaction's Moscow date
+func ConvertedSQL(alias, param string) string {
+	return fmt.Sprintf("convert_cents(%[1]s.amount_cents, %[1]s.currency, %[2]s, (%[1]s.timestamp AT TIME ZONE 'Europe/Moscow')::date)", alias, param)
+}
+
+// AccountBalanceSQL returns the balance of the account aliased alias in its currency: the opening balance
+// plus incomes and incoming transfer legs, minus expenses and outgoing legs
+func AccountBalanceSQL(alias string) string {
+	amount := ConvertedSQL("e", alias+".currency")
+	return fmt.Sprintf(`%[1]s.opening_balance_cents + COALESCE((
+		SELECT SUM(CASE WHEN e.operation_type = 'income' OR e.transfer_leg = 'credit' THEN %[2]s ELSE -%[2]s END)
+		FROM expenses e WHERE e.account_id = %[1]s.id AND e.deleted_at IS NULL), 0)`, alias, amount)
+}
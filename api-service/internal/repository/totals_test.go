@@ -0,0 +1,10 @@
+package repository
+
+import "testing"
+
+func TestConvertedSQL(t *testing.T) {
+	want := "convert_cents(e.amount_cents, e.currency, $2, (e.timestamp AT TIME ZONE 'Europe/Moscow')::date)"
+	if got := ConvertedSQL("e", "$2"); got != want {
+		t.Errorf("ConvertedSQL() = %s", got)
+	}
+}
@@ -0,0 +1,217 @@
+// Package repository owns the reads and writes of transactions. Expenses, incomes and the legs of
+// transfers are rows of one table, expenses, told apart by operation_type; the legacy incomes table was
+// folded into it by migration 018. Totals and balances are computed here, so every endpoint and the
+// analytics service count the same rows: live (not deleted) expenses and incomes, never transfers.
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Operation types
+const (
+	TypeExpense  = "expense"
+	TypeIncome   = "income"
+	TypeTransfer = "transfer"
+)
+
+// Income types
+const (
+	IncomeSalary     = "salary"
+	IncomeDebtReturn = "debt_return"
+	IncomePrize      = "prize"
+	IncomeGift       = "gift"
+	IncomeRefund     = "refund"
+	IncomeOther      = "other"
+)
+
+var incomeTypes = map[string]bool{
+	IncomeSalary: true, IncomeDebtReturn: true, IncomePrize: true, IncomeGift: true, IncomeRefund: true, IncomeOther: true,
+}
+
+// IncomeType returns t when it is a known income type and "other" otherwise
+func IncomeType(t string) string {
+	if incomeTypes[t] {
+		return t
+	}
+	return IncomeOther
+}
+
+// ErrDuplicate is returned by Insert when the transaction was recorded before:
+// the same bank transaction (external_id) or the same occurrence of a recurring transaction
+var ErrDuplicate = errors.New("transaction already recorded")
+
+// Querier is a pool or a transaction
+type Querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// Transaction is a row of expenses to insert. Zero values are the defaults: an expense, now,
+// in the user's base currency, personal and not linked to anything.
+type Transaction struct {
+	UserID        int64 // users.id
+	AmountCents   int64
+	OperationType string
+	CategoryID    *int
+	SubcategoryID *int
+	Timestamp     time.Time
+	IsShared      bool
+	IsPrivate     bool
+	GroupID       *int64
+	Description   string
+	MerchantID    *int
+	Currency      string
+	AccountID     *int
+
+	// Incomes recorded as such (salary, a repaid debt...); incomes entered as transactions have no type
+	IncomeType    string
+	RelatedDebtID *int
+
+	// Transfer legs
+	TransferID  *int64
+	TransferLeg string
+
+	// Idempotency keys: a second insert with the same key returns ErrDuplicate
+	ImportBatchID  *int
+	ExternalID     string
+	RecurringID    *int
+	OccurrenceDate *time.Time
+
+	// Restored from a backup already in the trash
+	DeletedAt *time.Time
+
+	// Set by Insert
+	ID int
+}
+
+// normalize applies the defaults and checks the fields that depend on the operation type
+func (t *Transaction) normalize(now time.Time) error {
+	if t.OperationType == "" {
+		t.OperationType = TypeExpense
+	}
+	if t.AmountCents <= 0 {
+		return fmt.Errorf("amount_cents must be positive, got %d", t.AmountCents)
+	}
+	switch t.OperationType {
+	case TypeExpense:
+		if t.IncomeType != "" || t.RelatedDebtID != nil {
+			return errors.New("expenses have no income type or related debt")
+		}
+	case TypeIncome:
+		if t.IncomeType != "" {
+			t.IncomeType = IncomeType(t.IncomeType)
+		}
+		if t.RelatedDebtID != nil && t.IncomeType == "" {
+			return errors.New("incomes repaying a debt need an income type")
+		}
+	case TypeTransfer:
+		if t.TransferID == nil || t.TransferLeg == "" || t.AccountID == nil {
+			return errors.New("transfer legs need a transfer id, a leg and an account")
+		}
+	default:
+		return fmt.Errorf("unknown operation type %q", t.OperationType)
+	}
+	if t.OperationType != TypeTransfer && (t.TransferID != nil || t.TransferLeg != "") {
+		return errors.New("only transfer legs have a transfer id")
+	}
+	if t.Timestamp.IsZero() {
+		t.Timestamp = now
+	}
+	t.Description = strings.TrimSpace(t.Description)
+	return nil
+}
+
+// Insert records a transaction and sets its ID and Currency (the trigger fills in the user's base currency)
+func Insert(ctx context.Context, q Querier, t *Transaction) error {
+	if err := t.normalize(time.Now()); err != nil {
+		return err
+	}
+	err := q.QueryRow(ctx, `
+		INSERT INTO expenses (user_id, amount_cents, operation_type, category_id, subcategory_id, timestamp, is_shared, is_private,
+			group_id, description, merchant_id, currency, account_id, income_type, related_debt_id, transfer_id, transfer_leg,
+			import_batch_id, external_id, recurring_id, occurrence_date, deleted_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), $11, NULLIF($12, ''), $13, NULLIF($14, ''), $15, $16, NULLIF($17, ''),
+			$18, NULLIF($19, ''), $20, $21, $22)
+		ON CONFLICT DO NOTHING
+		RETURNING id, currency
+	`, t.UserID, t.AmountCents, t.OperationType, t.CategoryID, t.SubcategoryID, t.Timestamp, t.IsShared, t.IsPrivate,
+		t.GroupID, t.Description, t.MerchantID, t.Currency, t.AccountID, t.IncomeType, t.RelatedDebtID, t.TransferID, t.TransferLeg,
+		t.ImportBatchID, t.ExternalID, t.RecurringID, t.OccurrenceDate, t.DeletedAt).Scan(&t.ID, &t.Currency)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// Update overwrites the editable fields of the transaction id: amount, type, categories, time, description,
+// merchant, sharing, group, currency and account. An income turned into an expense drops its income fields;
+// transfer legs and idempotency keys are never edited.
+func Update(ctx context.Context, q Querier, id int, t Transaction) error {
+	_, err := q.Exec(ctx, `
+		UPDATE expenses SET amount_cents = $2, operation_type = $3, category_id = $4, subcategory_id = $5, timestamp = $6,
+			description = NULLIF($7, ''), merchant_id = $8, is_shared = $9, is_private = $10, group_id = $11, currency = $12,
+			account_id = $13,
+			income_type = CASE WHEN $3 = 'income' THEN income_type END,
+			related_debt_id = CASE WHEN $3 = 'income' THEN related_debt_id END
+		WHERE id = $1
+	`, id, t.AmountCents, t.OperationType, t.CategoryID, t.SubcategoryID, t.Timestamp,
+		t.Description, t.MerchantID, t.IsShared, t.IsPrivate, t.GroupID, t.Currency, t.AccountID)
+	return err
+}
+
+// Deletion is a transaction deleted or restored by SetDeleted, with its deleted_at before and after
+type Deletion struct {
+	ID            int
+	Before, After *time.Time
+}
+
+// SetDeleted soft deletes (deleted) or restores the transaction id of the user; both legs of a transfer
+// change together. It returns the changed transactions, none when the transaction is not the user's
+// or is already deleted or live.
+func SetDeleted(ctx context.Context, q Querier, userID int64, id int, deleted bool) ([]Deletion, error) {
+	rows, err := q.Query(ctx, `
+		UPDATE expenses e SET deleted_at = CASE WHEN $3 THEN NOW() END
+		FROM (
+			SELECT id, deleted_at FROM expenses
+			WHERE id = $1 OR transfer_id = (SELECT transfer_id FROM expenses WHERE id = $1)
+			FOR UPDATE
+		) old
+		WHERE e.id = old.id AND e.user_id = $2 AND (old.deleted_at IS NULL) = $3
+		RETURNING e.id, old.deleted_at, e.deleted_at
+	`, id, userID, deleted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []Deletion
+	for rows.Next() {
+		var d Deletion
+		if err := rows.Scan(&d.ID, &d.Before, &d.After); err != nil {
+			return nil, err
+		}
+		changes = append(changes, d)
+	}
+	return changes, rows.Err()
+}
+
+// UnlinkDebts drops the link of the incomes repaying debtIDs to them; the incomes stay
+func UnlinkDebts(ctx context.Context, q Querier, debtIDs []int) error {
+	_, err := q.Exec(ctx, `UPDATE expenses SET related_debt_id = NULL WHERE related_debt_id = ANY($1)`, debtIDs)
+	return err
+}
+
+// Delete removes transactions for good and returns how many; the rows referencing them must be gone or unlinked
+func Delete(ctx context.Context, q Querier, ids []int) (int, error) {
+	tag, err := q.Exec(ctx, `DELETE FROM expenses WHERE id = ANY($1)`, ids)
+	return int(tag.RowsAffected()), err
+}
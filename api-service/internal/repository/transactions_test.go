@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNormalize(t *testing.T) {
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	id := func(v int) *int { return &v }
+	transferID := int64(7)
+
+	tx := Transaction{UserID: 1, AmountCents: 100, Description: " кофе "}
+	if err := tx.normalize(now); err != nil {
+		t.Fatal(err)
+	}
+	if tx.OperationType != TypeExpense || !tx.Timestamp.Equal(now) || tx.Description != "кофе" {
+		t.Errorf("defaults: %+v", tx)
+	}
+
+	income := Transaction{AmountCents: 100, OperationType: TypeIncome, IncomeType: "lottery"}
+	if err := income.normalize(now); err != nil {
+		t.Fatal(err)
+	}
+	if income.IncomeType != IncomeOther {
+		t.Errorf("income type = %q, want %q", income.IncomeType, IncomeOther)
+	}
+
+	tests := []struct {
+		name string
+		tx   Transaction
+		ok   bool
+	}{
+		{"untyped income", Transaction{AmountCents: 100, OperationType: TypeIncome}, true},
+		{"debt return", Transaction{AmountCents: 100, OperationType: TypeIncome, IncomeType: IncomeDebtReturn, RelatedDebtID: id(3)}, true},
+		{"transfer leg", Transaction{AmountCents: 100, OperationType: TypeTransfer, AccountID: id(1), TransferID: &transferID, TransferLeg: "debit"}, true},
+		{"zero amount", Transaction{}, false},
+		{"negative amount", Transaction{AmountCents: -100}, false},
+		{"unknown type", Transaction{AmountCents: 100, OperationType: "refund"}, false},
+		{"expense with income type", Transaction{AmountCents: 100, IncomeType: IncomeSalary}, false},
+		{"expense repaying a debt", Transaction{AmountCents: 100, RelatedDebtID: id(3)}, false},
+		{"untyped debt return", Transaction{AmountCents: 100, OperationType: TypeIncome, RelatedDebtID: id(3)}, false},
+		{"transfer without account", Transaction{AmountCents: 100, OperationType: TypeTransfer, TransferID: &transferID, TransferLeg: "debit"}, false},
+		{"expense with transfer id", Transaction{AmountCents: 100, TransferID: &transferID}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.tx.normalize(now); (err == nil) != tt.ok {
+				t.Errorf("normalize() err = %v, want ok = %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestIncomeType(t *testing.T) {
+	for in, want := range map[string]string{"salary": IncomeSalary, "debt_return": IncomeDebtReturn, "": IncomeOther, "Salary": IncomeOther} {
+		if got := IncomeType(in); got != want {
+			t.Errorf("IncomeType(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestScopeWhere(t *testing.T) {
+	tests := []struct {
+		name  string
+		scope Scope
+		where string
+		args  []any
+	}{
+		{"user", Scope{UserID: 5}, Counted + " AND e.user_id = $2", []any{int64(5)}},
+		{"family for a week", Scope{TelegramIDs: []int64{10, 20}, Days: PeriodDays("week")},
+			Counted + " AND u.telegram_id = ANY($2) AND e.timestamp >= NOW() - make_interval(days => $3)", []any{[]int64{10, 20}, 7}},
+		{"user for a month", Scope{UserID: 5, Days: PeriodDays("month")},
+			Counted + " AND e.user_id = $2 AND e.timestamp >= NOW() - make_interval(days => $3)", []any{int64(5), 30}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args := tt.scope.where(2)
+			if where != tt.where || !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("where(2) = %q %v, want %q %v", where, args, tt.where, tt.args)
+			}
+		})
+	}
+	if days := PeriodDays("all"); days != 0 {
+		t.Errorf("PeriodDays(all) = %d, want 0", days)
+	}
+}
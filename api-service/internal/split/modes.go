@@ -0,0 +1,71 @@
+package split
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Split modes for shared expenses
+const (
+	ModeEqual   = "equal"
+	ModeExact   = "exact"
+	ModePercent = "percent"
+	ModeShares  = "shares"
+)
+
+// ErrSumMismatch is returned when exact amounts or percentages do not add up
+var ErrSumMismatch = errors.New("split parts do not add up to the total")
+
+// Equal splits total into n parts that differ by at most one kopeck
+func Equal(total, n int) ([]int, error) {
+	weights := make([]int64, n)
+	for i := range weights {
+		weights[i] = 1
+	}
+	return Allocate(total, weights)
+}
+
+// Exact validates explicit amounts: none negative and summing exactly to total
+func Exact(total int, amounts []int) ([]int, error) {
+	if len(amounts) == 0 {
+		return nil, ErrNoWeights
+	}
+	sum := 0
+	for _, a := range amounts {
+		if a < 0 {
+			return nil, ErrInvalidWeight
+		}
+		sum += a
+	}
+	if sum != total {
+		return nil, fmt.Errorf("%w: amounts sum to %d, expected %d", ErrSumMismatch, sum, total)
+	}
+	return append([]int(nil), amounts...), nil
+}
+
+// Percent splits total by percentages with up to two decimals (e.g. 33.33) that must sum to 100
+func Percent(total int, percents []float64) ([]int, error) {
+	if len(percents) == 0 {
+		return nil, ErrNoWeights
+	}
+	basisPoints := make([]int64, len(percents))
+	var sum int64
+	for i, p := range percents {
+		bp := math.Round(p * 100)
+		if p < 0 || math.Abs(p*100-bp) > 1e-6 {
+			return nil, ErrInvalidWeight
+		}
+		basisPoints[i] = int64(bp)
+		sum += basisPoints[i]
+	}
+	if sum != 10000 {
+		return nil, fmt.Errorf("%w: percentages sum to %.2f, expected 100", ErrSumMismatch, float64(sum)/100)
+	}
+	return Allocate(total, basisPoints)
+}
+
+// Shares splits total proportionally to integer shares (e.g. 2:1:1)
+func Shares(total int, shares []int64) ([]int, error) {
+	return Allocate(total, shares)
+}
@@ -0,0 +1,69 @@
+package split
+
+import (
+	"errors"
+	"sort"
+)
+
+// ErrUnbalanced is returned when net balances do not sum to zero
+var ErrUnbalanced = errors.New("net balances do not sum to zero")
+
+// Transfer is one payment of a settle plan: From pays To
+type Transfer struct {
+	From        int64
+	To          int64
+	AmountCents int
+}
+
+// Settle returns transfers that clear the net balances (positive: is owed money, negative: owes money)
+// using the greedy min-cash-flow algorithm: the largest debtor repeatedly pays the largest creditor.
+// Every step clears at least one participant, so there are at most len(balances)-1 transfers.
+// Ties are broken by participant ID, so the plan is deterministic.
+func Settle(balances map[int64]int) ([]Transfer, error) {
+	type entry struct {
+		id      int64
+		balance int
+	}
+	var creditors, debtors []entry
+	total := 0
+	for id, balance := range balances {
+		total += balance
+		switch {
+		case balance > 0:
+			creditors = append(creditors, entry{id, balance})
+		case balance < 0:
+			debtors = append(debtors, entry{id, -balance})
+		}
+	}
+	if total != 0 {
+		return nil, ErrUnbalanced
+	}
+
+	largestFirst := func(entries []entry) {
+		sort.Slice(entries, func(a, b int) bool {
+			if entries[a].balance != entries[b].balance {
+				return entries[a].balance > entries[b].balance
+			}
+			return entries[a].id < entries[b].id
+		})
+	}
+
+	transfers := []Transfer{}
+	for len(creditors) > 0 && len(debtors) > 0 {
+		largestFirst(creditors)
+		largestFirst(debtors)
+
+		amount := min(creditors[0].balance, debtors[0].balance)
+		transfers = append(transfers, Transfer{From: debtors[0].id, To: creditors[0].id, AmountCents: amount})
+
+		creditors[0].balance -= amount
+		debtors[0].balance -= amount
+		if creditors[0].balance == 0 {
+			creditors = creditors[1:]
+		}
+		if debtors[0].balance == 0 {
+			debtors = debtors[1:]
+		}
+	}
+	return transfers, nil
+}
@@ -0,0 +1,168 @@
+package split
+
+import (
+	"errors"
+	"sort"
+)
+
+var (
+	// ErrNoWeights is returned when there is nobody to allocate an amount to
+	ErrNoWeights = errors.New("no participants to split between")
+	// ErrInvalidWeight is returned for negative weights or weights that sum to zero
+	ErrInvalidWeight = errors.New("weights must be non-negative and not all zero")
+	// ErrUnassignedItem is returned when a receipt item has no participants and no fallback is set
+	ErrUnassignedItem = errors.New("receipt item has no participants")
+)
+
+// Allocate splits total (in kopecks) proportionally to weights using the largest remainder method.
+// Every part is floor(total*weight/sum); the kopecks left over go one each to the parts with the
+// largest fractional remainders, ties broken by position. The parts always sum exactly to total.
+// A negative total (e.g. a discount) is allocated as its absolute value and negated.
+func Allocate(total int, weights []int64) ([]int, error) {
+	if len(weights) == 0 {
+		return nil, ErrNoWeights
+	}
+	var sum int64
+	for _, w := range weights {
+		if w < 0 {
+			return nil, ErrInvalidWeight
+		}
+		sum += w
+	}
+	if sum == 0 {
+		return nil, ErrInvalidWeight
+	}
+
+	sign := 1
+	if total < 0 {
+		sign, total = -1, -total
+	}
+
+	parts := make([]int, len(weights))
+	remainders := make([]int64, len(weights))
+	allocated := 0
+	for i, w := range weights {
+		product := int64(total) * w
+		parts[i] = int(product / sum)
+		remainders[i] = product % sum
+		allocated += parts[i]
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]] > remainders[order[b]]
+	})
+	for i := 0; i < total-allocated; i++ {
+		parts[order[i]]++
+	}
+
+	for i := range parts {
+		parts[i] *= sign
+	}
+	return parts, nil
+}
+
+// Item is a receipt line with the participants who consumed it.
+// Weights maps participant ID to their portion of the item: equal weights split it evenly,
+// weights like grams or pieces split it by amount consumed.
+type Item struct {
+	PriceCents int
+	Weights    map[int64]int64
+}
+
+// Share is the part of a receipt that falls on a single participant
+type Share struct {
+	Participant int64 `json:"participant"`
+	ItemsCents  int   `json:"items_cents"`
+	ExtraCents  int   `json:"extra_cents"`
+	AmountCents int   `json:"amount_cents"`
+}
+
+// Receipt splits receipt items between participants.
+// Extra is an amount on top of the items (tax not included in prices, tip, or a negative discount)
+// and is allocated proportionally to each participant's items subtotal.
+// Items without participants go to fallback; if fallback is 0 they are an error.
+// Shares are sorted by participant ID and sum exactly to the items total plus extra.
+func Receipt(items []Item, extra int, fallback int64) ([]Share, error) {
+	subtotals := map[int64]int{}
+	for _, item := range items {
+		participants := sortedParticipants(item.Weights)
+		if len(participants) == 0 {
+			if fallback == 0 {
+				return nil, ErrUnassignedItem
+			}
+			subtotals[fallback] += item.PriceCents
+			continue
+		}
+
+		weights := make([]int64, len(participants))
+		for i, p := range participants {
+			weights[i] = item.Weights[p]
+		}
+		parts, err := Allocate(item.PriceCents, weights)
+		if err != nil {
+			return nil, err
+		}
+		for i, p := range participants {
+			subtotals[p] += parts[i]
+		}
+	}
+
+	if len(subtotals) == 0 {
+		if fallback == 0 {
+			return nil, ErrNoWeights
+		}
+		subtotals[fallback] = 0
+	}
+
+	participants := make([]int64, 0, len(subtotals))
+	for p := range subtotals {
+		participants = append(participants, p)
+	}
+	sort.Slice(participants, func(i, j int) bool { return participants[i] < participants[j] })
+
+	extras := make([]int, len(participants))
+	if extra != 0 {
+		weights := make([]int64, len(participants))
+		var sum int64
+		for i, p := range participants {
+			weights[i] = int64(subtotals[p])
+			sum += weights[i]
+		}
+		if sum == 0 {
+			// Nothing was bought (all items free): spread the extra evenly
+			for i := range weights {
+				weights[i] = 1
+			}
+		}
+		var err error
+		if extras, err = Allocate(extra, weights); err != nil {
+			return nil, err
+		}
+	}
+
+	shares := make([]Share, len(participants))
+	for i, p := range participants {
+		shares[i] = Share{
+			Participant: p,
+			ItemsCents:  subtotals[p],
+			ExtraCents:  extras[i],
+			AmountCents: subtotals[p] + extras[i],
+		}
+	}
+	return shares, nil
+}
+
+func sortedParticipants(weights map[int64]int64) []int64 {
+	participants := make([]int64, 0, len(weights))
+	for p, w := range weights {
+		if w > 0 {
+			participants = append(participants, p)
+		}
+	}
+	sort.Slice(participants, func(i, j int) bool { return participants[i] < participants[j] })
+	return participants
+}
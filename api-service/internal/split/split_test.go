@@ -0,0 +1,200 @@
+package split
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func sum(parts []int) int {
+	total := 0
+	for _, p := range parts {
+		total += p
+	}
+	return total
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		total   int
+		weights []int64
+		want    []int
+	}{
+		{"even", 900, []int64{1, 1, 1}, []int{300, 300, 300}},
+		{"one kopeck over three", 100, []int64{1, 1, 1}, []int{34, 33, 33}},
+		{"two kopecks over three", 200, []int64{1, 1, 1}, []int{67, 67, 66}},
+		{"largest remainder wins", 100, []int64{1, 2, 4}, []int{14, 29, 57}},
+		{"single kopeck", 1, []int64{1, 1, 1, 1}, []int{1, 0, 0, 0}},
+		{"zero weight gets nothing", 1001, []int64{0, 1, 1}, []int{0, 501, 500}},
+		{"percent in basis points", 1000, []int64{3333, 3333, 3334}, []int{333, 333, 334}},
+		{"negative total", -100, []int64{1, 1, 1}, []int{-34, -33, -33}},
+		{"zero total", 0, []int64{1, 5}, []int{0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Allocate(tt.total, tt.weights)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Allocate(%d, %v) = %v, want %v", tt.total, tt.weights, got, tt.want)
+			}
+			if sum(got) != tt.total {
+				t.Errorf("parts sum to %d, want %d", sum(got), tt.total)
+			}
+		})
+	}
+}
+
+func TestAllocateErrors(t *testing.T) {
+	if _, err := Allocate(100, nil); err != ErrNoWeights {
+		t.Errorf("empty weights: err = %v", err)
+	}
+	if _, err := Allocate(100, []int64{0, 0}); err != ErrInvalidWeight {
+		t.Errorf("zero weights: err = %v", err)
+	}
+	if _, err := Allocate(100, []int64{2, -1}); err != ErrInvalidWeight {
+		t.Errorf("negative weight: err = %v", err)
+	}
+}
+
+func TestAllocateIsDeterministic(t *testing.T) {
+	first, _ := Allocate(1003, []int64{7, 7, 7, 7, 7, 7, 7})
+	for i := 0; i < 50; i++ {
+		again, _ := Allocate(1003, []int64{7, 7, 7, 7, 7, 7, 7})
+		if !reflect.DeepEqual(first, again) {
+			t.Fatalf("allocation changed between runs: %v vs %v", first, again)
+		}
+	}
+}
+
+func TestReceipt(t *testing.T) {
+	const alice, bob, carol = 101, 202, 303
+
+	items := []Item{
+		// Shared by three: 1 kopeck left over
+		{PriceCents: 1000, Weights: map[int64]int64{alice: 1, bob: 1, carol: 1}},
+		// Split by weight: alice ate 300 g, bob 200 g
+		{PriceCents: 899, Weights: map[int64]int64{alice: 300, bob: 200}},
+		// Nobody selected it: goes to the payer
+		{PriceCents: 4501},
+		// Bob alone
+		{PriceCents: 333, Weights: map[int64]int64{bob: 1}},
+	}
+
+	shares, err := Receipt(items, 100, carol)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Share{
+		{Participant: alice, ItemsCents: 334 + 539, ExtraCents: 13, AmountCents: 886},
+		{Participant: bob, ItemsCents: 333 + 360 + 333, ExtraCents: 15, AmountCents: 1041},
+		{Participant: carol, ItemsCents: 333 + 4501, ExtraCents: 72, AmountCents: 4906},
+	}
+	if !reflect.DeepEqual(shares, want) {
+		t.Errorf("shares = %+v\nwant   %+v", shares, want)
+	}
+
+	total := 0
+	for _, s := range shares {
+		total += s.AmountCents
+	}
+	if total != 1000+899+4501+333+100 {
+		t.Errorf("shares sum to %d", total)
+	}
+}
+
+func TestReceiptDiscount(t *testing.T) {
+	items := []Item{
+		{PriceCents: 100, Weights: map[int64]int64{1: 1, 2: 1, 3: 1}},
+		{PriceCents: 100, Weights: map[int64]int64{1: 1, 2: 1, 3: 1}},
+	}
+	shares, err := Receipt(items, -1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0
+	for _, s := range shares {
+		total += s.AmountCents
+	}
+	if total != 199 {
+		t.Errorf("shares sum to %d, want 199: %+v", total, shares)
+	}
+}
+
+func TestReceiptUnassigned(t *testing.T) {
+	if _, err := Receipt([]Item{{PriceCents: 100}}, 0, 0); err != ErrUnassignedItem {
+		t.Errorf("err = %v, want ErrUnassignedItem", err)
+	}
+}
+
+func TestModes(t *testing.T) {
+	if got, _ := Equal(1000, 3); !reflect.DeepEqual(got, []int{334, 333, 333}) {
+		t.Errorf("Equal = %v", got)
+	}
+
+	if got, err := Exact(1000, []int{600, 399, 1}); err != nil || sum(got) != 1000 {
+		t.Errorf("Exact = %v, %v", got, err)
+	}
+	if _, err := Exact(1000, []int{600, 399}); !errors.Is(err, ErrSumMismatch) {
+		t.Errorf("Exact mismatch err = %v", err)
+	}
+
+	if got, err := Percent(1001, []float64{33.33, 33.33, 33.34}); err != nil || !reflect.DeepEqual(got, []int{334, 333, 334}) {
+		t.Errorf("Percent = %v, %v", got, err)
+	}
+	if _, err := Percent(1000, []float64{50, 49.99}); !errors.Is(err, ErrSumMismatch) {
+		t.Errorf("Percent mismatch err = %v", err)
+	}
+	if _, err := Percent(1000, []float64{50.001, 49.999}); err != ErrInvalidWeight {
+		t.Errorf("Percent precision err = %v", err)
+	}
+
+	if got, err := Shares(1000, []int64{2, 1, 1}); err != nil || !reflect.DeepEqual(got, []int{500, 250, 250}) {
+		t.Errorf("Shares = %v, %v", got, err)
+	}
+}
+
+func TestSettle(t *testing.T) {
+	// A owes B 100, B owes C 100, C owes A 50: A -50, B 0, C +50
+	got, err := Settle(map[int64]int{1: -50, 2: 0, 3: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Transfer{{From: 1, To: 3, AmountCents: 50}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Settle = %+v, want %+v", got, want)
+	}
+
+	balances := map[int64]int{1: 700, 2: -400, 3: -200, 4: 300, 5: -400}
+	got, err = Settle(balances)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Transfer{
+		{From: 2, To: 1, AmountCents: 400},
+		{From: 5, To: 1, AmountCents: 300},
+		{From: 3, To: 4, AmountCents: 200},
+		{From: 5, To: 4, AmountCents: 100},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Settle = %+v\nwant   %+v", got, want)
+	}
+	for _, tr := range got {
+		balances[tr.From] += tr.AmountCents
+		balances[tr.To] -= tr.AmountCents
+	}
+	for id, balance := range balances {
+		if balance != 0 {
+			t.Errorf("participant %d left with %d", id, balance)
+		}
+	}
+
+	if got, _ := Settle(map[int64]int{1: 0}); len(got) != 0 {
+		t.Errorf("settled group got transfers: %+v", got)
+	}
+	if _, err := Settle(map[int64]int{1: 100, 2: -99}); err != ErrUnbalanced {
+		t.Errorf("unbalanced err = %v", err)
+	}
+}
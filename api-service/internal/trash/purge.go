@@ -0,0 +1,181 @@
+package trash
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/expense-tracker/api-service/internal/repository"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultRetention is how long soft-deleted transactions stay in the trash
+	DefaultRetention = 30 * 24 * time.Hour
+	// batchSize limits how many expenses one purge transaction removes
+	batchSize = 500
+)
+
+// ParseRetention parses TRASH_RETENTION_DAYS: empty means DefaultRetention, 0 keeps deleted transactions forever
+func ParseRetention(days string) (time.Duration, error) {
+	if days == "" {
+		return DefaultRetention, nil
+	}
+	n, err := strconv.Atoi(days)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid trash retention %q: want a number of days", days)
+	}
+	return time.Duration(n) * 24 * time.Hour, nil
+}
+
+// RetentionFromEnv returns the retention set by TRASH_RETENTION_DAYS, DefaultRetention if it is invalid
+func RetentionFromEnv() time.Duration {
+	retention, err := ParseRetention(os.Getenv("TRASH_RETENTION_DAYS"))
+	if err != nil {
+		log.Warn().Err(err).Msg("using default trash retention")
+		return DefaultRetention
+	}
+	return retention
+}
+
+// DB starts the transactions a purge runs in; *pgxpool.Pool is one
+type DB interface {
+	BeginTx(ctx context.Context, opts pgx.TxOptions) (pgx.Tx, error)
+}
+
+// Purger hard-deletes transactions that stayed in the trash longer than Retention
+type Purger struct {
+	DB        DB
+	Retention time.Duration // 0 disables the purge
+}
+
+// NewPurger creates a purger with the retention from the environment
+func NewPurger(db *pgxpool.Pool) *Purger {
+	return &Purger{DB: db, Retention: RetentionFromEnv()}
+}
+
+// Run purges expired transactions right away and then on every tick until ctx is done
+func (p *Purger) Run(ctx context.Context, every time.Duration) {
+	if p.Retention == 0 {
+		log.Info().Msg("trash retention disabled, deleted transactions are kept")
+		return
+	}
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		if purged, err := p.PurgeExpired(ctx, time.Now()); err != nil {
+			log.Error().Err(err).Msg("purge deleted transactions")
+		} else if purged > 0 {
+			log.Info().Int("purged", purged).Msg("purged deleted transactions")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeExpired hard-deletes the transactions deleted before now minus the retention and returns how many
+func (p *Purger) PurgeExpired(ctx context.Context, now time.Time) (int, error) {
+	cutoff := now.Add(-p.Retention)
+	total := 0
+	for {
+		n, err := purgeBatch(ctx, p.DB, `
+			SELECT id FROM expenses
+			WHERE deleted_at IS NOT NULL AND deleted_at < $1
+			ORDER BY id LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		`, cutoff, batchSize)
+		total += n
+		if err != nil || n < batchSize {
+			return total, err
+		}
+	}
+}
+
+// PurgeUser hard-deletes the deleted transactions of a user: the one with id, or all of them when id is nil.
+// It returns how many were removed; transactions that are not in the user's trash are left alone.
+// Purging one leg of a transfer purges the other leg too.
+func PurgeUser(ctx context.Context, db DB, userID int64, id *int) (int, error) {
+	if id != nil {
+		return purgeBatch(ctx, db, `
+			SELECT id FROM expenses
+			WHERE (id = $1 OR transfer_id = (SELECT transfer_id FROM expenses WHERE id = $1))
+				AND user_id = $2 AND deleted_at IS NOT NULL
+			FOR UPDATE
+		`, *id, userID)
+	}
+	total := 0
+	for {
+		n, err := purgeBatch(ctx, db, `
+			SELECT id FROM expenses
+			WHERE user_id = $1 AND deleted_at IS NOT NULL
+			ORDER BY id LIMIT $2
+			FOR UPDATE
+		`, userID, batchSize)
+		total += n
+		if err != nil || n < batchSize {
+			return total, err
+		}
+	}
+}
+
+// purgeBatch locks the expenses selected by query and removes them in one transaction.
+// Debts split from an expense or from its receipt go with it (their payments cascade),
+// and so do its receipts; history cascades too.
+func purgeBatch(ctx context.Context, db DB, query string, args ...interface{}) (int, error) {
+	tx, err := db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("select purged expenses: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return 0, fmt.Errorf("select purged expenses: %w", err)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	rows, err = tx.Query(ctx, `SELECT id FROM debts WHERE expense_id = ANY($1)
+		OR receipt_id IN (SELECT id FROM receipts WHERE expense_id = ANY($1))`, ids)
+	if err != nil {
+		return 0, fmt.Errorf("select purged debts: %w", err)
+	}
+	debtIDs, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return 0, fmt.Errorf("select purged debts: %w", err)
+	}
+	// Repayments already received stay as incomes, only their link to the debt is dropped
+	if err := repository.UnlinkDebts(ctx, tx, debtIDs); err != nil {
+		return 0, fmt.Errorf("unlink purged debt incomes: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM debts WHERE id = ANY($1)`, debtIDs); err != nil {
+		return 0, fmt.Errorf("delete purged debts: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM receipt_items WHERE receipt_id IN (SELECT id FROM receipts WHERE expense_id = ANY($1))`, ids); err != nil {
+		return 0, fmt.Errorf("delete purged receipt items: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM receipts WHERE expense_id = ANY($1)`, ids); err != nil {
+		return 0, fmt.Errorf("delete purged receipts: %w", err)
+	}
+	purged, err := repository.Delete(ctx, tx, ids)
+	if err != nil {
+		return 0, fmt.Errorf("delete purged expenses: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
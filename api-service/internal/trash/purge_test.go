@@ -0,0 +1,150 @@
+package trash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/expense-tracker/api-service/internal/dbtest"
+)
+
+func TestParseRetention(t *testing.T) {
+	tests := []struct {
+		days    string
+		want    time.Duration
+		wantErr bool
+	}{
+		{days: "", want: DefaultRetention},
+		{days: "0", want: 0},
+		{days: "7", want: 7 * 24 * time.Hour},
+		{days: "-1", wantErr: true},
+		{days: "30d", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRetention(tt.days)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseRetention(%q) = %v, %v", tt.days, got, err)
+		}
+	}
+}
+
+// purgeDB answers the select of a purge with the ids of batches, one batch per select, finds debt 9
+// split from them and deletes as many expenses as were selected
+func purgeDB(batches ...[]int) *dbtest.DB {
+	selected := 0
+	return dbtest.New(func(sql string, args []any) dbtest.Result {
+		switch {
+		case strings.Contains(sql, "FOR UPDATE"):
+			if len(batches) == 0 {
+				return dbtest.Result{}
+			}
+			var rows [][]any
+			for _, id := range batches[0] {
+				rows = append(rows, []any{id})
+			}
+			selected, batches = len(batches[0]), batches[1:]
+			return dbtest.Result{Rows: rows}
+		case strings.HasPrefix(strings.TrimSpace(sql), "SELECT id FROM debts"):
+			return dbtest.Result{Rows: [][]any{{9}}}
+		case strings.HasPrefix(strings.TrimSpace(sql), "DELETE FROM expenses"):
+			return dbtest.Result{Tag: fmt.Sprintf("DELETE %d", selected)}
+		}
+		return dbtest.Result{}
+	})
+}
+
+func TestPurgeBatchUnlinksBeforeDelete(t *testing.T) {
+	db := purgeDB([]int{3, 5})
+	n, err := purgeBatch(context.Background(), db, "SELECT id FROM expenses WHERE deleted_at IS NOT NULL FOR UPDATE")
+	if err != nil || n != 2 {
+		t.Fatalf("purgeBatch() = %d, %v, want 2", n, err)
+	}
+	if !db.Committed {
+		t.Error("purge not committed")
+	}
+
+	// Every row referencing the purged expenses is unlinked or removed before them
+	purged, debts := []any{[]int{3, 5}}, []any{[]int{9}}
+	steps := []struct {
+		fragments []string
+		args      []any
+	}{
+		{[]string{"SELECT id FROM debts", "expense_id = ANY($1)", "receipt_id IN"}, purged},
+		{[]string{"SET related_debt_id = NULL"}, debts},
+		{[]string{"DELETE FROM debts"}, debts},
+		{[]string{"DELETE FROM receipt_items"}, purged},
+		{[]string{"DELETE FROM receipts"}, purged},
+		{[]string{"DELETE FROM expenses WHERE id = ANY($1)"}, purged},
+	}
+	last := -1
+	for _, step := range steps {
+		i := db.Index(step.fragments...)
+		if i < 0 {
+			t.Fatalf("statement %q did not run: %+v", step.fragments, db.Statements)
+		}
+		if i < last {
+			t.Errorf("statement %q ran out of order", step.fragments)
+		}
+		if got := db.Statements[i].Args; !reflect.DeepEqual(got, step.args) {
+			t.Errorf("statement %q args = %v, want %v", step.fragments, got, step.args)
+		}
+		last = i
+	}
+}
+
+func TestPurgeBatchRollsBackOnError(t *testing.T) {
+	failed := errors.New("receipts locked")
+	db := purgeDB([]int{3})
+	handler := db.Handler
+	db.Handler = func(sql string, args []any) dbtest.Result {
+		if strings.Contains(sql, "DELETE FROM receipts") {
+			return dbtest.Result{Err: failed}
+		}
+		return handler(sql, args)
+	}
+
+	if _, err := purgeBatch(context.Background(), db, "SELECT id FROM expenses FOR UPDATE"); !errors.Is(err, failed) {
+		t.Fatalf("purgeBatch() error = %v, want %v", err, failed)
+	}
+	if _, ok := db.Ran("DELETE FROM expenses WHERE"); ok || db.Committed {
+		t.Errorf("expenses deleted after a failed step: %+v", db.Statements)
+	}
+}
+
+func TestPurgeExpiredSkipsLocked(t *testing.T) {
+	now := time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+
+	// All expired rows are locked by another transaction, e.g. one restoring them
+	db := purgeDB()
+	p := &Purger{DB: db, Retention: 7 * 24 * time.Hour}
+	n, err := p.PurgeExpired(context.Background(), now)
+	if err != nil || n != 0 {
+		t.Fatalf("PurgeExpired() = %d, %v, want 0", n, err)
+	}
+	s, ok := db.Ran("FOR UPDATE SKIP LOCKED")
+	if !ok {
+		t.Fatalf("select does not skip locked rows: %+v", db.Statements)
+	}
+	if cutoff := s.Args[0].(time.Time); !cutoff.Equal(now.Add(-7 * 24 * time.Hour)) {
+		t.Errorf("cutoff = %v", cutoff)
+	}
+	if _, ok := db.Ran("DELETE"); ok || db.Committed {
+		t.Errorf("statements ran without purged rows: %+v", db.Statements)
+	}
+}
+
+func TestPurgeExpiredBatches(t *testing.T) {
+	full := make([]int, batchSize)
+	for i := range full {
+		full[i] = i + 1
+	}
+	db := purgeDB(full, []int{batchSize + 1, batchSize + 2})
+	n, err := (&Purger{DB: db, Retention: DefaultRetention}).PurgeExpired(context.Background(), time.Now())
+	if err != nil || n != batchSize+2 {
+		t.Fatalf("PurgeExpired() = %d, %v, want %d", n, err, batchSize+2)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// currencySymbols are shown after amounts; other currencies are shown by their code
+var currencySymbols = map[string]string{"RUB": "руб.", "USD": "$", "EUR": "€", "GEL": "₾"}
+
+// currencyAliases are the ways a currency can be written after an amount: "100 eur кафе", "20 $ такси"
+var currencyAliases = map[string]string{
+	"rub": "RUB", "руб": "RUB", "руб.": "RUB", "₽": "RUB",
+	"usd": "USD", "$": "USD", "долл": "USD", "доллар": "USD", "долларов": "USD",
+	"eur": "EUR", "€": "EUR", "евро": "EUR",
+	"gel": "GEL", "₾": "GEL", "лари": "GEL",
+}
+
+// formatMoney formats minor units of a currency: 1250.50 руб., 12.00 €
+func formatMoney(cents int, currency string) string {
+	symbol, ok := currencySymbols[currency]
+	if !ok {
+		symbol = currency
+	}
+	return fmt.Sprintf("%.2f %s", float64(cents)/100.0, symbol)
+}
+
+// splitCurrency returns the currency written at the start of an expense description and the rest of it;
+// the currency is empty when the description does not start with one (the user's base currency is used)
+func splitCurrency(description string) (string, string) {
+	word, rest, _ := strings.Cut(strings.TrimSpace(description), " ")
+	if code, ok := currencyAliases[strings.ToLower(word)]; ok {
+		return code, strings.TrimSpace(rest)
+	}
+	return "", description
+}
+
+// setBaseCurrency changes the currency totals and reports are shown in: /currency EUR
+func setBaseCurrency(botToken, apiURL, botKey string, fromID int64, chatID int64, arg string) {
+	code := strings.ToUpper(strings.TrimSpace(arg))
+	if alias, ok := currencyAliases[strings.ToLower(code)]; ok {
+		code = alias
+	}
+	if code == "" {
+		sendMessage(botToken, chatID, "Используйте: /currency EUR — валюта, в которой показываются итоги (RUB, USD, EUR, GEL)")
+		return
+	}
+
+	var result struct {
+		BaseCurrency string `json:"base_currency"`
+	}
+	status, err := callInternal(apiURL, botKey, "/internal/users/currency", map[string]interface{}{
+		"telegram_id": fromID,
+		"currency":    code,
+	}, &result)
+	switch {
+	case err != nil:
+		sendMessage(botToken, chatID, "❌ Ошибка связи с сервером")
+	case status == http.StatusNotFound:
+		sendMessage(botToken, chatID, "❌ Сначала запишите хотя бы один расход")
+	case status == http.StatusBadRequest:
+		sendMessage(botToken, chatID, fmt.Sprintf("❌ Нет курсов для валюты %s", code))
+	case status != http.StatusOK:
+		sendMessage(botToken, chatID, "❌ Ошибка сервера")
+	default:
+		sendMessage(botToken, chatID, fmt.Sprintf("✅ Итоги теперь в %s", result.BaseCurrency))
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// forecastValue is an amount so far in the period and its projection with an 80% band
+type forecastValue struct {
+	Actual    float64 `json:"actual"`
+	Projected float64 `json:"projected"`
+	Low       float64 `json:"low"`
+	High      float64 `json:"high"`
+}
+
+// forecastTopCategories is how many categories the /forecast message lists
+const forecastTopCategories = 5
+
+// getForecast shows where the month (or the week) is heading: /forecast, /forecast week.
+// In a group chat the forecast covers the group.
+func getForecast(botToken, apiURL, botKey string, fromID int64, chatID int64, period string) {
+	var forecast struct {
+		DaysElapsed   int           `json:"days_elapsed"`
+		DaysRemaining int           `json:"days_remaining"`
+		Currency      string        `json:"currency"`
+		Expenses      forecastValue `json:"expenses"`
+		Incomes       forecastValue `json:"incomes"`
+		Categories    []struct {
+			Category string `json:"category"`
+			forecastValue
+		} `json:"categories"`
+		Recurring []struct {
+			Type   string  `json:"type"`
+			Amount float64 `json:"amount"`
+		} `json:"recurring"`
+		Balance *forecastValue `json:"balance"`
+		Runway  *struct {
+			Days int       `json:"days"`
+			Date time.Time `json:"date"`
+		} `json:"runway"`
+	}
+	path := "/internal/analytics/forecast?period=" + period + "&telegram_id=" + strconv.FormatInt(fromID, 10)
+	if chatID < 0 {
+		path += "&scope=group&group_id=" + strconv.FormatInt(chatID, 10)
+	}
+	status, err := callInternal(apiURL, botKey, path, nil, &forecast)
+	if err != nil {
+		sendMessage(botToken, chatID, "❌ Не удалось получить прогноз. Проверьте, что analytics-service запущен.")
+		return
+	}
+	if status != http.StatusOK {
+		sendMessage(botToken, chatID, fmt.Sprintf("❌ Ошибка получения прогноза (код %d)", status))
+		return
+	}
+
+	money := func(v float64) string { return formatMoney(int(math.Round(v*100)), forecast.Currency) }
+	band := func(v forecastValue) string {
+		if v.Low == v.High {
+			return ""
+		}
+		return fmt.Sprintf(" (от %s до %s)", money(v.Low), money(v.High))
+	}
+
+	periodName := "месяца"
+	if period == "week" {
+		periodName = "недели"
+	}
+	var message strings.Builder
+	message.WriteString(fmt.Sprintf("🔮 Прогноз на конец %s (прошло %d из %d дн.)\n\n", periodName,
+		forecast.DaysElapsed, forecast.DaysElapsed+forecast.DaysRemaining))
+	message.WriteString(fmt.Sprintf("💸 Расходы: %s сейчас, к концу ~%s%s\n", money(forecast.Expenses.Actual),
+		money(forecast.Expenses.Projected), band(forecast.Expenses)))
+	if forecast.Incomes.Projected > 0 {
+		message.WriteString(fmt.Sprintf("💰 Доходы: %s сейчас, к концу %s\n", money(forecast.Incomes.Actual), money(forecast.Incomes.Projected)))
+	}
+
+	if len(forecast.Categories) > 0 {
+		message.WriteString("\nПо категориям:\n")
+		for i, c := range forecast.Categories {
+			if i == forecastTopCategories {
+				break
+			}
+			message.WriteString(fmt.Sprintf("• %s: ~%s%s\n", c.Category, money(c.Projected), band(c.forecastValue)))
+		}
+	}
+
+	due := 0.0
+	for _, r := range forecast.Recurring {
+		if r.Type == "expense" {
+			due += r.Amount
+		}
+	}
+	if due > 0 {
+		message.WriteString(fmt.Sprintf("\n🔁 Ещё спишется регулярных платежей: %s\n", money(due)))
+	}
+
+	if b := forecast.Balance; b != nil {
+		message.WriteString(fmt.Sprintf("\n🏦 Баланс счетов: %s, к концу ~%s\n", money(b.Actual), money(b.Projected)))
+		if forecast.Runway != nil {
+			message.WriteString(fmt.Sprintf("⏳ При таком темпе денег хватит на %d дн. (до %s)", forecast.Runway.Days,
+				forecast.Runway.Date.Format("02.01.2006")))
+		} else {
+			message.WriteString("✅ Баланс не уменьшается")
+		}
+	}
+
+	sendPlainMessage(botToken, chatID, strings.TrimSpace(message.String()))
+}
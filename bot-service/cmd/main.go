@@ -5,12 +5,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"net/url"
 	"os"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 func envOr(key, def string) string {
@@ -23,10 +26,12 @@ func envOr(key, def string) string {
 
 // createHS256Token manually creates a simple JWT with numeric sub claim
 func postExpense(apiURL string, botKey string, telegramID int64, username string, amount float64) (int, error) {
-	return postExpenseWithCategory(apiURL, botKey, telegramID, username, amount, nil, nil)
+	status, _, err := postExpenseWithCategory(apiURL, botKey, telegramID, username, amount, "", "", "", nil, nil)
+	return status, err
 }
 
-func postExpenseWithCategory(apiURL string, botKey string, telegramID int64, username string, amount float64, categoryID *int, groupID *int64) (int, error) {
+// postExpenseWithCategory records an expense and returns the response status and the currency it was recorded in
+func postExpenseWithCategory(apiURL string, botKey string, telegramID int64, username string, amount float64, currency, description, merchant string, categoryID *int, groupID *int64) (int, string, error) {
 	// Convert amount to cents (multiply by 100 and round)
 	amountCents := int(amount * 100)
 	payload := map[string]interface{}{
@@ -35,6 +40,17 @@ func postExpenseWithCategory(apiURL string, botKey string, telegramID int64, use
 		"amount_cents": amountCents,
 		"timestamp":    time.Now().UTC().Format(time.RFC3339),
 	}
+	if currency != "" {
+		// Without it the expense is in the user's base currency
+		payload["currency"] = currency
+	}
+	if description != "" {
+		// Stored with the expense; without a merchant the API looks for a known one in it
+		payload["description"] = description
+	}
+	if merchant != "" {
+		payload["merchant"] = merchant
+	}
 	if categoryID != nil {
 		payload["category_id"] = *categoryID
 	}
@@ -52,17 +68,25 @@ func postExpenseWithCategory(apiURL string, botKey string, telegramID int64, use
 	resp, err := client.Do(req)
 	if err != nil {
 		fmt.Printf("❌ [ERROR] Failed to post expense for user %d: %v\n", telegramID, err)
-		return 0, err
+		return 0, "", err
 	}
 	defer resp.Body.Close()
-	io.Copy(io.Discard, resp.Body)
 
 	if resp.StatusCode != http.StatusCreated {
+		io.Copy(io.Discard, resp.Body)
 		fmt.Printf("⚠️ [WARN] Unexpected status code %d when posting expense for user %d\n", resp.StatusCode, telegramID)
-	} else {
-		fmt.Printf("✅ [INFO] Successfully posted expense: user=%d, amount=%.2f, group=%v\n", telegramID, amount, groupID != nil)
+		return resp.StatusCode, "", nil
+	}
+	// Without a currency in the request the expense is in the user's base currency, the response tells which
+	var created struct {
+		Currency string `json:"currency"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+	if created.Currency == "" {
+		created.Currency = currency
 	}
-	return resp.StatusCode, nil
+	fmt.Printf("✅ [INFO] Successfully posted expense: user=%d, amount=%.2f %s, group=%v\n", telegramID, amount, created.Currency, groupID != nil)
+	return resp.StatusCode, created.Currency, nil
 }
 
 func detectCategory(apiURL, description string) *int {
@@ -106,6 +130,7 @@ func main() {
 		os.Exit(2)
 	}
 	apiURL := envOr("API_URL", "http://api:8080")
+	ocrURL := envOr("OCR_URL", "http://ocr:8090")
 	botKey := os.Getenv("BOT_API_KEY")
 	if botKey == "" {
 		fmt.Println("WARNING: BOT_API_KEY not set; internal endpoint may reject requests")
@@ -113,6 +138,7 @@ func main() {
 
 	fmt.Printf("Bot service starting...\n")
 	fmt.Printf("API URL: %s\n", apiURL)
+	fmt.Printf("OCR URL: %s\n", ocrURL)
 	fmt.Printf("Bot Token: %s...%s\n", botToken[:10], botToken[len(botToken)-10:])
 
 	// poll getUpdates
@@ -153,31 +179,21 @@ func main() {
 					offset = int(uid) + 1
 				}
 			}
+
+			// handle inline keyboard taps
+			if cq, ok := item["callback_query"].(map[string]interface{}); ok {
+				handleCallbackQuery(botToken, apiURL, botKey, cq)
+				continue
+			}
+
 			msg, ok := item["message"].(map[string]interface{})
 			if !ok {
 				continue
 			}
 
 			// get user info
-			var fromID int64
-			username := ""
-			if from, ok := msg["from"].(map[string]interface{}); ok {
-				if idf, ok := from["id"].(float64); ok {
-					fromID = int64(idf)
-				}
-				if u, ok := from["username"].(string); ok {
-					username = u
-				} else {
-					// fallback to first_name + last_name
-					fn, _ := from["first_name"].(string)
-					ln, _ := from["last_name"].(string)
-					if fn != "" && ln != "" {
-						username = fn + " " + ln
-					} else {
-						username = fn + ln
-					}
-				}
-			}
+			from, _ := msg["from"].(map[string]interface{})
+			fromID, username := senderInfo(from)
 
 			chatID := int64(0)
 			chatType := ""
@@ -202,10 +218,66 @@ func main() {
 
 			// handle photo messages
 			if photos, ok := msg["photo"].([]interface{}); ok && len(photos) > 0 {
-				handlePhotoMessage(botToken, apiURL, botKey, fromID, username, chatID, photos)
+				if chatType == "group" || chatType == "supergroup" {
+					registerGroup(apiURL, botKey, chatID, chatTitle, chatType)
+					registerGroupMember(apiURL, botKey, chatID, fromID, username)
+				}
+				handlePhotoMessage(botToken, apiURL, ocrURL, botKey, fromID, username, chatID, chatType, photos)
+			}
+		}
+	}
+}
+
+// senderInfo extracts the Telegram ID and display name from a "from" object
+func senderInfo(from map[string]interface{}) (int64, string) {
+	var fromID int64
+	username := ""
+	if from == nil {
+		return fromID, username
+	}
+	if idf, ok := from["id"].(float64); ok {
+		fromID = int64(idf)
+	}
+	if u, ok := from["username"].(string); ok {
+		username = u
+	} else {
+		// fallback to first_name + last_name
+		fn, _ := from["first_name"].(string)
+		ln, _ := from["last_name"].(string)
+		if fn != "" && ln != "" {
+			username = fn + " " + ln
+		} else {
+			username = fn + ln
+		}
+	}
+	return fromID, username
+}
+
+// handleCallbackQuery routes inline keyboard taps
+func handleCallbackQuery(botToken, apiURL, botKey string, cq map[string]interface{}) {
+	callbackID, _ := cq["id"].(string)
+	data, _ := cq["data"].(string)
+	from, _ := cq["from"].(map[string]interface{})
+	fromID, username := senderInfo(from)
+
+	var chatID, messageID int64
+	if msg, ok := cq["message"].(map[string]interface{}); ok {
+		if mid, ok := msg["message_id"].(float64); ok {
+			messageID = int64(mid)
+		}
+		if chat, ok := msg["chat"].(map[string]interface{}); ok {
+			if cid, ok := chat["id"].(float64); ok {
+				chatID = int64(cid)
 			}
 		}
 	}
+
+	switch {
+	case strings.HasPrefix(data, receiptCallbackPrefix):
+		handleReceiptCallback(botToken, apiURL, botKey, callbackID, fromID, username, chatID, messageID, data)
+	default:
+		answerCallback(botToken, callbackID, "")
+	}
 }
 
 func handleTextMessage(botToken, apiURL, botKey string, fromID int64, username string, chatID int64, chatType string, chatTitle string, text string, re *regexp.Regexp) {
@@ -222,7 +294,7 @@ func handleTextMessage(botToken, apiURL, botKey string, fromID int64, username s
 
 	// handle commands
 	if strings.HasPrefix(text, "/") {
-		handleCommand(botToken, apiURL, botKey, fromID, username, chatID, text)
+		handleCommand(botToken, apiURL, botKey, fromID, username, chatID, isGroup, text)
 		return
 	}
 
@@ -230,12 +302,12 @@ func handleTextMessage(botToken, apiURL, botKey string, fromID int64, username s
 	// Format: "split 100 продукты @username1 @username2"
 	sharedRegex := regexp.MustCompile(`^split\s+([0-9]+(?:[.,][0-9]{1,2})?)\s+(.*)$`)
 	if sharedRegex.MatchString(text) {
-		handleSharedExpense(botToken, apiURL, botKey, fromID, username, chatID, text, sharedRegex)
+		handleSharedExpense(botToken, apiURL, botKey, fromID, username, chatID, chatType, text, sharedRegex)
 		return
 	}
 
-	// handle expense amounts with optional category
-	// Format: "100 продукты" or "50.50 кафе"
+	// handle expense amounts with optional currency and category
+	// Format: "100 продукты", "50.50 кафе" or "20 eur кафе"
 	expenseRegex := regexp.MustCompile(`^\s*([0-9]+(?:[.,][0-9]{1,2})?)\s*(.*)$`)
 	if !expenseRegex.MatchString(text) {
 		sendMessage(botToken, chatID, "Отправьте сумму расхода (например: 100 или 50.50 продукты) или используйте команды /help")
@@ -253,12 +325,12 @@ func handleTextMessage(botToken, apiURL, botKey string, fromID int64, username s
 		numStr = numStr[:idx] + "." + numStr[idx+1:]
 	}
 	amount, _ := strconv.ParseFloat(numStr, 64)
-	description := strings.TrimSpace(m[2])
+	currency, description := splitCurrency(strings.TrimSpace(m[2]))
 
 	// Try to detect category from description
 	categoryID := detectCategory(apiURL, description)
 
-	status, err := postExpenseWithCategory(apiURL, botKey, fromID, username, amount, categoryID, groupID)
+	status, recorded, err := postExpenseWithCategory(apiURL, botKey, fromID, username, amount, currency, description, "", categoryID, groupID)
 
 	// send a reply via sendMessage
 	var replyText string
@@ -269,14 +341,20 @@ func handleTextMessage(botToken, apiURL, botKey string, fromID int64, username s
 		if categoryID != nil {
 			categoryText = fmt.Sprintf(" (категория: %d)", *categoryID)
 		}
-		replyText = fmt.Sprintf("✅ Записал расход: %s руб.%s", m[1], categoryText)
+		amountText := m[1]
+		if recorded != "" {
+			amountText = formatMoney(int(amount*100), recorded)
+		}
+		replyText = fmt.Sprintf("✅ Записал расход: %s%s", amountText, categoryText)
+	} else if status == http.StatusBadRequest && currency != "" {
+		replyText = fmt.Sprintf("❌ Нет курсов для валюты %s", currency)
 	} else {
 		replyText = fmt.Sprintf("❌ Не удалось записать %s (ошибка %d)", m[1], status)
 	}
 	sendMessage(botToken, chatID, replyText)
 }
 
-func handleCommand(botToken, apiURL, botKey string, fromID int64, username string, chatID int64, command string) {
+func handleCommand(botToken, apiURL, botKey string, fromID int64, username string, chatID int64, isGroup bool, command string) {
 	// Normalize command (trim and lowercase for comparison)
 	cmd := strings.TrimSpace(strings.ToLower(command))
 
@@ -289,16 +367,26 @@ func handleCommand(botToken, apiURL, botKey string, fromID int64, username strin
 			"/total week - расходы за неделю\n" +
 			"/total month - расходы за месяц\n" +
 			"/debts - показать долги\n" +
+			"/paid @username [сумма] - отметить, что @username вернул вам долг\n" +
+			"/settle - кто кому сколько перевести, чтобы закрыть долги группы\n" +
+			"/recurring - регулярные платежи и доходы на ближайший месяц\n" +
+			"/forecast - прогноз расходов и баланса на конец месяца (/forecast week - недели)\n" +
+			"/export month - выгрузить операции за месяц файлом (week, all; csv, json)\n" +
+			"/find аптека - найти операции по описанию, магазину или категории\n" +
+			"/currency EUR - валюта, в которой показываются итоги\n" +
 			"/summary - AI саммари расходов за сегодня\n" +
 			"/summary week - AI саммари за неделю\n" +
 			"/summary month - AI саммари за месяц\n\n" +
 			"*💰 Как записать расход:*\n" +
 			"• Просто сумма: 100 или 50.50\n" +
 			"• С категорией: 100 продукты или 50.50 кафе\n" +
-			"• Shared расход: split 300 кафе @username1 @username2\n\n" +
+			"• В другой валюте: 20 eur кафе или 15 $ такси\n" +
+			"• Shared расход поровну: split 300 кафе @username1 @username2\n" +
+			"• Shared расход с суммами: split 300 кафе @username1:100 @username2:150\n\n" +
 			"*📸 Фото чеков:*\n" +
 			"• Отправьте фото чека для автоматического распознавания\n" +
-			"• (Функция в разработке)\n\n" +
+			"• Каждый отмечает кнопками позиции, которые брал\n" +
+			"• Автор чека нажимает «Готово» — расход и долги создаются автоматически\n\n" +
 			"*🏷️ Доступные категории:*\n" +
 			"• Продукты (еда, магазин, супермаркет)\n" +
 			"• Транспорт (бензин, такси, метро)\n" +
@@ -311,10 +399,12 @@ func handleCommand(botToken, apiURL, botKey string, fromID int64, username strin
 			"*💡 Примеры:*\n" +
 			"• 100 -> Записал расход: 100 руб.\n" +
 			"• 100 продукты -> Записал расход: 100 руб. (категория: Продукты)\n" +
-			"• split 300 кафе @wife @friend -> Создан shared расход на 3 человек\n" +
+			"• split 300 кафе @wife @friend -> Общий расход на 3 человек, каждый должен 100 руб.\n" +
+			"• split 300 кафе @wife:200 -> долг @wife 200 руб., ваша доля 100 руб.\n" +
 			"• /total -> Показать все расходы\n" +
-			"• /debts -> Показать долги\n\n" +
-			"Все суммы в рублях! 💸"
+			"• /debts -> Показать долги\n" +
+			"• /paid @wife 500 -> @wife вернула вам 500 руб., без суммы — весь долг\n\n" +
+			"Без валюты суммы записываются в вашей основной валюте (по умолчанию рубли), долги ведутся в рублях 💸"
 
 		sendMessage(botToken, chatID, helpText)
 
@@ -330,6 +420,34 @@ func handleCommand(botToken, apiURL, botKey string, fromID int64, username strin
 	case cmd == "/debts":
 		getDebts(botToken, apiURL, botKey, fromID, chatID)
 
+	case cmd == "/paid" || strings.HasPrefix(cmd, "/paid "):
+		handlePaidCommand(botToken, apiURL, botKey, fromID, chatID, strings.TrimSpace(command))
+
+	case cmd == "/recurring":
+		getUpcomingRecurring(botToken, apiURL, botKey, fromID, chatID)
+
+	case cmd == "/forecast":
+		getForecast(botToken, apiURL, botKey, fromID, chatID, "month")
+
+	case cmd == "/forecast week":
+		getForecast(botToken, apiURL, botKey, fromID, chatID, "week")
+
+	case cmd == "/export" || strings.HasPrefix(cmd, "/export "):
+		exportTransactions(botToken, apiURL, botKey, fromID, chatID, isGroup, strings.Fields(cmd)[1:])
+
+	case cmd == "/find" || strings.HasPrefix(cmd, "/find "):
+		findTransactions(botToken, apiURL, botKey, fromID, chatID, isGroup, strings.TrimSpace(strings.TrimSpace(command)[len("/find"):]))
+
+	case cmd == "/currency" || strings.HasPrefix(cmd, "/currency "):
+		setBaseCurrency(botToken, apiURL, botKey, fromID, chatID, strings.TrimSpace(cmd[len("/currency"):]))
+
+	case cmd == "/settle":
+		if !isGroup {
+			sendMessage(botToken, chatID, "👥 Команда /settle работает в семейной группе")
+			return
+		}
+		getSettlePlan(botToken, apiURL, botKey, fromID, chatID)
+
 	case cmd == "/summary":
 		getSummary(botToken, apiURL, botKey, fromID, chatID, "day")
 
@@ -373,7 +491,14 @@ func getTotalExpenses(botToken, apiURL, botKey string, fromID int64, chatID int6
 		return
 	}
 
-	totalRubles := data["total_rubles"].(float64)
+	total, ok := data["total"].(float64)
+	if !ok {
+		total, _ = data["total_rubles"].(float64)
+	}
+	currency, _ := data["currency"].(string)
+	if currency == "" {
+		currency = "RUB"
+	}
 	periodText := "всего"
 	if period == "week" {
 		periodText = "за неделю"
@@ -381,7 +506,7 @@ func getTotalExpenses(botToken, apiURL, botKey string, fromID int64, chatID int6
 		periodText = "за месяц"
 	}
 
-	sendMessage(botToken, chatID, fmt.Sprintf("📊 Расходы %s: %.2f руб.", periodText, totalRubles))
+	sendMessage(botToken, chatID, fmt.Sprintf("📊 Расходы %s: %s", periodText, formatMoney(int(math.Round(total*100)), currency)))
 }
 
 func getDebts(botToken, apiURL, botKey string, fromID int64, chatID int64) {
@@ -453,7 +578,350 @@ func getDebts(botToken, apiURL, botKey string, fromID int64, chatID int64) {
 	sendMessage(botToken, chatID, message.String())
 }
 
-func handleSharedExpense(botToken, apiURL, botKey string, fromID int64, username string, chatID int64, text string, regex *regexp.Regexp) {
+// getUpcomingRecurring lists recurring charges and incomes due in the next 30 days
+func getUpcomingRecurring(botToken, apiURL, botKey string, fromID int64, chatID int64) {
+	var charges []struct {
+		Date          string `json:"date"`
+		AmountCents   int    `json:"amount_cents"`
+		Currency      string `json:"currency"`
+		OperationType string `json:"operation_type"`
+		Description   string `json:"description"`
+		CategoryName  string `json:"category_name"`
+	}
+	status, err := callInternal(apiURL, botKey, "/internal/recurring/upcoming?days=30&telegram_id="+strconv.FormatInt(fromID, 10), nil, &charges)
+	if err != nil {
+		sendMessage(botToken, chatID, "❌ Ошибка получения данных")
+		return
+	}
+	if status != http.StatusOK {
+		sendMessage(botToken, chatID, "❌ Ошибка сервера")
+		return
+	}
+
+	if len(charges) == 0 {
+		sendMessage(botToken, chatID, "🔁 В ближайшие 30 дней регулярных платежей нет")
+		return
+	}
+
+	var message strings.Builder
+	message.WriteString("🔁 Регулярные платежи на 30 дней:\n\n")
+	// Totals per currency, in the order the currencies first appear
+	var currencies []string
+	expensesCents, incomesCents := map[string]int{}, map[string]int{}
+	for _, c := range charges {
+		if _, ok := expensesCents[c.Currency]; !ok {
+			currencies = append(currencies, c.Currency)
+			expensesCents[c.Currency] = 0
+		}
+		date := c.Date
+		if t, err := time.Parse("2006-01-02", c.Date); err == nil {
+			date = t.Format("02.01")
+		}
+		title := c.Description
+		if title == "" {
+			title = c.CategoryName
+		}
+		if title == "" {
+			title = "Без описания"
+		}
+		emoji := "💸"
+		if c.OperationType == "income" {
+			emoji = "💰"
+			incomesCents[c.Currency] += c.AmountCents
+		} else {
+			expensesCents[c.Currency] += c.AmountCents
+		}
+		message.WriteString(fmt.Sprintf("%s %s — %s: %s\n", emoji, date, title, formatMoney(c.AmountCents, c.Currency)))
+	}
+
+	total := func(cents map[string]int) string {
+		var parts []string
+		for _, code := range currencies {
+			if cents[code] > 0 {
+				parts = append(parts, formatMoney(cents[code], code))
+			}
+		}
+		return strings.Join(parts, " + ")
+	}
+	if spent := total(expensesCents); spent != "" {
+		message.WriteString("\nСписаний: " + spent)
+	}
+	if received := total(incomesCents); received != "" {
+		message.WriteString("\nПоступлений: " + received)
+	}
+	sendPlainMessage(botToken, chatID, message.String())
+}
+
+// moscowTime shows dates as the API counts periods
+var moscowTime = time.FixedZone("MSK", 3*60*60)
+
+// findTransactions searches the user's transactions: /find аптека.
+// In a group chat the results go to the private chat, they contain personal operations.
+func findTransactions(botToken, apiURL, botKey string, fromID int64, chatID int64, isGroup bool, query string) {
+	if utf8.RuneCountInString(query) < 2 {
+		sendMessage(botToken, chatID, "Используйте: /find аптека — поиск по описанию, магазину, категории")
+		return
+	}
+
+	var found struct {
+		Results []struct {
+			AmountCents   int    `json:"amount_cents"`
+			Currency      string `json:"currency"`
+			OperationType string `json:"operation_type"`
+			Timestamp     string `json:"timestamp"`
+			CategoryName  string `json:"category_name"`
+			Description   string `json:"description"`
+			Merchant      string `json:"merchant"`
+			Username      string `json:"username"`
+		} `json:"results"`
+		Pagination struct {
+			HasMore bool `json:"has_more"`
+		} `json:"pagination"`
+	}
+	path := fmt.Sprintf("/internal/transactions/search?telegram_id=%d&limit=10&q=%s", fromID, url.QueryEscape(query))
+	status, err := callInternal(apiURL, botKey, path, nil, &found)
+	if err != nil {
+		sendMessage(botToken, chatID, "❌ Ошибка получения данных")
+		return
+	}
+	if status == http.StatusNotFound {
+		sendMessage(botToken, chatID, "❌ Сначала запишите хотя бы один расход")
+		return
+	}
+	if status != http.StatusOK {
+		sendMessage(botToken, chatID, "❌ Ошибка сервера")
+		return
+	}
+
+	var message strings.Builder
+	if len(found.Results) == 0 {
+		message.WriteString(fmt.Sprintf("🔎 По запросу «%s» ничего не найдено", query))
+	} else {
+		message.WriteString(fmt.Sprintf("🔎 Найдено по запросу «%s»:\n\n", query))
+	}
+	for _, t := range found.Results {
+		date := t.Timestamp
+		if ts, err := time.Parse(time.RFC3339, t.Timestamp); err == nil {
+			date = ts.In(moscowTime).Format("02.01.2006")
+		}
+		title := t.Description
+		if t.Merchant != "" && !strings.Contains(strings.ToLower(title), strings.ToLower(t.Merchant)) {
+			title = strings.TrimSuffix(t.Merchant+", "+title, ", ")
+		}
+		if title == "" {
+			title = t.CategoryName
+		}
+		if title == "" {
+			title = "Без описания"
+		}
+		emoji := "💸"
+		if t.OperationType == "income" {
+			emoji = "💰"
+		}
+		message.WriteString(fmt.Sprintf("%s %s — %s: %s", emoji, date, title, formatMoney(t.AmountCents, t.Currency)))
+		if t.Username != "" {
+			message.WriteString(" (@" + t.Username + ")")
+		}
+		message.WriteString("\n")
+	}
+	if found.Pagination.HasMore {
+		message.WriteString("\nПоказаны 10 лучших совпадений, уточните запрос")
+	}
+
+	if !isGroup {
+		sendPlainMessage(botToken, chatID, message.String())
+		return
+	}
+	if err := callTelegram(botToken, "sendMessage", map[string]interface{}{"chat_id": fromID, "text": message.String()}, nil); err != nil {
+		fmt.Printf("⚠️ [WARN] Failed to send search results to %d: %v\n", fromID, err)
+		sendMessage(botToken, chatID, "❌ Не получилось отправить результаты в личные сообщения. Напишите боту /start и повторите")
+		return
+	}
+	sendMessage(botToken, chatID, "🔎 Результаты поиска отправил в личные сообщения")
+}
+
+// exportTransactions sends the user's transactions as a file: /export [week|month|all] [xlsx|csv|json].
+// In a group chat the file goes to the private chat, it contains personal operations.
+func exportTransactions(botToken, apiURL, botKey string, fromID int64, chatID int64, isGroup bool, args []string) {
+	period, format := "month", "xlsx"
+	for _, arg := range args {
+		switch arg {
+		case "week", "month", "all":
+			period = arg
+		case "xlsx", "csv", "json":
+			format = arg
+		default:
+			sendMessage(botToken, chatID, "Используйте: /export month, /export week или /export all, формат: xlsx (по умолчанию), csv, json")
+			return
+		}
+	}
+
+	path := fmt.Sprintf("/internal/transactions/export?telegram_id=%d&format=%s", fromID, format)
+	if period != "all" {
+		path += "&period=" + period
+	}
+	data, status, err := fetchInternalFile(apiURL, botKey, path)
+	if err != nil {
+		sendMessage(botToken, chatID, "❌ Ошибка получения данных")
+		return
+	}
+	if status == http.StatusNotFound {
+		sendMessage(botToken, chatID, "❌ Сначала запишите хотя бы один расход")
+		return
+	}
+	if status != http.StatusOK {
+		sendMessage(botToken, chatID, "❌ Ошибка сервера")
+		return
+	}
+
+	caption := "📤 Операции за месяц"
+	switch period {
+	case "week":
+		caption = "📤 Операции за неделю"
+	case "all":
+		caption = "📤 Все операции"
+	}
+	filename := fmt.Sprintf("operations_%s_%s.%s", period, time.Now().Format("2006-01-02"), format)
+	if err := sendDocument(botToken, fromID, filename, data, caption); err != nil {
+		fmt.Printf("⚠️ [WARN] Failed to send export to %d: %v\n", fromID, err)
+		if isGroup {
+			sendMessage(botToken, chatID, "❌ Не получилось отправить файл в личные сообщения. Напишите боту /start и повторите")
+		} else {
+			sendMessage(botToken, chatID, "❌ Не получилось отправить файл")
+		}
+		return
+	}
+	if isGroup {
+		sendMessage(botToken, chatID, "📤 Отправил выгрузку в личные сообщения")
+	}
+}
+
+// fetchInternalFile downloads a file from an internal api-service endpoint
+func fetchInternalFile(apiURL, botKey, path string) ([]byte, int, error) {
+	req, _ := http.NewRequest("GET", apiURL+path, nil)
+	req.Header.Set("X-BOT-KEY", botKey)
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, resp.StatusCode, nil
+	}
+	data, err := io.ReadAll(resp.Body)
+	return data, resp.StatusCode, err
+}
+
+// getSettlePlan prints the minimal set of transfers that clears all debts inside the group chat
+func getSettlePlan(botToken, apiURL, botKey string, fromID int64, chatID int64) {
+	var plan struct {
+		Transfers []struct {
+			FromTelegramID int64  `json:"from_telegram_id"`
+			FromUsername   string `json:"from_username"`
+			ToTelegramID   int64  `json:"to_telegram_id"`
+			ToUsername     string `json:"to_username"`
+			AmountCents    int    `json:"amount_cents"`
+		} `json:"transfers"`
+		DebtsCount int `json:"debts_count"`
+	}
+	path := fmt.Sprintf("/internal/groups/%d/settle-plan?telegram_id=%d", chatID, fromID)
+	status, err := callInternal(apiURL, botKey, path, nil, &plan)
+	if err != nil {
+		sendMessage(botToken, chatID, "❌ Ошибка получения данных")
+		return
+	}
+	if status != http.StatusOK {
+		sendMessage(botToken, chatID, fmt.Sprintf("❌ Не удалось рассчитать взаиморасчёты (ошибка %d)", status))
+		return
+	}
+
+	if len(plan.Transfers) == 0 {
+		sendMessage(botToken, chatID, "⚖️ В группе нет непогашенных долгов")
+		return
+	}
+
+	name := func(username string, telegramID int64) string {
+		if username == "" {
+			return strconv.FormatInt(telegramID, 10)
+		}
+		return "@" + username
+	}
+
+	var message strings.Builder
+	message.WriteString(fmt.Sprintf("🤝 Чтобы закрыть %d долгов, достаточно %d переводов:\n\n", plan.DebtsCount, len(plan.Transfers)))
+	for _, t := range plan.Transfers {
+		message.WriteString(fmt.Sprintf("💸 %s → %s: %.2f руб.\n", name(t.FromUsername, t.FromTelegramID), name(t.ToUsername, t.ToTelegramID), float64(t.AmountCents)/100.0))
+	}
+	sendPlainMessage(botToken, chatID, message.String())
+}
+
+// handlePaidCommand records that a debtor paid the sender back: "/paid @username [amount]".
+// Without an amount everything that user owes is paid; the sender gets a debt_return income.
+// Only the creditor marks a debt paid.
+func handlePaidCommand(botToken, apiURL, botKey string, fromID int64, chatID int64, command string) {
+	fields := strings.Fields(command)
+	if len(fields) < 2 || len(fields) > 3 || !strings.HasPrefix(fields[1], "@") {
+		sendMessage(botToken, chatID, "❌ Неверный формат. Используйте: /paid @username 500")
+		return
+	}
+	debtor := strings.TrimPrefix(fields[1], "@")
+
+	amountCents := 0 // everything outstanding
+	if len(fields) == 3 {
+		var ok bool
+		amountCents, ok = parseAmountCents(fields[2])
+		if !ok || amountCents <= 0 {
+			sendMessage(botToken, chatID, "❌ Неверная сумма")
+			return
+		}
+	}
+
+	debtorID, err := getUserIDByUsername(apiURL, botKey, debtor)
+	if err != nil {
+		sendPlainMessage(botToken, chatID, fmt.Sprintf("❌ Пользователь @%s не найден в системе. Он должен хотя бы раз написать боту.", debtor))
+		return
+	}
+
+	payload := map[string]interface{}{
+		"telegram_id":        fromID,
+		"debtor_telegram_id": debtorID,
+		"amount_cents":       amountCents,
+		"create_income":      true,
+	}
+	var result struct {
+		PaidCents        int `json:"paid_cents"`
+		OutstandingCents int `json:"outstanding_cents"`
+	}
+	status, err := callInternal(apiURL, botKey, "/internal/debts/pay", payload, &result)
+	if err != nil {
+		sendMessage(botToken, chatID, "❌ Ошибка записи платежа")
+		return
+	}
+	switch {
+	case status == http.StatusConflict:
+		sendPlainMessage(botToken, chatID, fmt.Sprintf("💰 @%s ничего вам не должен", debtor))
+		return
+	case status == http.StatusBadRequest:
+		sendPlainMessage(botToken, chatID, fmt.Sprintf("❌ Сумма больше долга @%s. Проверьте /debts", debtor))
+		return
+	case status != http.StatusOK:
+		sendMessage(botToken, chatID, fmt.Sprintf("❌ Не удалось записать платеж (ошибка %d)", status))
+		return
+	}
+
+	message := fmt.Sprintf("✅ Записал возврат долга от @%s: %.2f руб.\n", debtor, float64(result.PaidCents)/100.0)
+	if result.OutstandingCents > 0 {
+		message += fmt.Sprintf("Осталось получить: %.2f руб.", float64(result.OutstandingCents)/100.0)
+	} else {
+		message += "Долг полностью погашен 🎉"
+	}
+	sendPlainMessage(botToken, chatID, message)
+}
+
+func handleSharedExpense(botToken, apiURL, botKey string, fromID int64, username string, chatID int64, chatType string, text string, regex *regexp.Regexp) {
 	m := regex.FindStringSubmatch(text)
 	if len(m) < 3 {
 		sendMessage(botToken, chatID, "❌ Неверный формат. Используйте: split 100 продукты @username1 @username2")
@@ -461,67 +929,147 @@ func handleSharedExpense(botToken, apiURL, botKey string, fromID int64, username
 	}
 
 	// Parse amount
-	numStr := m[1]
-	if idx := strings.Index(numStr, ","); idx >= 0 {
-		numStr = numStr[:idx] + "." + numStr[idx+1:]
+	amountCents, ok := parseAmountCents(m[1])
+	if !ok || amountCents <= 0 {
+		sendMessage(botToken, chatID, "❌ Неверная сумма")
+		return
 	}
-	amount, _ := strconv.ParseFloat(numStr, 64)
 
-	// Parse description and usernames
+	// Parse description and mentions
 	description := strings.TrimSpace(m[2])
 
-	// Extract usernames (format: @username1 @username2)
-	usernameRegex := regexp.MustCompile(`@(\w+)`)
-	usernames := usernameRegex.FindAllStringSubmatch(description, -1)
+	// Extract mentions: "@username" for an equal split, "@username:100" for an exact amount
+	mentionRegex := regexp.MustCompile(`@(\w+)(?::([0-9]+(?:[.,][0-9]{1,2})?))?`)
+	mentions := mentionRegex.FindAllStringSubmatch(description, -1)
 
-	// Remove usernames from description
-	description = usernameRegex.ReplaceAllString(description, "")
+	// Remove mentions from description
+	description = mentionRegex.ReplaceAllString(description, "")
 	description = strings.TrimSpace(description)
 
-	// Get Telegram IDs for usernames
-	var splitWith []int64
-	for _, usernameMatch := range usernames {
-		username := usernameMatch[1] // Extract username without @
+	type participant struct {
+		telegramID  int64
+		username    string
+		amountCents int
+	}
+	var participants []participant
+	exact := false
+	othersCents := 0
+	for _, mention := range mentions {
+		mentioned := mention[1] // username without @
 
 		// Look up user by username in the database
-		userID, err := getUserIDByUsername(apiURL, botKey, username)
+		telegramID, err := getUserIDByUsername(apiURL, botKey, mentioned)
 		if err != nil {
-			sendMessage(botToken, chatID, fmt.Sprintf("❌ Пользователь @%s не найден в системе", username))
+			sendMessage(botToken, chatID, fmt.Sprintf("❌ Пользователь @%s не найден в системе. Он должен хотя бы раз написать боту.", mentioned))
+			return
+		}
+
+		// The current user's share is whatever is left
+		if telegramID == fromID {
 			continue
 		}
 
-		// Don't add the current user to split list
-		if userID != fromID {
-			splitWith = append(splitWith, userID)
+		p := participant{telegramID: telegramID, username: mentioned}
+		if mention[2] != "" {
+			exact = true
+			p.amountCents, ok = parseAmountCents(mention[2])
+			if !ok {
+				sendMessage(botToken, chatID, fmt.Sprintf("❌ Неверная сумма для @%s", mentioned))
+				return
+			}
+			othersCents += p.amountCents
 		}
+		participants = append(participants, p)
 	}
 
-	if len(splitWith) == 0 {
+	if len(participants) == 0 {
 		sendMessage(botToken, chatID, "❌ Не найдены пользователи для разделения. Используйте @username")
 		return
 	}
 
-	// Detect category
-	categoryID := detectCategory(apiURL, description)
+	payload := map[string]interface{}{
+		"telegram_id":  fromID,
+		"username":     username,
+		"amount_cents": amountCents,
+		"description":  description,
+	}
+	if categoryID := detectCategory(apiURL, description); categoryID != nil {
+		payload["category_id"] = *categoryID
+	}
+	if chatType == "group" || chatType == "supergroup" {
+		payload["group_id"] = chatID
+	}
 
-	// Create shared expense (simplified - just create regular expense for now)
-	// TODO: Implement proper shared expense creation
-	var groupID *int64
-	gid := chatID
-	groupID = &gid
-	status, err := postExpenseWithCategory(apiURL, botKey, fromID, username, amount, categoryID, groupID)
+	if exact {
+		// "@a:100 @b:200": everyone mentioned needs an amount, the rest is the payer's own share
+		if othersCents > amountCents {
+			sendMessage(botToken, chatID, fmt.Sprintf("❌ Сумма долей (%.2f руб.) больше суммы расхода", float64(othersCents)/100.0))
+			return
+		}
+		parts := []map[string]interface{}{{"telegram_id": fromID, "amount_cents": amountCents - othersCents}}
+		for _, p := range participants {
+			if p.amountCents == 0 {
+				sendMessage(botToken, chatID, fmt.Sprintf("❌ Укажите сумму для @%s (например @%s:100) или не указывайте суммы совсем", p.username, p.username))
+				return
+			}
+			parts = append(parts, map[string]interface{}{"telegram_id": p.telegramID, "amount_cents": p.amountCents})
+		}
+		payload["split_mode"] = "exact"
+		payload["participants"] = parts
+	} else {
+		splitWith := make([]int64, 0, len(participants))
+		for _, p := range participants {
+			splitWith = append(splitWith, p.telegramID)
+		}
+		payload["split_mode"] = "equal"
+		payload["split_with"] = splitWith
+	}
+
+	var result struct {
+		Shares []struct {
+			TelegramID  int64 `json:"telegram_id"`
+			AmountCents int   `json:"amount_cents"`
+		} `json:"shares"`
+	}
+	status, err := callInternal(apiURL, botKey, "/internal/expenses/shared", payload, &result)
 	if err != nil {
 		sendMessage(botToken, chatID, "❌ Ошибка создания расхода")
 		return
 	}
-
-	if status < 200 || status >= 300 {
-		sendMessage(botToken, chatID, "❌ Ошибка сервера при создании расхода")
+	if status != http.StatusCreated {
+		sendMessage(botToken, chatID, fmt.Sprintf("❌ Не удалось создать общий расход (ошибка %d)", status))
 		return
 	}
 
-	sendMessage(botToken, chatID, fmt.Sprintf("✅ Записал расход: %.2f руб. (категория: %d)\n💡 Shared расходы будут добавлены в следующей версии",
-		amount, *categoryID))
+	names := make(map[int64]string, len(participants))
+	for _, p := range participants {
+		names[p.telegramID] = p.username
+	}
+
+	var message strings.Builder
+	message.WriteString(fmt.Sprintf("✅ Общий расход: %.2f руб.", float64(amountCents)/100.0))
+	if description != "" {
+		message.WriteString(" (" + description + ")")
+	}
+	message.WriteString("\n\n")
+	for _, share := range result.Shares {
+		if share.TelegramID == fromID {
+			message.WriteString(fmt.Sprintf("👤 Ваша доля: %.2f руб.\n", float64(share.AmountCents)/100.0))
+			continue
+		}
+		message.WriteString(fmt.Sprintf("💸 @%s должен вам %.2f руб.\n", names[share.TelegramID], float64(share.AmountCents)/100.0))
+	}
+	sendPlainMessage(botToken, chatID, message.String())
+}
+
+// parseAmountCents converts "100", "50.5" or "50,50" into kopecks
+func parseAmountCents(s string) (int, bool) {
+	s = strings.Replace(s, ",", ".", 1)
+	amount, err := strconv.ParseFloat(s, 64)
+	if err != nil || amount < 0 {
+		return 0, false
+	}
+	return int(math.Round(amount * 100)), true
 }
 
 func getSummary(botToken, apiURL, botKey string, fromID int64, chatID int64, period string) {
@@ -530,9 +1078,14 @@ func getSummary(botToken, apiURL, botKey string, fromID int64, chatID int64, per
 		"telegram_id": fromID,
 		"period":      period,
 	}
+	if chatID < 0 {
+		// In a group chat the summary covers the group, not only the sender
+		payload["scope"] = "group"
+		payload["group_id"] = chatID
+	}
 	body, _ := json.Marshal(payload)
 
-	req, err := http.NewRequest("POST", apiURL+"/analytics/summary", bytes.NewReader(body))
+	req, err := http.NewRequest("POST", apiURL+"/internal/analytics/summary", bytes.NewReader(body))
 	if err != nil {
 		sendMessage(botToken, chatID, "❌ Ошибка при создании запроса")
 		return
@@ -580,24 +1133,6 @@ func getSummary(botToken, apiURL, botKey string, fromID int64, chatID int64, per
 	sendMessage(botToken, chatID, message)
 }
 
-func handlePhotoMessage(botToken, apiURL, botKey string, fromID int64, username string, chatID int64, photos []interface{}) {
-	// Get the largest photo (last in array)
-	if len(photos) == 0 {
-		return
-	}
-
-	photo := photos[len(photos)-1].(map[string]interface{})
-	_, _ = photo["file_id"].(string) // fileID for future OCR implementation
-
-	sendMessage(botToken, chatID, "📸 Получил фото чека. Обработка OCR будет добавлена в следующей версии.")
-
-	// TODO: Implement OCR processing
-	// 1. Get file path from Telegram
-	// 2. Download file
-	// 3. Send to OCR service
-	// 4. Parse results and show inline keyboard for selection
-}
-
 // getUserIDByUsername looks up a user by their Telegram username
 func getUserIDByUsername(apiURL, botKey, username string) (int64, error) {
 	// Make API call to find user by username
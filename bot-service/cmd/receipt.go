@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Callback data of the receipt keyboard: "rcpt:<receipt id>:item:<item id>", "rcpt:<receipt id>:done", "rcpt:<receipt id>:cancel"
+const receiptCallbackPrefix = "rcpt:"
+
+// maxButtonName limits item names on keyboard buttons
+const maxButtonName = 24
+
+// recognizedReceipt is the ocr-service /parse-receipt response
+type recognizedReceipt struct {
+	Merchant string     `json:"merchant"`
+	Date     *time.Time `json:"date,omitempty"`
+	Items    []struct {
+		Name       string  `json:"name"`
+		Quantity   float64 `json:"quantity"`
+		PriceCents int     `json:"price_cents"`
+	} `json:"items"`
+	TotalCents int `json:"total_cents"`
+	TaxCents   int `json:"tax_cents"`
+	Fiscal     *struct {
+		FN string `json:"fn"`
+		FD string `json:"fd"`
+		FP string `json:"fp"`
+	} `json:"fiscal,omitempty"`
+}
+
+// storedReceipt is the api-service representation of a receipt being split
+type storedReceipt struct {
+	ID              int        `json:"id"`
+	OwnerTelegramID int64      `json:"owner_telegram_id"`
+	Merchant        string     `json:"merchant"`
+	Date            *time.Time `json:"date"`
+	TotalCents      int        `json:"total_cents"`
+	Status          string     `json:"status"`
+	Items           []struct {
+		ID         int     `json:"id"`
+		Name       string  `json:"name"`
+		PriceCents int     `json:"price_cents"`
+		SelectedBy []int64 `json:"selected_by"`
+	} `json:"items"`
+	Participants []struct {
+		TelegramID int64  `json:"telegram_id"`
+		Username   string `json:"username"`
+	} `json:"participants"`
+}
+
+func handlePhotoMessage(botToken, apiURL, ocrURL, botKey string, fromID int64, username string, chatID int64, chatType string, photos []interface{}) {
+	// Get the largest photo (last in array)
+	if len(photos) == 0 {
+		return
+	}
+	photo, _ := photos[len(photos)-1].(map[string]interface{})
+	fileID, _ := photo["file_id"].(string)
+	if fileID == "" {
+		return
+	}
+
+	sendMessage(botToken, chatID, "📸 Получил фото чека, распознаю...")
+
+	image, err := downloadTelegramFile(botToken, fileID)
+	if err != nil {
+		fmt.Printf("❌ [ERROR] Failed to download photo %s: %v\n", fileID, err)
+		sendMessage(botToken, chatID, "❌ Не удалось скачать фото")
+		return
+	}
+
+	recognized, status, err := recognizeReceipt(ocrURL, image)
+	if err != nil {
+		fmt.Printf("❌ [ERROR] OCR request failed: %v\n", err)
+		sendMessage(botToken, chatID, "❌ Сервис распознавания недоступен, попробуйте позже")
+		return
+	}
+	if status == http.StatusUnprocessableEntity {
+		sendMessage(botToken, chatID, "❌ Не удалось распознать чек. Попробуйте сфотографировать его ровнее и при хорошем освещении.")
+		return
+	}
+	if status != http.StatusOK {
+		sendMessage(botToken, chatID, fmt.Sprintf("❌ Ошибка распознавания (код %d)", status))
+		return
+	}
+
+	var groupID *int64
+	if chatType == "group" || chatType == "supergroup" {
+		groupID = &chatID
+	}
+
+	// Only the fiscal QR code was read: there is nothing to split, record the total
+	if len(recognized.Items) == 0 {
+		if recognized.TotalCents <= 0 {
+			sendMessage(botToken, chatID, "❌ В чеке не найдено ни одной позиции")
+			return
+		}
+		amount := float64(recognized.TotalCents) / 100.0
+		status, _, err := postExpenseWithCategory(apiURL, botKey, fromID, username, amount, "RUB", "", recognized.Merchant, nil, groupID)
+		if err != nil || status < 200 || status >= 300 {
+			sendMessage(botToken, chatID, "❌ Не удалось записать расход по чеку")
+			return
+		}
+		sendMessage(botToken, chatID, fmt.Sprintf("✅ Позиции не распознаны, записал расход по итогу чека: %.2f руб.", amount))
+		return
+	}
+
+	payload := map[string]interface{}{
+		"telegram_id": fromID,
+		"username":    username,
+		"group_id":    groupID,
+		"merchant":    recognized.Merchant,
+		"date":        recognized.Date,
+		"total_cents": recognized.TotalCents,
+		"tax_cents":   recognized.TaxCents,
+		"fiscal":      recognized.Fiscal,
+		"items":       recognized.Items,
+	}
+	var rec storedReceipt
+	status, err = callInternal(apiURL, botKey, "/internal/receipts", payload, &rec)
+	if err != nil {
+		fmt.Printf("❌ [ERROR] Failed to store receipt for user %d: %v\n", fromID, err)
+		sendMessage(botToken, chatID, "❌ Не удалось сохранить чек")
+		return
+	}
+	if status == http.StatusConflict {
+		sendMessage(botToken, chatID, "⚠️ Этот чек уже был добавлен")
+		return
+	}
+	if status != http.StatusCreated {
+		sendMessage(botToken, chatID, fmt.Sprintf("❌ Не удалось сохранить чек (ошибка %d)", status))
+		return
+	}
+
+	if _, err := sendKeyboard(botToken, chatID, formatReceipt(&rec), receiptKeyboard(&rec)); err != nil {
+		fmt.Printf("❌ [ERROR] Failed to send receipt keyboard: %v\n", err)
+		return
+	}
+	fmt.Printf("✅ [INFO] Receipt %d recognized: user=%d, items=%d, total=%d\n", rec.ID, fromID, len(rec.Items), rec.TotalCents)
+}
+
+// handleReceiptCallback processes a tap on the receipt keyboard
+func handleReceiptCallback(botToken, apiURL, botKey, callbackID string, fromID int64, username string, chatID, messageID int64, data string) {
+	parts := strings.Split(strings.TrimPrefix(data, receiptCallbackPrefix), ":")
+	receiptID, err := strconv.Atoi(parts[0])
+	if err != nil || len(parts) < 2 {
+		answerCallback(botToken, callbackID, "")
+		return
+	}
+	base := fmt.Sprintf("/internal/receipts/%d", receiptID)
+
+	switch parts[1] {
+	case "item":
+		if len(parts) != 3 {
+			answerCallback(botToken, callbackID, "")
+			return
+		}
+		var rec storedReceipt
+		status, err := callInternal(apiURL, botKey, base+"/items/"+parts[2]+"/toggle",
+			map[string]interface{}{"telegram_id": fromID, "username": username}, &rec)
+		if err != nil || status != http.StatusOK {
+			answerCallback(botToken, callbackID, receiptErrorText(status, err))
+			return
+		}
+		answerCallback(botToken, callbackID, "")
+		editKeyboard(botToken, chatID, messageID, formatReceipt(&rec), receiptKeyboard(&rec))
+
+	case "done":
+		var result struct {
+			AmountCents int `json:"amount_cents"`
+			Shares      []struct {
+				TelegramID  int64  `json:"telegram_id"`
+				Username    string `json:"username"`
+				AmountCents int    `json:"amount_cents"`
+			} `json:"shares"`
+		}
+		status, err := callInternal(apiURL, botKey, base+"/finalize", map[string]interface{}{"telegram_id": fromID}, &result)
+		if err != nil || status != http.StatusOK {
+			answerCallback(botToken, callbackID, receiptErrorText(status, err))
+			return
+		}
+		answerCallback(botToken, callbackID, "Чек сохранён")
+
+		var message strings.Builder
+		message.WriteString(fmt.Sprintf("✅ Чек сохранён: расход %.2f руб.\n\n", float64(result.AmountCents)/100.0))
+		for _, share := range result.Shares {
+			if share.AmountCents == 0 {
+				continue
+			}
+			if share.TelegramID == fromID {
+				message.WriteString(fmt.Sprintf("👤 %s: %.2f руб.\n", share.Username, float64(share.AmountCents)/100.0))
+			} else {
+				message.WriteString(fmt.Sprintf("💸 %s должен %s %.2f руб.\n", share.Username, username, float64(share.AmountCents)/100.0))
+			}
+		}
+		editKeyboard(botToken, chatID, messageID, message.String(), nil)
+
+	case "cancel":
+		status, err := callInternal(apiURL, botKey, base+"/cancel", map[string]interface{}{"telegram_id": fromID}, nil)
+		if err != nil || status != http.StatusOK {
+			answerCallback(botToken, callbackID, receiptErrorText(status, err))
+			return
+		}
+		answerCallback(botToken, callbackID, "Чек отменён")
+		editKeyboard(botToken, chatID, messageID, "❌ Чек отменён", nil)
+
+	default:
+		answerCallback(botToken, callbackID, "")
+	}
+}
+
+func receiptErrorText(status int, err error) string {
+	switch {
+	case err != nil:
+		return "Сервер недоступен, попробуйте позже"
+	case status == http.StatusForbidden:
+		return "Только автор чека может это сделать"
+	case status == http.StatusConflict:
+		return "Чек уже закрыт"
+	case status == http.StatusNotFound:
+		return "Чек не найден"
+	default:
+		return fmt.Sprintf("Ошибка сервера (%d)", status)
+	}
+}
+
+func formatReceipt(rec *storedReceipt) string {
+	names := make(map[int64]string, len(rec.Participants))
+	for _, p := range rec.Participants {
+		names[p.TelegramID] = p.Username
+	}
+
+	var b strings.Builder
+	b.WriteString("🧾 ")
+	if rec.Merchant != "" {
+		b.WriteString(rec.Merchant)
+	} else {
+		b.WriteString("Чек")
+	}
+	if rec.Date != nil {
+		b.WriteString(", " + rec.Date.Format("02.01.2006 15:04"))
+	}
+	b.WriteString(fmt.Sprintf("\nИтого: %.2f руб.\n\n", float64(rec.TotalCents)/100.0))
+
+	for i, item := range rec.Items {
+		b.WriteString(fmt.Sprintf("%d. %s — %.2f руб.", i+1, item.Name, float64(item.PriceCents)/100.0))
+		if len(item.SelectedBy) > 0 {
+			selected := make([]string, 0, len(item.SelectedBy))
+			for _, id := range item.SelectedBy {
+				selected = append(selected, names[id])
+			}
+			b.WriteString(": " + strings.Join(selected, ", "))
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("\nОтметьте позиции, которые вы брали. Неотмеченные позиции достаются автору чека. Автор чека нажимает «Готово».")
+	return b.String()
+}
+
+func receiptKeyboard(rec *storedReceipt) [][]inlineButton {
+	keyboard := make([][]inlineButton, 0, len(rec.Items)+1)
+	for _, item := range rec.Items {
+		name := []rune(item.Name)
+		if len(name) > maxButtonName {
+			name = append(name[:maxButtonName-1], '…')
+		}
+		text := fmt.Sprintf("%s · %.2f", string(name), float64(item.PriceCents)/100.0)
+		if n := len(item.SelectedBy); n > 0 {
+			text = fmt.Sprintf("✅ %s (%d)", text, n)
+		}
+		keyboard = append(keyboard, []inlineButton{{
+			Text:         text,
+			CallbackData: fmt.Sprintf("%s%d:item:%d", receiptCallbackPrefix, rec.ID, item.ID),
+		}})
+	}
+	keyboard = append(keyboard, []inlineButton{
+		{Text: "✅ Готово", CallbackData: fmt.Sprintf("%s%d:done", receiptCallbackPrefix, rec.ID)},
+		{Text: "❌ Отмена", CallbackData: fmt.Sprintf("%s%d:cancel", receiptCallbackPrefix, rec.ID)},
+	})
+	return keyboard
+}
+
+// recognizeReceipt uploads the image to ocr-service and returns the parsed receipt with the response status
+func recognizeReceipt(ocrURL string, image []byte) (*recognizedReceipt, int, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", "receipt.jpg")
+	if err != nil {
+		return nil, 0, err
+	}
+	fw.Write(image)
+	mw.Close()
+
+	req, _ := http.NewRequest("POST", ocrURL+"/parse-receipt", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	client := &http.Client{Timeout: 90 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, resp.StatusCode, nil
+	}
+	var rec recognizedReceipt
+	if err := json.NewDecoder(resp.Body).Decode(&rec); err != nil {
+		return nil, 0, err
+	}
+	return &rec, resp.StatusCode, nil
+}
+
+// callInternal calls an internal api-service endpoint: POST with a JSON payload, or GET when payload is nil.
+// A successful response is decoded into out (if not nil).
+func callInternal(apiURL, botKey, path string, payload interface{}, out interface{}) (int, error) {
+	method := "GET"
+	var reqBody io.Reader
+	if payload != nil {
+		method = "POST"
+		body, _ := json.Marshal(payload)
+		reqBody = bytes.NewReader(body)
+	}
+	req, _ := http.NewRequest(method, apiURL+path, reqBody)
+	req.Header.Set("Content-Type", "application/json")
+	if botKey != "" {
+		req.Header.Set("X-BOT-KEY", botKey)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 && out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, err
+		}
+		return resp.StatusCode, nil
+	}
+	io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// inlineButton is a Telegram inline keyboard button
+type inlineButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data"`
+}
+
+// callTelegram posts a Bot API method and decodes the "result" field into out (if not nil)
+func callTelegram(botToken, method string, payload interface{}, out interface{}) error {
+	body, _ := json.Marshal(payload)
+	url := fmt.Sprintf("https://api.telegram.org/bot%s/%s", botToken, method)
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var data struct {
+		Ok          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return err
+	}
+	if !data.Ok {
+		return fmt.Errorf("%s: %s", method, data.Description)
+	}
+	if out != nil {
+		return json.Unmarshal(data.Result, out)
+	}
+	return nil
+}
+
+// downloadTelegramFile resolves a file_id via getFile and downloads the file contents
+func downloadTelegramFile(botToken, fileID string) ([]byte, error) {
+	var file struct {
+		FilePath string `json:"file_path"`
+	}
+	if err := callTelegram(botToken, "getFile", map[string]interface{}{"file_id": fileID}, &file); err != nil {
+		return nil, err
+	}
+	if file.FilePath == "" {
+		return nil, fmt.Errorf("getFile returned no file_path")
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(fmt.Sprintf("https://api.telegram.org/file/bot%s/%s", botToken, file.FilePath))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("file download failed with status %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// sendKeyboard sends a plain text message with an inline keyboard and returns its message_id
+func sendKeyboard(botToken string, chatID int64, text string, keyboard [][]inlineButton) (int64, error) {
+	var msg struct {
+		MessageID int64 `json:"message_id"`
+	}
+	err := callTelegram(botToken, "sendMessage", map[string]interface{}{
+		"chat_id":      chatID,
+		"text":         text,
+		"reply_markup": map[string]interface{}{"inline_keyboard": keyboard},
+	}, &msg)
+	return msg.MessageID, err
+}
+
+// editKeyboard replaces the text and inline keyboard of a message; a nil keyboard removes it
+func editKeyboard(botToken string, chatID, messageID int64, text string, keyboard [][]inlineButton) {
+	payload := map[string]interface{}{
+		"chat_id":    chatID,
+		"message_id": messageID,
+		"text":       text,
+	}
+	if keyboard != nil {
+		payload["reply_markup"] = map[string]interface{}{"inline_keyboard": keyboard}
+	}
+	if err := callTelegram(botToken, "editMessageText", payload, nil); err != nil {
+		fmt.Printf("⚠️ [WARN] Failed to edit message %d in chat %d: %v\n", messageID, chatID, err)
+	}
+}
+
+// answerCallback acknowledges a callback query, optionally showing a short notification
+func answerCallback(botToken, callbackID, text string) {
+	payload := map[string]interface{}{"callback_query_id": callbackID}
+	if text != "" {
+		payload["text"] = text
+	}
+	if err := callTelegram(botToken, "answerCallbackQuery", payload, nil); err != nil {
+		fmt.Printf("⚠️ [WARN] Failed to answer callback %s: %v\n", callbackID, err)
+	}
+}
+
+// sendPlainMessage sends text without Markdown parsing, for messages containing usernames or other user input
+func sendPlainMessage(botToken string, chatID int64, text string) {
+	if err := callTelegram(botToken, "sendMessage", map[string]interface{}{"chat_id": chatID, "text": text}, nil); err != nil {
+		fmt.Printf("⚠️ [WARN] Failed to send message to chat %d: %v\n", chatID, err)
+	}
+}
+
+// sendDocument uploads a file to the chat as a document with an optional caption
+func sendDocument(botToken string, chatID int64, filename string, data []byte, caption string) error {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("chat_id", strconv.FormatInt(chatID, 10))
+	if caption != "" {
+		form.WriteField("caption", caption)
+	}
+	part, err := form.CreateFormFile("document", filename)
+	if err != nil {
+		return err
+	}
+	part.Write(data)
+	if err := form.Close(); err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Post(fmt.Sprintf("https://api.telegram.org/bot%s/sendDocument", botToken), form.FormDataContentType(), &body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Ok          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if !result.Ok {
+		return fmt.Errorf("sendDocument: %s", result.Description)
+	}
+	return nil
+}
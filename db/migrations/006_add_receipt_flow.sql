@@ -0,0 +1,42 @@
+-- Migration: Add receipt recognition flow
+-- Version: 006
+-- Description: Stores recognized receipts from the bot, per-item selections and the resulting expense/debts
+-- Compatibility: PostgreSQL 16+
+
+BEGIN;
+
+-- 1. Recognized receipt data and lifecycle
+ALTER TABLE receipts
+ADD COLUMN IF NOT EXISTS merchant TEXT,
+ADD COLUMN IF NOT EXISTS receipt_date TIMESTAMPTZ,
+ADD COLUMN IF NOT EXISTS total_cents INT,
+ADD COLUMN IF NOT EXISTS tax_cents INT NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS fiscal_fn VARCHAR(32),
+ADD COLUMN IF NOT EXISTS fiscal_fd VARCHAR(32),
+ADD COLUMN IF NOT EXISTS fiscal_fp VARCHAR(32),
+ADD COLUMN IF NOT EXISTS group_id BIGINT REFERENCES telegram_groups(id) ON DELETE SET NULL,
+ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'finalized', 'cancelled')),
+ADD COLUMN IF NOT EXISTS expense_id INT REFERENCES expenses(id) ON DELETE SET NULL,
+ADD COLUMN IF NOT EXISTS finalized_at TIMESTAMPTZ;
+
+-- 2. Item quantity (price_cents stays the line total)
+ALTER TABLE receipt_items
+ADD COLUMN IF NOT EXISTS quantity NUMERIC(10, 3) NOT NULL DEFAULT 1;
+
+-- 3. Link debts to the receipt they were created from
+ALTER TABLE debts
+ADD COLUMN IF NOT EXISTS receipt_id INT REFERENCES receipts(id) ON DELETE SET NULL;
+
+-- 4. Indexes
+CREATE INDEX IF NOT EXISTS idx_receipts_owner ON receipts(owner_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_receipts_status ON receipts(status);
+CREATE INDEX IF NOT EXISTS idx_debts_receipt ON debts(receipt_id);
+-- The same fiscal receipt must not be recorded twice
+CREATE UNIQUE INDEX IF NOT EXISTS idx_receipts_fiscal ON receipts(fiscal_fn, fiscal_fd, fiscal_fp)
+WHERE fiscal_fn IS NOT NULL AND status <> 'cancelled';
+
+-- 5. Comments
+COMMENT ON COLUMN receipt_items.selected_by IS 'JSON array of Telegram IDs of users who consumed the item';
+COMMENT ON COLUMN receipts.status IS 'pending = items are being selected, finalized = expense and debts created, cancelled = discarded';
+
+COMMIT;
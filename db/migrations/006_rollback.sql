@@ -0,0 +1,33 @@
+-- Rollback for Migration 006: Remove receipt recognition flow
+-- Version: 006
+-- Description: Removes receipt flow columns and indexes
+
+BEGIN;
+
+-- 1. Drop indexes
+DROP INDEX IF EXISTS idx_receipts_fiscal;
+DROP INDEX IF EXISTS idx_debts_receipt;
+DROP INDEX IF EXISTS idx_receipts_status;
+DROP INDEX IF EXISTS idx_receipts_owner;
+
+-- 2. Remove columns
+ALTER TABLE debts
+DROP COLUMN IF EXISTS receipt_id;
+
+ALTER TABLE receipt_items
+DROP COLUMN IF EXISTS quantity;
+
+ALTER TABLE receipts
+DROP COLUMN IF EXISTS finalized_at,
+DROP COLUMN IF EXISTS expense_id,
+DROP COLUMN IF EXISTS status,
+DROP COLUMN IF EXISTS group_id,
+DROP COLUMN IF EXISTS fiscal_fp,
+DROP COLUMN IF EXISTS fiscal_fd,
+DROP COLUMN IF EXISTS fiscal_fn,
+DROP COLUMN IF EXISTS tax_cents,
+DROP COLUMN IF EXISTS total_cents,
+DROP COLUMN IF EXISTS receipt_date,
+DROP COLUMN IF EXISTS merchant;
+
+COMMIT;
@@ -0,0 +1,32 @@
+-- Migration: Add debt payments
+-- Version: 007
+-- Description: Tracks full and partial debt repayments and links them to debt_return incomes
+-- Compatibility: PostgreSQL 16+
+
+BEGIN;
+
+-- 1. Create debt_payments table
+CREATE TABLE IF NOT EXISTS debt_payments (
+    id SERIAL PRIMARY KEY,
+    debt_id INT NOT NULL REFERENCES debts(id) ON DELETE CASCADE,
+    amount_cents INT NOT NULL CHECK (amount_cents > 0),
+    recorded_by INT REFERENCES users(id) ON DELETE SET NULL,
+    income_id INT REFERENCES incomes(id) ON DELETE SET NULL,
+    note TEXT,
+    paid_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- 2. Existing debts marked as paid were paid in full
+INSERT INTO debt_payments (debt_id, amount_cents, paid_at)
+SELECT d.id, d.amount_cents, COALESCE(d.paid_at, NOW())
+FROM debts d
+WHERE d.is_paid = true
+  AND NOT EXISTS (SELECT 1 FROM debt_payments p WHERE p.debt_id = d.id);
+
+-- 3. Indexes
+CREATE INDEX IF NOT EXISTS idx_debt_payments_debt ON debt_payments(debt_id);
+CREATE INDEX IF NOT EXISTS idx_debts_unpaid ON debts(from_user, to_user) WHERE is_paid = false;
+
+COMMENT ON TABLE debt_payments IS 'Repayments of debts; a debt is paid when its payments add up to debts.amount_cents';
+
+COMMIT;
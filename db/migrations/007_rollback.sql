@@ -0,0 +1,11 @@
+-- Rollback for Migration 007: Remove debt payments
+-- Version: 007
+-- Description: Drops the debt_payments table (debts.is_paid is kept)
+
+BEGIN;
+
+DROP INDEX IF EXISTS idx_debts_unpaid;
+DROP INDEX IF EXISTS idx_debt_payments_debt;
+DROP TABLE IF EXISTS debt_payments;
+
+COMMIT;
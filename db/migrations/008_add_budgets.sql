@@ -0,0 +1,113 @@
+-- Migration: Add budgets
+-- Version: 008
+-- Description: Per-user and per-group budgets by category/subcategory with period limits, rollover and overspend alerts
+-- Compatibility: PostgreSQL 16+
+
+BEGIN;
+
+-- 1. Create budgets table
+-- A budget without group_id covers the owner's own expenses, a group budget covers the group's expenses
+-- except the private ones.
+-- A budget without category_id covers all expenses.
+CREATE TABLE IF NOT EXISTS budgets (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    group_id BIGINT REFERENCES telegram_groups(id) ON DELETE CASCADE,
+    category_id INT REFERENCES categories(id) ON DELETE CASCADE,
+    subcategory_id INT REFERENCES subcategories(id) ON DELETE CASCADE,
+    name VARCHAR(100),
+    limit_cents INT NOT NULL CHECK (limit_cents > 0),
+    period VARCHAR(10) NOT NULL DEFAULT 'month' CHECK (period IN ('month', 'week', 'custom')),
+    start_date DATE NOT NULL DEFAULT CURRENT_DATE,
+    end_date DATE,
+    rollover BOOLEAN NOT NULL DEFAULT false,
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+    CHECK (period <> 'custom' OR (end_date IS NOT NULL AND end_date >= start_date))
+);
+
+-- 2. Alerts already sent, one per budget, period and threshold
+CREATE TABLE IF NOT EXISTS budget_alerts (
+    id SERIAL PRIMARY KEY,
+    budget_id INT NOT NULL REFERENCES budgets(id) ON DELETE CASCADE,
+    period_start DATE NOT NULL,
+    threshold INT NOT NULL CHECK (threshold IN (80, 100)),
+    spent_cents INT NOT NULL,
+    sent_at TIMESTAMPTZ DEFAULT NOW(),
+    UNIQUE(budget_id, period_start, threshold)
+);
+
+-- 3. Current period status of every active budget, shared by api-service and analytics-service.
+-- Periods follow the Moscow calendar: month and week (from Monday) periods recur, a custom period is
+-- start_date..end_date. With rollover, what is left of the previous period (or overspent in it) moves
+-- into the current limit. A period is current only while the budget runs (start_date..end_date), and
+-- the previous period counts from start_date.
+CREATE OR REPLACE VIEW v_budget_status AS
+WITH bounds AS (
+    SELECT b.*,
+        CASE b.period
+            WHEN 'month' THEN date_trunc('month', t.today)::date
+            WHEN 'week' THEN date_trunc('week', t.today)::date
+            ELSE b.start_date
+        END AS period_start,
+        CASE b.period
+            WHEN 'month' THEN (date_trunc('month', t.today) + INTERVAL '1 month')::date
+            WHEN 'week' THEN (date_trunc('week', t.today) + INTERVAL '7 days')::date
+            ELSE b.end_date + 1
+        END AS period_end,
+        CASE b.period
+            WHEN 'month' THEN (date_trunc('month', t.today) - INTERVAL '1 month')::date
+            WHEN 'week' THEN (date_trunc('week', t.today) - INTERVAL '7 days')::date
+        END AS previous_start,
+        t.today
+    FROM budgets b
+    CROSS JOIN (SELECT (NOW() AT TIME ZONE 'Europe/Moscow')::date AS today) t
+    WHERE b.is_active
+)
+SELECT
+    bo.id AS budget_id,
+    bo.user_id,
+    bo.group_id,
+    bo.category_id,
+    bo.subcategory_id,
+    bo.name,
+    bo.period,
+    bo.rollover,
+    bo.limit_cents,
+    bo.period_start,
+    bo.period_end - 1 AS period_end,
+    bo.today >= bo.period_start AND bo.today < bo.period_end
+        AND bo.today BETWEEN bo.start_date AND COALESCE(bo.end_date, 'infinity') AS is_current,
+    s.spent_cents,
+    CASE
+        WHEN bo.rollover AND bo.previous_start IS NOT NULL AND bo.period_start > bo.start_date
+        THEN bo.limit_cents - s.previous_spent_cents
+        ELSE 0
+    END AS rollover_cents
+FROM bounds bo
+CROSS JOIN LATERAL (
+    SELECT
+        COALESCE(SUM(e.amount_cents) FILTER (WHERE (e.timestamp AT TIME ZONE 'Europe/Moscow')::date >= bo.period_start), 0)::int AS spent_cents,
+        COALESCE(SUM(e.amount_cents) FILTER (WHERE (e.timestamp AT TIME ZONE 'Europe/Moscow')::date < bo.period_start
+            AND (e.timestamp AT TIME ZONE 'Europe/Moscow')::date >= bo.start_date), 0)::int AS previous_spent_cents
+    FROM expenses e
+    WHERE e.operation_type = 'expense'
+      AND e.deleted_at IS NULL
+      AND (e.timestamp AT TIME ZONE 'Europe/Moscow')::date >= COALESCE(bo.previous_start, bo.period_start)
+      AND (e.timestamp AT TIME ZONE 'Europe/Moscow')::date < bo.period_end
+      AND (bo.category_id IS NULL OR e.category_id = bo.category_id)
+      AND (bo.subcategory_id IS NULL OR e.subcategory_id = bo.subcategory_id)
+      AND (CASE WHEN bo.group_id IS NULL THEN e.user_id = bo.user_id ELSE e.group_id = bo.group_id AND e.is_private = false END)
+) s;
+
+-- 4. Indexes
+CREATE INDEX IF NOT EXISTS idx_budgets_user ON budgets(user_id) WHERE is_active;
+CREATE INDEX IF NOT EXISTS idx_budgets_group ON budgets(group_id) WHERE is_active;
+CREATE INDEX IF NOT EXISTS idx_expenses_group_timestamp ON expenses(group_id, timestamp DESC);
+
+COMMENT ON TABLE budgets IS 'Spending limits per category/subcategory for a user or a family group';
+COMMENT ON TABLE budget_alerts IS 'Overspend alerts sent by analytics-service (80% and 100% of the limit)';
+COMMENT ON VIEW v_budget_status IS 'Spent vs. limit of every active budget in its current period';
+
+COMMIT;
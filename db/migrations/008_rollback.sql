@@ -0,0 +1,16 @@
+-- Rollback for Migration 008: Remove budgets
+-- Version: 008
+-- Description: Drops the budget status view, budget alerts and budgets
+
+BEGIN;
+
+DROP VIEW IF EXISTS v_budget_status;
+
+DROP INDEX IF EXISTS idx_expenses_group_timestamp;
+DROP INDEX IF EXISTS idx_budgets_group;
+DROP INDEX IF EXISTS idx_budgets_user;
+
+DROP TABLE IF EXISTS budget_alerts;
+DROP TABLE IF EXISTS budgets;
+
+COMMIT;
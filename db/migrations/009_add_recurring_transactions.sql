@@ -0,0 +1,47 @@
+-- Migration: Add recurring transactions
+-- Version: 009
+-- Description: Recurring expenses and incomes (salary, rent, subscriptions) materialized into expenses by api-service
+-- Compatibility: PostgreSQL 16+
+
+BEGIN;
+
+-- 1. Create recurring_transactions table
+-- schedule: 'monthly' on day_of_month (clamped to the month end), 'last_business_day',
+-- or 'weekly' on the weekday of start_date; interval_count repeats every N months/weeks.
+CREATE TABLE IF NOT EXISTS recurring_transactions (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    group_id BIGINT REFERENCES telegram_groups(id) ON DELETE SET NULL,
+    amount_cents INT NOT NULL CHECK (amount_cents > 0),
+    operation_type VARCHAR(10) NOT NULL DEFAULT 'expense' CHECK (operation_type IN ('expense', 'income')),
+    category_id INT REFERENCES categories(id) ON DELETE SET NULL,
+    subcategory_id INT REFERENCES subcategories(id) ON DELETE SET NULL,
+    description TEXT,
+    schedule VARCHAR(20) NOT NULL CHECK (schedule IN ('monthly', 'last_business_day', 'weekly')),
+    interval_count INT NOT NULL DEFAULT 1 CHECK (interval_count BETWEEN 1 AND 52),
+    day_of_month INT CHECK (day_of_month BETWEEN 1 AND 31),
+    start_date DATE NOT NULL DEFAULT CURRENT_DATE,
+    end_date DATE,
+    next_run DATE,
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+    CHECK (schedule <> 'monthly' OR day_of_month IS NOT NULL)
+);
+
+-- 2. Link materialized occurrences to their recurring transaction
+ALTER TABLE expenses
+ADD COLUMN IF NOT EXISTS recurring_id INT REFERENCES recurring_transactions(id) ON DELETE SET NULL,
+ADD COLUMN IF NOT EXISTS occurrence_date DATE;
+
+-- 3. One expense per occurrence: materializing again after a restart is a no-op
+CREATE UNIQUE INDEX IF NOT EXISTS idx_expenses_recurring_occurrence
+ON expenses(recurring_id, occurrence_date) WHERE recurring_id IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_recurring_due ON recurring_transactions(next_run) WHERE is_active;
+CREATE INDEX IF NOT EXISTS idx_recurring_user ON recurring_transactions(user_id);
+
+COMMENT ON TABLE recurring_transactions IS 'Recurring expenses and incomes; next_run is the next occurrence to materialize';
+COMMENT ON COLUMN expenses.occurrence_date IS 'Scheduled date of the recurring occurrence this expense was created from';
+
+COMMIT;
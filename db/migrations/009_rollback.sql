@@ -0,0 +1,17 @@
+-- Rollback for Migration 009: Remove recurring transactions
+-- Version: 009
+-- Description: Drops recurring transactions; materialized expenses are kept
+
+BEGIN;
+
+DROP INDEX IF EXISTS idx_recurring_user;
+DROP INDEX IF EXISTS idx_recurring_due;
+DROP INDEX IF EXISTS idx_expenses_recurring_occurrence;
+
+ALTER TABLE expenses
+DROP COLUMN IF EXISTS occurrence_date,
+DROP COLUMN IF EXISTS recurring_id;
+
+DROP TABLE IF EXISTS recurring_transactions;
+
+COMMIT;
@@ -0,0 +1,40 @@
+-- Migration: Add bank statement imports
+-- Version: 010
+-- Description: Import batches for CSV/OFX/QIF statements (preview, then commit) and the description of imported expenses
+-- Compatibility: PostgreSQL 16+
+
+BEGIN;
+
+-- 1. Create import_batches table
+-- rows holds the parsed preview (date, amount, description, category, duplicate_of, skip)
+-- until the user commits or cancels the batch.
+CREATE TABLE IF NOT EXISTS import_batches (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    format VARCHAR(10) NOT NULL CHECK (format IN ('csv', 'ofx', 'qif')),
+    preset VARCHAR(20),
+    filename TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'committed', 'cancelled')),
+    rows JSONB NOT NULL DEFAULT '[]',
+    imported_count INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    committed_at TIMESTAMPTZ
+);
+
+-- 2. Statement lines keep their description and origin
+ALTER TABLE expenses
+ADD COLUMN IF NOT EXISTS description TEXT,
+ADD COLUMN IF NOT EXISTS import_batch_id INT REFERENCES import_batches(id) ON DELETE SET NULL,
+ADD COLUMN IF NOT EXISTS external_id TEXT;
+
+-- 3. A bank transaction id is imported once per user, even from overlapping statements
+CREATE UNIQUE INDEX IF NOT EXISTS idx_expenses_user_external_id
+ON expenses(user_id, external_id) WHERE external_id IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_import_batches_user ON import_batches(user_id, created_at DESC);
+
+COMMENT ON TABLE import_batches IS 'Uploaded bank statements; rows is the preview committed into expenses';
+COMMENT ON COLUMN expenses.description IS 'Free text description, e.g. the statement line of an imported expense';
+COMMENT ON COLUMN expenses.external_id IS 'Bank transaction id (OFX FITID) of an imported expense';
+
+COMMIT;
@@ -0,0 +1,17 @@
+-- Rollback for Migration 010: Remove bank statement imports
+-- Version: 010
+-- Description: Drops import batches and the import columns; imported expenses are kept
+
+BEGIN;
+
+DROP INDEX IF EXISTS idx_import_batches_user;
+DROP INDEX IF EXISTS idx_expenses_user_external_id;
+
+ALTER TABLE expenses
+DROP COLUMN IF EXISTS external_id,
+DROP COLUMN IF EXISTS import_batch_id,
+DROP COLUMN IF EXISTS description;
+
+DROP TABLE IF EXISTS import_batches;
+
+COMMIT;
@@ -0,0 +1,33 @@
+-- Migration: Add backup and restore
+-- Version: 011
+-- Description: Installation id written into backup archives and the map of restored rows for idempotent restores
+-- Compatibility: PostgreSQL 16+
+
+BEGIN;
+
+-- 1. Create instance_info table (a single row)
+-- Archives carry the instance id, so a restore recognizes rows it has already restored from the same installation.
+CREATE TABLE IF NOT EXISTS instance_info (
+    id BOOLEAN PRIMARY KEY DEFAULT true CHECK (id),
+    instance_id UUID NOT NULL DEFAULT gen_random_uuid(),
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+INSERT INTO instance_info (id) VALUES (true) ON CONFLICT (id) DO NOTHING;
+
+-- 2. Create restored_rows table
+-- Maps a row id of the source installation to the id it got here; users and groups keep their Telegram ids
+-- and categories are matched by name, so only the other tables are mapped.
+CREATE TABLE IF NOT EXISTS restored_rows (
+    source_instance TEXT NOT NULL,
+    entity VARCHAR(30) NOT NULL,
+    source_id BIGINT NOT NULL,
+    target_id BIGINT NOT NULL,
+    restored_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (source_instance, entity, source_id)
+);
+
+COMMENT ON TABLE instance_info IS 'Id of this installation, written into backup archives';
+COMMENT ON TABLE restored_rows IS 'Source -> target ids of rows restored from backup archives';
+
+COMMIT;
@@ -0,0 +1,10 @@
+-- Rollback for Migration 011: Remove backup and restore
+-- Version: 011
+-- Description: Drops the installation id and the map of restored rows; restored data is kept
+
+BEGIN;
+
+DROP TABLE IF EXISTS restored_rows;
+DROP TABLE IF EXISTS instance_info;
+
+COMMIT;
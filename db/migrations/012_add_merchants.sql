@@ -0,0 +1,28 @@
+-- Migration: Add merchants
+-- Version: 012
+-- Description: Normalized merchants and the merchant of an expense; description (added in 010) is now set for all new expenses
+-- Compatibility: PostgreSQL 16+
+
+BEGIN;
+
+-- 1. Create merchants table
+-- normalized_name is lowercase without quotes, legal forms and store numbers, with ё as е:
+-- "ООО «Пятёрочка»" and "пятерочка 1234" are one merchant.
+CREATE TABLE IF NOT EXISTS merchants (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    normalized_name TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- 2. Link expenses to merchants
+ALTER TABLE expenses
+ADD COLUMN IF NOT EXISTS description TEXT,
+ADD COLUMN IF NOT EXISTS merchant_id INT REFERENCES merchants(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_expenses_merchant ON expenses(merchant_id, timestamp DESC) WHERE merchant_id IS NOT NULL;
+
+COMMENT ON TABLE merchants IS 'Shops and services expenses are paid to, matched by normalized_name';
+COMMENT ON COLUMN expenses.merchant_id IS 'Merchant named by the client or found in the description';
+
+COMMIT;
@@ -0,0 +1,14 @@
+-- Rollback for Migration 012: Remove merchants
+-- Version: 012
+-- Description: Drops merchants and expenses.merchant_id; descriptions are kept (the column belongs to migration 010)
+
+BEGIN;
+
+DROP INDEX IF EXISTS idx_expenses_merchant;
+
+ALTER TABLE expenses
+DROP COLUMN IF EXISTS merchant_id;
+
+DROP TABLE IF EXISTS merchants;
+
+COMMIT;
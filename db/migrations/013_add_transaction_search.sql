@@ -0,0 +1,32 @@
+-- Migration: Add transaction search
+-- Version: 013
+-- Description: Russian full-text vectors over expense and income descriptions and pg_trgm for typo-tolerant search
+-- Compatibility: PostgreSQL 16+
+
+BEGIN;
+
+-- 1. Trigram similarity for queries with typos ("аптка")
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- 2. Stemmed descriptions ("аптеке" finds "аптека")
+-- Category, subcategory, merchant and user names live in other tables and are added at query time.
+ALTER TABLE expenses
+ADD COLUMN IF NOT EXISTS search_vector tsvector
+GENERATED ALWAYS AS (to_tsvector('russian', COALESCE(description, ''))) STORED;
+
+ALTER TABLE incomes
+ADD COLUMN IF NOT EXISTS search_vector tsvector
+GENERATED ALWAYS AS (to_tsvector('russian', COALESCE(description, '') || ' ' || COALESCE(income_type, ''))) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_expenses_search_vector ON expenses USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_incomes_search_vector ON incomes USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_incomes_user_timestamp ON incomes(user_id, timestamp DESC);
+
+-- 3. Serves description %> query under pg_trgm.word_similarity_threshold, the typo fallback of search
+CREATE INDEX IF NOT EXISTS idx_expenses_description_trgm ON expenses USING GIN (description gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_incomes_description_trgm ON incomes USING GIN (description gin_trgm_ops);
+
+COMMENT ON COLUMN expenses.search_vector IS 'Russian full-text vector of description, see GET /api/transactions/search';
+COMMENT ON COLUMN incomes.search_vector IS 'Russian full-text vector of description and income_type';
+
+COMMIT;
@@ -0,0 +1,16 @@
+-- Rollback for Migration 013: Remove transaction search
+-- Version: 013
+-- Description: Drops the full-text vectors; pg_trgm is kept as other objects may use it
+
+BEGIN;
+
+DROP INDEX IF EXISTS idx_incomes_description_trgm;
+DROP INDEX IF EXISTS idx_expenses_description_trgm;
+DROP INDEX IF EXISTS idx_incomes_user_timestamp;
+DROP INDEX IF EXISTS idx_incomes_search_vector;
+DROP INDEX IF EXISTS idx_expenses_search_vector;
+
+ALTER TABLE incomes DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE expenses DROP COLUMN IF EXISTS search_vector;
+
+COMMIT;
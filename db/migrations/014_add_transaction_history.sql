@@ -0,0 +1,26 @@
+-- Migration: Add transaction history
+-- Version: 014
+-- Description: Audit trail of transaction edits, deletes and restores with before/after values, actor and source
+-- Compatibility: PostgreSQL 16+
+
+BEGIN;
+
+-- 1. Create transaction_history table
+-- before/after hold only the changed fields of an update; deletes and restores record deleted_at.
+CREATE TABLE IF NOT EXISTS transaction_history (
+    id SERIAL PRIMARY KEY,
+    expense_id INT NOT NULL REFERENCES expenses(id) ON DELETE CASCADE,
+    actor_id INT REFERENCES users(id) ON DELETE SET NULL,
+    source VARCHAR(10) NOT NULL CHECK (source IN ('web', 'bot')),
+    action VARCHAR(10) NOT NULL CHECK (action IN ('update', 'delete', 'restore')),
+    before JSONB NOT NULL DEFAULT '{}',
+    after JSONB NOT NULL DEFAULT '{}',
+    changed_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_transaction_history_expense ON transaction_history(expense_id, changed_at DESC);
+
+COMMENT ON TABLE transaction_history IS 'Changes of expenses rows, see GET /api/transactions/{id}/history';
+COMMENT ON COLUMN transaction_history.source IS 'web (site/API) or bot';
+
+COMMIT;
@@ -0,0 +1,10 @@
+-- Rollback for Migration 014: Remove transaction history
+-- Version: 014
+-- Description: Drops the audit trail of transaction changes
+
+BEGIN;
+
+DROP INDEX IF EXISTS idx_transaction_history_expense;
+DROP TABLE IF EXISTS transaction_history;
+
+COMMIT;
@@ -0,0 +1,27 @@
+-- Migration: Add trash retention
+-- Version: 015
+-- Description: Links debts to the expense they were split from, so purging a deleted expense removes its debts
+-- Compatibility: PostgreSQL 16+
+
+BEGIN;
+
+-- 1. Link debts to their expense
+-- Shared expenses and finalized receipts create debts; receipt debts were only linked through the receipt.
+ALTER TABLE debts
+ADD COLUMN IF NOT EXISTS expense_id INT REFERENCES expenses(id) ON DELETE SET NULL;
+
+UPDATE debts d
+SET expense_id = r.expense_id
+FROM receipts r
+WHERE d.receipt_id = r.id
+  AND r.expense_id IS NOT NULL
+  AND d.expense_id IS NULL;
+
+-- 2. Indexes
+CREATE INDEX IF NOT EXISTS idx_debts_expense ON debts(expense_id);
+-- The purge job looks for transactions deleted before the retention window
+CREATE INDEX IF NOT EXISTS idx_expenses_deleted_at ON expenses(deleted_at) WHERE deleted_at IS NOT NULL;
+
+COMMENT ON COLUMN debts.expense_id IS 'Shared expense the debt was split from; purged together with the expense';
+
+COMMIT;
@@ -0,0 +1,11 @@
+-- Rollback for Migration 015: Remove trash retention
+-- Version: 015
+-- Description: Drops the debt to expense link and the deleted transactions index
+
+BEGIN;
+
+DROP INDEX IF EXISTS idx_expenses_deleted_at;
+DROP INDEX IF EXISTS idx_debts_expense;
+ALTER TABLE debts DROP COLUMN IF EXISTS expense_id;
+
+COMMIT;
@@ -0,0 +1,139 @@
+-- Migration: Add currencies
+-- Version: 016
+-- Description: Transaction currencies, stored exchange rates and conversion into each user's base currency
+-- Compatibility: PostgreSQL 16+
+
+BEGIN;
+
+-- 1. Base currency of every user: totals, balances, budgets and analytics are reported in it
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS base_currency CHAR(3) NOT NULL DEFAULT 'RUB';
+
+-- 2. Exchange rates: rubles per unit of the currency on a date.
+-- Rubles are the settlement currency, debts are kept in them.
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    currency CHAR(3) NOT NULL CHECK (currency ~ '^[A-Z]{3}$' AND currency <> 'RUB'),
+    rate_date DATE NOT NULL,
+    rate NUMERIC(20, 10) NOT NULL CHECK (rate > 0),
+    source VARCHAR(30) NOT NULL DEFAULT 'manual',
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (currency, rate_date)
+);
+
+-- 3. Transaction currencies; existing transactions were all in rubles
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS currency CHAR(3);
+UPDATE expenses SET currency = 'RUB' WHERE currency IS NULL;
+ALTER TABLE expenses ALTER COLUMN currency SET NOT NULL;
+
+ALTER TABLE incomes ADD COLUMN IF NOT EXISTS currency CHAR(3);
+UPDATE incomes SET currency = 'RUB' WHERE currency IS NULL;
+ALTER TABLE incomes ALTER COLUMN currency SET NOT NULL;
+
+-- Transactions inserted without a currency (recurring, imports, restores) are in the owner's base currency
+CREATE OR REPLACE FUNCTION set_transaction_currency() RETURNS trigger AS $$
+BEGIN
+    IF NEW.currency IS NULL THEN
+        SELECT base_currency INTO NEW.currency FROM users WHERE id = NEW.user_id;
+        NEW.currency := COALESCE(NEW.currency, 'RUB');
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_expenses_currency ON expenses;
+CREATE TRIGGER trg_expenses_currency BEFORE INSERT ON expenses
+FOR EACH ROW EXECUTE FUNCTION set_transaction_currency();
+
+DROP TRIGGER IF EXISTS trg_incomes_currency ON incomes;
+CREATE TRIGGER trg_incomes_currency BEFORE INSERT ON incomes
+FOR EACH ROW EXECUTE FUNCTION set_transaction_currency();
+
+-- Recurring transactions create their occurrences in their own currency
+ALTER TABLE recurring_transactions ADD COLUMN IF NOT EXISTS currency CHAR(3);
+UPDATE recurring_transactions SET currency = 'RUB' WHERE currency IS NULL;
+ALTER TABLE recurring_transactions ALTER COLUMN currency SET NOT NULL;
+
+DROP TRIGGER IF EXISTS trg_recurring_currency ON recurring_transactions;
+CREATE TRIGGER trg_recurring_currency BEFORE INSERT ON recurring_transactions
+FOR EACH ROW EXECUTE FUNCTION set_transaction_currency();
+
+-- 4. Conversion at the rate of a date: the latest rate on or before it, the earliest one for older dates
+CREATE OR REPLACE FUNCTION exchange_rate(cur CHAR(3), on_date DATE) RETURNS NUMERIC AS $$
+    SELECT CASE WHEN cur = 'RUB' THEN 1 ELSE COALESCE(
+        (SELECT rate FROM exchange_rates WHERE currency = cur AND rate_date <= on_date ORDER BY rate_date DESC LIMIT 1),
+        (SELECT rate FROM exchange_rates WHERE currency = cur ORDER BY rate_date LIMIT 1)
+    ) END
+$$ LANGUAGE sql STABLE;
+
+-- NULL when a currency has no rates at all
+CREATE OR REPLACE FUNCTION convert_cents(amount BIGINT, from_cur CHAR(3), to_cur CHAR(3), on_date DATE) RETURNS BIGINT AS $$
+    SELECT CASE WHEN from_cur = to_cur THEN amount
+        ELSE ROUND(amount * exchange_rate(from_cur, on_date) / exchange_rate(to_cur, on_date))::bigint END
+$$ LANGUAGE sql STABLE;
+
+-- 5. Budgets are in the owner's base currency
+CREATE OR REPLACE VIEW v_budget_status AS
+WITH bounds AS (
+    SELECT b.*, u.base_currency,
+        CASE b.period
+            WHEN 'month' THEN date_trunc('month', t.today)::date
+            WHEN 'week' THEN date_trunc('week', t.today)::date
+            ELSE b.start_date
+        END AS period_start,
+        CASE b.period
+            WHEN 'month' THEN (date_trunc('month', t.today) + INTERVAL '1 month')::date
+            WHEN 'week' THEN (date_trunc('week', t.today) + INTERVAL '7 days')::date
+            ELSE b.end_date + 1
+        END AS period_end,
+        CASE b.period
+            WHEN 'month' THEN (date_trunc('month', t.today) - INTERVAL '1 month')::date
+            WHEN 'week' THEN (date_trunc('week', t.today) - INTERVAL '7 days')::date
+        END AS previous_start,
+        t.today
+    FROM budgets b
+    JOIN users u ON u.id = b.user_id
+    CROSS JOIN (SELECT (NOW() AT TIME ZONE 'Europe/Moscow')::date AS today) t
+    WHERE b.is_active
+)
+SELECT
+    bo.id AS budget_id,
+    bo.user_id,
+    bo.group_id,
+    bo.category_id,
+    bo.subcategory_id,
+    bo.name,
+    bo.period,
+    bo.rollover,
+    bo.limit_cents,
+    bo.period_start,
+    bo.period_end - 1 AS period_end,
+    bo.today >= bo.period_start AND bo.today < bo.period_end
+        AND bo.today BETWEEN bo.start_date AND COALESCE(bo.end_date, 'infinity') AS is_current,
+    s.spent_cents,
+    CASE
+        WHEN bo.rollover AND bo.previous_start IS NOT NULL AND bo.period_start > bo.start_date
+        THEN bo.limit_cents - s.previous_spent_cents
+        ELSE 0
+    END AS rollover_cents,
+    bo.base_currency AS currency
+FROM bounds bo
+CROSS JOIN LATERAL (
+    SELECT
+        COALESCE(SUM(convert_cents(e.amount_cents, e.currency, bo.base_currency, (e.timestamp AT TIME ZONE 'Europe/Moscow')::date)) FILTER (WHERE (e.timestamp AT TIME ZONE 'Europe/Moscow')::date >= bo.period_start), 0)::int AS spent_cents,
+        COALESCE(SUM(convert_cents(e.amount_cents, e.currency, bo.base_currency, (e.timestamp AT TIME ZONE 'Europe/Moscow')::date)) FILTER (WHERE (e.timestamp AT TIME ZONE 'Europe/Moscow')::date < bo.period_start
+            AND (e.timestamp AT TIME ZONE 'Europe/Moscow')::date >= bo.start_date), 0)::int AS previous_spent_cents
+    FROM expenses e
+    WHERE e.operation_type = 'expense'
+      AND e.deleted_at IS NULL
+      AND (e.timestamp AT TIME ZONE 'Europe/Moscow')::date >= COALESCE(bo.previous_start, bo.period_start)
+      AND (e.timestamp AT TIME ZONE 'Europe/Moscow')::date < bo.period_end
+      AND (bo.category_id IS NULL OR e.category_id = bo.category_id)
+      AND (bo.subcategory_id IS NULL OR e.subcategory_id = bo.subcategory_id)
+      AND (CASE WHEN bo.group_id IS NULL THEN e.user_id = bo.user_id ELSE e.group_id = bo.group_id AND e.is_private = false END)
+) s;
+
+COMMENT ON COLUMN users.base_currency IS 'ISO 4217 code totals, balances and budgets are converted into';
+COMMENT ON TABLE exchange_rates IS 'Rubles per unit of a currency by date, loaded from files or a rates provider';
+COMMENT ON FUNCTION convert_cents(BIGINT, CHAR, CHAR, DATE) IS 'Converts minor units between currencies at the rate of a date';
+
+COMMIT;
@@ -0,0 +1,79 @@
+-- Rollback for Migration 016: Remove currencies
+-- Version: 016
+-- Description: Restores the ruble-only budget view and drops currencies and exchange rates
+
+BEGIN;
+
+-- The view got a currency column, so it is recreated as in migration 008
+DROP VIEW IF EXISTS v_budget_status;
+CREATE OR REPLACE VIEW v_budget_status AS
+WITH bounds AS (
+    SELECT b.*,
+        CASE b.period
+            WHEN 'month' THEN date_trunc('month', t.today)::date
+            WHEN 'week' THEN date_trunc('week', t.today)::date
+            ELSE b.start_date
+        END AS period_start,
+        CASE b.period
+            WHEN 'month' THEN (date_trunc('month', t.today) + INTERVAL '1 month')::date
+            WHEN 'week' THEN (date_trunc('week', t.today) + INTERVAL '7 days')::date
+            ELSE b.end_date + 1
+        END AS period_end,
+        CASE b.period
+            WHEN 'month' THEN (date_trunc('month', t.today) - INTERVAL '1 month')::date
+            WHEN 'week' THEN (date_trunc('week', t.today) - INTERVAL '7 days')::date
+        END AS previous_start,
+        t.today
+    FROM budgets b
+    CROSS JOIN (SELECT (NOW() AT TIME ZONE 'Europe/Moscow')::date AS today) t
+    WHERE b.is_active
+)
+SELECT
+    bo.id AS budget_id,
+    bo.user_id,
+    bo.group_id,
+    bo.category_id,
+    bo.subcategory_id,
+    bo.name,
+    bo.period,
+    bo.rollover,
+    bo.limit_cents,
+    bo.period_start,
+    bo.period_end - 1 AS period_end,
+    bo.today >= bo.period_start AND bo.today < bo.period_end
+        AND bo.today BETWEEN bo.start_date AND COALESCE(bo.end_date, 'infinity') AS is_current,
+    s.spent_cents,
+    CASE
+        WHEN bo.rollover AND bo.previous_start IS NOT NULL AND bo.period_start > bo.start_date
+        THEN bo.limit_cents - s.previous_spent_cents
+        ELSE 0
+    END AS rollover_cents
+FROM bounds bo
+CROSS JOIN LATERAL (
+    SELECT
+        COALESCE(SUM(e.amount_cents) FILTER (WHERE (e.timestamp AT TIME ZONE 'Europe/Moscow')::date >= bo.period_start), 0)::int AS spent_cents,
+        COALESCE(SUM(e.amount_cents) FILTER (WHERE (e.timestamp AT TIME ZONE 'Europe/Moscow')::date < bo.period_start
+            AND (e.timestamp AT TIME ZONE 'Europe/Moscow')::date >= bo.start_date), 0)::int AS previous_spent_cents
+    FROM expenses e
+    WHERE e.operation_type = 'expense'
+      AND e.deleted_at IS NULL
+      AND (e.timestamp AT TIME ZONE 'Europe/Moscow')::date >= COALESCE(bo.previous_start, bo.period_start)
+      AND (e.timestamp AT TIME ZONE 'Europe/Moscow')::date < bo.period_end
+      AND (bo.category_id IS NULL OR e.category_id = bo.category_id)
+      AND (bo.subcategory_id IS NULL OR e.subcategory_id = bo.subcategory_id)
+      AND (CASE WHEN bo.group_id IS NULL THEN e.user_id = bo.user_id ELSE e.group_id = bo.group_id AND e.is_private = false END)
+) s;
+
+DROP FUNCTION IF EXISTS convert_cents(BIGINT, CHAR, CHAR, DATE);
+DROP FUNCTION IF EXISTS exchange_rate(CHAR, DATE);
+DROP TRIGGER IF EXISTS trg_recurring_currency ON recurring_transactions;
+DROP TRIGGER IF EXISTS trg_incomes_currency ON incomes;
+DROP TRIGGER IF EXISTS trg_expenses_currency ON expenses;
+DROP FUNCTION IF EXISTS set_transaction_currency();
+ALTER TABLE recurring_transactions DROP COLUMN IF EXISTS currency;
+ALTER TABLE incomes DROP COLUMN IF EXISTS currency;
+ALTER TABLE expenses DROP COLUMN IF EXISTS currency;
+DROP TABLE IF EXISTS exchange_rates;
+ALTER TABLE users DROP COLUMN IF EXISTS base_currency;
+
+COMMIT;
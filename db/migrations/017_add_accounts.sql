@@ -0,0 +1,55 @@
+-- Migration: Add accounts and transfers
+-- Version: 017
+-- Description: Accounts (cash, cards, savings) with opening balances, account_id on transactions,
+--              and transfers between accounts stored as linked debit/credit legs
+-- Compatibility: PostgreSQL 16+
+
+BEGIN;
+
+-- 1. Accounts of a user; each one is kept in its own currency
+CREATE TABLE IF NOT EXISTS accounts (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('cash', 'debit_card', 'credit_card', 'savings')),
+    currency CHAR(3) NOT NULL DEFAULT 'RUB',
+    opening_balance_cents BIGINT NOT NULL DEFAULT 0,
+    is_archived BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    UNIQUE (user_id, name)
+);
+
+-- 2. The account a transaction was paid from or received to; accounts in use are archived, not deleted
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS account_id INT REFERENCES accounts(id);
+ALTER TABLE incomes ADD COLUMN IF NOT EXISTS account_id INT REFERENCES accounts(id);
+ALTER TABLE recurring_transactions ADD COLUMN IF NOT EXISTS account_id INT REFERENCES accounts(id);
+
+-- 3. Transfers: two expenses rows with operation_type 'transfer' and the same transfer_id,
+-- the debit leg leaves one account and the credit leg enters another (in its currency)
+CREATE SEQUENCE IF NOT EXISTS transfer_id_seq;
+
+ALTER TABLE expenses
+ADD COLUMN IF NOT EXISTS transfer_id BIGINT,
+ADD COLUMN IF NOT EXISTS transfer_leg VARCHAR(6) CHECK (transfer_leg IN ('debit', 'credit'));
+
+ALTER TABLE expenses DROP CONSTRAINT IF EXISTS expenses_operation_type_check;
+ALTER TABLE expenses ADD CONSTRAINT expenses_operation_type_check
+CHECK (operation_type IN ('expense', 'income', 'transfer'));
+
+ALTER TABLE expenses DROP CONSTRAINT IF EXISTS check_transfer_legs;
+ALTER TABLE expenses ADD CONSTRAINT check_transfer_legs CHECK (
+    (operation_type = 'transfer') = (transfer_id IS NOT NULL)
+    AND (transfer_id IS NULL) = (transfer_leg IS NULL)
+    AND (transfer_id IS NULL OR account_id IS NOT NULL)
+);
+
+-- 4. Indexes
+CREATE INDEX IF NOT EXISTS idx_accounts_user ON accounts(user_id);
+CREATE INDEX IF NOT EXISTS idx_expenses_account ON expenses(account_id) WHERE account_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_incomes_account ON incomes(account_id) WHERE account_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_expenses_transfer_leg ON expenses(transfer_id, transfer_leg) WHERE transfer_id IS NOT NULL;
+
+COMMENT ON TABLE accounts IS 'Cash, cards and savings of a user; the balance is the opening balance plus its transactions';
+COMMENT ON COLUMN expenses.transfer_id IS 'Links the debit and credit legs of a transfer; transfers are not expenses or incomes';
+
+COMMIT;
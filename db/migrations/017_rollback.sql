@@ -0,0 +1,26 @@
+-- Rollback for Migration 017: Remove accounts and transfers
+-- Version: 017
+-- Description: Deletes transfers and drops accounts from transactions
+
+BEGIN;
+
+DELETE FROM expenses WHERE operation_type = 'transfer';
+
+DROP INDEX IF EXISTS idx_expenses_transfer_leg;
+DROP INDEX IF EXISTS idx_incomes_account;
+DROP INDEX IF EXISTS idx_expenses_account;
+
+ALTER TABLE expenses DROP CONSTRAINT IF EXISTS check_transfer_legs;
+ALTER TABLE expenses DROP CONSTRAINT IF EXISTS expenses_operation_type_check;
+ALTER TABLE expenses ADD CONSTRAINT expenses_operation_type_check CHECK (operation_type IN ('expense', 'income'));
+
+ALTER TABLE expenses DROP COLUMN IF EXISTS transfer_leg;
+ALTER TABLE expenses DROP COLUMN IF EXISTS transfer_id;
+DROP SEQUENCE IF EXISTS transfer_id_seq;
+
+ALTER TABLE recurring_transactions DROP COLUMN IF EXISTS account_id;
+ALTER TABLE incomes DROP COLUMN IF EXISTS account_id;
+ALTER TABLE expenses DROP COLUMN IF EXISTS account_id;
+DROP TABLE IF EXISTS accounts;
+
+COMMIT;
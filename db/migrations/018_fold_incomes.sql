@@ -0,0 +1,68 @@
+-- Migration: Fold incomes into expenses
+-- Version: 018
+-- Description: Moves the legacy incomes table into expenses (operation_type = 'income') with its income_type,
+--              description and related_debt_id, so every total and balance is computed from one table
+-- Compatibility: PostgreSQL 16+
+
+BEGIN;
+
+-- 1. Income fields on the unified table; legacy_income_id keeps the old id for debt payments, restores and rollback
+ALTER TABLE expenses
+ADD COLUMN IF NOT EXISTS income_type VARCHAR(50),
+ADD COLUMN IF NOT EXISTS related_debt_id INT REFERENCES debts(id) ON DELETE SET NULL,
+ADD COLUMN IF NOT EXISTS legacy_income_id INT;
+
+ALTER TABLE expenses DROP CONSTRAINT IF EXISTS check_income_fields;
+ALTER TABLE expenses ADD CONSTRAINT check_income_fields CHECK (
+    operation_type = 'income' OR (income_type IS NULL AND related_debt_id IS NULL)
+);
+
+-- 2. Copy the incomes
+INSERT INTO expenses (user_id, amount_cents, operation_type, timestamp, is_shared, group_id, is_private,
+    description, currency, account_id, income_type, related_debt_id, legacy_income_id)
+SELECT i.user_id, i.amount_cents, 'income', COALESCE(i.timestamp, NOW()), false, i.group_id, COALESCE(i.is_private, false),
+    i.description, i.currency, i.account_id, i.income_type, i.related_debt_id, i.id
+FROM incomes i
+WHERE NOT EXISTS (SELECT 1 FROM expenses e WHERE e.legacy_income_id = i.id)
+ORDER BY i.id;
+
+-- 3. Debt payments and restored rows point at the folded rows
+ALTER TABLE debt_payments DROP CONSTRAINT IF EXISTS debt_payments_income_id_fkey;
+UPDATE debt_payments p SET income_id = e.id FROM expenses e WHERE e.legacy_income_id = p.income_id;
+ALTER TABLE debt_payments ADD CONSTRAINT debt_payments_income_id_fkey
+FOREIGN KEY (income_id) REFERENCES expenses(id) ON DELETE SET NULL;
+
+UPDATE restored_rows m SET target_id = e.id
+FROM expenses e
+WHERE m.entity = 'income' AND e.legacy_income_id = m.target_id;
+
+-- 4. Income types are searched as well
+DROP INDEX IF EXISTS idx_expenses_search_vector;
+ALTER TABLE expenses DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE expenses
+ADD COLUMN search_vector tsvector
+GENERATED ALWAYS AS (to_tsvector('russian', COALESCE(description, '') || ' ' || COALESCE(income_type, ''))) STORED;
+CREATE INDEX IF NOT EXISTS idx_expenses_search_vector ON expenses USING GIN (search_vector);
+
+-- 5. The compatibility view reads the real income fields; the lossy copy function is gone
+DROP VIEW IF EXISTS v_incomes;
+CREATE VIEW v_incomes AS
+SELECT id, user_id, amount_cents, currency, timestamp, group_id, is_private,
+    COALESCE(income_type, 'other') AS income_type, description, related_debt_id
+FROM expenses
+WHERE operation_type = 'income' AND deleted_at IS NULL;
+
+DROP FUNCTION IF EXISTS migrate_incomes_to_expenses();
+
+-- 6. Drop the legacy table
+DROP TABLE incomes;
+
+-- 7. Indexes
+CREATE INDEX IF NOT EXISTS idx_expenses_related_debt ON expenses(related_debt_id) WHERE related_debt_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_expenses_legacy_income ON expenses(legacy_income_id) WHERE legacy_income_id IS NOT NULL;
+
+COMMENT ON COLUMN expenses.income_type IS 'salary, debt_return, prize, gift, refund or other; incomes only';
+COMMENT ON COLUMN expenses.related_debt_id IS 'The debt a debt_return income repays';
+COMMENT ON COLUMN expenses.legacy_income_id IS 'Id of the row in the incomes table before migration 018';
+
+COMMIT;
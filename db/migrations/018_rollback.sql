@@ -0,0 +1,95 @@
+-- Rollback for Migration 018: Restore the incomes table
+-- Version: 018
+-- Description: Moves incomes with an income_type back into a recreated incomes table; folded rows get their old ids
+
+BEGIN;
+
+-- 1. Recreate the table as migrations 004, 013, 016 and 017 left it
+CREATE TABLE incomes (
+    id SERIAL PRIMARY KEY,
+    user_id INT REFERENCES users(id),
+    amount_cents INT NOT NULL CHECK (amount_cents > 0),
+    income_type VARCHAR(50) NOT NULL DEFAULT 'other',
+    description TEXT,
+    related_debt_id INT REFERENCES debts(id),
+    timestamp TIMESTAMPTZ DEFAULT NOW(),
+    group_id BIGINT REFERENCES telegram_groups(id) ON DELETE SET NULL,
+    is_private BOOLEAN DEFAULT false,
+    currency CHAR(3) NOT NULL,
+    account_id INT REFERENCES accounts(id),
+    search_vector tsvector
+        GENERATED ALWAYS AS (to_tsvector('russian', COALESCE(description, '') || ' ' || COALESCE(income_type, ''))) STORED
+);
+
+CREATE TRIGGER trg_incomes_currency BEFORE INSERT ON incomes
+FOR EACH ROW EXECUTE FUNCTION set_transaction_currency();
+
+-- 2. Move the rows back: folded ones keep their old ids, incomes recorded since then get new ones
+CREATE TEMP TABLE income_ids ON COMMIT DROP AS
+SELECT e.id AS expense_id, COALESCE(e.legacy_income_id, 0) AS income_id
+FROM expenses e
+WHERE e.operation_type = 'income' AND e.income_type IS NOT NULL AND e.deleted_at IS NULL;
+
+INSERT INTO incomes (id, user_id, amount_cents, income_type, description, related_debt_id, timestamp, group_id, is_private, currency, account_id)
+SELECT e.legacy_income_id, e.user_id, e.amount_cents, e.income_type, e.description, e.related_debt_id, e.timestamp,
+    e.group_id, e.is_private, e.currency, e.account_id
+FROM expenses e JOIN income_ids m ON m.expense_id = e.id
+WHERE m.income_id <> 0;
+
+SELECT setval('incomes_id_seq', COALESCE((SELECT MAX(id) FROM incomes), 0) + 1, false);
+
+UPDATE income_ids SET income_id = nextval('incomes_id_seq') WHERE income_id = 0;
+
+INSERT INTO incomes (id, user_id, amount_cents, income_type, description, related_debt_id, timestamp, group_id, is_private, currency, account_id)
+SELECT m.income_id, e.user_id, e.amount_cents, e.income_type, e.description, e.related_debt_id, e.timestamp,
+    e.group_id, e.is_private, e.currency, e.account_id
+FROM expenses e JOIN income_ids m ON m.expense_id = e.id
+WHERE e.legacy_income_id IS NULL;
+
+-- 3. Debt payments and restored rows point at incomes again
+ALTER TABLE debt_payments DROP CONSTRAINT IF EXISTS debt_payments_income_id_fkey;
+-- Payments of incomes that stay in expenses (deleted ones) lose the link
+UPDATE debt_payments p SET income_id = m.income_id
+FROM expenses e LEFT JOIN income_ids m ON m.expense_id = e.id
+WHERE e.id = p.income_id;
+ALTER TABLE debt_payments ADD CONSTRAINT debt_payments_income_id_fkey
+FOREIGN KEY (income_id) REFERENCES incomes(id) ON DELETE SET NULL;
+
+UPDATE restored_rows r SET target_id = m.income_id
+FROM income_ids m
+WHERE r.entity = 'income' AND r.target_id = m.expense_id;
+
+DELETE FROM expenses WHERE id IN (SELECT expense_id FROM income_ids);
+
+-- 4. Indexes of the table
+CREATE INDEX IF NOT EXISTS idx_incomes_user_timestamp ON incomes(user_id, timestamp DESC);
+CREATE INDEX IF NOT EXISTS idx_incomes_timestamp ON incomes(timestamp DESC);
+CREATE INDEX IF NOT EXISTS idx_incomes_group ON incomes(group_id);
+CREATE INDEX IF NOT EXISTS idx_incomes_private ON incomes(is_private);
+CREATE INDEX IF NOT EXISTS idx_incomes_search_vector ON incomes USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_incomes_description_trgm ON incomes USING GIN (description gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_incomes_account ON incomes(account_id) WHERE account_id IS NOT NULL;
+
+-- 5. The expenses side as migration 017 left it
+DROP VIEW IF EXISTS v_incomes;
+CREATE VIEW v_incomes AS
+SELECT id, user_id, amount_cents, category_id, subcategory_id, timestamp, is_shared,
+    'other' AS income_type, NULL AS description, NULL AS related_debt_id
+FROM expenses
+WHERE operation_type = 'income';
+
+DROP INDEX IF EXISTS idx_expenses_search_vector;
+ALTER TABLE expenses DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE expenses
+ADD COLUMN search_vector tsvector
+GENERATED ALWAYS AS (to_tsvector('russian', COALESCE(description, ''))) STORED;
+CREATE INDEX IF NOT EXISTS idx_expenses_search_vector ON expenses USING GIN (search_vector);
+
+DROP INDEX IF EXISTS idx_expenses_legacy_income;
+DROP INDEX IF EXISTS idx_expenses_related_debt;
+ALTER TABLE expenses DROP CONSTRAINT IF EXISTS check_income_fields;
+ALTER TABLE expenses DROP COLUMN IF EXISTS legacy_income_id;
+ALTER TABLE expenses DROP COLUMN IF EXISTS related_debt_id;
+ALTER TABLE expenses DROP COLUMN IF EXISTS income_type;
+
+COMMIT;
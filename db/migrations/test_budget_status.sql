@@ -0,0 +1,62 @@
+-- Test script for the v_budget_status view (migration 008)
+-- Seeds budgets and expenses in a transaction, checks the view and rolls everything back.
+-- A failed check stops the script with an ASSERT error.
+
+BEGIN;
+
+DO $$
+DECLARE
+    today DATE := (NOW() AT TIME ZONE 'Europe/Moscow')::date;
+    month_start DATE := date_trunc('month', (NOW() AT TIME ZONE 'Europe/Moscow'))::date;
+    previous_month_start DATE := (date_trunc('month', (NOW() AT TIME ZONE 'Europe/Moscow')) - INTERVAL '1 month')::date;
+    owner_id INT;
+    member_id INT;
+    new_budget INT;
+    status v_budget_status%ROWTYPE;
+BEGIN
+    INSERT INTO users (telegram_id, username) VALUES (-9000001, 'budget_owner') RETURNING id INTO owner_id;
+    INSERT INTO users (telegram_id, username) VALUES (-9000002, 'budget_member') RETURNING id INTO member_id;
+    INSERT INTO telegram_groups (id, name) VALUES (-9000100, 'budget test group');
+    INSERT INTO group_members (group_id, user_id) VALUES (-9000100, -9000001), (-9000100, -9000002);
+
+    -- Test 1: a budget is current only between its start_date and end_date
+    INSERT INTO budgets (user_id, limit_cents, period, start_date)
+    VALUES (owner_id, 1000, 'month', today + 1) RETURNING id INTO new_budget;
+    SELECT * INTO status FROM v_budget_status s WHERE s.budget_id = new_budget;
+    ASSERT NOT status.is_current, 'a monthly budget starting tomorrow must not be current';
+
+    INSERT INTO budgets (user_id, limit_cents, period, start_date, end_date)
+    VALUES (owner_id, 1000, 'month', previous_month_start, today - 1) RETURNING id INTO new_budget;
+    SELECT * INTO status FROM v_budget_status s WHERE s.budget_id = new_budget;
+    ASSERT NOT status.is_current, 'a monthly budget that ended yesterday must not be current';
+
+    INSERT INTO budgets (user_id, limit_cents, period, start_date)
+    VALUES (owner_id, 1000, 'month', today) RETURNING id INTO new_budget;
+    SELECT * INTO status FROM v_budget_status s WHERE s.budget_id = new_budget;
+    ASSERT status.is_current, 'a monthly budget starting today must be current';
+
+    -- Test 2: the rollover counts the previous period from start_date only
+    INSERT INTO expenses (user_id, amount_cents, operation_type, timestamp)
+    VALUES (owner_id, 5000, 'expense', (previous_month_start + 2 + TIME '12:00') AT TIME ZONE 'Europe/Moscow'),
+           (owner_id, 300, 'expense', (previous_month_start + 20 + TIME '12:00') AT TIME ZONE 'Europe/Moscow');
+    INSERT INTO budgets (user_id, limit_cents, period, start_date, rollover)
+    VALUES (owner_id, 1000, 'month', previous_month_start + 14, true) RETURNING id INTO new_budget;
+    SELECT * INTO status FROM v_budget_status s WHERE s.budget_id = new_budget;
+    ASSERT status.rollover_cents = 700,
+        format('rollover_cents = %s, want 700: expenses before start_date must not be carried over', status.rollover_cents);
+
+    -- Test 3: a group budget leaves out the private expenses of the members
+    INSERT INTO expenses (user_id, amount_cents, operation_type, timestamp, group_id, is_private)
+    VALUES (owner_id, 200, 'expense', (month_start + TIME '12:00') AT TIME ZONE 'Europe/Moscow', -9000100, false),
+           (member_id, 900, 'expense', (month_start + TIME '12:00') AT TIME ZONE 'Europe/Moscow', -9000100, true);
+    INSERT INTO budgets (user_id, group_id, limit_cents, period, start_date)
+    VALUES (owner_id, -9000100, 1000, 'month', month_start) RETURNING id INTO new_budget;
+    SELECT * INTO status FROM v_budget_status s WHERE s.budget_id = new_budget;
+    ASSERT status.spent_cents = 200,
+        format('spent_cents = %s, want 200: private expenses must not count in a group budget', status.spent_cents);
+
+    RAISE NOTICE 'v_budget_status: all checks passed';
+END
+$$;
+
+ROLLBACK;
@@ -58,8 +58,8 @@ export const AIAssistant: React.FC<AIAssistantProps> = ({ token }) => {
 
       const data = await response.json()
       
-      if (data.ollama_status === 'available') {
-        setSummary('✅ Ollama доступна и работает!\n\nМодель: ' + (data.model || 'llama2'))
+      if (data.ollama) {
+        setSummary('✅ Ollama доступна и работает!\n\nМодель: ' + (data.model || 'не указана'))
       } else {
         setError('❌ Ollama недоступна. Проверьте, что сервис запущен.')
       }
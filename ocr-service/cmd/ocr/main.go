@@ -1,33 +1,65 @@
 package main
 
 import (
-	"encoding/json"
 	"log"
 	"net/http"
 	"os"
+	"strings"
+	"time"
+
+	"github.com/expense-tracker/ocr-service/internal/handlers"
+	"github.com/expense-tracker/ocr-service/internal/receipt"
+	"github.com/expense-tracker/ocr-service/internal/recognizer"
 )
 
-type Item struct {
-	Name       string `json:"name"`
-	PriceCents int    `json:"price_cents"`
+func envOr(key, def string) string {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	return v
 }
 
-func main() {
-	http.HandleFunc("/parse-receipt", func(w http.ResponseWriter, r *http.Request) {
-		// For MVP we accept an image file via multipart form 'file' and return dummy items
-		useLocal := os.Getenv("USE_LOCAL_OCR")
-		_ = useLocal // future: switch between GCV and local
-
-		items := []Item{
-			{Name: "Milk", PriceCents: 12000},
-			{Name: "Bread", PriceCents: 5000},
+// newRecognizer selects the recognizer based on USE_LOCAL_OCR:
+//   - "true": local Tesseract
+//   - "fixture": deterministic fixture read from OCR_FIXTURE_FILE
+//   - anything else: Google Cloud Vision, which is not bundled yet, so local Tesseract is used
+func newRecognizer(parser *receipt.Parser) recognizer.Recognizer {
+	tesseract := recognizer.NewTesseract(envOr("TESSERACT_PATH", "tesseract"), envOr("OCR_LANGUAGES", "rus+eng"), parser)
+
+	switch strings.ToLower(os.Getenv("USE_LOCAL_OCR")) {
+	case "true", "1":
+		return tesseract
+	case "fixture":
+		path := os.Getenv("OCR_FIXTURE_FILE")
+		text, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("failed to read OCR_FIXTURE_FILE %q: %v", path, err)
 		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{"items": items})
-	})
+		return recognizer.NewFixture(string(text), parser)
+	default:
+		log.Printf("Google Cloud Vision recognizer is not available, falling back to local Tesseract")
+		return tesseract
+	}
+}
+
+func main() {
+	location, err := time.LoadLocation(envOr("RECEIPT_TIMEZONE", "Europe/Moscow"))
+	if err != nil {
+		log.Printf("failed to load receipt timezone, using UTC: %v", err)
+		location = time.UTC
+	}
+
+	parser := receipt.NewParser(location)
+	// The fiscal QR code gives the exact date and total, and a result even when text OCR fails
+	rec := recognizer.WithFiscalQR(newRecognizer(parser), parser)
+	h := handlers.NewHandlers(rec)
+
+	http.HandleFunc("/health", h.Health)
+	http.HandleFunc("/parse-receipt", h.ParseReceipt)
 
 	addr := ":8090"
-	log.Printf("ocr-service listening on %s", addr)
+	log.Printf("ocr-service listening on %s (recognizer: %s)", addr, rec.Name())
 	if err := http.ListenAndServe(addr, nil); err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/expense-tracker/ocr-service/internal/recognizer"
+)
+
+// MaxUploadSize limits the size of an uploaded receipt image
+const MaxUploadSize = 10 << 20
+
+// recognizeTimeout bounds a single recognition run
+const recognizeTimeout = 60 * time.Second
+
+// Handlers holds dependencies for HTTP handlers
+type Handlers struct {
+	recognizer recognizer.Recognizer
+}
+
+// NewHandlers creates new handlers
+func NewHandlers(r recognizer.Recognizer) *Handlers {
+	return &Handlers{recognizer: r}
+}
+
+// Health reports service status
+func (h *Handlers) Health(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"status":     "ok",
+		"service":    "ocr",
+		"recognizer": h.recognizer.Name(),
+	})
+}
+
+// ParseReceipt accepts a receipt image as multipart form field "file" and returns the structured receipt
+func (h *Handlers) ParseReceipt(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, MaxUploadSize)
+	if err := r.ParseMultipartForm(MaxUploadSize); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, "image too large")
+			return
+		}
+		writeError(w, http.StatusBadRequest, "multipart form with 'file' field required")
+		return
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "multipart form with 'file' field required")
+		return
+	}
+	defer file.Close()
+
+	image, err := io.ReadAll(file)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read image")
+		return
+	}
+
+	switch contentType := http.DetectContentType(image); contentType {
+	case "image/jpeg", "image/png":
+	default:
+		writeError(w, http.StatusUnsupportedMediaType, "only JPEG and PNG images are supported")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), recognizeTimeout)
+	defer cancel()
+
+	rec, err := h.recognizer.Recognize(ctx, image)
+	if err != nil {
+		if errors.Is(err, recognizer.ErrNoText) {
+			writeError(w, http.StatusUnprocessableEntity, "no receipt text recognized")
+			return
+		}
+		log.Printf("recognizer %s failed: %v", h.recognizer.Name(), err)
+		writeError(w, http.StatusInternalServerError, "recognition failed")
+		return
+	}
+
+	log.Printf("parsed receipt: source=%s merchant=%q items=%d total=%d", rec.Source, rec.Merchant, len(rec.Items), rec.TotalCents)
+	writeJSON(w, http.StatusOK, rec)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/expense-tracker/ocr-service/internal/receipt"
+	"github.com/expense-tracker/ocr-service/internal/recognizer"
+)
+
+func uploadRequest(t *testing.T, data []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", "receipt.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(data)
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/parse-receipt", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func pngImage(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseReceipt(t *testing.T) {
+	fixture := recognizer.NewFixture("Кофейня\nКапучино 180.00\nИТОГ =180.00", receipt.NewParser(nil))
+	h := NewHandlers(fixture)
+
+	rec := httptest.NewRecorder()
+	h.ParseReceipt(rec, uploadRequest(t, pngImage(t)))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var got receipt.Receipt
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Source != "fixture" || got.TotalCents != 18000 || len(got.Items) != 1 || got.Items[0].Name != "Капучино" {
+		t.Errorf("unexpected receipt: %+v", got)
+	}
+}
+
+func TestParseReceiptRejectsNonImage(t *testing.T) {
+	h := NewHandlers(recognizer.NewFixture("Капучино 180.00", receipt.NewParser(nil)))
+
+	rec := httptest.NewRecorder()
+	h.ParseReceipt(rec, uploadRequest(t, []byte("definitely not an image")))
+
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusUnsupportedMediaType)
+	}
+}
+
+func TestParseReceiptRequiresFile(t *testing.T) {
+	h := NewHandlers(recognizer.NewFixture("Капучино 180.00", receipt.NewParser(nil)))
+
+	rec := httptest.NewRecorder()
+	h.ParseReceipt(rec, httptest.NewRequest(http.MethodPost, "/parse-receipt", nil))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
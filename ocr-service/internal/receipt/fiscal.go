@@ -0,0 +1,110 @@
+package receipt
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotFiscal is returned when a QR payload is not a Russian fiscal receipt code
+var ErrNotFiscal = errors.New("not a fiscal receipt QR payload")
+
+// Fiscal operation types ("n" parameter of the QR payload)
+const (
+	OperationSale          = 1 // приход
+	OperationSaleRefund    = 2 // возврат прихода
+	OperationExpense       = 3 // расход
+	OperationExpenseRefund = 4 // возврат расхода
+)
+
+// Fiscal holds the fiscal attributes printed in the receipt QR code.
+// Together FN, FD and FP uniquely identify the receipt in the tax service (ФНС).
+type Fiscal struct {
+	Time          time.Time `json:"time"`
+	TotalCents    int       `json:"total_cents"`
+	FN            string    `json:"fn"` // fiscal drive number (ФН)
+	FD            string    `json:"fd"` // fiscal document number (ФД)
+	FP            string    `json:"fp"` // fiscal sign (ФП)
+	OperationType int       `json:"operation_type"`
+}
+
+// IsRefund reports whether the receipt returns money to the buyer
+func (f *Fiscal) IsRefund() bool {
+	return f.OperationType == OperationSaleRefund
+}
+
+// fiscalTimeLayouts lists the "t" parameter formats seen on receipts
+var fiscalTimeLayouts = []string{"20060102T150405", "20060102T1504"}
+
+// ParseFiscal parses a fiscal QR payload like
+// "t=20231015T1842&s=314.53&fn=9289000100123456&i=12345&fp=1234567890&n=1".
+// The timestamp carries no zone and is interpreted in the parser location.
+func (p *Parser) ParseFiscal(payload string) (*Fiscal, error) {
+	values, err := url.ParseQuery(strings.TrimSpace(payload))
+	if err != nil {
+		return nil, ErrNotFiscal
+	}
+	for _, key := range []string{"t", "s", "fn", "i", "fp"} {
+		if values.Get(key) == "" {
+			return nil, ErrNotFiscal
+		}
+	}
+
+	f := &Fiscal{
+		FN:            values.Get("fn"),
+		FD:            values.Get("i"),
+		FP:            values.Get("fp"),
+		OperationType: OperationSale,
+	}
+
+	parsed := false
+	for _, layout := range fiscalTimeLayouts {
+		if ts, err := time.ParseInLocation(layout, values.Get("t"), p.location); err == nil {
+			f.Time = ts
+			parsed = true
+			break
+		}
+	}
+	if !parsed {
+		return nil, ErrNotFiscal
+	}
+
+	total, ok := ParseCents(values.Get("s"))
+	if !ok {
+		return nil, ErrNotFiscal
+	}
+	f.TotalCents = total
+
+	if n := values.Get("n"); n != "" {
+		op, err := strconv.Atoi(n)
+		if err != nil || op < OperationSale || op > OperationExpenseRefund {
+			return nil, ErrNotFiscal
+		}
+		f.OperationType = op
+	}
+
+	return f, nil
+}
+
+// ApplyFiscal overrides date and total with the exact values from the fiscal QR code
+// and rescores line items against the fiscal total
+func (r *Receipt) ApplyFiscal(f *Fiscal) {
+	r.Fiscal = f
+
+	date := f.Time
+	r.Date = &date
+	r.Confidence.Date = 1
+	r.TotalCents = f.TotalCents
+	r.Confidence.Total = 1
+
+	if len(r.Items) == 0 {
+		r.Confidence.Items = 0
+		return
+	}
+	r.Confidence.Items = r.meanItemConfidence()
+	if r.ItemsTotalCents() != r.TotalCents {
+		r.Confidence.Items *= 0.7
+	}
+}
@@ -0,0 +1,73 @@
+package receipt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseFiscal(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*60*60)
+	p := NewParser(moscow)
+
+	f, err := p.ParseFiscal("t=20231015T1842&s=314.53&fn=9960440300000001&i=12345&fp=1234567890&n=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Time.Equal(time.Date(2023, 10, 15, 18, 42, 0, 0, moscow)) {
+		t.Errorf("time = %v", f.Time)
+	}
+	if f.TotalCents != 31453 || f.FN != "9960440300000001" || f.FD != "12345" || f.FP != "1234567890" {
+		t.Errorf("unexpected fiscal data: %+v", f)
+	}
+	if f.IsRefund() {
+		t.Error("sale parsed as refund")
+	}
+
+	f, err = p.ParseFiscal("t=20231015T184205&s=1000&fn=1&i=2&fp=3&n=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Time.Second() != 5 || f.TotalCents != 100000 || !f.IsRefund() {
+		t.Errorf("unexpected fiscal data: %+v", f)
+	}
+
+	for _, payload := range []string{
+		"https://example.com",
+		"t=20231015T1842&s=314.53&fn=1&i=2",
+		"t=yesterday&s=314.53&fn=1&i=2&fp=3",
+		"t=20231015T1842&s=abc&fn=1&i=2&fp=3",
+		"t=20231015T1842&s=314.53&fn=1&i=2&fp=3&n=9",
+	} {
+		if _, err := p.ParseFiscal(payload); err != ErrNotFiscal {
+			t.Errorf("ParseFiscal(%q) error = %v, want ErrNotFiscal", payload, err)
+		}
+	}
+}
+
+func TestApplyFiscal(t *testing.T) {
+	p := NewParser(nil)
+	rec := p.Parse(linesOf("Кофейня\nКапучино 180.00\nКруассан 95.00\nИТОГ =275.00", 0.6))
+
+	f, err := p.ParseFiscal("t=20231015T0930&s=275.00&fn=1&i=2&fp=3&n=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.ApplyFiscal(f)
+
+	if rec.Fiscal != f || rec.Date == nil || !rec.Date.Equal(f.Time) {
+		t.Errorf("fiscal data not applied: %+v", rec)
+	}
+	if rec.Confidence.Total != 1 || rec.Confidence.Date != 1 {
+		t.Errorf("confidence = %+v, want exact date and total", rec.Confidence)
+	}
+	if rec.Confidence.Items != 0.6 {
+		t.Errorf("items confidence = %v, want 0.6", rec.Confidence.Items)
+	}
+
+	// OCR misread the total; the fiscal one wins and the items no longer add up
+	f.TotalCents = 30000
+	rec.ApplyFiscal(f)
+	if rec.TotalCents != 30000 || rec.Confidence.Items >= 0.6 {
+		t.Errorf("total = %d, items confidence = %v", rec.TotalCents, rec.Confidence.Items)
+	}
+}
@@ -0,0 +1,342 @@
+package receipt
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// money matches amounts with kopecks; thousands separators are not supported because
+// they are indistinguishable from a preceding quantity or weight on OCR output
+const money = `(\d+[.,]\d{2})`
+
+var (
+	// "2 x 45.00 =90.00", "1.000 шт * 89,90 = 89,90", "0.754 кг х 199.00"
+	quantityRe = regexp.MustCompile(`(\d+(?:[.,]\d{1,3})?)\s*(?:шт\.?|кг|г|л)?\s*[xXхХ*×]\s*` + money + `(?:\s*=?\s*` + money + `)?`)
+	// "Молоко 3.2% 1л   89.90", "=1234,56 ₽"
+	trailingAmountRe = regexp.MustCompile(`=?\s*` + money + `\s*(?:₽|руб\.?|р\.)?\s*$`)
+	// "15.10.23 12:34", "15/10/2023"
+	dateRe = regexp.MustCompile(`\b(\d{2})[./-](\d{2})[./-](\d{4}|\d{2})(?:\s+(\d{1,2}):(\d{2}))?`)
+	// "2023-10-15 12:34", "2023-10-15T12:34"
+	isoDateRe = regexp.MustCompile(`\b(\d{4})-(\d{2})-(\d{2})(?:[ T](\d{2}):(\d{2}))?`)
+)
+
+// totalPrefixes mark the line carrying the receipt total
+var totalPrefixes = []string{"ИТОГО", "ИТОГ", "ВСЕГО", "К ОПЛАТЕ", "СУММА ИТОГ", "TOTAL"}
+
+// serviceWords mark fiscal and payment lines that are never line items
+var serviceWords = map[string]bool{
+	"ИНН": true, "ФН": true, "ФД": true, "ФП": true, "ККТ": true, "СНО": true, "НДС": true,
+	"КАССИР": true, "СМЕНА": true, "ЧЕК": true, "ПРИХОД": true, "ВОЗВРАТ": true,
+	"ИТОГ": true, "ИТОГО": true, "ВСЕГО": true, "СДАЧА": true, "ПОЛУЧЕНО": true,
+	"НАЛИЧНЫМИ": true, "НАЛИЧНЫЕ": true, "БЕЗНАЛИЧНЫМИ": true, "ЭЛЕКТРОННЫМИ": true,
+	"КАРТОЙ": true, "ОПЛАТА": true, "СКИДКА": true, "ТЕЛ": true, "САЙТ": true,
+}
+
+// legalForms identify the merchant line at the top of a receipt
+var legalForms = map[string]bool{"ООО": true, "ИП": true, "АО": true, "ПАО": true, "ЗАО": true, "OOO": true}
+
+// merchantSearchLines limits how deep into the receipt the merchant is looked for
+const merchantSearchLines = 6
+
+// Parser turns recognized text lines into a structured receipt
+type Parser struct {
+	location *time.Location
+}
+
+// NewParser creates a parser that interprets receipt dates in the given location
+func NewParser(location *time.Location) *Parser {
+	if location == nil {
+		location = time.UTC
+	}
+	return &Parser{location: location}
+}
+
+// Parse builds a receipt from OCR lines
+func (p *Parser) Parse(lines []Line) *Receipt {
+	rec := &Receipt{Items: []Item{}}
+
+	p.parseMerchant(lines, rec)
+	p.parseDate(lines, rec)
+	p.parseBody(lines, rec)
+	p.scoreTotals(rec)
+
+	return rec
+}
+
+// parseMerchant picks the merchant from the receipt header
+func (p *Parser) parseMerchant(lines []Line, rec *Receipt) {
+	var fallback *Line
+	for i := 0; i < len(lines) && i < merchantSearchLines; i++ {
+		line := lines[i]
+		text := strings.TrimSpace(line.Text)
+		if countLetters(text) < 3 || trailingAmountRe.MatchString(text) {
+			continue
+		}
+
+		words := upperWords(text)
+		if hasServiceWord(words) {
+			continue
+		}
+		for _, w := range words {
+			if legalForms[w] {
+				rec.Merchant = text
+				rec.Confidence.Merchant = line.Confidence * 0.95
+				return
+			}
+		}
+		if fallback == nil {
+			fallback = &lines[i]
+		}
+	}
+
+	if fallback != nil {
+		rec.Merchant = strings.TrimSpace(fallback.Text)
+		rec.Confidence.Merchant = fallback.Confidence * 0.6
+	}
+}
+
+// parseDate finds the first valid purchase date on the receipt
+func (p *Parser) parseDate(lines []Line, rec *Receipt) {
+	for _, line := range lines {
+		if m := isoDateRe.FindStringSubmatch(line.Text); m != nil {
+			if ts, ok := p.buildDate(m[1], m[2], m[3], m[4], m[5]); ok {
+				rec.Date = &ts
+				rec.Confidence.Date = line.Confidence
+				return
+			}
+		}
+		if m := dateRe.FindStringSubmatch(line.Text); m != nil {
+			year := m[3]
+			if len(year) == 2 {
+				year = "20" + year
+			}
+			if ts, ok := p.buildDate(year, m[2], m[1], m[4], m[5]); ok {
+				rec.Date = &ts
+				rec.Confidence.Date = line.Confidence
+				return
+			}
+		}
+	}
+}
+
+func (p *Parser) buildDate(yearStr, monthStr, dayStr, hourStr, minuteStr string) (time.Time, bool) {
+	year, _ := strconv.Atoi(yearStr)
+	month, _ := strconv.Atoi(monthStr)
+	day, _ := strconv.Atoi(dayStr)
+	hour, _ := strconv.Atoi(hourStr)
+	minute, _ := strconv.Atoi(minuteStr)
+
+	if month < 1 || month > 12 || day < 1 || day > 31 || hour > 23 || minute > 59 {
+		return time.Time{}, false
+	}
+	ts := time.Date(year, time.Month(month), day, hour, minute, 0, 0, p.location)
+	// Reject dates that overflowed into the next month (e.g. 31.02)
+	if ts.Day() != day {
+		return time.Time{}, false
+	}
+	return ts, true
+}
+
+// parseBody extracts line items, total and tax
+func (p *Parser) parseBody(lines []Line, rec *Receipt) {
+	totalFound := false
+	pendingName := ""
+	pendingConfidence := 0.0
+
+	for _, line := range lines {
+		text := strings.TrimSpace(line.Text)
+		if text == "" {
+			continue
+		}
+		upper := strings.ToUpper(text)
+		words := upperWords(text)
+
+		if isTotalLine(upper) {
+			if m := trailingAmountRe.FindStringSubmatch(text); m != nil && !totalFound {
+				if cents, ok := ParseCents(m[1]); ok {
+					rec.TotalCents = cents
+					rec.Confidence.Total = line.Confidence
+					totalFound = true
+				}
+			}
+			pendingName = ""
+			continue
+		}
+
+		// "15.10.23" would otherwise be read as an item priced 10.23
+		if dateRe.MatchString(text) || isoDateRe.MatchString(text) {
+			pendingName = ""
+			continue
+		}
+
+		if hasServiceWord(words) {
+			if containsWord(words, "НДС") {
+				if m := trailingAmountRe.FindStringSubmatch(text); m != nil {
+					if cents, ok := ParseCents(m[1]); ok {
+						rec.TaxCents += cents
+					}
+				}
+			}
+			pendingName = ""
+			continue
+		}
+
+		if loc := quantityRe.FindStringSubmatchIndex(text); loc != nil {
+			name := cleanName(text[:loc[0]])
+			confidence := line.Confidence
+			if countLetters(name) == 0 {
+				name = pendingName
+				confidence = math.Min(confidence, pendingConfidence)
+			}
+			pendingName = ""
+			if name == "" {
+				continue
+			}
+
+			quantity := parseQuantity(text[loc[2]:loc[3]])
+			unitCents, _ := ParseCents(text[loc[4]:loc[5]])
+			expected := int(math.Round(quantity * float64(unitCents)))
+			totalCents := expected
+			if loc[6] >= 0 {
+				totalCents, _ = ParseCents(text[loc[6]:loc[7]])
+				// Quantity and line total disagree: one of the numbers was misread
+				if abs(totalCents-expected) > 1 {
+					confidence *= 0.5
+				}
+			}
+
+			rec.Items = append(rec.Items, Item{
+				Name:           name,
+				Quantity:       quantity,
+				UnitPriceCents: unitCents,
+				PriceCents:     totalCents,
+				Confidence:     confidence,
+			})
+			continue
+		}
+
+		if loc := trailingAmountRe.FindStringSubmatchIndex(text); loc != nil {
+			cents, ok := ParseCents(text[loc[2]:loc[3]])
+			if !ok || cents == 0 {
+				continue
+			}
+			name := cleanName(text[:loc[0]])
+			confidence := line.Confidence
+			if countLetters(name) == 0 {
+				name = pendingName
+				confidence = math.Min(confidence, pendingConfidence)
+			}
+			pendingName = ""
+			if name == "" {
+				continue
+			}
+
+			rec.Items = append(rec.Items, Item{
+				Name:           name,
+				Quantity:       1,
+				UnitPriceCents: cents,
+				PriceCents:     cents,
+				Confidence:     confidence,
+			})
+			continue
+		}
+
+		// A line without any amount is usually the first half of a two-line item
+		if countLetters(text) >= 2 {
+			pendingName = cleanName(text)
+			pendingConfidence = line.Confidence
+		}
+	}
+}
+
+// scoreTotals reconciles the total with line items and derives the items confidence
+func (p *Parser) scoreTotals(rec *Receipt) {
+	if len(rec.Items) == 0 {
+		return
+	}
+
+	itemsConfidence := rec.meanItemConfidence()
+	itemsTotal := rec.ItemsTotalCents()
+
+	switch {
+	case rec.TotalCents == 0:
+		// No total line recognized: fall back to the items sum with reduced trust
+		rec.TotalCents = itemsTotal
+		rec.Confidence.Total = itemsConfidence * 0.5
+	case rec.TotalCents != itemsTotal:
+		itemsConfidence *= 0.7
+	}
+
+	rec.Confidence.Items = itemsConfidence
+}
+
+func isTotalLine(upper string) bool {
+	for _, prefix := range totalPrefixes {
+		if strings.HasPrefix(upper, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasServiceWord(words []string) bool {
+	for _, w := range words {
+		if serviceWords[w] {
+			return true
+		}
+	}
+	return false
+}
+
+func containsWord(words []string, word string) bool {
+	for _, w := range words {
+		if w == word {
+			return true
+		}
+	}
+	return false
+}
+
+// upperWords splits text into upper-cased words consisting of letters only
+func upperWords(text string) []string {
+	return strings.FieldsFunc(strings.ToUpper(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+}
+
+func countLetters(s string) int {
+	n := 0
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			n++
+		}
+	}
+	return n
+}
+
+// cleanName strips OCR leftovers like leading item numbers and trailing separators
+func cleanName(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimRight(s, " =*:.-\t")
+	s = strings.TrimLeft(s, "0123456789.) \t")
+	return strings.TrimSpace(s)
+}
+
+func parseQuantity(s string) float64 {
+	q, err := strconv.ParseFloat(strings.Replace(s, ",", ".", 1), 64)
+	if err != nil || q <= 0 {
+		return 1
+	}
+	return q
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,111 @@
+package receipt
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const sampleReceipt = `ООО "Агроторг"
+Магазин Пятёрочка 1234
+КАССОВЫЙ ЧЕК
+ПРИХОД
+15.10.23 18:42
+1. Молоко 3.2% 1л
+2 x 89.90 =179.80
+Хлеб Бородинский 45.00
+Бананы 0.754 кг х 119.00 =89.73
+ИТОГ =314.53
+НДС 10% =28.59
+НАЛИЧНЫМИ =314.53
+ФН 9960440300000001 ФД 12345 ФП 1234567890`
+
+func linesOf(text string, confidence float64) []Line {
+	var lines []Line
+	for _, l := range strings.Split(text, "\n") {
+		lines = append(lines, Line{Text: l, Confidence: confidence})
+	}
+	return lines
+}
+
+func TestParseReceipt(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*60*60)
+	rec := NewParser(moscow).Parse(linesOf(sampleReceipt, 0.9))
+
+	if rec.Merchant != `ООО "Агроторг"` {
+		t.Errorf("merchant = %q", rec.Merchant)
+	}
+	if rec.Date == nil || !rec.Date.Equal(time.Date(2023, 10, 15, 18, 42, 0, 0, moscow)) {
+		t.Errorf("date = %v", rec.Date)
+	}
+	if rec.TotalCents != 31453 {
+		t.Errorf("total = %d, want 31453", rec.TotalCents)
+	}
+	if rec.TaxCents != 2859 {
+		t.Errorf("tax = %d, want 2859", rec.TaxCents)
+	}
+
+	want := []Item{
+		{Name: "Молоко 3.2% 1л", Quantity: 2, UnitPriceCents: 8990, PriceCents: 17980},
+		{Name: "Хлеб Бородинский", Quantity: 1, UnitPriceCents: 4500, PriceCents: 4500},
+		{Name: "Бананы", Quantity: 0.754, UnitPriceCents: 11900, PriceCents: 8973},
+	}
+	if len(rec.Items) != len(want) {
+		t.Fatalf("items = %+v", rec.Items)
+	}
+	for i, w := range want {
+		got := rec.Items[i]
+		if got.Name != w.Name || got.Quantity != w.Quantity || got.UnitPriceCents != w.UnitPriceCents || got.PriceCents != w.PriceCents {
+			t.Errorf("item %d = %+v, want %+v", i, got, w)
+		}
+	}
+
+	if rec.Confidence.Items != 0.9 || rec.Confidence.Total != 0.9 {
+		t.Errorf("confidence = %+v", rec.Confidence)
+	}
+}
+
+func TestParseReceiptWithoutTotal(t *testing.T) {
+	rec := NewParser(nil).Parse(linesOf("Кофейня\nКапучино 180.00\nКруассан 150.00", 0.8))
+
+	if rec.TotalCents != 33000 {
+		t.Errorf("total = %d, want items sum 33000", rec.TotalCents)
+	}
+	if rec.Confidence.Total >= rec.Confidence.Items {
+		t.Errorf("derived total should be trusted less than items: %+v", rec.Confidence)
+	}
+	if rec.Merchant != "Кофейня" {
+		t.Errorf("merchant = %q", rec.Merchant)
+	}
+}
+
+func TestParseReceiptMismatchLowersConfidence(t *testing.T) {
+	rec := NewParser(nil).Parse(linesOf("Сыр 2 x 100.00 =250.00\nИТОГО 300.00", 1))
+
+	if len(rec.Items) != 1 || rec.Items[0].PriceCents != 25000 {
+		t.Fatalf("items = %+v", rec.Items)
+	}
+	if rec.Items[0].Confidence != 0.5 {
+		t.Errorf("item confidence = %v, want 0.5", rec.Items[0].Confidence)
+	}
+	if rec.Confidence.Items >= 0.5 {
+		t.Errorf("items confidence = %v, want reduced by total mismatch", rec.Confidence.Items)
+	}
+}
+
+func TestParseCents(t *testing.T) {
+	cases := map[string]int{
+		"89.90":    8990,
+		"89,9":     8990,
+		"1 234,56": 123456,
+		"12":       1200,
+	}
+	for in, want := range cases {
+		if got, ok := ParseCents(in); !ok || got != want {
+			t.Errorf("ParseCents(%q) = %d, %v; want %d", in, got, ok, want)
+		}
+	}
+	if _, ok := ParseCents("1.234"); ok {
+		t.Errorf("ParseCents should reject three fraction digits")
+	}
+}
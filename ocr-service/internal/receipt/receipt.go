@@ -0,0 +1,98 @@
+package receipt
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Receipt represents a recognized shop receipt
+type Receipt struct {
+	Merchant   string          `json:"merchant"`
+	Date       *time.Time      `json:"date,omitempty"`
+	Items      []Item          `json:"items"`
+	TotalCents int             `json:"total_cents"`
+	TaxCents   int             `json:"tax_cents"`
+	Confidence FieldConfidence `json:"confidence"`
+	Fiscal     *Fiscal         `json:"fiscal,omitempty"`
+	Source     string          `json:"source"` // recognizer that produced the receipt: "tesseract", "fixture", "qr", "tesseract+qr"
+}
+
+// Item represents a single receipt line item.
+// PriceCents is the line total (quantity * unit price), which is what receipt_items.price_cents stores.
+type Item struct {
+	Name           string  `json:"name"`
+	Quantity       float64 `json:"quantity"`
+	UnitPriceCents int     `json:"unit_price_cents"`
+	PriceCents     int     `json:"price_cents"`
+	Confidence     float64 `json:"confidence"`
+}
+
+// FieldConfidence holds recognition confidence (0.0 to 1.0) for every receipt field
+type FieldConfidence struct {
+	Merchant float64 `json:"merchant"`
+	Date     float64 `json:"date"`
+	Items    float64 `json:"items"`
+	Total    float64 `json:"total"`
+}
+
+// Line is a single recognized text line with its OCR confidence (0.0 to 1.0)
+type Line struct {
+	Text       string
+	Confidence float64
+}
+
+// ItemsTotalCents returns the sum of all line item totals
+func (r *Receipt) ItemsTotalCents() int {
+	sum := 0
+	for _, item := range r.Items {
+		sum += item.PriceCents
+	}
+	return sum
+}
+
+// meanItemConfidence averages line item confidence
+func (r *Receipt) meanItemConfidence() float64 {
+	if len(r.Items) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, item := range r.Items {
+		sum += item.Confidence
+	}
+	return sum / float64(len(r.Items))
+}
+
+// ParseCents converts a money string like "1 234,56" or "89.9" into cents
+func ParseCents(s string) (int, bool) {
+	s = strings.TrimSpace(s)
+	s = strings.NewReplacer(" ", "", " ", "", ",", ".").Replace(s)
+	if s == "" {
+		return 0, false
+	}
+
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	if whole == "" {
+		whole = "0"
+	}
+	rubles, err := strconv.Atoi(whole)
+	if err != nil || rubles < 0 {
+		return 0, false
+	}
+
+	kopecks := 0
+	if hasFrac {
+		if len(frac) == 0 || len(frac) > 2 {
+			return 0, false
+		}
+		if len(frac) == 1 {
+			frac += "0"
+		}
+		kopecks, err = strconv.Atoi(frac)
+		if err != nil {
+			return 0, false
+		}
+	}
+
+	return rubles*100 + kopecks, true
+}
@@ -0,0 +1,90 @@
+package recognizer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+
+	"github.com/expense-tracker/ocr-service/internal/receipt"
+)
+
+// ErrNoQR is returned when the image contains no readable QR code
+var ErrNoQR = errors.New("no QR code found")
+
+// DecodeQR finds a QR code in a JPEG or PNG image and returns its text
+func DecodeQR(data []byte) (string, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	bmp, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		return "", fmt.Errorf("failed to binarize image: %w", err)
+	}
+
+	hints := map[gozxing.DecodeHintType]interface{}{
+		gozxing.DecodeHintType_TRY_HARDER: true,
+	}
+	result, err := qrcode.NewQRCodeReader().Decode(bmp, hints)
+	if err != nil {
+		// Not found, checksum and format errors all mean there is nothing usable in the image
+		return "", ErrNoQR
+	}
+	return result.GetText(), nil
+}
+
+// FiscalQR wraps a text recognizer and completes its result with the fiscal QR code of the receipt.
+// The QR carries the exact date and total, so it wins over OCR for those fields and still yields
+// a receipt when text recognition fails.
+type FiscalQR struct {
+	inner  Recognizer
+	parser *receipt.Parser
+}
+
+// WithFiscalQR creates a recognizer that reads the fiscal QR code in addition to inner
+func WithFiscalQR(inner Recognizer, parser *receipt.Parser) *FiscalQR {
+	return &FiscalQR{inner: inner, parser: parser}
+}
+
+// Name returns recognizer name
+func (f *FiscalQR) Name() string {
+	return f.inner.Name() + "+qr"
+}
+
+// Recognize runs the inner recognizer and applies the fiscal QR data when present
+func (f *FiscalQR) Recognize(ctx context.Context, image []byte) (*receipt.Receipt, error) {
+	fiscal, qrErr := f.readFiscal(image)
+
+	rec, err := f.inner.Recognize(ctx, image)
+	if err != nil {
+		if qrErr != nil {
+			return nil, err
+		}
+		rec = &receipt.Receipt{Items: []receipt.Item{}}
+		rec.ApplyFiscal(fiscal)
+		rec.Source = "qr"
+		return rec, nil
+	}
+
+	if qrErr == nil {
+		rec.ApplyFiscal(fiscal)
+		rec.Source += "+qr"
+	}
+	return rec, nil
+}
+
+func (f *FiscalQR) readFiscal(image []byte) (*receipt.Fiscal, error) {
+	text, err := DecodeQR(image)
+	if err != nil {
+		return nil, err
+	}
+	return f.parser.ParseFiscal(text)
+}
@@ -0,0 +1,76 @@
+package recognizer
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"testing"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+
+	"github.com/expense-tracker/ocr-service/internal/receipt"
+)
+
+const fiscalPayload = "t=20231015T1842&s=314.53&fn=9960440300000001&i=12345&fp=1234567890&n=1"
+
+func qrImage(t *testing.T, text string) []byte {
+	t.Helper()
+	matrix, err := qrcode.NewQRCodeWriter().Encode(text, gozxing.BarcodeFormat_QR_CODE, 300, 300, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, matrix); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeQR(t *testing.T) {
+	text, err := DecodeQR(qrImage(t, fiscalPayload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != fiscalPayload {
+		t.Errorf("text = %q", text)
+	}
+}
+
+func TestFiscalQRWithoutText(t *testing.T) {
+	parser := receipt.NewParser(nil)
+	rec, err := WithFiscalQR(NewFixture("", parser), parser).Recognize(context.Background(), qrImage(t, fiscalPayload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Source != "qr" || rec.TotalCents != 31453 || rec.Date == nil || rec.Fiscal == nil || rec.Fiscal.FD != "12345" {
+		t.Errorf("unexpected receipt: %+v", rec)
+	}
+}
+
+func TestFiscalQROverridesTotal(t *testing.T) {
+	parser := receipt.NewParser(nil)
+	fixture := NewFixture("Пятёрочка\nМолоко 179.80\nИТОГ =174.80", parser)
+	rec, err := WithFiscalQR(fixture, parser).Recognize(context.Background(), qrImage(t, fiscalPayload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Source != "fixture+qr" || rec.TotalCents != 31453 || rec.Confidence.Total != 1 {
+		t.Errorf("unexpected receipt: %+v", rec)
+	}
+}
+
+func TestFiscalQRWithoutCode(t *testing.T) {
+	parser := receipt.NewParser(nil)
+	rec, err := WithFiscalQR(NewFixture("Капучино 180.00", parser), parser).Recognize(context.Background(), qrImage(t, "just text"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Source != "fixture" || rec.Fiscal != nil {
+		t.Errorf("unexpected receipt: %+v", rec)
+	}
+
+	if _, err := WithFiscalQR(NewFixture("", parser), parser).Recognize(context.Background(), qrImage(t, "just text")); err != ErrNoText {
+		t.Errorf("error = %v, want ErrNoText", err)
+	}
+}
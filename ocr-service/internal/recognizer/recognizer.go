@@ -0,0 +1,19 @@
+package recognizer
+
+import (
+	"context"
+	"errors"
+
+	"github.com/expense-tracker/ocr-service/internal/receipt"
+)
+
+// ErrNoText is returned when the image contains no recognizable text
+var ErrNoText = errors.New("no text recognized")
+
+// Recognizer turns a receipt image into a structured receipt
+type Recognizer interface {
+	// Name identifies the recognizer in responses and logs
+	Name() string
+	// Recognize parses a receipt from raw image bytes (JPEG or PNG)
+	Recognize(ctx context.Context, image []byte) (*receipt.Receipt, error)
+}
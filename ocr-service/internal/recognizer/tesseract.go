@@ -0,0 +1,119 @@
+package recognizer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/expense-tracker/ocr-service/internal/receipt"
+)
+
+// Tesseract recognizes receipts with a local tesseract binary
+type Tesseract struct {
+	binary    string
+	languages string
+	parser    *receipt.Parser
+}
+
+// NewTesseract creates a Tesseract recognizer.
+// binary is the path to the tesseract executable, languages is a "+"-separated list like "rus+eng".
+func NewTesseract(binary, languages string, parser *receipt.Parser) *Tesseract {
+	return &Tesseract{
+		binary:    binary,
+		languages: languages,
+		parser:    parser,
+	}
+}
+
+// Name returns recognizer name
+func (t *Tesseract) Name() string {
+	return "tesseract"
+}
+
+// Recognize runs tesseract over the image and parses its output
+func (t *Tesseract) Recognize(ctx context.Context, image []byte) (*receipt.Receipt, error) {
+	// --psm 4: single column of text of variable sizes, which is how receipts are laid out
+	cmd := exec.CommandContext(ctx, t.binary, "stdin", "stdout", "-l", t.languages, "--psm", "4", "tsv")
+	cmd.Stdin = bytes.NewReader(image)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("tesseract failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	lines, err := parseTSV(out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse tesseract output: %w", err)
+	}
+	if len(lines) == 0 {
+		return nil, ErrNoText
+	}
+
+	rec := t.parser.Parse(lines)
+	rec.Source = t.Name()
+	return rec, nil
+}
+
+type lineKey struct {
+	page, block, paragraph, line int
+}
+
+// parseTSV groups tesseract word-level TSV output into lines with averaged confidence.
+// Columns: level page_num block_num par_num line_num word_num left top width height conf text
+func parseTSV(data []byte) ([]receipt.Line, error) {
+	var order []lineKey
+	words := make(map[lineKey][]string)
+	confidences := make(map[lineKey][]float64)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	header := true
+	for scanner.Scan() {
+		if header {
+			header = false
+			continue
+		}
+		cols := strings.Split(scanner.Text(), "\t")
+		if len(cols) < 12 || cols[0] != "5" { // level 5 = word
+			continue
+		}
+		text := strings.TrimSpace(cols[11])
+		conf, err := strconv.ParseFloat(cols[10], 64)
+		if text == "" || err != nil || conf < 0 {
+			continue
+		}
+
+		var key lineKey
+		key.page, _ = strconv.Atoi(cols[1])
+		key.block, _ = strconv.Atoi(cols[2])
+		key.paragraph, _ = strconv.Atoi(cols[3])
+		key.line, _ = strconv.Atoi(cols[4])
+
+		if _, seen := words[key]; !seen {
+			order = append(order, key)
+		}
+		words[key] = append(words[key], text)
+		confidences[key] = append(confidences[key], conf/100)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	lines := make([]receipt.Line, 0, len(order))
+	for _, key := range order {
+		sum := 0.0
+		for _, c := range confidences[key] {
+			sum += c
+		}
+		lines = append(lines, receipt.Line{
+			Text:       strings.Join(words[key], " "),
+			Confidence: sum / float64(len(confidences[key])),
+		})
+	}
+	return lines, nil
+}
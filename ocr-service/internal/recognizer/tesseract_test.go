@@ -0,0 +1,26 @@
+package recognizer
+
+import "testing"
+
+func TestParseTSV(t *testing.T) {
+	tsv := "level\tpage_num\tblock_num\tpar_num\tline_num\tword_num\tleft\ttop\twidth\theight\tconf\ttext\n" +
+		"1\t1\t0\t0\t0\t0\t0\t0\t100\t100\t-1\t\n" +
+		"5\t1\t1\t1\t1\t1\t0\t0\t10\t10\t90\tМолоко\n" +
+		"5\t1\t1\t1\t1\t2\t0\t0\t10\t10\t70\t89.90\n" +
+		"5\t1\t1\t1\t2\t1\t0\t0\t10\t10\t-1\t \n" +
+		"5\t1\t1\t1\t3\t1\t0\t0\t10\t10\t60\tИТОГ\n"
+
+	lines, err := parseTSV([]byte(tsv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("lines = %+v", lines)
+	}
+	if lines[0].Text != "Молоко 89.90" || lines[0].Confidence != 0.8 {
+		t.Errorf("line 0 = %+v", lines[0])
+	}
+	if lines[1].Text != "ИТОГ" || lines[1].Confidence != 0.6 {
+		t.Errorf("line 1 = %+v", lines[1])
+	}
+}
@@ -2,4 +2,4 @@ module tools
 
 go 1.24.2
 
-require github.com/golang-jwt/jwt/v5 v5.3.0 // indirect
+require github.com/golang-jwt/jwt/v5 v5.3.0